@@ -18,9 +18,12 @@
 package aoserrors
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"os"
 	"runtime"
+	"sync/atomic"
 )
 
 /***********************************************************************************************************************
@@ -29,17 +32,63 @@ import (
 
 const callerLevel = 2
 
+// Error codes.
+const (
+	CodeUnknown ErrorCode = iota
+	CodeNotFound
+	CodeAlreadyExists
+	CodeInvalidArgument
+	CodeTimeout
+	CodeCanceled
+	CodePermissionDenied
+	CodeUnavailable
+	CodeInternal
+)
+
 /***********************************************************************************************************************
  * Types
  **********************************************************************************************************************/
 
 // Error Aos error type.
 type Error struct {
-	pc   uintptr
-	line int
-	err  error
+	pc     uintptr
+	file   string
+	line   int
+	err    error
+	code   ErrorCode
+	stack  []uintptr
+	origin string
 }
 
+// ErrorCode Aos error code used to classify failures.
+type ErrorCode int
+
+type retryError struct {
+	err       error
+	retryable bool
+}
+
+/***********************************************************************************************************************
+ * Vars
+ **********************************************************************************************************************/
+
+// nolint:gochecknoglobals
+var (
+	stackTraceDepth int32
+
+	errorCodeNames = map[ErrorCode]string{
+		CodeUnknown:          "Unknown",
+		CodeNotFound:         "NotFound",
+		CodeAlreadyExists:    "AlreadyExists",
+		CodeInvalidArgument:  "InvalidArgument",
+		CodeTimeout:          "Timeout",
+		CodeCanceled:         "Canceled",
+		CodePermissionDenied: "PermissionDenied",
+		CodeUnavailable:      "Unavailable",
+		CodeInternal:         "Internal",
+	}
+)
+
 /***********************************************************************************************************************
  * Public
  **********************************************************************************************************************/
@@ -67,8 +116,210 @@ func Wrap(fromErr error) error {
 	return createAosError(fromErr)
 }
 
+// NewWithCode creates new Aos error with code from string message.
+func NewWithCode(code ErrorCode, message string) error {
+	aosErr := createAosError(errors.New(message)) // nolint:goerr113 // convert to Aos error
+	aosErr.code = code
+
+	return aosErr
+}
+
+// ErrorfWithCode creates new formatted Aos error with code.
+func ErrorfWithCode(code ErrorCode, format string, args ...interface{}) error {
+	aosErr := createAosError(fmt.Errorf(format, args...)) // nolint:goerr113 // convert to Aos error
+	aosErr.code = code
+
+	return aosErr
+}
+
+// WrapWithCode wraps existing error and assigns code to it.
+func WrapWithCode(code ErrorCode, fromErr error) error {
+	if fromErr == nil {
+		return nil
+	}
+
+	aosErr := createAosError(fromErr)
+	aosErr.code = code
+
+	return aosErr
+}
+
+// GetCode returns code of the first Aos error or error info in the chain which has code assigned. If no code is found, it is
+// derived from well known standard errors.
+func GetCode(err error) ErrorCode {
+	for item := err; item != nil; item = errors.Unwrap(item) {
+		switch codeErr := item.(type) { // nolint:errorlint // check each chain item
+		case *Error:
+			if codeErr.code != CodeUnknown {
+				return codeErr.code
+			}
+
+		case *ErrorInfo:
+			if codeErr.Code != CodeUnknown {
+				return codeErr.Code
+			}
+		}
+	}
+
+	switch {
+	case err == nil:
+		return CodeUnknown
+
+	case errors.Is(err, context.DeadlineExceeded):
+		return CodeTimeout
+
+	case errors.Is(err, context.Canceled):
+		return CodeCanceled
+
+	case errors.Is(err, os.ErrNotExist):
+		return CodeNotFound
+
+	case errors.Is(err, os.ErrExist):
+		return CodeAlreadyExists
+
+	case errors.Is(err, os.ErrPermission):
+		return CodePermissionDenied
+
+	default:
+		return CodeUnknown
+	}
+}
+
+// IsCode checks if error has specified code.
+func IsCode(err error, code ErrorCode) bool {
+	return GetCode(err) == code
+}
+
+// IsNotFound checks if error is not found error.
+func IsNotFound(err error) bool {
+	return IsCode(err, CodeNotFound)
+}
+
+// IsTimeout checks if error is timeout error.
+func IsTimeout(err error) bool {
+	return IsCode(err, CodeTimeout)
+}
+
+// IsInvalidArgument checks if error is invalid argument error.
+func IsInvalidArgument(err error) bool {
+	return IsCode(err, CodeInvalidArgument)
+}
+
+// SetStackTraceDepth sets max number of stack frames captured on error creation. Stack trace is printed with %+v
+// format verb. Zero depth (default) disables stack trace capturing.
+func SetStackTraceDepth(depth int) {
+	if depth < 0 {
+		depth = 0
+	}
+
+	atomic.StoreInt32(&stackTraceDepth, int32(depth))
+}
+
+// StackTrace returns captured stack trace.
+func (aosErr *Error) StackTrace() (frames []runtime.Frame) {
+	if len(aosErr.stack) == 0 {
+		return nil
+	}
+
+	callersFrames := runtime.CallersFrames(aosErr.stack)
+
+	for {
+		frame, more := callersFrames.Next()
+
+		frames = append(frames, frame)
+
+		if !more {
+			return frames
+		}
+	}
+}
+
+// Format formats error. %+v prints error with captured stack trace.
+func (aosErr *Error) Format(state fmt.State, verb rune) {
+	switch verb {
+	case 'v':
+		if state.Flag('+') {
+			_, _ = fmt.Fprint(state, aosErr.Error())
+
+			for _, frame := range aosErr.StackTrace() {
+				_, _ = fmt.Fprintf(state, "\n%s\n\t%s:%d", frame.Function, frame.File, frame.Line)
+			}
+
+			return
+		}
+
+		_, _ = fmt.Fprint(state, aosErr.Error())
+
+	case 's':
+		_, _ = fmt.Fprint(state, aosErr.Error())
+
+	case 'q':
+		_, _ = fmt.Fprintf(state, "%q", aosErr.Error())
+
+	default:
+		_, _ = fmt.Fprintf(state, "%%!%c(%s)", verb, aosErr.Error())
+	}
+}
+
+// Retryable marks error as retryable: operation failed with this error may succeed on retry.
+func Retryable(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &retryError{err: err, retryable: true}
+}
+
+// Permanent marks error as permanent: retrying operation failed with this error is useless.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &retryError{err: err, retryable: false}
+}
+
+// IsRetryable checks if error is retryable. The outermost Retryable/Permanent mark in the chain is used. Errors
+// without mark are considered as retryable.
+func IsRetryable(err error) bool {
+	var markedErr *retryError
+
+	if errors.As(err, &markedErr) {
+		return markedErr.retryable
+	}
+
+	return true
+}
+
+func (markedErr *retryError) Error() string {
+	return markedErr.err.Error()
+}
+
+func (markedErr *retryError) Unwrap() error {
+	return markedErr.err
+}
+
+// Code returns Aos error code.
+func (aosErr *Error) Code() ErrorCode {
+	return aosErr.code
+}
+
 // Error returns Aos error message.
 func (aosErr *Error) Error() string {
+	// Error created by WrapWithCode from existing Aos error already contains origin
+	if _, ok := aosErr.err.(*Error); ok { // nolint:errorlint // check only directly wrapped error
+		return aosErr.err.Error()
+	}
+
+	if aosErr.origin != "" {
+		return fmt.Sprintf("%s [%s]", aosErr.err.Error(), aosErr.origin)
+	}
+
+	// Error restored from error info without origin has no location
+	if aosErr.pc == 0 {
+		return aosErr.err.Error()
+	}
+
 	f := runtime.FuncForPC(aosErr.pc)
 	if f == nil {
 		return "[unknown:???]"
@@ -82,6 +333,33 @@ func (aosErr *Error) Unwrap() error {
 	return aosErr.err
 }
 
+// String returns error code name.
+func (code ErrorCode) String() string {
+	if name, ok := errorCodeNames[code]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("Code(%d)", int(code))
+}
+
+// MarshalText marshals error code to its name.
+func (code ErrorCode) MarshalText() (text []byte, err error) {
+	return []byte(code.String()), nil
+}
+
+// UnmarshalText unmarshals error code from its name.
+func (code *ErrorCode) UnmarshalText(text []byte) (err error) {
+	for value, name := range errorCodeNames {
+		if name == string(text) {
+			*code = value
+
+			return nil
+		}
+	}
+
+	return Errorf("unknown error code: %s", text)
+}
+
 /***********************************************************************************************************************
  * Private
  **********************************************************************************************************************/
@@ -89,7 +367,12 @@ func (aosErr *Error) Unwrap() error {
 func createAosError(fromErr error) *Error {
 	aosErr := &Error{err: fromErr}
 
-	aosErr.pc, _, aosErr.line, _ = runtime.Caller(callerLevel)
+	aosErr.pc, aosErr.file, aosErr.line, _ = runtime.Caller(callerLevel)
+
+	if depth := atomic.LoadInt32(&stackTraceDepth); depth > 0 {
+		aosErr.stack = make([]uintptr, depth)
+		aosErr.stack = aosErr.stack[:runtime.Callers(callerLevel+1, aosErr.stack)]
+	}
 
 	return aosErr
 }
@@ -18,9 +18,13 @@
 package aoserrors_test
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"os"
 	"runtime"
+	"strings"
 	"testing"
 
 	"github.com/aoscloud/aos_common/aoserrors"
@@ -61,3 +65,247 @@ func TestAosError(t *testing.T) {
 		t.Errorf("Wrong error message: %s", err.Error())
 	}
 }
+
+func TestErrorCodes(t *testing.T) {
+	err := aoserrors.NewWithCode(aoserrors.CodeNotFound, "item not found")
+
+	if !aoserrors.IsNotFound(err) {
+		t.Errorf("Wrong error code: %s", aoserrors.GetCode(err))
+	}
+
+	if !aoserrors.IsNotFound(aoserrors.Wrap(fmt.Errorf("wrapped: %w", err))) {
+		t.Error("Code should be preserved by wrapping")
+	}
+
+	err = aoserrors.WrapWithCode(aoserrors.CodeInvalidArgument, aoserrors.Wrap(errTestError))
+
+	if !aoserrors.IsInvalidArgument(err) {
+		t.Errorf("Wrong error code: %s", aoserrors.GetCode(err))
+	}
+
+	if !errors.Is(err, errTestError) {
+		t.Error("Wrapped error should be errTestError")
+	}
+
+	var aosErr *aoserrors.Error
+
+	if !errors.As(err, &aosErr) || aosErr.Code() != aoserrors.CodeInvalidArgument {
+		t.Error("Can't get Aos error")
+	}
+
+	if strings.Count(err.Error(), "[") != 1 {
+		t.Errorf("Wrong error message: %s", err)
+	}
+
+	if code := aoserrors.GetCode(aoserrors.ErrorfWithCode(aoserrors.CodeTimeout, "timeout: %d", 1)); code !=
+		aoserrors.CodeTimeout {
+		t.Errorf("Wrong error code: %s", code)
+	}
+
+	if !aoserrors.IsTimeout(aoserrors.Wrap(context.DeadlineExceeded)) {
+		t.Error("Deadline exceeded should be timeout")
+	}
+
+	if !aoserrors.IsNotFound(aoserrors.Wrap(os.ErrNotExist)) {
+		t.Error("Not exist should be not found")
+	}
+
+	if code := aoserrors.GetCode(aoserrors.Wrap(errTestError)); code != aoserrors.CodeUnknown {
+		t.Errorf("Wrong error code: %s", code)
+	}
+}
+
+func TestStackTrace(t *testing.T) {
+	err := aoserrors.New("no stack")
+
+	if strings.Contains(fmt.Sprintf("%+v", err), "\n") {
+		t.Errorf("Stack trace should not be captured: %+v", err)
+	}
+
+	aoserrors.SetStackTraceDepth(5)
+	defer aoserrors.SetStackTraceDepth(0)
+
+	err = createNestedError()
+
+	var aosErr *aoserrors.Error
+
+	if !errors.As(err, &aosErr) {
+		t.Fatal("Can't get Aos error")
+	}
+
+	frames := aosErr.StackTrace()
+
+	if len(frames) == 0 || len(frames) > 5 {
+		t.Fatalf("Wrong stack trace depth: %d", len(frames))
+	}
+
+	if !strings.HasSuffix(frames[0].Function, "createNestedError") {
+		t.Errorf("Wrong first frame: %s", frames[0].Function)
+	}
+
+	trace := fmt.Sprintf("%+v", err)
+
+	if !strings.Contains(trace, "createNestedError") || !strings.Contains(trace, "TestStackTrace") {
+		t.Errorf("Wrong stack trace: %s", trace)
+	}
+
+	if fmt.Sprintf("%v", err) != err.Error() || fmt.Sprintf("%s", err) != err.Error() {
+		t.Errorf("Wrong error format: %v", err)
+	}
+
+	if formatted := fmt.Sprintf("%d", err); formatted != "%!d("+err.Error()+")" { // nolint:staticcheck
+		t.Errorf("Wrong error format: %s", formatted)
+	}
+}
+
+func TestErrorJSON(t *testing.T) {
+	err := aoserrors.Errorf("can't install service: %w",
+		aoserrors.WrapWithCode(aoserrors.CodeNotFound, aoserrors.Wrap(os.ErrNotExist)))
+
+	data, jsonErr := aoserrors.ToJSON(err)
+	if jsonErr != nil {
+		t.Fatalf("Can't convert error to JSON: %s", jsonErr)
+	}
+
+	var info aoserrors.ErrorInfo
+
+	if jsonErr = json.Unmarshal(data, &info); jsonErr != nil {
+		t.Fatalf("Can't unmarshal error info: %s", jsonErr)
+	}
+
+	if !strings.HasPrefix(info.Origin, "aoserrors/aoserrors_test.go:") {
+		t.Errorf("Wrong error origin: %s", info.Origin)
+	}
+
+	if info.Cause == nil || info.Cause.Code != aoserrors.CodeNotFound || info.Cause.Message != os.ErrNotExist.Error() {
+		t.Errorf("Wrong error cause: %s", data)
+	}
+
+	if !strings.Contains(string(data), `"code":"NotFound"`) {
+		t.Errorf("Wrong error code format: %s", data)
+	}
+
+	restoredErr, jsonErr := aoserrors.FromJSON(data)
+	if jsonErr != nil {
+		t.Fatalf("Can't restore error from JSON: %s", jsonErr)
+	}
+
+	if restoredErr.Error() != fmt.Sprintf("%s [%s]", info.Message, info.Origin) {
+		t.Errorf("Wrong restored error: %s", restoredErr)
+	}
+
+	if !aoserrors.IsNotFound(restoredErr) {
+		t.Errorf("Wrong restored error code: %s", aoserrors.GetCode(restoredErr))
+	}
+
+	if restoredErr.Origin != info.Origin || restoredErr.Cause == nil ||
+		restoredErr.Cause.Code != aoserrors.CodeNotFound {
+		t.Errorf("Wrong restored error info: %v", restoredErr)
+	}
+
+	if cause := errors.Unwrap(restoredErr); cause == nil || cause.Error() != restoredErr.Cause.Error() {
+		t.Errorf("Wrong restored error cause: %v", cause)
+	}
+
+	if convertedErr := restoredErr.ToError(); convertedErr.Error() != restoredErr.Error() ||
+		!aoserrors.IsNotFound(convertedErr) {
+		t.Errorf("Wrong converted error: %s", convertedErr)
+	}
+
+	if restoredErr, jsonErr = aoserrors.FromJSON([]byte(`{"message":"disk gone","code":"NotFound"}`)); jsonErr != nil {
+		t.Fatalf("Can't restore error from JSON: %s", jsonErr)
+	}
+
+	if restoredErr.Error() != "disk gone" {
+		t.Errorf("Wrong restored error: %s", restoredErr)
+	}
+
+	if !aoserrors.IsNotFound(restoredErr) {
+		t.Errorf("Wrong restored error code: %s", aoserrors.GetCode(restoredErr))
+	}
+
+	if restoredErr, _ = aoserrors.FromJSON([]byte("null")); restoredErr != nil {
+		t.Errorf("Nil error expected: %s", restoredErr)
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	if !aoserrors.IsRetryable(aoserrors.Wrap(errTestError)) {
+		t.Error("Error should be retryable by default")
+	}
+
+	err := aoserrors.Wrap(aoserrors.Permanent(aoserrors.New("signature verification failed")))
+
+	if aoserrors.IsRetryable(err) {
+		t.Error("Error should be permanent")
+	}
+
+	if aoserrors.IsRetryable(fmt.Errorf("wrapped: %w", err)) {
+		t.Error("Wrapped error should be permanent")
+	}
+
+	if !aoserrors.IsRetryable(aoserrors.Retryable(err)) {
+		t.Error("Outermost mark should be used")
+	}
+
+	if !errors.Is(aoserrors.Permanent(errTestError), errTestError) {
+		t.Error("Marked error should be errTestError")
+	}
+
+	if aoserrors.Permanent(nil) != nil || aoserrors.Retryable(nil) != nil {
+		t.Error("Nil error expected")
+	}
+}
+
+func TestMultiError(t *testing.T) {
+	if aoserrors.Join(nil, nil) != nil {
+		t.Error("Nil error expected")
+	}
+
+	errNotExist := aoserrors.Wrap(os.ErrNotExist)
+
+	err := aoserrors.Append(nil, errTestError)
+	err = aoserrors.Append(err, nil, errNotExist)
+
+	var multiErr *aoserrors.MultiError
+
+	if !errors.As(err, &multiErr) {
+		t.Fatal("Multi error expected")
+	}
+
+	if len(multiErr.Errors()) != 2 {
+		t.Errorf("Wrong errors count: %d", len(multiErr.Errors()))
+	}
+
+	if !errors.Is(err, errTestError) || !errors.Is(err, os.ErrNotExist) {
+		t.Error("Multi error should match all members")
+	}
+
+	if errors.Is(err, context.Canceled) {
+		t.Error("Multi error should not match context.Canceled")
+	}
+
+	var aosErr *aoserrors.Error
+
+	if !errors.As(aoserrors.Wrap(err), &multiErr) || !errors.As(err, &aosErr) {
+		t.Error("Can't find member error")
+	}
+
+	expectedMessage := "2 errors occurred:\n* test error\n* " + errNotExist.Error()
+
+	if err.Error() != expectedMessage {
+		t.Errorf("Wrong error message: %s", err)
+	}
+
+	if err = aoserrors.Join(errTestError); err.Error() != errTestError.Error() {
+		t.Errorf("Wrong error message: %s", err)
+	}
+}
+
+/***********************************************************************************************************************
+ * Private
+ **********************************************************************************************************************/
+
+func createNestedError() error {
+	return aoserrors.New("nested error")
+}
@@ -0,0 +1,158 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2022 Renesas Electronics Corporation.
+// Copyright (C) 2022 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aoserrors
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+)
+
+/***********************************************************************************************************************
+ * Types
+ **********************************************************************************************************************/
+
+// ErrorInfo machine-readable error representation used to report errors to the cloud. It implements error interface:
+// code, origin and cause chain of received error are available to the caller.
+type ErrorInfo struct {
+	Message string     `json:"message"`
+	Code    ErrorCode  `json:"code,omitempty"`
+	Origin  string     `json:"origin,omitempty"`
+	Cause   *ErrorInfo `json:"cause,omitempty"`
+}
+
+type infoError struct {
+	message string
+	cause   error
+}
+
+/***********************************************************************************************************************
+ * Public
+ **********************************************************************************************************************/
+
+// NewErrorInfo creates error info from error chain.
+func NewErrorInfo(err error) (info *ErrorInfo) {
+	if err == nil {
+		return nil
+	}
+
+	if aosErr, ok := err.(*Error); ok { // nolint:errorlint // check only current chain item
+		// Error created by WrapWithCode from existing Aos error: take code and use wrapped error info
+		if _, ok := aosErr.err.(*Error); ok { // nolint:errorlint // check only directly wrapped error
+			info = NewErrorInfo(aosErr.err)
+
+			if aosErr.code != CodeUnknown {
+				info.Code = aosErr.code
+			}
+
+			return info
+		}
+
+		return &ErrorInfo{
+			Message: aosErr.err.Error(),
+			Code:    aosErr.code,
+			Origin:  aosErr.getOrigin(),
+			Cause:   NewErrorInfo(errors.Unwrap(aosErr.err)),
+		}
+	}
+
+	return &ErrorInfo{Message: err.Error(), Cause: NewErrorInfo(errors.Unwrap(err))}
+}
+
+// ToError converts error info back to error. Restored error keeps message, code, origin and cause chain.
+func (info *ErrorInfo) ToError() error {
+	if info == nil {
+		return nil
+	}
+
+	var cause error
+
+	if info.Cause != nil {
+		cause = info.Cause.ToError()
+	}
+
+	restoredErr := &infoError{message: info.Message, cause: cause}
+
+	if info.Code == CodeUnknown && info.Origin == "" {
+		return restoredErr
+	}
+
+	return &Error{err: restoredErr, code: info.Code, origin: info.Origin}
+}
+
+// ToJSON serializes error to JSON.
+func ToJSON(err error) (data []byte, jsonErr error) {
+	if data, jsonErr = json.Marshal(NewErrorInfo(err)); jsonErr != nil {
+		return nil, Wrap(jsonErr)
+	}
+
+	return data, nil
+}
+
+// FromJSON deserializes error info from JSON. Nil info is returned for JSON null.
+func FromJSON(data []byte) (info *ErrorInfo, err error) {
+	if err = json.Unmarshal(data, &info); err != nil {
+		return nil, Wrap(err)
+	}
+
+	return info, nil
+}
+
+// Error returns error info message.
+func (info *ErrorInfo) Error() string {
+	if info.Origin != "" {
+		return fmt.Sprintf("%s [%s]", info.Message, info.Origin)
+	}
+
+	return info.Message
+}
+
+// Unwrap returns error info cause.
+func (info *ErrorInfo) Unwrap() error {
+	if info.Cause == nil {
+		return nil
+	}
+
+	return info.Cause
+}
+
+func (restoredErr *infoError) Error() string {
+	return restoredErr.message
+}
+
+func (restoredErr *infoError) Unwrap() error {
+	return restoredErr.cause
+}
+
+/***********************************************************************************************************************
+ * Private
+ **********************************************************************************************************************/
+
+func (aosErr *Error) getOrigin() (origin string) {
+	if aosErr.origin != "" {
+		return aosErr.origin
+	}
+
+	if aosErr.file == "" {
+		return ""
+	}
+
+	return fmt.Sprintf("%s:%d", filepath.Join(filepath.Base(filepath.Dir(aosErr.file)), filepath.Base(aosErr.file)),
+		aosErr.line)
+}
@@ -0,0 +1,116 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2022 Renesas Electronics Corporation.
+// Copyright (C) 2022 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aoserrors
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+/***********************************************************************************************************************
+ * Types
+ **********************************************************************************************************************/
+
+// MultiError aggregates multiple errors into one error.
+type MultiError struct {
+	errs []error
+}
+
+/***********************************************************************************************************************
+ * Public
+ **********************************************************************************************************************/
+
+// Append appends errors to err. If err is MultiError, errors are added to it, otherwise new MultiError is created.
+// Nil errors are skipped. Returns nil if there are no errors.
+func Append(err error, errs ...error) error {
+	var multiErr *MultiError
+
+	if err != nil {
+		var ok bool
+
+		if multiErr, ok = err.(*MultiError); !ok { // nolint:errorlint // extend only top level multi error
+			multiErr = &MultiError{errs: []error{err}}
+		}
+	}
+
+	for _, item := range errs {
+		if item == nil {
+			continue
+		}
+
+		if multiErr == nil {
+			multiErr = &MultiError{}
+		}
+
+		multiErr.errs = append(multiErr.errs, item)
+	}
+
+	if multiErr == nil {
+		return nil
+	}
+
+	return multiErr
+}
+
+// Join joins errors into one error. Nil errors are skipped. Returns nil if there are no errors.
+func Join(errs ...error) error {
+	return Append(nil, errs...)
+}
+
+// Errors returns aggregated errors.
+func (multiErr *MultiError) Errors() []error {
+	return multiErr.errs
+}
+
+// Error returns multi-line message of all aggregated errors.
+func (multiErr *MultiError) Error() string {
+	if len(multiErr.errs) == 1 {
+		return multiErr.errs[0].Error()
+	}
+
+	messages := make([]string, 0, len(multiErr.errs))
+
+	for _, err := range multiErr.errs {
+		messages = append(messages, "* "+strings.ReplaceAll(err.Error(), "\n", "\n  "))
+	}
+
+	return fmt.Sprintf("%d errors occurred:\n%s", len(multiErr.errs), strings.Join(messages, "\n"))
+}
+
+// Is checks if any of aggregated errors matches target.
+func (multiErr *MultiError) Is(target error) bool {
+	for _, err := range multiErr.errs {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// As finds the first aggregated error that matches target.
+func (multiErr *MultiError) As(target interface{}) bool {
+	for _, err := range multiErr.errs {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -19,6 +19,7 @@ package aostypes
 
 import (
 	"encoding/json"
+	"math"
 	"strconv"
 	"strings"
 	"time"
@@ -26,6 +27,36 @@ import (
 	"github.com/aoscloud/aos_common/aoserrors"
 )
 
+/***********************************************************************************************************************
+ * Consts
+ **********************************************************************************************************************/
+
+const decimalBase = 10
+
+// Size units.
+const (
+	Byte Size = 1
+	KB   Size = 1000 * Byte
+	MB   Size = 1000 * KB
+	GB   Size = 1000 * MB
+	TB   Size = 1000 * GB
+	KiB  Size = 1024 * Byte
+	MiB  Size = 1024 * KiB
+	GiB  Size = 1024 * MiB
+	TiB  Size = 1024 * GiB
+)
+
+/***********************************************************************************************************************
+ * Vars
+ **********************************************************************************************************************/
+
+// nolint:gochecknoglobals // size units lookup table
+var sizeUnits = map[string]Size{
+	"": Byte, "B": Byte,
+	"K": KB, "KB": KB, "M": MB, "MB": MB, "G": GB, "GB": GB, "T": TB, "TB": TB,
+	"KIB": KiB, "MIB": MiB, "GIB": GiB, "TIB": TiB,
+}
+
 /***********************************************************************************************************************
  * Types
  **********************************************************************************************************************/
@@ -35,6 +66,9 @@ type Duration struct {
 	time.Duration
 }
 
+// Size represents size in bytes in format "512MiB", "1.5GB" or plain number of bytes.
+type Size uint64
+
 // Time represents time in format "00:00:00".
 type Time struct {
 	time.Time
@@ -120,6 +154,10 @@ func (d *Duration) UnmarshalJSON(b []byte) (err error) {
 
 	switch value := v.(type) {
 	case float64:
+		if value < 0 {
+			return aoserrors.Errorf("negative duration value: %v", value)
+		}
+
 		d.Duration = time.Duration(value)
 
 		return nil
@@ -130,6 +168,10 @@ func (d *Duration) UnmarshalJSON(b []byte) (err error) {
 			return aoserrors.Wrap(err)
 		}
 
+		if duration < 0 {
+			return aoserrors.Errorf("negative duration value: %v", value)
+		}
+
 		d.Duration = duration
 
 		return nil
@@ -138,3 +180,82 @@ func (d *Duration) UnmarshalJSON(b []byte) (err error) {
 		return aoserrors.Errorf("invalid duration value: %v", value)
 	}
 }
+
+// ParseSize parses size string, e.g. "512MiB", "1.5GB", "1024". Units are case insensitive.
+func ParseSize(str string) (size Size, err error) {
+	str = strings.TrimSpace(str)
+
+	pos := strings.IndexFunc(str, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	if pos < 0 {
+		pos = len(str)
+	}
+
+	unit, ok := sizeUnits[strings.ToUpper(strings.TrimSpace(str[pos:]))]
+	if !ok {
+		return 0, aoserrors.Errorf("invalid size unit: %s", str)
+	}
+
+	value, err := strconv.ParseFloat(str[:pos], 64)
+	if err != nil {
+		return 0, aoserrors.Errorf("invalid size value: %s", str)
+	}
+
+	if value*float64(unit) > math.MaxUint64 {
+		return 0, aoserrors.Errorf("size value is too big: %s", str)
+	}
+
+	return Size(value * float64(unit)), nil
+}
+
+// String returns size with the biggest binary unit which represents it exactly.
+func (s Size) String() string {
+	for _, unit := range []struct {
+		name string
+		size Size
+	}{{"TiB", TiB}, {"GiB", GiB}, {"MiB", MiB}, {"KiB", KiB}} {
+		if s >= unit.size && s%unit.size == 0 {
+			return strconv.FormatUint(uint64(s/unit.size), decimalBase) + unit.name
+		}
+	}
+
+	return strconv.FormatUint(uint64(s), decimalBase) + "B"
+}
+
+// MarshalJSON marshals JSON Size type.
+func (s Size) MarshalJSON() (b []byte, err error) {
+	if b, err = json.Marshal(s.String()); err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	return b, nil
+}
+
+// UnmarshalJSON unmarshals JSON Size type.
+func (s *Size) UnmarshalJSON(b []byte) (err error) {
+	var v interface{}
+
+	if err := json.Unmarshal(b, &v); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	switch value := v.(type) {
+	case float64:
+		if value < 0 {
+			return aoserrors.Errorf("negative size value: %v", value)
+		}
+
+		*s = Size(value)
+
+		return nil
+
+	case string:
+		if *s, err = ParseSize(value); err != nil {
+			return err
+		}
+
+		return nil
+
+	default:
+		return aoserrors.Errorf("invalid size value: %v", value)
+	}
+}
@@ -138,3 +138,67 @@ func TestDurationMarshal(t *testing.T) {
 		}
 	}
 }
+
+func TestDurationValidation(t *testing.T) {
+	for _, rawJSON := range []string{`"-10s"`, `-1`, `"10"`, `true`} {
+		var duration aostypes.Duration
+
+		if err := json.Unmarshal([]byte(rawJSON), &duration); err == nil {
+			t.Errorf("Error expected for %s", rawJSON)
+		}
+	}
+}
+
+func TestSizeMarshal(t *testing.T) {
+	unmarshalData := []struct {
+		rawJSON string
+		size    aostypes.Size
+		valid   bool
+	}{
+		{rawJSON: `"512MiB"`, size: 512 * aostypes.MiB, valid: true},
+		{rawJSON: `"1.5GB"`, size: 1500 * aostypes.MB, valid: true},
+		{rawJSON: `"16kib"`, size: 16 * aostypes.KiB, valid: true},
+		{rawJSON: `"1024"`, size: 1024, valid: true},
+		{rawJSON: `4096`, size: 4096, valid: true},
+		{rawJSON: `"10XB"`},
+		{rawJSON: `"-1MiB"`},
+		{rawJSON: `-1`},
+	}
+
+	for _, item := range unmarshalData {
+		var size aostypes.Size
+
+		err := json.Unmarshal([]byte(item.rawJSON), &size)
+		if (err == nil) != item.valid {
+			t.Errorf("Wrong unmarshal result for %s: %v", item.rawJSON, err)
+
+			continue
+		}
+
+		if item.valid && size != item.size {
+			t.Errorf("Wrong size value for %s: %d", item.rawJSON, size)
+		}
+	}
+
+	marshalData := []struct {
+		size    aostypes.Size
+		rawJSON string
+	}{
+		{size: 512 * aostypes.MiB, rawJSON: `"512MiB"`},
+		{size: 3 * aostypes.GiB, rawJSON: `"3GiB"`},
+		{size: 1500, rawJSON: `"1500B"`},
+	}
+
+	for _, item := range marshalData {
+		rawJSON, err := json.Marshal(item.size)
+		if err != nil {
+			t.Errorf("Can't marshal json: %s", err)
+
+			continue
+		}
+
+		if string(rawJSON) != item.rawJSON {
+			t.Errorf("Wrong json data: %s", string(rawJSON))
+		}
+	}
+}
@@ -0,0 +1,523 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package downloader
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/aoscloud/aos_common/aoserrors"
+	"github.com/aoscloud/aos_common/image"
+	"github.com/aoscloud/aos_common/utils/contextreader"
+	"github.com/aoscloud/aos_common/utils/retryhelper"
+)
+
+/***********************************************************************************************************************
+ * Consts
+ **********************************************************************************************************************/
+
+const (
+	defaultRetryInterval    = 1 * time.Second
+	defaultMaxRetryInterval = 1 * time.Minute
+	defaultMaxTry           = 5
+)
+
+const (
+	stateFileSuffix = ".state"
+	statePerm       = 0o600
+	filePerm        = 0o600
+)
+
+/***********************************************************************************************************************
+ * Types
+ **********************************************************************************************************************/
+
+// Param download parameters.
+type Param struct {
+	// FileInfo expected size and checksums of downloaded file. File is verified after download if set.
+	FileInfo *image.FileInfo
+	// Backoff retry backoff. Interrupted download is resumed on retry. Default backoff with 5 tries is used if
+	// initial interval is not set.
+	Backoff retryhelper.Backoff
+	// RateLimiter limits bandwidth of the download. Rate can be changed at runtime with RateLimiter.SetRate.
+	// The limiter can be shared between several downloads. Download is limited only by global limit if not set.
+	RateLimiter *contextreader.RateLimiter
+	// Connections number of concurrent range requests used to download the file. File is downloaded sequentially
+	// if not set or the server doesn't support range requests.
+	Connections int
+	// Processors process downloaded data while it is being downloaded, e.g. to verify it. Download is aborted as soon
+	// as a processor returns error. File is downloaded sequentially if processors are set.
+	Processors []StreamProcessor
+	// Transformers transform data received from processors, e.g. decrypt it. File contains output of the last
+	// transformer and FileInfo describes transformed file. Download is aborted as soon as a transformer returns
+	// error. File is downloaded sequentially and is not resumed if transformers are set.
+	Transformers []StreamTransformer
+	// TLSConfig TLS configuration of the download, e.g. with root CAs and client certificate provided by cryptutils
+	// crypto context. Default TLS configuration is used if not set.
+	TLSConfig *tls.Config
+	// ProxyURL proxy URL: http://[user:password@]host:port, https://[user:password@]host:port or socks5://host:port.
+	// Proxy from HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables is used if not set.
+	ProxyURL string
+}
+
+// Mirror download mirror.
+type Mirror struct {
+	URL string
+	// Backoff retry backoff of the mirror. Download param backoff is used if initial interval is not set.
+	Backoff retryhelper.Backoff
+}
+
+// transfer download transfer settings.
+type transfer struct {
+	client       *http.Client
+	rateLimiters []*contextreader.RateLimiter
+	processors   []StreamProcessor
+	transformers []StreamTransformer
+}
+
+// downloadState is stored next to the partially downloaded file and is used to resume download.
+type downloadState struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+	Size         int64  `json:"size"`
+	// Chunks is set for parallel download
+	Chunks []downloadChunk `json:"chunks,omitempty"`
+}
+
+/***********************************************************************************************************************
+ * Vars
+ **********************************************************************************************************************/
+
+// nolint:gochecknoglobals // global bandwidth limit of all downloads
+var globalRateLimiter = contextreader.NewRateLimiter(0)
+
+/***********************************************************************************************************************
+ * Public
+ **********************************************************************************************************************/
+
+// SetGlobalRateLimit sets bandwidth limit in bytes per second applied to all downloads. 0 disables the limit.
+// The limit is applied to running downloads as well.
+func SetGlobalRateLimit(rate int64) {
+	globalRateLimiter.SetRate(rate)
+}
+
+// Download downloads file by url to dst. Partially downloaded file is resumed using HTTP range requests if the
+// remote file is not changed.
+func Download(ctx context.Context, url, dst string, param Param) (err error) {
+	return DownloadMirrors(ctx, []Mirror{{URL: url}}, dst, param)
+}
+
+// DownloadMirrors downloads file to dst from the first available mirror. Mirrors are tried in the specified order
+// except mirrors failed recently which are tried last. Each mirror is retried according to its backoff before
+// switching to the next one.
+func DownloadMirrors(ctx context.Context, mirrors []Mirror, dst string, param Param) (err error) {
+	if len(mirrors) == 0 {
+		return aoserrors.New("no download URL")
+	}
+
+	if isDownloaded(ctx, dst, param.FileInfo) {
+		log.WithFields(log.Fields{"dst": dst}).Debug("File already downloaded")
+
+		return nil
+	}
+
+	for _, mirror := range sortMirrors(mirrors) {
+		if err = downloadMirror(ctx, mirror, dst, param); err == nil {
+			setMirrorHealth(mirror.URL, nil)
+
+			return nil
+		}
+
+		if ctx.Err() != nil {
+			return aoserrors.Wrap(ctx.Err())
+		}
+
+		setMirrorHealth(mirror.URL, err)
+
+		log.WithFields(log.Fields{"url": mirror.URL}).Warnf("Mirror download failed: %s", err)
+	}
+
+	return err
+}
+
+/***********************************************************************************************************************
+ * Private
+ **********************************************************************************************************************/
+
+func downloadMirror(ctx context.Context, mirror Mirror, dst string, param Param) (err error) {
+	log.WithFields(log.Fields{"url": mirror.URL, "dst": dst}).Debug("Start downloading file")
+
+	backoff := mirror.Backoff
+
+	if backoff.InitialInterval == 0 {
+		backoff = param.Backoff
+	}
+
+	if backoff.InitialInterval == 0 {
+		backoff = retryhelper.Backoff{
+			InitialInterval: defaultRetryInterval,
+			MaxInterval:     defaultMaxRetryInterval,
+			MaxTry:          defaultMaxTry,
+			Jitter:          retryhelper.JitterEqual,
+		}
+	}
+
+	client, err := newHTTPClient(param)
+	if err != nil {
+		return err
+	}
+
+	transfer := transfer{
+		client:       client,
+		rateLimiters: []*contextreader.RateLimiter{globalRateLimiter},
+		processors:   param.Processors,
+		transformers: param.Transformers,
+	}
+
+	if param.RateLimiter != nil {
+		transfer.rateLimiters = append(transfer.rateLimiters, param.RateLimiter)
+	}
+
+	if err = retryhelper.RetryContext(ctx, func(ctx context.Context) error {
+		if len(param.Processors) == 0 && len(param.Transformers) == 0 && (param.Connections > 1 || hasChunksState(mirror.URL, dst)) {
+			return downloadParallel(ctx, mirror.URL, dst, param.Connections, transfer)
+		}
+
+		return downloadSequential(ctx, mirror.URL, dst, transfer)
+	}, func(retryCount int, delay time.Duration, err error) {
+		log.WithFields(log.Fields{"url": mirror.URL}).Warnf("Download error: %s, try %d in %v",
+			err, retryCount+1, delay)
+	}, backoff); err != nil {
+		return err
+	}
+
+	if err = finishProcessors(param.Processors); err != nil {
+		if removeErr := removeDownload(dst); removeErr != nil {
+			log.Errorf("Can't remove downloaded file: %s", removeErr)
+		}
+
+		return err
+	}
+
+	if param.FileInfo != nil {
+		if err = image.CheckFileInfo(ctx, dst, *param.FileInfo); err != nil {
+			if removeErr := removeDownload(dst); removeErr != nil {
+				log.Errorf("Can't remove downloaded file: %s", removeErr)
+			}
+
+			return err
+		}
+	}
+
+	if err = os.Remove(dst + stateFileSuffix); err != nil && !os.IsNotExist(err) {
+		return aoserrors.Wrap(err)
+	}
+
+	log.WithFields(log.Fields{"url": mirror.URL, "dst": dst}).Debug("Download complete")
+
+	return nil
+}
+
+func newHTTPClient(param Param) (client *http.Client, err error) {
+	if param.TLSConfig == nil && param.ProxyURL == "" {
+		return http.DefaultClient, nil
+	}
+
+	defaultTransport, ok := http.DefaultTransport.(*http.Transport)
+	if !ok {
+		return nil, aoserrors.New("unexpected default transport type")
+	}
+
+	transport := defaultTransport.Clone()
+
+	if param.TLSConfig != nil {
+		transport.TLSClientConfig = param.TLSConfig
+	}
+
+	if param.ProxyURL != "" {
+		proxyURL, err := url.Parse(param.ProxyURL)
+		if err != nil {
+			return nil, aoserrors.Wrap(err)
+		}
+
+		if proxyURL.Scheme != "http" && proxyURL.Scheme != "https" && proxyURL.Scheme != "socks5" {
+			return nil, aoserrors.Errorf("unsupported proxy scheme: %s", proxyURL.Scheme)
+		}
+
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	return &http.Client{Transport: transport}, nil
+}
+
+func downloadSequential(ctx context.Context, url, dst string, transfer transfer) (err error) {
+	state, offset := getResumeState(url, dst)
+
+	// Parallel download state can't be resumed sequentially. Transformed file doesn't match downloaded data, so it
+	// can't be resumed as well.
+	if len(state.Chunks) > 0 || len(transfer.transformers) > 0 {
+		state, offset = downloadState{}, 0
+	}
+
+	resetProcessors(transfer.processors)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return aoserrors.Permanent(aoserrors.Wrap(err))
+	}
+
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+
+		if validator := state.validator(); validator != "" {
+			req.Header.Set("If-Range", validator)
+		}
+	}
+
+	resp, err := transfer.client.Do(req)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		if err = checkContentRange(resp, state, offset); err != nil {
+			if removeErr := removeDownload(dst); removeErr != nil {
+				log.Errorf("Can't remove downloaded file: %s", removeErr)
+			}
+
+			return err
+		}
+
+		log.WithFields(log.Fields{"url": url, "offset": offset}).Debug("Resume download")
+
+		if err = replayProcessors(dst, offset, transfer.processors); err != nil {
+			return err
+		}
+
+	case resp.StatusCode == http.StatusOK:
+		offset = 0
+		state = downloadState{
+			URL:          url,
+			ETag:         resp.Header.Get("ETag"),
+			LastModified: resp.Header.Get("Last-Modified"),
+			Size:         resp.ContentLength,
+		}
+
+		if err = saveState(dst, state); err != nil {
+			return err
+		}
+
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		if offset == state.Size {
+			return replayProcessors(dst, offset, transfer.processors)
+		}
+
+		if err = removeDownload(dst); err != nil {
+			return aoserrors.Permanent(err)
+		}
+
+		return statusError(resp)
+
+	default:
+		return statusError(resp)
+	}
+
+	var body io.Reader = contextreader.NewWithParam(ctx, resp.Body, contextreader.Param{
+		RateLimiters: transfer.rateLimiters,
+	})
+
+	if len(transfer.processors) > 0 {
+		body = &processingReader{reader: body, processors: transfer.processors}
+	}
+
+	size := state.Size
+
+	if len(transfer.transformers) > 0 {
+		if body, err = transformBody(body, transfer.transformers); err != nil {
+			return aoserrors.Permanent(err)
+		}
+
+		// Size of transformed data is unknown
+		size = -1
+	}
+
+	if err = writeBody(dst, body, offset, size); err != nil {
+		var procErr *processError
+
+		if errors.As(err, &procErr) {
+			if removeErr := removeDownload(dst); removeErr != nil {
+				log.Errorf("Can't remove downloaded file: %s", removeErr)
+			}
+
+			return aoserrors.Permanent(err)
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func writeBody(dst string, body io.Reader, offset, size int64) (err error) {
+	flags := os.O_WRONLY | os.O_CREATE
+
+	if offset == 0 {
+		flags |= os.O_TRUNC
+	}
+
+	file, err := os.OpenFile(dst, flags, filePerm)
+	if err != nil {
+		return aoserrors.Permanent(aoserrors.Wrap(err))
+	}
+
+	defer func() {
+		if closeErr := file.Close(); closeErr != nil && err == nil {
+			err = aoserrors.Wrap(closeErr)
+		}
+	}()
+
+	if _, err = file.Seek(offset, io.SeekStart); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	written, err := io.Copy(file, body)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	if size >= 0 && offset+written != size {
+		return aoserrors.Errorf("downloaded size %d doesn't match file size %d", offset+written, size)
+	}
+
+	return nil
+}
+
+func getResumeState(url, dst string) (state downloadState, offset int64) {
+	data, err := ioutil.ReadFile(dst + stateFileSuffix)
+	if err != nil {
+		return state, 0
+	}
+
+	if err = json.Unmarshal(data, &state); err != nil || state.URL != url {
+		return downloadState{}, 0
+	}
+
+	stat, err := os.Stat(dst)
+	if err != nil {
+		return downloadState{}, 0
+	}
+
+	// Resume is possible only if remote file can be identified
+	if (state.validator() == "" && state.Size < 0) || (state.Size >= 0 && stat.Size() > state.Size) {
+		return downloadState{}, 0
+	}
+
+	return state, stat.Size()
+}
+
+func saveState(dst string, state downloadState) (err error) {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	if err = ioutil.WriteFile(dst+stateFileSuffix, data, statePerm); err != nil {
+		return aoserrors.Permanent(aoserrors.Wrap(err))
+	}
+
+	return nil
+}
+
+func removeDownload(dst string) (err error) {
+	if removeErr := os.Remove(dst + stateFileSuffix); removeErr != nil && !os.IsNotExist(removeErr) {
+		err = aoserrors.Append(err, removeErr)
+	}
+
+	if removeErr := os.Remove(dst); removeErr != nil && !os.IsNotExist(removeErr) {
+		err = aoserrors.Append(err, removeErr)
+	}
+
+	return err
+}
+
+func isDownloaded(ctx context.Context, dst string, fileInfo *image.FileInfo) (result bool) {
+	if fileInfo == nil {
+		return false
+	}
+
+	if _, err := os.Stat(dst + stateFileSuffix); err == nil {
+		return false
+	}
+
+	return image.CheckFileInfo(ctx, dst, *fileInfo) == nil
+}
+
+func checkContentRange(resp *http.Response, state downloadState, offset int64) (err error) {
+	var start, end, size int64
+
+	if _, err = fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes %d-%d/%d", &start, &end, &size); err != nil {
+		return aoserrors.Errorf("invalid content range: %s", resp.Header.Get("Content-Range"))
+	}
+
+	if start != offset {
+		return aoserrors.Errorf("content range start %d doesn't match offset %d", start, offset)
+	}
+
+	if state.Size >= 0 && size != state.Size {
+		return aoserrors.Errorf("remote file size changed: %d", size)
+	}
+
+	if etag := resp.Header.Get("ETag"); etag != "" && state.ETag != "" && etag != state.ETag {
+		return aoserrors.Errorf("remote file ETag changed: %s", etag)
+	}
+
+	return nil
+}
+
+func statusError(resp *http.Response) (err error) {
+	err = aoserrors.Errorf("unexpected response status: %s", resp.Status)
+
+	if resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusRequestTimeout ||
+		resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+		return err
+	}
+
+	return aoserrors.Permanent(err)
+}
+
+func (state downloadState) validator() (validator string) {
+	if state.ETag != "" {
+		return state.ETag
+	}
+
+	return state.LastModified
+}
@@ -0,0 +1,625 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package downloader_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/aoscloud/aos_common/downloader"
+	"github.com/aoscloud/aos_common/image"
+	"github.com/aoscloud/aos_common/utils/contextreader"
+	"github.com/aoscloud/aos_common/utils/cryptutils"
+	"github.com/aoscloud/aos_common/utils/retryhelper"
+)
+
+/***********************************************************************************************************************
+ * Consts
+ **********************************************************************************************************************/
+
+const noRangeWriteSize = 32 * 1024
+
+/***********************************************************************************************************************
+ * Types
+ **********************************************************************************************************************/
+
+type testFileServer struct {
+	sync.Mutex
+	data          []byte
+	noRange       bool
+	abortRequest  int
+	abortOffset   int
+	rangeRequests int
+	requests      int
+	sent          int64
+}
+
+type abortWriter struct {
+	http.ResponseWriter
+	remaining int
+}
+
+/***********************************************************************************************************************
+ * Vars
+ **********************************************************************************************************************/
+
+var workDir string
+
+/***********************************************************************************************************************
+ * Init
+ **********************************************************************************************************************/
+
+func init() {
+	log.SetFormatter(&log.TextFormatter{
+		DisableTimestamp: false,
+		TimestampFormat:  "2006-01-02 15:04:05.000",
+		FullTimestamp:    true,
+	})
+	log.SetLevel(log.DebugLevel)
+	log.SetOutput(os.Stdout)
+}
+
+/***********************************************************************************************************************
+ * Main
+ **********************************************************************************************************************/
+
+func TestMain(m *testing.M) {
+	var err error
+
+	if workDir, err = ioutil.TempDir("", "aos_"); err != nil {
+		log.Fatalf("Error create work dir: %s", err)
+	}
+
+	ret := m.Run()
+
+	if err = os.RemoveAll(workDir); err != nil {
+		log.Fatalf("Error removing tmp dir: %s", err)
+	}
+
+	os.Exit(ret)
+}
+
+/***********************************************************************************************************************
+ * Tests
+ **********************************************************************************************************************/
+
+func TestResumeDownload(t *testing.T) {
+	fileServer := newTestFileServer(1024 * 1024)
+	fileServer.abortRequest = 1
+	fileServer.abortOffset = 300 * 1024
+
+	server := httptest.NewServer(fileServer)
+	defer server.Close()
+
+	fileInfo, err := image.CreateReaderFileInfo(context.Background(), bytes.NewReader(fileServer.data))
+	if err != nil {
+		t.Fatalf("Can't create file info: %s", err)
+	}
+
+	dst := path.Join(workDir, "resume.bin")
+
+	if err = downloader.Download(context.Background(), server.URL, dst, downloader.Param{
+		FileInfo: &fileInfo,
+		Backoff:  retryhelper.Backoff{InitialInterval: 10 * time.Millisecond, MaxTry: 3},
+	}); err != nil {
+		t.Fatalf("Can't download file: %s", err)
+	}
+
+	if fileServer.requests != 2 || fileServer.rangeRequests != 1 {
+		t.Errorf("Wrong requests count: %d, range requests: %d", fileServer.requests, fileServer.rangeRequests)
+	}
+
+	if _, err = os.Stat(dst + ".state"); !os.IsNotExist(err) {
+		t.Error("State file should be removed")
+	}
+
+	// Already downloaded file should not be downloaded again
+
+	if err = downloader.Download(context.Background(), server.URL, dst, downloader.Param{
+		FileInfo: &fileInfo,
+	}); err != nil {
+		t.Fatalf("Can't download file: %s", err)
+	}
+
+	if fileServer.requests != 2 {
+		t.Errorf("Wrong requests count: %d", fileServer.requests)
+	}
+}
+
+func TestDownloadChecksumMismatch(t *testing.T) {
+	fileServer := newTestFileServer(64 * 1024)
+
+	server := httptest.NewServer(fileServer)
+	defer server.Close()
+
+	fileInfo, err := image.CreateReaderFileInfo(context.Background(), bytes.NewReader(make([]byte, 64*1024)))
+	if err != nil {
+		t.Fatalf("Can't create file info: %s", err)
+	}
+
+	dst := path.Join(workDir, "mismatch.bin")
+
+	if err = downloader.Download(context.Background(), server.URL, dst, downloader.Param{
+		FileInfo: &fileInfo,
+	}); err == nil {
+		t.Error("Checksum error expected")
+	}
+
+	if _, err = os.Stat(dst); !os.IsNotExist(err) {
+		t.Error("Corrupted file should be removed")
+	}
+
+	if err = downloader.Download(context.Background(), server.URL+"/notfound", dst, downloader.Param{
+		Backoff: retryhelper.Backoff{InitialInterval: 10 * time.Millisecond, MaxTry: 3},
+	}); err == nil {
+		t.Error("Not found error expected")
+	}
+
+	if fileServer.requests != 2 {
+		t.Errorf("Not found error should not be retried: %d", fileServer.requests)
+	}
+}
+
+func TestDownloadRateLimit(t *testing.T) {
+	const rate = 256 * 1024
+
+	fileServer := newTestFileServer(2 * rate)
+
+	server := httptest.NewServer(fileServer)
+	defer server.Close()
+
+	// Per download limit
+
+	startTime := time.Now()
+
+	if err := downloader.Download(context.Background(), server.URL, path.Join(workDir, "limit.bin"), downloader.Param{
+		RateLimiter: contextreader.NewRateLimiter(rate),
+	}); err != nil {
+		t.Fatalf("Can't download file: %s", err)
+	}
+
+	if duration := time.Since(startTime); duration < 900*time.Millisecond || duration > 3*time.Second {
+		t.Errorf("Wrong download duration: %v", duration)
+	}
+
+	// Global limit
+
+	downloader.SetGlobalRateLimit(rate)
+	defer downloader.SetGlobalRateLimit(0)
+
+	startTime = time.Now()
+
+	if err := downloader.Download(
+		context.Background(), server.URL, path.Join(workDir, "limit.bin"), downloader.Param{}); err != nil {
+		t.Fatalf("Can't download file: %s", err)
+	}
+
+	if duration := time.Since(startTime); duration < 900*time.Millisecond || duration > 3*time.Second {
+		t.Errorf("Wrong download duration: %v", duration)
+	}
+}
+
+func TestParallelDownload(t *testing.T) {
+	fileServer := newTestFileServer(1024 * 1024)
+
+	server := httptest.NewServer(fileServer)
+	defer server.Close()
+
+	fileInfo, err := image.CreateReaderFileInfo(context.Background(), bytes.NewReader(fileServer.data))
+	if err != nil {
+		t.Fatalf("Can't create file info: %s", err)
+	}
+
+	param := downloader.Param{
+		FileInfo:    &fileInfo,
+		Backoff:     retryhelper.Backoff{InitialInterval: 10 * time.Millisecond, MaxTry: 3},
+		Connections: 4,
+	}
+
+	if err = downloader.Download(context.Background(), server.URL, path.Join(workDir, "parallel.bin"),
+		param); err != nil {
+		t.Fatalf("Can't download file: %s", err)
+	}
+
+	// Probe request and request per chunk
+	if fileServer.requests != 5 || fileServer.rangeRequests != 5 {
+		t.Errorf("Wrong requests count: %d, range requests: %d", fileServer.requests, fileServer.rangeRequests)
+	}
+
+	// Interrupted chunk should be resumed
+
+	fileServer = newTestFileServer(1024 * 1024)
+	fileServer.abortRequest = 3
+	fileServer.abortOffset = 10 * 1024
+
+	server.Config.Handler = fileServer
+
+	if fileInfo, err = image.CreateReaderFileInfo(
+		context.Background(), bytes.NewReader(fileServer.data)); err != nil {
+		t.Fatalf("Can't create file info: %s", err)
+	}
+
+	if err = downloader.Download(context.Background(), server.URL, path.Join(workDir, "parallel_resume.bin"),
+		param); err != nil {
+		t.Fatalf("Can't download file: %s", err)
+	}
+
+	if fileServer.requests != 6 {
+		t.Errorf("Wrong requests count: %d", fileServer.requests)
+	}
+
+	// Server without range support
+
+	fileServer = newTestFileServer(1024 * 1024)
+	fileServer.noRange = true
+
+	server.Config.Handler = fileServer
+
+	if fileInfo, err = image.CreateReaderFileInfo(
+		context.Background(), bytes.NewReader(fileServer.data)); err != nil {
+		t.Fatalf("Can't create file info: %s", err)
+	}
+
+	if err = downloader.Download(context.Background(), server.URL, path.Join(workDir, "parallel_norange.bin"),
+		param); err != nil {
+		t.Fatalf("Can't download file: %s", err)
+	}
+
+	if fileServer.requests != 2 {
+		t.Errorf("Wrong requests count: %d", fileServer.requests)
+	}
+
+	// Probe response of server without range support should not be downloaded
+
+	fileServer = newTestFileServer(32 * 1024 * 1024)
+	fileServer.noRange = true
+
+	server.Config.Handler = fileServer
+
+	param.FileInfo = nil
+
+	if err = downloader.Download(context.Background(), server.URL, path.Join(workDir, "parallel_norange_big.bin"),
+		param); err != nil {
+		t.Fatalf("Can't download file: %s", err)
+	}
+
+	fileServer.Lock()
+	defer fileServer.Unlock()
+
+	if fileServer.sent > int64(len(fileServer.data))*3/2 {
+		t.Errorf("Too much data sent: %d", fileServer.sent)
+	}
+}
+
+func TestDownloadMirrors(t *testing.T) {
+	failedRequests := 0
+
+	failedServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		failedRequests++
+
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failedServer.Close()
+
+	fileServer := newTestFileServer(64 * 1024)
+
+	server := httptest.NewServer(fileServer)
+	defer server.Close()
+
+	mirrors := []downloader.Mirror{
+		{URL: failedServer.URL, Backoff: retryhelper.Backoff{InitialInterval: 10 * time.Millisecond, MaxTry: 2}},
+		{URL: server.URL},
+	}
+
+	if err := downloader.DownloadMirrors(
+		context.Background(), mirrors, path.Join(workDir, "mirror1.bin"), downloader.Param{}); err != nil {
+		t.Fatalf("Can't download file: %s", err)
+	}
+
+	if failedRequests != 2 || fileServer.requests != 1 {
+		t.Errorf("Wrong requests count: %d, %d", failedRequests, fileServer.requests)
+	}
+
+	// Failed mirror should be tried last
+
+	if err := downloader.DownloadMirrors(
+		context.Background(), mirrors, path.Join(workDir, "mirror2.bin"), downloader.Param{}); err != nil {
+		t.Fatalf("Can't download file: %s", err)
+	}
+
+	if failedRequests != 2 || fileServer.requests != 2 {
+		t.Errorf("Wrong requests count: %d, %d", failedRequests, fileServer.requests)
+	}
+}
+
+func TestStreamProcessors(t *testing.T) {
+	const blockSize = 64 * 1024
+
+	fileServer := newTestFileServer(1024*1024 + 100)
+	fileServer.abortRequest = 1
+	fileServer.abortOffset = 300 * 1024
+
+	server := httptest.NewServer(fileServer)
+	defer server.Close()
+
+	var hashes [][]byte
+
+	for offset := 0; offset < len(fileServer.data); offset += blockSize {
+		end := offset + blockSize
+		if end > len(fileServer.data) {
+			end = len(fileServer.data)
+		}
+
+		blockHash := sha256.Sum256(fileServer.data[offset:end])
+
+		hashes = append(hashes, blockHash[:])
+	}
+
+	param := downloader.Param{
+		Backoff:     retryhelper.Backoff{InitialInterval: 10 * time.Millisecond, MaxTry: 3},
+		Connections: 4,
+		Processors:  []downloader.StreamProcessor{downloader.NewBlockHashVerifier(blockSize, hashes, sha256.New())},
+	}
+
+	if err := downloader.Download(
+		context.Background(), server.URL, path.Join(workDir, "blocks.bin"), param); err != nil {
+		t.Fatalf("Can't download file: %s", err)
+	}
+
+	if fileServer.requests != 2 || fileServer.rangeRequests != 1 {
+		t.Errorf("Wrong requests count: %d, range requests: %d", fileServer.requests, fileServer.rangeRequests)
+	}
+
+	// Corrupted block should abort download
+
+	hashes[2] = make([]byte, sha256.Size)
+
+	fileServer.requests = 0
+
+	dst := path.Join(workDir, "corrupted.bin")
+
+	if err := downloader.Download(context.Background(), server.URL, dst, param); err == nil {
+		t.Error("Block hash mismatch error expected")
+	}
+
+	if fileServer.requests != 1 {
+		t.Errorf("Corrupted download should not be retried: %d", fileServer.requests)
+	}
+
+	if _, err := os.Stat(dst); !os.IsNotExist(err) {
+		t.Error("Corrupted file should be removed")
+	}
+}
+
+func TestStreamTransformers(t *testing.T) {
+	plainData := make([]byte, 300*1024+5)
+
+	rand.Read(plainData) // nolint:gosec // test data
+
+	key, iv := make([]byte, 32), make([]byte, 12)
+
+	rand.Read(key) // nolint:gosec // test key
+	rand.Read(iv)  // nolint:gosec // test IV
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatalf("Can't create cipher: %s", err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatalf("Can't create GCM: %s", err)
+	}
+
+	// Single chunk: nonce is IV and additional data marks the last chunk
+	fileServer := &testFileServer{data: aead.Seal(nil, iv, plainData, []byte{1})}
+	fileServer.abortRequest = 1
+	fileServer.abortOffset = 100 * 1024
+
+	server := httptest.NewServer(fileServer)
+	defer server.Close()
+
+	decryptParams := cryptutils.DecryptParams{Mode: cryptutils.ModeGCM, Key: key, IV: iv, ChunkSize: 1024 * 1024}
+
+	param := downloader.Param{
+		Backoff:      retryhelper.Backoff{InitialInterval: 10 * time.Millisecond, MaxTry: 3},
+		Connections:  4,
+		Transformers: []downloader.StreamTransformer{downloader.NewDecryptTransformer(decryptParams)},
+	}
+
+	dst := path.Join(workDir, "decrypted.bin")
+
+	if err := downloader.Download(context.Background(), server.URL, dst, param); err != nil {
+		t.Fatalf("Can't download file: %s", err)
+	}
+
+	// Transformed download is restarted from the beginning
+	if fileServer.requests != 2 || fileServer.rangeRequests != 0 {
+		t.Errorf("Wrong requests count: %d, range requests: %d", fileServer.requests, fileServer.rangeRequests)
+	}
+
+	data, err := ioutil.ReadFile(dst)
+	if err != nil {
+		t.Fatalf("Can't read downloaded file: %s", err)
+	}
+
+	if !bytes.Equal(data, plainData) {
+		t.Error("Wrong decrypted data")
+	}
+
+	// Decrypt error should abort download
+
+	decryptParams.Key = make([]byte, 32)
+
+	param.Transformers = []downloader.StreamTransformer{downloader.NewDecryptTransformer(decryptParams)}
+	fileServer.requests, fileServer.abortRequest = 0, 0
+
+	dst = path.Join(workDir, "wrong_key.bin")
+
+	if err := downloader.Download(context.Background(), server.URL, dst, param); err == nil {
+		t.Error("Decrypt error expected")
+	}
+
+	if fileServer.requests != 1 {
+		t.Errorf("Failed decrypt should not be retried: %d", fileServer.requests)
+	}
+
+	if _, err := os.Stat(dst); !os.IsNotExist(err) {
+		t.Error("Failed file should be removed")
+	}
+}
+
+func TestDownloadTLSAndProxy(t *testing.T) {
+	fileServer := newTestFileServer(64 * 1024)
+
+	tlsServer := httptest.NewTLSServer(fileServer)
+	defer tlsServer.Close()
+
+	param := downloader.Param{Backoff: retryhelper.Backoff{InitialInterval: 10 * time.Millisecond, MaxTry: 1}}
+
+	if err := downloader.Download(
+		context.Background(), tlsServer.URL, path.Join(workDir, "tls.bin"), param); err == nil {
+		t.Error("Unknown certificate authority error expected")
+	}
+
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(tlsServer.Certificate())
+
+	param.TLSConfig = &tls.Config{RootCAs: rootCAs, MinVersion: tls.VersionTLS12}
+
+	if err := downloader.Download(
+		context.Background(), tlsServer.URL, path.Join(workDir, "tls.bin"), param); err != nil {
+		t.Errorf("Can't download file: %s", err)
+	}
+
+	// Proxy serves requests to any host
+
+	proxyServer := httptest.NewServer(fileServer)
+	defer proxyServer.Close()
+
+	fileServer.requests = 0
+
+	param = downloader.Param{ProxyURL: "ftp://localhost"}
+
+	if err := downloader.Download(
+		context.Background(), "http://download.invalid/", path.Join(workDir, "proxy.bin"), param); err == nil {
+		t.Error("Unsupported proxy scheme error expected")
+	}
+
+	param.ProxyURL = proxyServer.URL
+
+	if err := downloader.Download(
+		context.Background(), "http://download.invalid/", path.Join(workDir, "proxy.bin"), param); err != nil {
+		t.Errorf("Can't download file: %s", err)
+	}
+
+	if fileServer.requests != 1 {
+		t.Errorf("Wrong proxy requests count: %d", fileServer.requests)
+	}
+}
+
+/***********************************************************************************************************************
+ * Private
+ **********************************************************************************************************************/
+
+func newTestFileServer(size int) (server *testFileServer) {
+	server = &testFileServer{data: make([]byte, size)}
+
+	rand.Read(server.data) // nolint:gosec // test data
+
+	return server
+}
+
+func (server *testFileServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	server.Lock()
+
+	server.requests++
+
+	if r.Header.Get("Range") != "" {
+		server.rangeRequests++
+	}
+
+	if server.requests == server.abortRequest {
+		w = &abortWriter{ResponseWriter: w, remaining: server.abortOffset}
+	}
+
+	server.Unlock()
+
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+
+		return
+	}
+
+	if server.noRange {
+		for offset := 0; offset < len(server.data); offset += noRangeWriteSize {
+			n, err := w.Write(server.data[offset:minInt(offset+noRangeWriteSize, len(server.data))])
+
+			server.Lock()
+			server.sent += int64(n)
+			server.Unlock()
+
+			if err != nil {
+				return
+			}
+		}
+
+		return
+	}
+
+	w.Header().Set("ETag", `"`+strconv.Itoa(len(server.data))+`"`)
+
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(server.data))
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
+
+func (writer *abortWriter) Write(p []byte) (n int, err error) {
+	if len(p) > writer.remaining {
+		_, _ = writer.ResponseWriter.Write(p[:writer.remaining])
+
+		panic(http.ErrAbortHandler)
+	}
+
+	writer.remaining -= len(p)
+
+	return writer.ResponseWriter.Write(p)
+}
@@ -0,0 +1,88 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package downloader
+
+import (
+	"net/url"
+	"sync"
+	"time"
+)
+
+/***********************************************************************************************************************
+ * Consts
+ **********************************************************************************************************************/
+
+// mirrorFailureTimeout time during which failed mirror is tried after other mirrors.
+const mirrorFailureTimeout = 5 * time.Minute
+
+/***********************************************************************************************************************
+ * Vars
+ **********************************************************************************************************************/
+
+// nolint:gochecknoglobals // mirrors health is shared between downloads
+var (
+	mirrorsMutex   sync.Mutex
+	mirrorFailures = make(map[string]time.Time)
+)
+
+/***********************************************************************************************************************
+ * Private
+ **********************************************************************************************************************/
+
+func sortMirrors(mirrors []Mirror) (sorted []Mirror) {
+	var failed []Mirror
+
+	for _, mirror := range mirrors {
+		if isMirrorFailed(mirror.URL) {
+			failed = append(failed, mirror)
+		} else {
+			sorted = append(sorted, mirror)
+		}
+	}
+
+	return append(sorted, failed...)
+}
+
+func isMirrorFailed(mirrorURL string) (failed bool) {
+	mirrorsMutex.Lock()
+	defer mirrorsMutex.Unlock()
+
+	failureTime, ok := mirrorFailures[mirrorHost(mirrorURL)]
+
+	return ok && time.Since(failureTime) < mirrorFailureTimeout
+}
+
+func setMirrorHealth(mirrorURL string, err error) {
+	mirrorsMutex.Lock()
+	defer mirrorsMutex.Unlock()
+
+	if err != nil {
+		mirrorFailures[mirrorHost(mirrorURL)] = time.Now()
+	} else {
+		delete(mirrorFailures, mirrorHost(mirrorURL))
+	}
+}
+
+func mirrorHost(mirrorURL string) (host string) {
+	parsedURL, err := url.Parse(mirrorURL)
+	if err != nil || parsedURL.Host == "" {
+		return mirrorURL
+	}
+
+	return parsedURL.Scheme + "://" + parsedURL.Host
+}
@@ -0,0 +1,348 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/aoscloud/aos_common/aoserrors"
+	"github.com/aoscloud/aos_common/utils/contextreader"
+)
+
+/***********************************************************************************************************************
+ * Consts
+ **********************************************************************************************************************/
+
+const minChunkSize = 64 * 1024
+
+/***********************************************************************************************************************
+ * Types
+ **********************************************************************************************************************/
+
+type downloadChunk struct {
+	Start      int64 `json:"start"`
+	Size       int64 `json:"size"`
+	Downloaded int64 `json:"downloaded"`
+}
+
+type parallelDownload struct {
+	sync.Mutex
+	url       string
+	dst       string
+	state     downloadState
+	file      *os.File
+	transfer  transfer
+	restarted bool
+}
+
+type chunkWriter struct {
+	download *parallelDownload
+	index    int
+}
+
+/***********************************************************************************************************************
+ * Private
+ **********************************************************************************************************************/
+
+func downloadParallel(ctx context.Context, url, dst string, connections int, transfer transfer) (err error) {
+	download := &parallelDownload{url: url, dst: dst, transfer: transfer}
+
+	if !download.loadState() {
+		// Continue sequential download if it is already started
+		if _, offset := getResumeState(url, dst); offset > 0 {
+			return downloadSequential(ctx, url, dst, transfer)
+		}
+
+		supported, err := download.prepare(ctx, connections)
+		if err != nil {
+			return err
+		}
+
+		if !supported {
+			return downloadSequential(ctx, url, dst, transfer)
+		}
+	}
+
+	if download.file, err = os.OpenFile(dst, os.O_WRONLY, filePerm); err != nil {
+		return aoserrors.Wrap(err)
+	}
+	defer download.file.Close()
+
+	defer func() {
+		if saveErr := download.saveState(); saveErr != nil && err == nil {
+			err = saveErr
+		}
+	}()
+
+	downloadCtx, cancelFunc := context.WithCancel(ctx)
+	defer cancelFunc()
+
+	var (
+		wg       sync.WaitGroup
+		errMutex sync.Mutex
+	)
+
+	for i := range download.state.Chunks {
+		wg.Add(1)
+
+		go func(index int) {
+			defer wg.Done()
+
+			if chunkErr := download.downloadChunk(downloadCtx, index); chunkErr != nil {
+				errMutex.Lock()
+				defer errMutex.Unlock()
+
+				if err == nil {
+					err = chunkErr
+				}
+
+				// Other chunks keep downloading on retryable error to be resumed on next try
+				if !aoserrors.IsRetryable(chunkErr) || download.isRestarted() {
+					cancelFunc()
+				}
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	return err
+}
+
+func hasChunksState(url, dst string) (result bool) {
+	state, _ := getResumeState(url, dst)
+
+	return len(state.Chunks) > 0
+}
+
+func (download *parallelDownload) loadState() (result bool) {
+	state, _ := getResumeState(download.url, download.dst)
+	if len(state.Chunks) == 0 {
+		return false
+	}
+
+	download.state = state
+
+	return true
+}
+
+func (download *parallelDownload) saveState() (err error) {
+	download.Lock()
+	defer download.Unlock()
+
+	if download.restarted {
+		return aoserrors.Wrap(removeDownload(download.dst))
+	}
+
+	return saveState(download.dst, download.state)
+}
+
+// prepare checks range requests support and creates chunks.
+func (download *parallelDownload) prepare(ctx context.Context, connections int) (supported bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, download.url, nil)
+	if err != nil {
+		return false, aoserrors.Permanent(aoserrors.Wrap(err))
+	}
+
+	req.Header.Set("Range", "bytes=0-0")
+
+	resp, err := download.transfer.client.Do(req)
+	if err != nil {
+		return false, aoserrors.Wrap(err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		// Drain one byte range body to reuse connection
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+
+	case http.StatusOK:
+		// Body is closed without reading as it contains whole file which is downloaded sequentially
+		log.WithField("url", download.url).Debug("Range requests are not supported, download sequentially")
+
+		return false, nil
+
+	default:
+		return false, statusError(resp)
+	}
+
+	var start, end, size int64
+
+	if _, err = fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes %d-%d/%d", &start, &end, &size); err != nil {
+		log.WithField("url", download.url).Debug("File size is unknown, download sequentially")
+
+		return false, nil
+	}
+
+	download.state = downloadState{
+		URL:          download.url,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Size:         size,
+		Chunks:       splitChunks(size, connections),
+	}
+
+	if len(download.state.Chunks) <= 1 {
+		return false, nil
+	}
+
+	file, err := os.OpenFile(download.dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, filePerm)
+	if err != nil {
+		return false, aoserrors.Permanent(aoserrors.Wrap(err))
+	}
+	defer file.Close()
+
+	if err = file.Truncate(size); err != nil {
+		return false, aoserrors.Permanent(aoserrors.Wrap(err))
+	}
+
+	if err = saveState(download.dst, download.state); err != nil {
+		return false, err
+	}
+
+	log.WithFields(log.Fields{
+		"url": download.url, "chunks": len(download.state.Chunks),
+	}).Debug("Download in parallel chunks")
+
+	return true, nil
+}
+
+func (download *parallelDownload) downloadChunk(ctx context.Context, index int) (err error) {
+	download.Lock()
+	chunk := download.state.Chunks[index]
+	download.Unlock()
+
+	if chunk.Downloaded >= chunk.Size {
+		return nil
+	}
+
+	offset := chunk.Start + chunk.Downloaded
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, download.url, nil)
+	if err != nil {
+		return aoserrors.Permanent(aoserrors.Wrap(err))
+	}
+
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, chunk.Start+chunk.Size-1))
+
+	if validator := download.state.validator(); validator != "" {
+		req.Header.Set("If-Range", validator)
+	}
+
+	resp, err := download.transfer.client.Do(req)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusPartialContent {
+		if resp.StatusCode == http.StatusOK {
+			// Remote file is changed: restart download on retry
+			download.restart()
+
+			return aoserrors.New("remote file changed")
+		}
+
+		return statusError(resp)
+	}
+
+	if err = checkContentRange(resp, download.state, offset); err != nil {
+		download.restart()
+
+		return err
+	}
+
+	body := contextreader.NewWithParam(ctx, io.LimitReader(resp.Body, chunk.Size-chunk.Downloaded),
+		contextreader.Param{RateLimiters: download.transfer.rateLimiters})
+
+	if _, err = io.Copy(&chunkWriter{download: download, index: index}, body); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	download.Lock()
+	defer download.Unlock()
+
+	if download.state.Chunks[index].Downloaded != chunk.Size {
+		return aoserrors.Errorf("chunk %d is not completely downloaded", index)
+	}
+
+	return nil
+}
+
+func (download *parallelDownload) restart() {
+	download.Lock()
+	defer download.Unlock()
+
+	download.restarted = true
+}
+
+func (download *parallelDownload) isRestarted() (result bool) {
+	download.Lock()
+	defer download.Unlock()
+
+	return download.restarted
+}
+
+func (writer *chunkWriter) Write(p []byte) (n int, err error) {
+	writer.download.Lock()
+	chunk := writer.download.state.Chunks[writer.index]
+	writer.download.Unlock()
+
+	n, err = writer.download.file.WriteAt(p, chunk.Start+chunk.Downloaded)
+
+	writer.download.Lock()
+	writer.download.state.Chunks[writer.index].Downloaded += int64(n)
+	writer.download.Unlock()
+
+	return n, aoserrors.Wrap(err)
+}
+
+func splitChunks(size int64, connections int) (chunks []downloadChunk) {
+	count := int64(connections)
+
+	if maxCount := size / minChunkSize; count > maxCount {
+		count = maxCount
+	}
+
+	if count <= 1 {
+		return nil
+	}
+
+	chunkSize := size / count
+
+	for i := int64(0); i < count; i++ {
+		chunk := downloadChunk{Start: i * chunkSize, Size: chunkSize}
+
+		if i == count-1 {
+			chunk.Size = size - chunk.Start
+		}
+
+		chunks = append(chunks, chunk)
+	}
+
+	return chunks
+}
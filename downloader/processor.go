@@ -0,0 +1,303 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package downloader
+
+import (
+	"bytes"
+	"errors"
+	"hash"
+	"io"
+	"os"
+
+	"github.com/aoscloud/aos_common/aoserrors"
+	"github.com/aoscloud/aos_common/utils/cryptutils"
+)
+
+/***********************************************************************************************************************
+ * Types
+ **********************************************************************************************************************/
+
+// StreamProcessor processes downloaded data in file order. Processor observes data and doesn't change it.
+type StreamProcessor interface {
+	// Reset resets processor state. Data is processed again from the beginning of the file after reset.
+	Reset()
+	// Process processes next part of downloaded data. Download is aborted if error is returned.
+	Process(data []byte) (err error)
+	// Finish is called when the file is completely downloaded.
+	Finish() (err error)
+}
+
+// StreamTransformer transforms downloaded data, e.g. decrypts it. Downloaded file contains transformed data, so
+// download with transformers is not resumed: it is restarted from the beginning on retry.
+type StreamTransformer interface {
+	// NewReader returns reader which transforms data read from source. It is called on each download attempt.
+	NewReader(source io.Reader) (reader io.Reader, err error)
+}
+
+// DecryptTransformer decrypts downloaded data.
+type DecryptTransformer struct {
+	params cryptutils.DecryptParams
+}
+
+// BlockHashVerifier verifies downloaded data by hashes of fixed size blocks. Download is aborted as soon as
+// a corrupted block is received.
+type BlockHashVerifier struct {
+	blockSize int
+	hashes    [][]byte
+	hash      hash.Hash
+	block     int
+	filled    int
+}
+
+type processingReader struct {
+	reader     io.Reader
+	processors []StreamProcessor
+}
+
+type sourceReader struct {
+	reader io.Reader
+}
+
+type transformingReader struct {
+	reader io.Reader
+}
+
+type processError struct {
+	err error
+}
+
+// sourceError error of reading downloaded data. It is used to distinguish download errors from transform errors.
+type sourceError struct {
+	err error
+}
+
+/***********************************************************************************************************************
+ * Public
+ **********************************************************************************************************************/
+
+// NewBlockHashVerifier creates block hash verifier. The last block may be smaller than block size.
+func NewBlockHashVerifier(blockSize int, hashes [][]byte, blockHash hash.Hash) (verifier *BlockHashVerifier) {
+	return &BlockHashVerifier{blockSize: blockSize, hashes: hashes, hash: blockHash}
+}
+
+// NewDecryptTransformer creates decrypt transformer.
+func NewDecryptTransformer(params cryptutils.DecryptParams) (transformer *DecryptTransformer) {
+	return &DecryptTransformer{params: params}
+}
+
+// NewReader returns reader which decrypts data read from source.
+func (transformer *DecryptTransformer) NewReader(source io.Reader) (reader io.Reader, err error) {
+	if reader, err = cryptutils.NewDecryptReader(source, transformer.params); err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	return reader, nil
+}
+
+// Reset resets verifier state.
+func (verifier *BlockHashVerifier) Reset() {
+	verifier.hash.Reset()
+	verifier.block = 0
+	verifier.filled = 0
+}
+
+// Process verifies downloaded data.
+func (verifier *BlockHashVerifier) Process(data []byte) (err error) {
+	for len(data) > 0 {
+		size := verifier.blockSize - verifier.filled
+		if size > len(data) {
+			size = len(data)
+		}
+
+		// hash Write never returns an error
+		_, _ = verifier.hash.Write(data[:size])
+
+		verifier.filled += size
+		data = data[size:]
+
+		if verifier.filled == verifier.blockSize {
+			if err = verifier.checkBlock(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Finish verifies the last block and blocks count.
+func (verifier *BlockHashVerifier) Finish() (err error) {
+	if verifier.filled > 0 {
+		if err = verifier.checkBlock(); err != nil {
+			return err
+		}
+	}
+
+	if verifier.block != len(verifier.hashes) {
+		return aoserrors.Errorf("blocks count mismatch: %d", verifier.block)
+	}
+
+	return nil
+}
+
+/***********************************************************************************************************************
+ * Private
+ **********************************************************************************************************************/
+
+func (verifier *BlockHashVerifier) checkBlock() (err error) {
+	if verifier.block >= len(verifier.hashes) {
+		return aoserrors.Errorf("unexpected block %d", verifier.block)
+	}
+
+	if !bytes.Equal(verifier.hash.Sum(nil), verifier.hashes[verifier.block]) {
+		return aoserrors.Errorf("block %d hash mismatch", verifier.block)
+	}
+
+	verifier.hash.Reset()
+	verifier.block++
+	verifier.filled = 0
+
+	return nil
+}
+
+func (reader *processingReader) Read(p []byte) (n int, err error) {
+	n, err = reader.reader.Read(p)
+
+	if n > 0 {
+		if procErr := processData(reader.processors, p[:n]); procErr != nil {
+			return 0, procErr
+		}
+	}
+
+	return n, err // nolint:wrapcheck // error not properly handled by io.Copy
+}
+
+func (reader *sourceReader) Read(p []byte) (n int, err error) {
+	n, err = reader.reader.Read(p)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return n, &sourceError{err: err}
+	}
+
+	return n, err // nolint:wrapcheck // EOF should not be wrapped
+}
+
+func (reader *transformingReader) Read(p []byte) (n int, err error) {
+	n, err = reader.reader.Read(p)
+	if err != nil && !errors.Is(err, io.EOF) {
+		var srcErr *sourceError
+
+		if !errors.As(err, &srcErr) {
+			return n, &processError{err: err}
+		}
+	}
+
+	return n, err // nolint:wrapcheck // error not properly handled by io.Copy
+}
+
+func (srcErr *sourceError) Error() string {
+	return srcErr.err.Error()
+}
+
+func (srcErr *sourceError) Unwrap() error {
+	return srcErr.err
+}
+
+func (procErr *processError) Error() string {
+	return procErr.err.Error()
+}
+
+func (procErr *processError) Unwrap() error {
+	return procErr.err
+}
+
+func processData(processors []StreamProcessor, data []byte) (err error) {
+	for _, processor := range processors {
+		if err = processor.Process(data); err != nil {
+			return &processError{err: err}
+		}
+	}
+
+	return nil
+}
+
+// transformBody chains transformers. Errors of transformers are reported as process errors which abort download.
+func transformBody(body io.Reader, transformers []StreamTransformer) (reader io.Reader, err error) {
+	reader = &sourceReader{reader: body}
+
+	for _, transformer := range transformers {
+		if reader, err = transformer.NewReader(reader); err != nil {
+			return nil, aoserrors.Wrap(err)
+		}
+	}
+
+	return &transformingReader{reader: reader}, nil
+}
+
+func resetProcessors(processors []StreamProcessor) {
+	for _, processor := range processors {
+		processor.Reset()
+	}
+}
+
+func finishProcessors(processors []StreamProcessor) (err error) {
+	for _, processor := range processors {
+		if err = processor.Finish(); err != nil {
+			return aoserrors.Wrap(err)
+		}
+	}
+
+	return nil
+}
+
+// replayProcessors processes already downloaded part of the file on resume.
+func replayProcessors(dst string, offset int64, processors []StreamProcessor) (err error) {
+	if len(processors) == 0 {
+		return nil
+	}
+
+	file, err := os.Open(dst)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+	defer file.Close()
+
+	buffer := make([]byte, 32*1024)
+	reader := io.LimitReader(file, offset)
+
+	for {
+		n, readErr := reader.Read(buffer)
+
+		if n > 0 {
+			if err = processData(processors, buffer[:n]); err != nil {
+				if removeErr := removeDownload(dst); removeErr != nil {
+					err = aoserrors.Append(err, removeErr)
+				}
+
+				return aoserrors.Permanent(err)
+			}
+		}
+
+		if readErr == io.EOF {
+			return nil
+		}
+
+		if readErr != nil {
+			return aoserrors.Wrap(readErr)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2022 Renesas Electronics Corporation.
+// Copyright (C) 2022 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package image
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os/exec"
+	"strings"
+
+	"github.com/aoscloud/aos_common/aoserrors"
+)
+
+/***********************************************************************************************************************
+ * Consts
+ **********************************************************************************************************************/
+
+// Compression types.
+const (
+	CompressionNone  = ""
+	CompressionAuto  = "auto"
+	CompressionGzip  = "gzip"
+	CompressionBzip2 = "bzip2"
+	CompressionXz    = "xz"
+	CompressionZstd  = "zstd"
+)
+
+const compressionMagicSize = 6
+
+/***********************************************************************************************************************
+ * Types
+ **********************************************************************************************************************/
+
+type commandReader struct {
+	command  *exec.Cmd
+	stdout   io.ReadCloser
+	stderr   bytes.Buffer
+	waitDone bool
+	waitErr  error
+}
+
+/***********************************************************************************************************************
+ * Vars
+ **********************************************************************************************************************/
+
+// nolint:gochecknoglobals
+var compressionMagics = map[string][]byte{
+	CompressionGzip:  {0x1f, 0x8b},
+	CompressionBzip2: []byte("BZh"),
+	CompressionXz:    {0xfd, '7', 'z', 'X', 'Z', 0x00},
+	CompressionZstd:  {0x28, 0xb5, 0x2f, 0xfd},
+}
+
+/***********************************************************************************************************************
+ * Public
+ **********************************************************************************************************************/
+
+// DetectCompression detects compression of data provided by reader. Reader position is not changed.
+func DetectCompression(reader *bufio.Reader) (compression string, err error) {
+	magic, err := reader.Peek(compressionMagicSize)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", aoserrors.Wrap(err)
+	}
+
+	for compression, compressionMagic := range compressionMagics {
+		if bytes.HasPrefix(magic, compressionMagic) {
+			return compression, nil
+		}
+	}
+
+	return CompressionNone, nil
+}
+
+// NewDecompressReader creates reader which decompresses data. Compression is detected if CompressionAuto is set.
+// gzip and bzip2 are decompressed natively, xz and zstd are decompressed by corresponding external tools which should
+// be installed in PATH: error is returned if the tool is not found.
+func NewDecompressReader(
+	ctx context.Context, reader io.Reader, compression string) (decompressReader io.ReadCloser, err error) {
+	if compression == CompressionAuto {
+		bufReader := bufio.NewReader(reader)
+
+		if compression, err = DetectCompression(bufReader); err != nil {
+			return nil, err
+		}
+
+		reader = bufReader
+	}
+
+	switch compression {
+	case CompressionNone:
+		return ioutil.NopCloser(reader), nil
+
+	case CompressionGzip:
+		gzipReader, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, aoserrors.Wrap(err)
+		}
+
+		return gzipReader, nil
+
+	case CompressionBzip2:
+		return ioutil.NopCloser(bzip2.NewReader(reader)), nil
+
+	case CompressionXz, CompressionZstd:
+		return newCommandReader(ctx, reader, compression, "-dc")
+
+	default:
+		return nil, aoserrors.Errorf("unsupported compression: %s", compression)
+	}
+}
+
+func (reader *commandReader) Read(data []byte) (n int, err error) {
+	// Command is waited only once as wait closes stdout, wait result is returned on subsequent reads
+	if reader.waitDone {
+		if reader.waitErr != nil {
+			return 0, reader.waitErr
+		}
+
+		return 0, io.EOF
+	}
+
+	if n, err = reader.stdout.Read(data); errors.Is(err, io.EOF) {
+		reader.waitDone = true
+
+		if waitErr := reader.command.Wait(); waitErr != nil {
+			reader.waitErr = aoserrors.Errorf("%s: %s", waitErr, strings.TrimSpace(reader.stderr.String()))
+
+			return n, reader.waitErr
+		}
+	}
+
+	return n, err // nolint:wrapcheck // io.Reader should return unwrapped io.EOF
+}
+
+func (reader *commandReader) Close() (err error) {
+	if reader.command.ProcessState == nil {
+		_ = reader.command.Process.Kill()
+		_ = reader.command.Wait()
+	}
+
+	return nil
+}
+
+/***********************************************************************************************************************
+ * Private
+ **********************************************************************************************************************/
+
+func newCommandReader(ctx context.Context, stdin io.Reader, name string, args ...string) (reader *commandReader,
+	err error) {
+	if _, err = exec.LookPath(name); err != nil {
+		return nil, aoserrors.Errorf("%s tool is not installed: %s", name, err)
+	}
+
+	reader = &commandReader{command: exec.CommandContext(ctx, name, args...)}
+
+	reader.command.Stdin = stdin
+	reader.command.Stderr = &reader.stderr
+
+	if reader.stdout, err = reader.command.StdoutPipe(); err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	if err = reader.command.Start(); err != nil {
+		return nil, aoserrors.Errorf("can't start %s decompression: %s", name, err)
+	}
+
+	return reader, nil
+}
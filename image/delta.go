@@ -0,0 +1,295 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2022 Renesas Electronics Corporation.
+// Copyright (C) 2022 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package image
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/aoscloud/aos_common/aoserrors"
+	"github.com/aoscloud/aos_common/utils/contextreader"
+)
+
+/***********************************************************************************************************************
+ * Consts
+ **********************************************************************************************************************/
+
+const (
+	bsdiffMagic      = "BSDIFF40"
+	bsdiffHeaderSize = 32
+	deltaChunkSize   = 64 * 1024
+)
+
+/***********************************************************************************************************************
+ * Types
+ **********************************************************************************************************************/
+
+type progressWriter struct {
+	writer      io.Writer
+	progressCbk func(written int64)
+	written     int64
+}
+
+type bsdiffPatch struct {
+	ctrl  io.Reader
+	diff  io.Reader
+	extra io.Reader
+}
+
+/***********************************************************************************************************************
+ * Vars
+ **********************************************************************************************************************/
+
+// nolint:gochecknoglobals
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+/***********************************************************************************************************************
+ * Public
+ **********************************************************************************************************************/
+
+// ApplyDelta applies delta patch to base and writes result to dst. Progress callback, if set, is called with number
+// of bytes written to dst. Returns file info of the result. bsdiff (BSDIFF40) and zstd (created with zstd
+// --patch-from) patches are supported. zstd patches are applied by external zstd tool which should be installed in PATH
+// and require base to be *os.File.
+func ApplyDelta(ctx context.Context, base io.ReaderAt, patch io.Reader, dst io.Writer,
+	progressCbk func(written int64)) (fileInfo FileInfo, err error) {
+	patchReader := bufio.NewReader(contextreader.New(ctx, patch))
+
+	magic, err := patchReader.Peek(len(bsdiffMagic))
+	if err != nil {
+		return fileInfo, aoserrors.Wrap(err)
+	}
+
+	calculator := NewFileInfoCalculator()
+	writer := &progressWriter{writer: io.MultiWriter(dst, calculator), progressCbk: progressCbk}
+
+	switch {
+	case string(magic) == bsdiffMagic:
+		if err = applyBsdiff(base, patchReader, writer); err != nil {
+			return fileInfo, err
+		}
+
+	case bytes.HasPrefix(magic, zstdMagic):
+		if err = applyZstd(ctx, base, patchReader, writer); err != nil {
+			return fileInfo, err
+		}
+
+	default:
+		return fileInfo, aoserrors.New("unknown delta format")
+	}
+
+	return calculator.FileInfo(), nil
+}
+
+/***********************************************************************************************************************
+ * Private
+ **********************************************************************************************************************/
+
+func (writer *progressWriter) Write(data []byte) (n int, err error) {
+	n, err = writer.writer.Write(data)
+
+	writer.written += int64(n)
+
+	if writer.progressCbk != nil {
+		writer.progressCbk(writer.written)
+	}
+
+	return n, aoserrors.Wrap(err)
+}
+
+func applyBsdiff(base io.ReaderAt, patchReader io.Reader, writer io.Writer) (err error) {
+	header := make([]byte, bsdiffHeaderSize)
+
+	if _, err = io.ReadFull(patchReader, header); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	ctrlLen, diffLen, newSize := bsdiffOfftin(header[8:]), bsdiffOfftin(header[16:]), bsdiffOfftin(header[24:])
+
+	if ctrlLen < 0 || diffLen < 0 || newSize < 0 {
+		return aoserrors.New("corrupted bsdiff header")
+	}
+
+	// Patch is not seekable: ctrl and diff blocks are read into memory, extra block is streamed from patch
+	ctrlData, err := readPatchBlock(patchReader, ctrlLen)
+	if err != nil {
+		return err
+	}
+
+	diffData, err := readPatchBlock(patchReader, diffLen)
+	if err != nil {
+		return err
+	}
+
+	patch := bsdiffPatch{
+		ctrl:  bzip2.NewReader(bytes.NewReader(ctrlData)),
+		diff:  bzip2.NewReader(bytes.NewReader(diffData)),
+		extra: bzip2.NewReader(patchReader),
+	}
+
+	return patch.apply(base, writer, newSize)
+}
+
+func (patch *bsdiffPatch) apply(base io.ReaderAt, writer io.Writer, newSize int64) (err error) {
+	var (
+		oldPos, newPos int64
+		ctrl           = make([]byte, 24) // nolint:gomnd // 3 offtin values
+		buffer         = make([]byte, deltaChunkSize)
+		baseBuffer     = make([]byte, deltaChunkSize)
+	)
+
+	for newPos < newSize {
+		if _, err = io.ReadFull(patch.ctrl, ctrl); err != nil {
+			return aoserrors.Wrap(err)
+		}
+
+		diffSize, extraSize, seek := bsdiffOfftin(ctrl), bsdiffOfftin(ctrl[8:]), bsdiffOfftin(ctrl[16:])
+
+		if diffSize < 0 || extraSize < 0 || newPos+diffSize+extraSize > newSize {
+			return aoserrors.New("corrupted bsdiff patch")
+		}
+
+		for remaining := diffSize; remaining > 0; {
+			chunk := minInt64(remaining, deltaChunkSize)
+
+			if _, err = io.ReadFull(patch.diff, buffer[:chunk]); err != nil {
+				return aoserrors.Wrap(err)
+			}
+
+			if err = readBase(base, baseBuffer[:chunk], oldPos); err != nil {
+				return err
+			}
+
+			for i := int64(0); i < chunk; i++ {
+				buffer[i] += baseBuffer[i]
+			}
+
+			if _, err = writer.Write(buffer[:chunk]); err != nil {
+				return aoserrors.Wrap(err)
+			}
+
+			oldPos += chunk
+			remaining -= chunk
+		}
+
+		copied, err := io.CopyBuffer(writer, io.LimitReader(patch.extra, extraSize), buffer)
+		if err != nil {
+			return aoserrors.Wrap(err)
+		}
+
+		if copied != extraSize {
+			return aoserrors.New("bsdiff patch is truncated")
+		}
+
+		newPos += diffSize + extraSize
+		oldPos += seek
+	}
+
+	if newPos != newSize {
+		return aoserrors.New("corrupted bsdiff patch")
+	}
+
+	// Read extra block till the end to check that patch is not truncated
+	size, err := io.Copy(ioutil.Discard, patch.extra)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	if size != 0 {
+		return aoserrors.New("corrupted bsdiff patch")
+	}
+
+	return nil
+}
+
+func applyZstd(ctx context.Context, base io.ReaderAt, patchReader io.Reader, writer io.Writer) (err error) {
+	// zstd requires base as file. Base is not copied to temporary file as it may be as big as the whole partition.
+	baseFile, ok := base.(*os.File)
+	if !ok {
+		return aoserrors.New("zstd patch requires base file")
+	}
+
+	// --long=31 allows max window size which can be used to create patch for big base
+	reader, err := newCommandReader(ctx, patchReader, "zstd", "-d", "-c", "--long=31",
+		"--patch-from="+baseFile.Name())
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	if _, err = io.Copy(writer, reader); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	return nil
+}
+
+func readPatchBlock(reader io.Reader, size int64) (data []byte, err error) {
+	if data, err = ioutil.ReadAll(io.LimitReader(reader, size)); err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	if int64(len(data)) != size {
+		return nil, aoserrors.New("bsdiff patch is truncated")
+	}
+
+	return data, nil
+}
+
+// readBase reads base data at offset. Data outside of base is read as zeros.
+func readBase(base io.ReaderAt, data []byte, offset int64) (err error) {
+	for i := range data {
+		data[i] = 0
+	}
+
+	start := int64(0)
+
+	if offset < 0 {
+		if start = -offset; start >= int64(len(data)) {
+			return nil
+		}
+	}
+
+	if _, err = base.ReadAt(data[start:], offset+start); err != nil && !errors.Is(err, io.EOF) {
+		return aoserrors.Wrap(err)
+	}
+
+	return nil
+}
+
+// bsdiffOfftin decodes bsdiff sign-magnitude int64.
+func bsdiffOfftin(data []byte) (value int64) {
+	const signBit = 1 << 63
+
+	unsigned := binary.LittleEndian.Uint64(data)
+
+	value = int64(unsigned &^ signBit)
+
+	if unsigned&signBit != 0 {
+		value = -value
+	}
+
+	return value
+}
@@ -0,0 +1,333 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2022 Renesas Electronics Corporation.
+// Copyright (C) 2022 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package image
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"hash"
+	"io"
+	"os"
+	"syscall"
+	"unsafe"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/aoscloud/aos_common/aoserrors"
+	"github.com/aoscloud/aos_common/utils/contextreader"
+)
+
+/***********************************************************************************************************************
+ * Consts
+ **********************************************************************************************************************/
+
+const (
+	// DefaultDeviceBlockSize default device write block size.
+	DefaultDeviceBlockSize = 1024 * 1024
+	directIOAlignment      = 4096
+)
+
+/***********************************************************************************************************************
+ * Types
+ **********************************************************************************************************************/
+
+// DeviceWriteOptions device write options.
+type DeviceWriteOptions struct {
+	// BlockSize write block size. Should be multiple of 4096. DefaultDeviceBlockSize is used if not set.
+	BlockSize int
+	// DirectIO use O_DIRECT writes bypassing page cache. Falls back to buffered writes if not supported.
+	DirectIO bool
+	// Verify read back written data and compare with source checksum.
+	Verify bool
+	// SyncInterval number of bytes written between fsync calls. Synced only at the end if 0.
+	SyncInterval int64
+	// ProgressCbk called with number of bytes written after each block.
+	ProgressCbk func(written int64)
+}
+
+type deviceWriter struct {
+	file      *os.File
+	directIO  bool
+	opts      DeviceWriteOptions
+	offset    int64
+	written   int64
+	unsynced  int64
+	hash      []byte
+	hashState hash.Hash
+	syncCbk   func(offset int64) error
+}
+
+/***********************************************************************************************************************
+ * Public
+ **********************************************************************************************************************/
+
+// WriteToDevice streams image to block device. Returns number of written bytes.
+func WriteToDevice(
+	ctx context.Context, src io.Reader, device string, opts DeviceWriteOptions) (written int64, err error) {
+	if opts, err = prepareDeviceWriteOptions(opts); err != nil {
+		return 0, err
+	}
+
+	writer, err := newDeviceWriter(device, 0, opts)
+	if err != nil {
+		return 0, err
+	}
+	defer writer.file.Close()
+
+	if err = writer.write(contextreader.New(ctx, src)); err != nil {
+		return writer.written, err
+	}
+
+	if err = writer.file.Close(); err != nil {
+		return writer.written, aoserrors.Wrap(err)
+	}
+
+	if opts.Verify {
+		if err = verifyDevice(ctx, device, 0, writer.written, writer.hash, opts); err != nil {
+			return writer.written, err
+		}
+	}
+
+	return writer.written, nil
+}
+
+/***********************************************************************************************************************
+ * Private
+ **********************************************************************************************************************/
+
+func prepareDeviceWriteOptions(opts DeviceWriteOptions) (preparedOpts DeviceWriteOptions, err error) {
+	if opts.BlockSize == 0 {
+		opts.BlockSize = DefaultDeviceBlockSize
+	}
+
+	if opts.BlockSize%directIOAlignment != 0 {
+		return opts, aoserrors.Errorf("block size should be multiple of %d", directIOAlignment)
+	}
+
+	return opts, nil
+}
+
+func newDeviceWriter(device string, offset int64, opts DeviceWriteOptions) (writer *deviceWriter, err error) {
+	writer = &deviceWriter{opts: opts, offset: offset, hashState: sha256.New()}
+
+	if writer.file, writer.directIO, err = openDevice(device, os.O_WRONLY, opts.DirectIO); err != nil {
+		return nil, err
+	}
+
+	if offset == 0 {
+		return writer, nil
+	}
+
+	if _, err = writer.file.Seek(offset, io.SeekStart); err != nil {
+		writer.file.Close()
+
+		return nil, aoserrors.Wrap(err)
+	}
+
+	if writer.directIO && offset%directIOAlignment != 0 {
+		if err = disableDirectIO(writer.file); err != nil {
+			writer.file.Close()
+
+			return nil, err
+		}
+
+		writer.directIO = false
+	}
+
+	return writer, nil
+}
+
+func (writer *deviceWriter) write(src io.Reader) (err error) {
+	buffer := alignedBuffer(writer.opts.BlockSize)
+
+	for {
+		n, readErr := io.ReadFull(src, buffer)
+		if readErr != nil && !errors.Is(readErr, io.EOF) && !errors.Is(readErr, io.ErrUnexpectedEOF) {
+			return aoserrors.Wrap(readErr)
+		}
+
+		if n > 0 {
+			if err = writer.writeBlock(buffer[:n]); err != nil {
+				return err
+			}
+		}
+
+		if readErr != nil {
+			break
+		}
+	}
+
+	if err = writer.sync(); err != nil {
+		return err
+	}
+
+	writer.hash = writer.hashState.Sum(nil)
+
+	return nil
+}
+
+func (writer *deviceWriter) sync() (err error) {
+	if err = writer.file.Sync(); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	writer.unsynced = 0
+
+	if writer.syncCbk != nil {
+		return writer.syncCbk(writer.offset + writer.written)
+	}
+
+	return nil
+}
+
+func (writer *deviceWriter) writeBlock(data []byte) (err error) {
+	// Direct IO requires aligned size: write unaligned tail with buffered IO
+	if writer.directIO && len(data)%directIOAlignment != 0 {
+		if err = disableDirectIO(writer.file); err != nil {
+			return err
+		}
+
+		writer.directIO = false
+	}
+
+	if _, err = writer.file.Write(data); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	// hash Write never returns an error
+	_, _ = writer.hashState.Write(data)
+
+	writer.written += int64(len(data))
+	writer.unsynced += int64(len(data))
+
+	if writer.opts.SyncInterval != 0 && writer.unsynced >= writer.opts.SyncInterval {
+		if err = writer.sync(); err != nil {
+			return err
+		}
+	}
+
+	if writer.opts.ProgressCbk != nil {
+		writer.opts.ProgressCbk(writer.offset + writer.written)
+	}
+
+	return nil
+}
+
+func verifyDevice(ctx context.Context, device string, offset, size int64, checksum []byte,
+	opts DeviceWriteOptions) (err error) {
+	file, directIO, err := openDevice(device, os.O_RDONLY, opts.DirectIO)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if offset != 0 {
+		if _, err = file.Seek(offset, io.SeekStart); err != nil {
+			return aoserrors.Wrap(err)
+		}
+
+		if directIO && offset%directIOAlignment != 0 {
+			if err = disableDirectIO(file); err != nil {
+				return err
+			}
+		}
+	}
+
+	hashState := sha256.New()
+	buffer := alignedBuffer(opts.BlockSize)
+
+	for remaining := size; remaining > 0; {
+		if ctx.Err() != nil {
+			return aoserrors.Wrap(ctx.Err())
+		}
+
+		// Read full aligned block as required by direct IO and hash only written part
+		n, err := io.ReadFull(file, buffer)
+		if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return aoserrors.Wrap(err)
+		}
+
+		if int64(n) > remaining {
+			n = int(remaining)
+		}
+
+		if n == 0 {
+			return aoserrors.New("device is smaller than written data")
+		}
+
+		_, _ = hashState.Write(buffer[:n])
+
+		remaining -= int64(n)
+	}
+
+	if !bytes.Equal(hashState.Sum(nil), checksum) {
+		return aoserrors.New("device data verification failed")
+	}
+
+	return nil
+}
+
+func openDevice(device string, flag int, directIO bool) (file *os.File, direct bool, err error) {
+	if directIO {
+		if file, err = os.OpenFile(device, flag|syscall.O_DIRECT, 0); err == nil {
+			return file, true, nil
+		}
+
+		if !errors.Is(err, syscall.EINVAL) {
+			return nil, false, aoserrors.Wrap(err)
+		}
+
+		log.WithField("device", device).Warn("Direct IO is not supported, use buffered IO")
+	}
+
+	if file, err = os.OpenFile(device, flag, 0); err != nil {
+		return nil, false, aoserrors.Wrap(err)
+	}
+
+	return file, false, nil
+}
+
+func disableDirectIO(file *os.File) (err error) {
+	flags, _, errno := syscall.Syscall(syscall.SYS_FCNTL, file.Fd(), syscall.F_GETFL, 0)
+	if errno != 0 {
+		return aoserrors.Wrap(errno)
+	}
+
+	if _, _, errno = syscall.Syscall(
+		syscall.SYS_FCNTL, file.Fd(), syscall.F_SETFL, flags&^syscall.O_DIRECT); errno != 0 {
+		return aoserrors.Wrap(errno)
+	}
+
+	return nil
+}
+
+// alignedBuffer allocates buffer aligned as required by direct IO.
+func alignedBuffer(size int) (buffer []byte) {
+	buffer = make([]byte, size+directIOAlignment)
+
+	offset := 0
+
+	// nolint:gosec // pointer is used only to calculate alignment
+	if remainder := int(uintptr(unsafe.Pointer(&buffer[0])) & (directIOAlignment - 1)); remainder != 0 {
+		offset = directIOAlignment - remainder
+	}
+
+	return buffer[offset : offset+size]
+}
@@ -0,0 +1,377 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2022 Renesas Electronics Corporation.
+// Copyright (C) 2022 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package image
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"unicode/utf16"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/aoscloud/aos_common/aoserrors"
+	"github.com/aoscloud/aos_common/utils/contextreader"
+)
+
+/***********************************************************************************************************************
+ * Consts
+ **********************************************************************************************************************/
+
+const (
+	gptSignature        = "EFI PART"
+	gptHeaderSize       = 92
+	gptMinEntrySize     = 128
+	gptMaxEntrySize     = 4096
+	gptNameSize         = 72
+	gptMaxEntries       = 1024
+	gptEmptyTypeGUID    = "00000000-0000-0000-0000-000000000000"
+	gptDefaultSector    = 512
+	gptAdvancedSector   = 4096
+	gptEntryGUIDSize    = 16
+	gptHeaderCRCOffset  = 16
+	gptHeaderCRCEndSize = 4
+)
+
+/***********************************************************************************************************************
+ * Types
+ **********************************************************************************************************************/
+
+// GPTPartition GPT partition info.
+type GPTPartition struct {
+	// Index partition number starting from 1.
+	Index      int
+	TypeGUID   string
+	PartUUID   string
+	Label      string
+	Start      int64
+	Size       int64
+	Attributes uint64
+}
+
+// PartitionSelector selects partition by label and/or type GUID. Empty fields are not checked.
+type PartitionSelector struct {
+	Label    string
+	TypeGUID string
+}
+
+// PartitionMapping maps source image partition to target disk partition.
+type PartitionMapping struct {
+	Source PartitionSelector
+	Target PartitionSelector
+}
+
+type gptHeader struct {
+	Signature      [8]byte
+	Revision       uint32
+	HeaderSize     uint32
+	HeaderCRC      uint32
+	Reserved       uint32
+	CurrentLBA     uint64
+	BackupLBA      uint64
+	FirstUsableLBA uint64
+	LastUsableLBA  uint64
+	DiskGUID       [16]byte
+	EntriesLBA     uint64
+	EntriesCount   uint32
+	EntrySize      uint32
+	EntriesCRC     uint32
+}
+
+type gptEntry struct {
+	TypeGUID   [16]byte
+	UniqueGUID [16]byte
+	FirstLBA   uint64
+	LastLBA    uint64
+	Attributes uint64
+	Name       [gptNameSize]byte
+}
+
+/***********************************************************************************************************************
+ * Public
+ **********************************************************************************************************************/
+
+// ReadGPT reads GPT partitions of disk or disk image. Sector size (512 or 4096) is detected automatically.
+func ReadGPT(disk io.ReaderAt) (partitions []GPTPartition, err error) {
+	var lastErr error
+
+	for _, sectorSize := range []int64{gptDefaultSector, gptAdvancedSector} {
+		if partitions, err = readGPT(disk, sectorSize); err == nil {
+			return partitions, nil
+		}
+
+		lastErr = err
+	}
+
+	return nil, lastErr
+}
+
+// WriteDiskImagePartitions writes selected partitions of full disk image to target disk partitions. Only partitions
+// content is written: target GPT and partitions UUIDs are preserved.
+func WriteDiskImagePartitions(ctx context.Context, src io.ReaderAt, target string, mappings []PartitionMapping,
+	opts DeviceWriteOptions) (err error) {
+	if opts, err = prepareDeviceWriteOptions(opts); err != nil {
+		return err
+	}
+
+	srcPartitions, err := ReadGPT(src)
+	if err != nil {
+		return err
+	}
+
+	targetPartitions, err := readDeviceGPT(target)
+	if err != nil {
+		return err
+	}
+
+	for _, mapping := range mappings {
+		srcPartition, err := findPartition(srcPartitions, mapping.Source)
+		if err != nil {
+			return err
+		}
+
+		targetPartition, err := findPartition(targetPartitions, mapping.Target)
+		if err != nil {
+			return err
+		}
+
+		if srcPartition.Size > targetPartition.Size {
+			return aoserrors.Errorf("source partition %d doesn't fit target partition %d",
+				srcPartition.Index, targetPartition.Index)
+		}
+
+		log.WithFields(log.Fields{
+			"source": srcPartition.Index, "target": targetPartition.Index, "size": srcPartition.Size,
+		}).Debug("Write disk image partition")
+
+		if err = writePartition(ctx, io.NewSectionReader(src, srcPartition.Start, srcPartition.Size), target,
+			targetPartition.Start, opts); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Match checks if partition matches selector.
+func (selector PartitionSelector) Match(partition GPTPartition) bool {
+	if selector.Label == "" && selector.TypeGUID == "" {
+		return false
+	}
+
+	if selector.Label != "" && selector.Label != partition.Label {
+		return false
+	}
+
+	if selector.TypeGUID != "" && !strings.EqualFold(selector.TypeGUID, partition.TypeGUID) {
+		return false
+	}
+
+	return true
+}
+
+/***********************************************************************************************************************
+ * Private
+ **********************************************************************************************************************/
+
+func readGPT(disk io.ReaderAt, sectorSize int64) (partitions []GPTPartition, err error) {
+	headerData := make([]byte, gptHeaderSize)
+
+	if _, err = disk.ReadAt(headerData, sectorSize); err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	var header gptHeader
+
+	if err = binary.Read(bytes.NewReader(headerData), binary.LittleEndian, &header); err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	if string(header.Signature[:]) != gptSignature {
+		return nil, aoserrors.New("GPT not found")
+	}
+
+	if err = validateGPTHeader(disk, &header, sectorSize); err != nil {
+		return nil, err
+	}
+
+	if headerData, err = readAt(disk, sectorSize, int64(header.HeaderSize)); err != nil {
+		return nil, err
+	}
+
+	// Header CRC is calculated with CRC field set to zero
+	copy(headerData[gptHeaderCRCOffset:gptHeaderCRCOffset+gptHeaderCRCEndSize], make([]byte, gptHeaderCRCEndSize))
+
+	if crc32.ChecksumIEEE(headerData) != header.HeaderCRC {
+		return nil, aoserrors.New("GPT header CRC mismatch")
+	}
+
+	entriesData, err := readAt(disk, int64(header.EntriesLBA)*sectorSize,
+		int64(header.EntriesCount)*int64(header.EntrySize))
+	if err != nil {
+		return nil, err
+	}
+
+	if crc32.ChecksumIEEE(entriesData) != header.EntriesCRC {
+		return nil, aoserrors.New("GPT entries CRC mismatch")
+	}
+
+	for i := 0; i < int(header.EntriesCount); i++ {
+		var entry gptEntry
+
+		if err = binary.Read(bytes.NewReader(entriesData[i*int(header.EntrySize):]), binary.LittleEndian,
+			&entry); err != nil {
+			return nil, aoserrors.Wrap(err)
+		}
+
+		if typeGUID := formatGUID(entry.TypeGUID); typeGUID != gptEmptyTypeGUID {
+			if entry.LastLBA < entry.FirstLBA ||
+				entry.FirstLBA < header.FirstUsableLBA || entry.LastLBA > header.LastUsableLBA {
+				return nil, aoserrors.Errorf("invalid GPT partition %d LBA range: %d-%d", i+1,
+					entry.FirstLBA, entry.LastLBA)
+			}
+
+			partitions = append(partitions, GPTPartition{
+				Index:      i + 1,
+				TypeGUID:   typeGUID,
+				PartUUID:   formatGUID(entry.UniqueGUID),
+				Label:      decodeGPTName(entry.Name),
+				Start:      int64(entry.FirstLBA) * sectorSize,
+				Size:       int64(entry.LastLBA-entry.FirstLBA+1) * sectorSize,
+				Attributes: entry.Attributes,
+			})
+		}
+	}
+
+	return partitions, nil
+}
+
+// validateGPTHeader checks header fields before they are used to read partition entries.
+func validateGPTHeader(disk io.ReaderAt, header *gptHeader, sectorSize int64) (err error) {
+	if header.HeaderSize < gptHeaderSize || header.HeaderSize > uint32(sectorSize) ||
+		header.EntrySize < gptMinEntrySize || header.EntrySize > gptMaxEntrySize ||
+		header.EntrySize&(header.EntrySize-1) != 0 || header.EntriesCount > gptMaxEntries {
+		return aoserrors.New("invalid GPT header")
+	}
+
+	// Primary partition entries are located between header and first usable LBA
+	if header.FirstUsableLBA > header.LastUsableLBA || header.LastUsableLBA > uint64(math.MaxInt64/sectorSize) ||
+		header.EntriesLBA < 2 || header.EntriesLBA > header.FirstUsableLBA ||
+		int64(header.EntriesLBA)*sectorSize+int64(header.EntriesCount)*int64(header.EntrySize) >
+			int64(header.FirstUsableLBA)*sectorSize {
+		return aoserrors.New("invalid GPT header LBA layout")
+	}
+
+	if sizer, ok := disk.(interface{ Size() int64 }); ok && int64(header.LastUsableLBA+1)*sectorSize > sizer.Size() {
+		return aoserrors.New("GPT exceeds disk size")
+	}
+
+	return nil
+}
+
+func readDeviceGPT(device string) (partitions []GPTPartition, err error) {
+	file, err := os.Open(device)
+	if err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+	defer file.Close()
+
+	return ReadGPT(file)
+}
+
+func readAt(reader io.ReaderAt, offset, size int64) (data []byte, err error) {
+	data = make([]byte, size)
+
+	if _, err = reader.ReadAt(data, offset); err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	return data, nil
+}
+
+func findPartition(partitions []GPTPartition, selector PartitionSelector) (partition GPTPartition, err error) {
+	found := false
+
+	for _, item := range partitions {
+		if !selector.Match(item) {
+			continue
+		}
+
+		if found {
+			return partition, aoserrors.Errorf("more than one partition matches selector %+v", selector)
+		}
+
+		partition, found = item, true
+	}
+
+	if !found {
+		return partition, aoserrors.Errorf("no partition matches selector %+v", selector)
+	}
+
+	return partition, nil
+}
+
+func writePartition(ctx context.Context, src *io.SectionReader, target string, offset int64,
+	opts DeviceWriteOptions) (err error) {
+	writer, err := newDeviceWriter(target, offset, opts)
+	if err != nil {
+		return err
+	}
+	defer writer.file.Close()
+
+	if err = writer.write(contextreader.New(ctx, src)); err != nil {
+		return err
+	}
+
+	if err = writer.file.Close(); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	if opts.Verify {
+		return verifyDevice(ctx, target, offset, writer.written, writer.hash, opts)
+	}
+
+	return nil
+}
+
+// formatGUID formats GUID stored in mixed-endian format.
+func formatGUID(guid [gptEntryGUIDSize]byte) string {
+	return fmt.Sprintf("%08X-%04X-%04X-%X-%X", binary.LittleEndian.Uint32(guid[0:4]),
+		binary.LittleEndian.Uint16(guid[4:6]), binary.LittleEndian.Uint16(guid[6:8]), guid[8:10], guid[10:])
+}
+
+func decodeGPTName(name [gptNameSize]byte) string {
+	chars := make([]uint16, 0, gptNameSize/2)
+
+	for i := 0; i < gptNameSize; i += 2 {
+		char := binary.LittleEndian.Uint16(name[i:])
+		if char == 0 {
+			break
+		}
+
+		chars = append(chars, char)
+	}
+
+	return string(utf16.Decode(chars))
+}
@@ -19,13 +19,14 @@ package image
 
 import (
 	"archive/tar"
-	"compress/gzip"
+	"bytes"
 	"context"
 	"errors"
+	"hash"
 	"io"
+	"io/ioutil"
 	"os"
 	"path"
-	"reflect"
 	"strings"
 	"time"
 
@@ -56,6 +57,13 @@ type FileInfo struct {
 	Size   uint64
 }
 
+// FileInfoCalculator calculates file info of data written to it.
+type FileInfoCalculator struct {
+	hash256 hash.Hash
+	hash512 hash.Hash
+	size    uint64
+}
+
 /***********************************************************************************************************************
  * Public
  **********************************************************************************************************************/
@@ -110,33 +118,24 @@ func CheckFileInfo(ctx context.Context, fileName string, fileInfo FileInfo) (err
 		return aoserrors.New("file size mistmatch")
 	}
 
-	hash256 := sha3.New256()
-
-	contextRead := contextreader.New(ctx, file)
-
-	if _, err := io.Copy(hash256, contextRead); err != nil {
-		return aoserrors.Wrap(err)
-	}
-
-	if !reflect.DeepEqual(hash256.Sum(nil), fileInfo.Sha256) {
-		return aoserrors.New("checksum sha256 mistmatch")
-	}
+	return CheckReader(ctx, file, fileInfo)
+}
 
-	hash512 := sha3.New512()
+// CheckReader checks if data read from reader matches FileInfo.
+func CheckReader(ctx context.Context, reader io.Reader, fileInfo FileInfo) (err error) {
+	return CopyAndCheck(ctx, ioutil.Discard, reader, fileInfo)
+}
 
-	if _, err = file.Seek(0, io.SeekStart); err != nil {
-		return aoserrors.Wrap(err)
-	}
+// CopyAndCheck copies data from reader to writer and checks if copied data matches FileInfo. Checksums are
+// calculated while data is being written, so it is not required to read the written data again to verify it.
+func CopyAndCheck(ctx context.Context, writer io.Writer, reader io.Reader, fileInfo FileInfo) (err error) {
+	calculator := NewFileInfoCalculator()
 
-	if _, err := io.Copy(hash512, contextRead); err != nil {
+	if _, err = io.Copy(writer, io.TeeReader(contextreader.New(ctx, reader), calculator)); err != nil {
 		return aoserrors.Wrap(err)
 	}
 
-	if !reflect.DeepEqual(hash512.Sum(nil), fileInfo.Sha512) {
-		return aoserrors.New("checksum sha512 mistmatch")
-	}
-
-	return nil
+	return calculator.Check(fileInfo)
 }
 
 // CreateFileInfo creates FileInfo from existing file.
@@ -147,39 +146,64 @@ func CreateFileInfo(ctx context.Context, fileName string) (fileInfo FileInfo, er
 	}
 	defer file.Close()
 
-	stat, err := file.Stat()
-	if err != nil {
+	return CreateReaderFileInfo(ctx, file)
+}
+
+// CreateReaderFileInfo creates FileInfo from data read from reader.
+func CreateReaderFileInfo(ctx context.Context, reader io.Reader) (fileInfo FileInfo, err error) {
+	calculator := NewFileInfoCalculator()
+
+	if _, err = io.Copy(calculator, contextreader.New(ctx, reader)); err != nil {
 		return fileInfo, aoserrors.Wrap(err)
 	}
 
-	fileInfo.Size = uint64(stat.Size())
+	return calculator.FileInfo(), nil
+}
 
-	hash256 := sha3.New256()
+// NewFileInfoCalculator creates file info calculator.
+func NewFileInfoCalculator() (calculator *FileInfoCalculator) {
+	return &FileInfoCalculator{hash256: sha3.New256(), hash512: sha3.New512()}
+}
 
-	contextRead := contextreader.New(ctx, file)
+// Write calculates file info of written data.
+func (calculator *FileInfoCalculator) Write(data []byte) (n int, err error) {
+	// hash Write never returns an error
+	_, _ = calculator.hash256.Write(data)
+	_, _ = calculator.hash512.Write(data)
 
-	if _, err := io.Copy(hash256, contextRead); err != nil {
-		return fileInfo, aoserrors.Wrap(err)
-	}
+	calculator.size += uint64(len(data))
 
-	fileInfo.Sha256 = hash256.Sum(nil)
+	return len(data), nil
+}
 
-	hash512 := sha3.New512()
+// FileInfo returns file info of written data.
+func (calculator *FileInfoCalculator) FileInfo() (fileInfo FileInfo) {
+	return FileInfo{
+		Sha256: calculator.hash256.Sum(nil),
+		Sha512: calculator.hash512.Sum(nil),
+		Size:   calculator.size,
+	}
+}
 
-	if _, err = file.Seek(0, io.SeekStart); err != nil {
-		return fileInfo, aoserrors.Wrap(err)
+// Check checks if written data matches FileInfo.
+func (calculator *FileInfoCalculator) Check(fileInfo FileInfo) (err error) {
+	if calculator.size != fileInfo.Size {
+		return aoserrors.New("file size mistmatch")
 	}
 
-	if _, err := io.Copy(hash512, contextRead); err != nil {
-		return fileInfo, aoserrors.Wrap(err)
+	if !bytes.Equal(calculator.hash256.Sum(nil), fileInfo.Sha256) {
+		return aoserrors.New("checksum sha256 mistmatch")
 	}
 
-	fileInfo.Sha512 = hash512.Sum(nil)
+	if !bytes.Equal(calculator.hash512.Sum(nil), fileInfo.Sha512) {
+		return aoserrors.New("checksum sha512 mistmatch")
+	}
 
-	return fileInfo, nil
+	return nil
 }
 
-// UntarGZArchive extract data from tar.gz archive.
+// UntarGZArchive extract data from tar archive. Archive compression is detected automatically
+// (see NewDecompressReader). xz and zstd compressed archives require xz and zstd tools installed.
 func UntarGZArchive(ctx context.Context, source, destination string) (err error) {
 	if _, err = os.Stat(destination); os.IsNotExist(err) {
 		return aoserrors.Wrap(err)
@@ -191,13 +215,13 @@ func UntarGZArchive(ctx context.Context, source, destination string) (err error)
 	}
 	defer archive.Close()
 
-	gzipReader, err := gzip.NewReader(archive)
+	decompressReader, err := NewDecompressReader(ctx, archive, CompressionAuto)
 	if err != nil {
 		return aoserrors.Wrap(err)
 	}
-	defer gzipReader.Close()
+	defer decompressReader.Close()
 
-	tarReader := tar.NewReader(gzipReader)
+	tarReader := tar.NewReader(decompressReader)
 	contextReader := contextreader.New(ctx, tarReader)
 
 	for {
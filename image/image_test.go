@@ -18,19 +18,38 @@
 package image_test
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"hash/crc32"
+	"io"
 	"io/ioutil"
+	"math/big"
 	"os"
 	"os/exec"
 	"path"
+	"reflect"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
+	"unicode/utf16"
 
 	log "github.com/sirupsen/logrus"
 
 	"github.com/aoscloud/aos_common/image"
+	"github.com/aoscloud/aos_common/utils/cryptutils"
 )
 
 /***********************************************************************************************************************
@@ -39,6 +58,24 @@ import (
 
 const filePerm = 0o600
 
+/***********************************************************************************************************************
+ * Types
+ **********************************************************************************************************************/
+
+type testGPTPartition struct {
+	label    string
+	typeGUID string
+	partUUID string
+	first    uint64
+	last     uint64
+}
+
+type failingReadSeeker struct {
+	io.ReadSeeker
+	failOffset int64
+	offset     int64
+}
+
 /***********************************************************************************************************************
  * Vars
  **********************************************************************************************************************/
@@ -250,3 +287,1207 @@ func TestCheckFileInfo(t *testing.T) {
 		t.Error("sha512 should not be matched")
 	}
 }
+
+func TestCopyAndCheck(t *testing.T) {
+	data := []byte("Hello streaming checksum")
+
+	info, err := image.CreateReaderFileInfo(context.Background(), bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Can't create file info: %s", err)
+	}
+
+	fileInfo, err := image.CreateFileInfo(context.Background(), writeTestFile(t, "stream", data))
+	if err != nil {
+		t.Fatalf("Can't create file info: %s", err)
+	}
+
+	if !reflect.DeepEqual(info, fileInfo) {
+		t.Error("Reader file info mismatch")
+	}
+
+	var buffer bytes.Buffer
+
+	if err = image.CopyAndCheck(context.Background(), &buffer, bytes.NewReader(data), info); err != nil {
+		t.Errorf("Copy and check error: %s", err)
+	}
+
+	if !bytes.Equal(buffer.Bytes(), data) {
+		t.Error("Copied data mismatch")
+	}
+
+	info.Sha512[0]++
+
+	if err = image.CheckReader(context.Background(), bytes.NewReader(data), info); err == nil {
+		t.Error("sha512 should not be matched")
+	}
+
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	cancelFunc()
+
+	if err = image.CheckReader(ctx, bytes.NewReader(data), fileInfo); !errors.Is(err, context.Canceled) {
+		t.Errorf("Context canceled error expected: %v", err)
+	}
+}
+
+func TestExtractSquashFS(t *testing.T) {
+	if err := image.ExtractSquashFS(context.Background(),
+		writeTestFile(t, "not_squashfs", bytes.Repeat([]byte("not squashfs image"), 10)), workDir); err == nil {
+		t.Error("ExtractSquashFS should failed: not a squashfs image")
+	}
+
+	if _, err := exec.LookPath("mksquashfs"); err != nil {
+		t.Skip("mksquashfs is not available")
+	}
+
+	sourceDir := path.Join(workDir, "squashfs_source")
+	destinationDir := path.Join(workDir, "squashfs_destination")
+
+	for _, dir := range []string{path.Join(sourceDir, "dir1", "dir2"), destinationDir} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatalf("Error creating tmp dir %s", err)
+		}
+	}
+
+	if err := ioutil.WriteFile(path.Join(sourceDir, "file.txt"), []byte("This is test file"), filePerm); err != nil {
+		t.Fatalf("Can't write test file: %s", err)
+	}
+
+	// Big file to check data blocks and sparse blocks
+	bigData := append(bytes.Repeat([]byte("This is big test file"), 20000), make([]byte, 300000)...)
+
+	if err := ioutil.WriteFile(path.Join(sourceDir, "dir1", "dir2", "big.bin"), bigData, filePerm); err != nil {
+		t.Fatalf("Can't write test file: %s", err)
+	}
+
+	if err := os.Symlink("../file.txt", path.Join(sourceDir, "dir1", "link")); err != nil {
+		t.Fatalf("Can't create symlink: %s", err)
+	}
+
+	if err := os.Link(path.Join(sourceDir, "file.txt"), path.Join(sourceDir, "dir1", "hardlink")); err != nil {
+		t.Fatalf("Can't create hard link: %s", err)
+	}
+
+	imageFile := path.Join(workDir, "test.squashfs")
+
+	if output, err := exec.Command("mksquashfs", sourceDir, imageFile, "-noappend").CombinedOutput(); err != nil {
+		t.Fatalf("Can't run mksquashfs: %s, %s", err, output)
+	}
+
+	squashFS, err := image.OpenSquashFS(imageFile)
+	if err != nil {
+		t.Fatalf("Can't open squashfs: %s", err)
+	}
+	defer squashFS.Close()
+
+	entries, err := squashFS.List()
+	if err != nil {
+		t.Fatalf("Can't list squashfs: %s", err)
+	}
+
+	var paths []string
+
+	for _, entry := range entries {
+		paths = append(paths, entry.Path)
+
+		if entry.Path == "/dir1/link" && entry.LinkTarget != "../file.txt" {
+			t.Errorf("Wrong link target: %s", entry.LinkTarget)
+		}
+
+		if entry.Path == "/dir1/dir2/big.bin" && entry.Size != int64(len(bigData)) {
+			t.Errorf("Wrong file size: %d", entry.Size)
+		}
+	}
+
+	expectedPaths := []string{
+		"/", "/dir1", "/dir1/dir2", "/dir1/dir2/big.bin", "/dir1/hardlink", "/dir1/link", "/file.txt",
+	}
+
+	if !reflect.DeepEqual(paths, expectedPaths) {
+		t.Errorf("Wrong squashfs entries: %v", paths)
+	}
+
+	if err = image.ExtractSquashFS(context.Background(), imageFile, destinationDir); err != nil {
+		t.Fatalf("Can't extract squashfs: %s", err)
+	}
+
+	// compare source dir and extracted dir
+	out, _ := exec.Command("git", "diff", "--no-index", sourceDir, destinationDir).Output()
+
+	if string(out) != "" {
+		t.Errorf("Extracted content not identical")
+	}
+}
+
+func TestSquashFSFixture(t *testing.T) {
+	fixture, err := ioutil.ReadFile(path.Join("testdata", "test.squashfs"))
+	if err != nil {
+		t.Fatalf("Can't read squashfs fixture: %s", err)
+	}
+
+	destinationDir := path.Join(workDir, "squashfs_fixture")
+
+	if err = os.MkdirAll(destinationDir, 0o755); err != nil {
+		t.Fatalf("Error creating tmp dir %s", err)
+	}
+
+	if err = image.ExtractSquashFS(
+		context.Background(), path.Join("testdata", "test.squashfs"), destinationDir); err != nil {
+		t.Fatalf("Can't extract squashfs: %s", err)
+	}
+
+	bigData := append(append(bytes.Repeat([]byte("This is big test file"), 200)[:4096], make([]byte, 4096)...),
+		bytes.Repeat([]byte("tail "), 100)...)
+
+	for fileName, content := range map[string][]byte{
+		"file.txt": []byte("This is test file"), "dir1/big.bin": bigData,
+	} {
+		data, err := ioutil.ReadFile(path.Join(destinationDir, fileName))
+		if err != nil {
+			t.Fatalf("Can't read extracted file: %s", err)
+		}
+
+		if !bytes.Equal(data, content) {
+			t.Errorf("Wrong extracted file content: %s", fileName)
+		}
+	}
+
+	if target, err := os.Readlink(path.Join(destinationDir, "dir1", "link")); err != nil || target != "../file.txt" {
+		t.Errorf("Wrong extracted link: %s, %v", target, err)
+	}
+
+	// Corrupt superblock: block size offset is 12, block log offset is 22, bytes used offset is 40
+	corruptions := map[string]func(data []byte){
+		"zero block size": func(data []byte) { binary.LittleEndian.PutUint32(data[12:], 0) },
+		"wrong block log": func(data []byte) { binary.LittleEndian.PutUint16(data[22:], 13) },
+		"huge block size": func(data []byte) { binary.LittleEndian.PutUint32(data[12:], 1<<24) },
+		"truncated image": func(data []byte) { binary.LittleEndian.PutUint64(data[40:], uint64(len(data)+1)) },
+	}
+
+	for name, corrupt := range corruptions {
+		data := append([]byte{}, fixture...)
+
+		corrupt(data)
+
+		if squashFS, err := image.OpenSquashFS(writeTestFile(t, "corrupted.squashfs", data)); err == nil {
+			squashFS.Close()
+
+			t.Errorf("Error expected for corrupted squashfs: %s", name)
+		}
+	}
+}
+
+func TestExtractMaliciousSquashFS(t *testing.T) {
+	for _, fixture := range []string{"symlink_traversal.squashfs", "dir_loop.squashfs", "dot_dot.squashfs"} {
+		extractDir := path.Join(workDir, "malicious_"+fixture)
+		destinationDir := path.Join(extractDir, "destination")
+		outsideDir := path.Join(extractDir, "outside")
+
+		for _, dir := range []string{destinationDir, outsideDir} {
+			if err := os.MkdirAll(dir, 0o755); err != nil {
+				t.Fatalf("Error creating tmp dir %s", err)
+			}
+		}
+
+		if err := image.ExtractSquashFS(
+			context.Background(), path.Join("testdata", fixture), destinationDir); err == nil {
+			t.Errorf("Extract error expected: %s", fixture)
+		}
+
+		for _, fileName := range []string{path.Join(outsideDir, "passwd"), path.Join(extractDir, "passwd")} {
+			if _, err := os.Stat(fileName); err == nil {
+				t.Errorf("File is written outside of destination: %s", fileName)
+			}
+		}
+	}
+}
+
+func TestValidateOCIImage(t *testing.T) {
+	imagePath := path.Join(workDir, "oci_image")
+
+	config := writeOCIBlob(t, imagePath, image.MediaTypeImageConfig, []byte(`{"architecture":"amd64","os":"linux"}`))
+	layer := writeOCIBlob(t, imagePath, image.MediaTypeImageLayerGzip, []byte("layer content"))
+
+	manifestData, err := json.Marshal(image.OCIManifest{
+		SchemaVersion: 2, MediaType: image.MediaTypeImageManifest, Config: config,
+		Layers: []image.OCIDescriptor{layer},
+	})
+	if err != nil {
+		t.Fatalf("Can't marshal manifest: %s", err)
+	}
+
+	// Validate image with index
+	manifest := writeOCIBlob(t, imagePath, image.MediaTypeImageManifest, manifestData)
+
+	indexData, err := json.Marshal(image.OCIIndex{SchemaVersion: 2, Manifests: []image.OCIDescriptor{manifest}})
+	if err != nil {
+		t.Fatalf("Can't marshal index: %s", err)
+	}
+
+	if err = ioutil.WriteFile(path.Join(imagePath, image.OCIIndexFile), indexData, filePerm); err != nil {
+		t.Fatalf("Can't write index: %s", err)
+	}
+
+	imageManifest, err := image.ValidateOCIImage(context.Background(), imagePath)
+	if err != nil {
+		t.Fatalf("Can't validate image: %s", err)
+	}
+
+	if !reflect.DeepEqual(imageManifest.Layers, []image.OCIDescriptor{layer}) {
+		t.Errorf("Wrong image layers: %v", imageManifest.Layers)
+	}
+
+	// Validate image with manifest
+	if err = ioutil.WriteFile(path.Join(imagePath, image.OCIManifestFile), manifestData, filePerm); err != nil {
+		t.Fatalf("Can't write manifest: %s", err)
+	}
+
+	if _, err = image.ValidateOCIImage(context.Background(), imagePath); err != nil {
+		t.Errorf("Can't validate image: %s", err)
+	}
+
+	// Corrupted layer
+	layerPath, err := image.GetOCIBlobPath(imagePath, layer.Digest)
+	if err != nil {
+		t.Fatalf("Can't get blob path: %s", err)
+	}
+
+	if err = ioutil.WriteFile(layerPath, []byte("layer CONTENT"), filePerm); err != nil {
+		t.Fatalf("Can't write layer: %s", err)
+	}
+
+	if _, err = image.ValidateOCIImage(context.Background(), imagePath); err == nil {
+		t.Error("Layer digest should not be matched")
+	}
+
+	// Wrong manifest
+	for _, manifestData := range []string{
+		`{"schemaVersion":1}`,
+		`{"schemaVersion":2,"config":{"mediaType":"application/json","digest":"` + config.Digest + `"}}`,
+		`{"schemaVersion":2,"config":{"mediaType":"` + image.MediaTypeImageConfig + `","digest":"sha256:1234"}}`,
+		`{"schemaVersion":2,"config":` + toJSON(t, config) + `,"layers":[{"mediaType":"text/plain","digest":"` +
+			layer.Digest + `"}]}`,
+	} {
+		if err = ioutil.WriteFile(
+			path.Join(imagePath, image.OCIManifestFile), []byte(manifestData), filePerm); err != nil {
+			t.Fatalf("Can't write manifest: %s", err)
+		}
+
+		if _, err = image.ParseOCIManifest(path.Join(imagePath, image.OCIManifestFile)); err == nil {
+			t.Errorf("Manifest should be invalid: %s", manifestData)
+		}
+	}
+}
+
+func TestApplyDelta(t *testing.T) {
+	base := []byte("This is base firmware image content")
+	expected := []byte("This is new firmware image content with extra data")
+
+	// Control: diff first 8 bytes, add "new ", skip "base ", diff the rest of base, add extra data
+	ctrl := [][3]int64{{8, 4, 5}, {22, 16, 0}}
+
+	var diff []byte
+
+	for i := 0; i < 8; i++ {
+		diff = append(diff, expected[i]-base[i])
+	}
+
+	for i := 0; i < 22; i++ {
+		diff = append(diff, expected[12+i]-base[13+i])
+	}
+
+	patch := createBsdiffPatch(t, ctrl, diff, []byte("new  with extra data"), int64(len(expected)))
+
+	var (
+		result       bytes.Buffer
+		lastProgress int64
+	)
+
+	fileInfo, err := image.ApplyDelta(context.Background(), bytes.NewReader(base), bytes.NewReader(patch), &result,
+		func(written int64) { lastProgress = written })
+	if err != nil {
+		t.Fatalf("Can't apply delta: %s", err)
+	}
+
+	if !bytes.Equal(result.Bytes(), expected) {
+		t.Errorf("Wrong delta result: %s", result.String())
+	}
+
+	if lastProgress != int64(len(expected)) {
+		t.Errorf("Wrong progress: %d", lastProgress)
+	}
+
+	expectedInfo, err := image.CreateReaderFileInfo(context.Background(), bytes.NewReader(expected))
+	if err != nil {
+		t.Fatalf("Can't create file info: %s", err)
+	}
+
+	if !reflect.DeepEqual(fileInfo, expectedInfo) {
+		t.Error("Wrong delta result file info")
+	}
+
+	// Corrupted patch
+	if _, err = image.ApplyDelta(context.Background(), bytes.NewReader(base),
+		bytes.NewReader(patch[:len(patch)-10]), ioutil.Discard, nil); err == nil {
+		t.Error("Error expected")
+	}
+
+	if _, err = image.ApplyDelta(context.Background(), bytes.NewReader(base),
+		bytes.NewReader([]byte("unknown patch format")), ioutil.Discard, nil); err == nil {
+		t.Error("Error expected")
+	}
+}
+
+func TestApplyZstdDelta(t *testing.T) {
+	if _, err := exec.LookPath("zstd"); err != nil {
+		t.Skip("zstd is not available")
+	}
+
+	baseData := bytes.Repeat([]byte("This is base firmware image content"), 1000)
+	expected := append(append([]byte{}, baseData[:20000]...), bytes.Repeat([]byte("new firmware content"), 100)...)
+
+	baseFile := writeTestFile(t, "zstd_base", baseData)
+	patchFile := path.Join(workDir, "zstd_patch")
+
+	if output, err := exec.Command("zstd", "-q", "-f", "--patch-from="+baseFile, "-o", patchFile,
+		writeTestFile(t, "zstd_new", expected)).CombinedOutput(); err != nil {
+		t.Fatalf("Can't create zstd patch: %s, %s", err, output)
+	}
+
+	patch, err := ioutil.ReadFile(patchFile)
+	if err != nil {
+		t.Fatalf("Can't read zstd patch: %s", err)
+	}
+
+	base, err := os.Open(baseFile)
+	if err != nil {
+		t.Fatalf("Can't open base file: %s", err)
+	}
+	defer base.Close()
+
+	var result bytes.Buffer
+
+	if _, err = image.ApplyDelta(context.Background(), base, bytes.NewReader(patch), &result, nil); err != nil {
+		t.Fatalf("Can't apply delta: %s", err)
+	}
+
+	if !bytes.Equal(result.Bytes(), expected) {
+		t.Error("Wrong delta result")
+	}
+
+	// Base is not a file
+	if _, err = image.ApplyDelta(context.Background(), bytes.NewReader(baseData), bytes.NewReader(patch),
+		ioutil.Discard, nil); err == nil {
+		t.Error("Error expected")
+	}
+
+	wrongBase, err := os.Open(writeTestFile(t, "zstd_wrong_base", expected))
+	if err != nil {
+		t.Fatalf("Can't open base file: %s", err)
+	}
+	defer wrongBase.Close()
+
+	if _, err = image.ApplyDelta(context.Background(), wrongBase, bytes.NewReader(patch), ioutil.Discard,
+		nil); err == nil {
+		t.Error("Error expected")
+	}
+}
+
+func TestWriteToDevice(t *testing.T) {
+	// Use regular file as device
+	device := writeTestFile(t, "device", make([]byte, 1024*1024))
+	data := bytes.Repeat([]byte("device image data"), 20000)
+
+	var lastProgress int64
+
+	written, err := image.WriteToDevice(context.Background(), bytes.NewReader(data), device,
+		image.DeviceWriteOptions{
+			BlockSize:    64 * 1024,
+			DirectIO:     true,
+			Verify:       true,
+			SyncInterval: 128 * 1024,
+			ProgressCbk:  func(written int64) { lastProgress = written },
+		})
+	if err != nil {
+		t.Fatalf("Can't write to device: %s", err)
+	}
+
+	if written != int64(len(data)) || lastProgress != written {
+		t.Errorf("Wrong written size: %d, progress: %d", written, lastProgress)
+	}
+
+	deviceData, err := ioutil.ReadFile(device)
+	if err != nil {
+		t.Fatalf("Can't read device: %s", err)
+	}
+
+	if !bytes.Equal(deviceData[:len(data)], data) {
+		t.Error("Wrong device content")
+	}
+
+	if _, err = image.WriteToDevice(context.Background(), bytes.NewReader(data), device,
+		image.DeviceWriteOptions{BlockSize: 1000}); err == nil {
+		t.Error("Error expected: wrong block size")
+	}
+
+	if _, err = image.WriteToDevice(context.Background(), bytes.NewReader(data), path.Join(workDir, "no_device"),
+		image.DeviceWriteOptions{}); err == nil {
+		t.Error("Error expected: device doesn't exist")
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	content := bytes.Repeat([]byte("artifact content "), 10000)
+	key := bytes.Repeat([]byte{0x11}, 32)
+	iv := bytes.Repeat([]byte{0x22}, 16)
+
+	var compressed bytes.Buffer
+
+	gzipWriter := gzip.NewWriter(&compressed)
+
+	if _, err := gzipWriter.Write(content); err != nil {
+		t.Fatalf("Can't compress data: %s", err)
+	}
+
+	if err := gzipWriter.Close(); err != nil {
+		t.Fatalf("Can't compress data: %s", err)
+	}
+
+	command := exec.Command("openssl", "enc", "-aes-256-cbc", "-K", hex.EncodeToString(key),
+		"-iv", hex.EncodeToString(iv))
+	command.Stdin = &compressed
+
+	artifact, err := command.Output()
+	if err != nil {
+		t.Fatalf("Can't encrypt data: %s", err)
+	}
+
+	artifactInfo, err := image.CreateReaderFileInfo(context.Background(), bytes.NewReader(artifact))
+	if err != nil {
+		t.Fatalf("Can't create file info: %s", err)
+	}
+
+	contentInfo, err := image.CreateReaderFileInfo(context.Background(), bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("Can't create file info: %s", err)
+	}
+
+	descriptor := image.ArtifactDescriptor{
+		FileInfo:      &artifactInfo,
+		DecryptParams: &cryptutils.DecryptParams{Mode: cryptutils.ModeCBC, Key: key, IV: iv},
+		Compression:   image.CompressionGzip,
+		ContentInfo:   &contentInfo,
+	}
+
+	var result bytes.Buffer
+
+	if _, err = image.NewArtifactPipeline(descriptor).Process(
+		context.Background(), bytes.NewReader(artifact), &result); err != nil {
+		t.Fatalf("Can't process artifact: %s", err)
+	}
+
+	if !bytes.Equal(result.Bytes(), content) {
+		t.Error("Wrong processed content")
+	}
+
+	// Wrong content info
+	contentInfo.Sha256[0]++
+
+	if _, err = image.NewArtifactPipeline(descriptor).Process(
+		context.Background(), bytes.NewReader(artifact), ioutil.Discard); err == nil {
+		t.Error("Content verification error expected")
+	}
+
+	// Unsupported compression
+	if _, err = image.NewPipeline().Decompress(image.CompressionZstd).Process(
+		context.Background(), bytes.NewReader(artifact), ioutil.Discard); err == nil {
+		t.Error("Unsupported compression error expected")
+	}
+}
+
+func TestUntarCompressedArchive(t *testing.T) {
+	sourceDir := path.Join(workDir, "compressed_source")
+
+	if err := os.MkdirAll(path.Join(sourceDir, "dir1"), 0o755); err != nil {
+		t.Fatalf("Error creating tmp dir %s", err)
+	}
+
+	if err := ioutil.WriteFile(path.Join(sourceDir, "dir1", "file.txt"),
+		[]byte("This is test file"), filePerm); err != nil {
+		t.Fatalf("Can't write test file: %s", err)
+	}
+
+	for _, compression := range []struct {
+		tool     string
+		tarFlags string
+	}{
+		{tool: "tar", tarFlags: "-cf"},
+		{tool: "gzip", tarFlags: "-czf"},
+		{tool: "bzip2", tarFlags: "-cjf"},
+		{tool: "xz", tarFlags: "-cJf"},
+		{tool: "zstd", tarFlags: "--zstd -cf"},
+	} {
+		if _, err := exec.LookPath(compression.tool); err != nil {
+			t.Logf("Skip %s compression: tool is not available", compression.tool)
+
+			continue
+		}
+
+		archive := path.Join(workDir, "archive_"+compression.tool)
+		destination := path.Join(workDir, "untar_"+compression.tool)
+
+		if err := os.MkdirAll(destination, 0o755); err != nil {
+			t.Fatalf("Error creating tmp dir %s", err)
+		}
+
+		args := append(strings.Fields(compression.tarFlags), archive, "-C", sourceDir, ".")
+
+		if output, err := exec.Command("tar", args...).CombinedOutput(); err != nil {
+			t.Fatalf("Can't run tar: %s, %s", err, output)
+		}
+
+		if err := image.UntarGZArchive(context.Background(), archive, destination); err != nil {
+			t.Errorf("Can't untar %s archive: %s", compression.tool, err)
+
+			continue
+		}
+
+		if out, _ := exec.Command("git", "diff", "--no-index", sourceDir, destination).Output(); string(out) != "" {
+			t.Errorf("Untar %s content not identical", compression.tool)
+		}
+	}
+}
+
+func TestCommandDecompressReader(t *testing.T) {
+	if _, err := exec.LookPath("zstd"); err != nil {
+		t.Skip("zstd is not available")
+	}
+
+	data := bytes.Repeat([]byte("compressed data"), 100)
+
+	compressed, err := exec.Command("zstd", "-c", writeTestFile(t, "zstd_data", data)).Output()
+	if err != nil {
+		t.Fatalf("Can't compress data: %s", err)
+	}
+
+	reader, err := image.NewDecompressReader(
+		context.Background(), bytes.NewReader(compressed), image.CompressionAuto)
+	if err != nil {
+		t.Fatalf("Can't create decompress reader: %s", err)
+	}
+	defer reader.Close()
+
+	result, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("Can't read decompressed data: %s", err)
+	}
+
+	if !bytes.Equal(result, data) {
+		t.Error("Wrong decompressed data")
+	}
+
+	// Subsequent read after EOF should return EOF as well
+	if _, err = reader.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+		t.Errorf("EOF expected: %v", err)
+	}
+}
+
+func TestDecompressToolNotInstalled(t *testing.T) {
+	emptyDir, err := ioutil.TempDir(workDir, "empty_path_")
+	if err != nil {
+		t.Fatalf("Can't create empty dir: %s", err)
+	}
+
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+
+	os.Setenv("PATH", emptyDir)
+
+	for _, compression := range []string{image.CompressionXz, image.CompressionZstd} {
+		if _, err = image.NewDecompressReader(
+			context.Background(), bytes.NewReader(nil), compression); err == nil ||
+			!strings.Contains(err.Error(), "tool is not installed") {
+			t.Errorf("Tool is not installed error expected: %v", err)
+		}
+	}
+}
+
+func TestInstallToDevice(t *testing.T) {
+	device := writeTestFile(t, "install_device", make([]byte, 1024*1024))
+	journalFile := path.Join(workDir, "install.journal")
+	data := bytes.Repeat([]byte("install image data"), 30000)
+	opts := image.DeviceWriteOptions{BlockSize: 64 * 1024, DirectIO: true, Verify: true, SyncInterval: 64 * 1024}
+
+	// Simulate failure in the middle of installation
+	if _, err := image.InstallToDevice(context.Background(), &failingReadSeeker{
+		ReadSeeker: bytes.NewReader(data), failOffset: 300 * 1024,
+	}, device, "image1", journalFile, opts); err == nil {
+		t.Fatal("Error expected")
+	}
+
+	journalData, err := ioutil.ReadFile(journalFile)
+	if err != nil {
+		t.Fatalf("Can't read journal: %s", err)
+	}
+
+	var journal image.InstallJournal
+
+	if err = json.Unmarshal(journalData, &journal); err != nil {
+		t.Fatalf("Can't parse journal: %s", err)
+	}
+
+	if journal.Offset != 256*1024 {
+		t.Errorf("Wrong journal offset: %d", journal.Offset)
+	}
+
+	// Resume installation
+	var firstProgress int64
+
+	opts.ProgressCbk = func(written int64) {
+		if firstProgress == 0 {
+			firstProgress = written
+		}
+	}
+
+	size, err := image.InstallToDevice(context.Background(), bytes.NewReader(data), device, "image1", journalFile, opts)
+	if err != nil {
+		t.Fatalf("Can't install image: %s", err)
+	}
+
+	if size != int64(len(data)) {
+		t.Errorf("Wrong image size: %d", size)
+	}
+
+	if firstProgress != journal.Offset+int64(opts.BlockSize) {
+		t.Errorf("Installation is not resumed: %d", firstProgress)
+	}
+
+	if _, err = os.Stat(journalFile); !os.IsNotExist(err) {
+		t.Error("Journal should be removed")
+	}
+
+	deviceData, err := ioutil.ReadFile(device)
+	if err != nil {
+		t.Fatalf("Can't read device: %s", err)
+	}
+
+	if !bytes.Equal(deviceData[:len(data)], data) {
+		t.Error("Wrong device content")
+	}
+}
+
+func TestWriteDiskImagePartitions(t *testing.T) {
+	const (
+		sectorSize    = 512
+		efiTypeGUID   = "C12A7328-F81F-11D2-BA4B-00A0C93EC93B"
+		linuxTypeGUID = "0FC63DAF-8483-4772-8E79-3D69ED7D3639"
+	)
+
+	bootData := bytes.Repeat([]byte("boot"), 1024*sectorSize/4)
+	rootfsData := bytes.Repeat([]byte("rootfs"), 3072*sectorSize/6)
+
+	srcImage := createGPTDisk(t, "disk.img", 8192, []testGPTPartition{
+		{label: "boot", typeGUID: efiTypeGUID, partUUID: "11111111-2222-3333-4444-000000000001", first: 2048, last: 3071},
+		{label: "rootfs", typeGUID: linuxTypeGUID, partUUID: "11111111-2222-3333-4444-000000000002", first: 3072, last: 6143},
+	})
+
+	srcFile, err := os.OpenFile(srcImage, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatalf("Can't open disk image: %s", err)
+	}
+	defer srcFile.Close()
+
+	if _, err = srcFile.WriteAt(bootData, 2048*sectorSize); err != nil {
+		t.Fatalf("Can't write disk image: %s", err)
+	}
+
+	if _, err = srcFile.WriteAt(rootfsData, 3072*sectorSize); err != nil {
+		t.Fatalf("Can't write disk image: %s", err)
+	}
+
+	srcPartitions, err := image.ReadGPT(srcFile)
+	if err != nil {
+		t.Fatalf("Can't read GPT: %s", err)
+	}
+
+	expectedPartitions := []image.GPTPartition{
+		{
+			Index: 1, TypeGUID: efiTypeGUID, PartUUID: "11111111-2222-3333-4444-000000000001", Label: "boot",
+			Start: 2048 * sectorSize, Size: 1024 * sectorSize,
+		},
+		{
+			Index: 2, TypeGUID: linuxTypeGUID, PartUUID: "11111111-2222-3333-4444-000000000002", Label: "rootfs",
+			Start: 3072 * sectorSize, Size: 3072 * sectorSize,
+		},
+	}
+
+	if !reflect.DeepEqual(srcPartitions, expectedPartitions) {
+		t.Errorf("Wrong source partitions: %v", srcPartitions)
+	}
+
+	invalidDisk, err := ioutil.ReadFile(createGPTDisk(t, "invalid.img", 8192, []testGPTPartition{
+		{label: "boot", typeGUID: efiTypeGUID, partUUID: "11111111-2222-3333-4444-000000000001", first: 3071, last: 2048},
+	}))
+	if err != nil {
+		t.Fatalf("Can't read disk image: %s", err)
+	}
+
+	if _, err = image.ReadGPT(bytes.NewReader(invalidDisk)); err == nil {
+		t.Error("Invalid partition range error expected")
+	}
+
+	validDisk, err := ioutil.ReadFile(srcImage)
+	if err != nil {
+		t.Fatalf("Can't read disk image: %s", err)
+	}
+
+	// Truncated disk: GPT header claims more sectors than available
+	if _, err = image.ReadGPT(bytes.NewReader(validDisk[:4096*sectorSize])); err == nil {
+		t.Error("GPT exceeds disk size error expected")
+	}
+
+	targetDisk := createGPTDisk(t, "target.img", 16384, []testGPTPartition{
+		{label: "boot", typeGUID: efiTypeGUID, partUUID: "AAAAAAAA-BBBB-CCCC-DDDD-000000000001", first: 2048, last: 4095},
+		{
+			label: "rootfs_a", typeGUID: linuxTypeGUID, partUUID: "AAAAAAAA-BBBB-CCCC-DDDD-000000000002",
+			first: 4096, last: 10239,
+		},
+		{
+			label: "rootfs_b", typeGUID: linuxTypeGUID, partUUID: "AAAAAAAA-BBBB-CCCC-DDDD-000000000003",
+			first: 10240, last: 16000,
+		},
+	})
+
+	targetGPT, err := ioutil.ReadFile(targetDisk)
+	if err != nil {
+		t.Fatalf("Can't read target disk: %s", err)
+	}
+
+	targetGPT = targetGPT[:2048*sectorSize]
+
+	// Target partition is too small
+	if err = image.WriteDiskImagePartitions(context.Background(), srcFile, targetDisk, []image.PartitionMapping{
+		{Source: image.PartitionSelector{Label: "rootfs"}, Target: image.PartitionSelector{Label: "boot"}},
+	}, image.DeviceWriteOptions{}); err == nil {
+		t.Error("Error expected")
+	}
+
+	// Ambiguous target selector
+	if err = image.WriteDiskImagePartitions(context.Background(), srcFile, targetDisk, []image.PartitionMapping{
+		{Source: image.PartitionSelector{Label: "rootfs"}, Target: image.PartitionSelector{TypeGUID: linuxTypeGUID}},
+	}, image.DeviceWriteOptions{}); err == nil {
+		t.Error("Error expected")
+	}
+
+	if err = image.WriteDiskImagePartitions(context.Background(), srcFile, targetDisk, []image.PartitionMapping{
+		{Source: image.PartitionSelector{TypeGUID: efiTypeGUID}, Target: image.PartitionSelector{Label: "boot"}},
+		{
+			Source: image.PartitionSelector{TypeGUID: strings.ToLower(linuxTypeGUID)},
+			Target: image.PartitionSelector{Label: "rootfs_b"},
+		},
+	}, image.DeviceWriteOptions{BlockSize: 64 * 1024, DirectIO: true, Verify: true}); err != nil {
+		t.Fatalf("Can't write disk image partitions: %s", err)
+	}
+
+	targetData, err := ioutil.ReadFile(targetDisk)
+	if err != nil {
+		t.Fatalf("Can't read target disk: %s", err)
+	}
+
+	if !bytes.Equal(targetData[:2048*sectorSize], targetGPT) {
+		t.Error("Target GPT should not be changed")
+	}
+
+	if !bytes.Equal(targetData[2048*sectorSize:2048*sectorSize+len(bootData)], bootData) {
+		t.Error("Wrong boot partition content")
+	}
+
+	if !bytes.Equal(targetData[10240*sectorSize:10240*sectorSize+len(rootfsData)], rootfsData) {
+		t.Error("Wrong rootfs_b partition content")
+	}
+
+	if !bytes.Equal(targetData[4096*sectorSize:10240*sectorSize], make([]byte, 6144*sectorSize)) {
+		t.Error("rootfs_a partition should not be changed")
+	}
+}
+
+func TestVerity(t *testing.T) {
+	const blockSize = 4096
+
+	salt := bytes.Repeat([]byte{0x5a}, 32)
+
+	hashBlock := func(data []byte) []byte {
+		digest := sha256.Sum256(append(append([]byte{}, salt...), data...))
+
+		return digest[:]
+	}
+
+	// Single level hash tree: root hash is hash of hash block containing data block hashes
+	data := bytes.Repeat([]byte("verity data block"), 3*blockSize/16)[:3*blockSize]
+	dataFile := writeTestFile(t, "verity_data", data)
+	hashFile := path.Join(workDir, "verity_hash")
+
+	info, err := image.GenerateVerity(context.Background(), dataFile, hashFile, image.VerityOptions{Salt: salt})
+	if err != nil {
+		t.Fatalf("Can't generate verity: %s", err)
+	}
+
+	var level []byte
+
+	for i := 0; i < 3; i++ {
+		level = append(level, hashBlock(data[i*blockSize:(i+1)*blockSize])...)
+	}
+
+	level = append(level, make([]byte, blockSize-len(level))...)
+
+	if !bytes.Equal(info.RootHash, hashBlock(level)) {
+		t.Errorf("Wrong root hash: %s", hex.EncodeToString(info.RootHash))
+	}
+
+	if info.DataBlocks != 3 || info.HashOffset != blockSize || info.HashSize != 2*blockSize {
+		t.Errorf("Wrong verity info: %+v", info)
+	}
+
+	hashData, err := ioutil.ReadFile(hashFile)
+	if err != nil {
+		t.Fatalf("Can't read hash file: %s", err)
+	}
+
+	if !bytes.HasPrefix(hashData, []byte("verity\x00\x00")) {
+		t.Error("Verity superblock not found")
+	}
+
+	if !bytes.Equal(hashData[blockSize:], level) {
+		t.Error("Wrong hash tree")
+	}
+
+	if err = image.VerifyVerity(context.Background(), dataFile, hashFile, info.RootHash,
+		image.VerityOptions{}); err != nil {
+		t.Errorf("Verity verification failed: %s", err)
+	}
+
+	if output, err := exec.Command("veritysetup", "verify", dataFile, hashFile,
+		hex.EncodeToString(info.RootHash)).CombinedOutput(); err == nil {
+		t.Log("Verity is verified by veritysetup")
+	} else if !errors.Is(err, exec.ErrNotFound) {
+		t.Errorf("veritysetup verification failed: %s", output)
+	}
+
+	// Multi level hash tree stored in data file after data
+	data = make([]byte, 200*blockSize)
+
+	for i := range data {
+		data[i] = byte(i / blockSize)
+	}
+
+	dataFile = writeTestFile(t, "verity_image", data)
+
+	info, err = image.GenerateVerity(context.Background(), dataFile, dataFile, image.VerityOptions{
+		HashOffset: int64(len(data)),
+	})
+	if err != nil {
+		t.Fatalf("Can't generate verity: %s", err)
+	}
+
+	if info.DataBlocks != 200 || info.HashSize != 4*blockSize {
+		t.Errorf("Wrong verity info: %+v", info)
+	}
+
+	opts := image.VerityOptions{HashOffset: int64(len(data))}
+
+	if err = image.VerifyVerity(context.Background(), dataFile, dataFile, info.RootHash, opts); err != nil {
+		t.Errorf("Verity verification failed: %s", err)
+	}
+
+	file, err := os.OpenFile(dataFile, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("Can't open data file: %s", err)
+	}
+	defer file.Close()
+
+	if _, err = file.WriteAt([]byte{0xff}, 150*blockSize+10); err != nil {
+		t.Fatalf("Can't corrupt data file: %s", err)
+	}
+
+	if err = image.VerifyVerity(context.Background(), dataFile, dataFile, info.RootHash, opts); err == nil {
+		t.Error("Verity verification should fail")
+	}
+}
+
+func TestVerifyMetadataSignature(t *testing.T) {
+	caKey, caCert := createTestCertificate(t, "Test CA", nil, nil)
+	signerKey, signerCert := createTestCertificate(t, "Test signer", caKey, caCert)
+	_, otherCert := createTestCertificate(t, "Other", caKey, caCert)
+
+	trustStore := x509.NewCertPool()
+	trustStore.AddCert(caCert)
+
+	metadata := []byte(`{"version": 1, "urls": ["file:///update.tar"]}`)
+	digest := sha256.Sum256(metadata)
+
+	value, err := signerKey.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatalf("Can't sign metadata: %s", err)
+	}
+
+	signature := image.MetadataSignature{
+		KeyID:        hex.EncodeToString(signerCert.SubjectKeyId),
+		Algorithm:    image.SignatureECDSASHA256,
+		Value:        value,
+		Certificates: [][]byte{otherCert.Raw, signerCert.Raw},
+	}
+
+	signer, err := image.VerifyMetadataSignature(metadata, signature, trustStore)
+	if err != nil {
+		t.Fatalf("Can't verify metadata signature: %s", err)
+	}
+
+	if signer.Subject.CommonName != signerCert.Subject.CommonName {
+		t.Errorf("Wrong signer: %s", signer.Subject.CommonName)
+	}
+
+	fingerprint := sha256.Sum256(signerCert.Raw)
+	signature.KeyID = hex.EncodeToString(fingerprint[:])
+
+	if _, err = image.VerifyMetadataSignature(metadata, signature, trustStore); err != nil {
+		t.Errorf("Can't verify metadata signature by fingerprint: %s", err)
+	}
+
+	// wrong key ID selects wrong signer
+	wrongSignature := signature
+	wrongSignature.KeyID = hex.EncodeToString(otherCert.SubjectKeyId)
+
+	if _, err = image.VerifyMetadataSignature(metadata, wrongSignature, trustStore); err == nil {
+		t.Error("Verification with wrong signer should fail")
+	}
+
+	// algorithm doesn't match key type
+	wrongSignature = signature
+	wrongSignature.Algorithm = image.SignatureRSASHA256
+
+	if _, err = image.VerifyMetadataSignature(metadata, wrongSignature, trustStore); err == nil {
+		t.Error("Verification with wrong algorithm should fail")
+	}
+
+	// modified metadata
+	if _, err = image.VerifyMetadataSignature(
+		append(metadata, ' '), signature, trustStore); err == nil {
+		t.Error("Verification of modified metadata should fail")
+	}
+
+	// untrusted signer
+	if _, err = image.VerifyMetadataSignature(metadata, signature, x509.NewCertPool()); err == nil {
+		t.Error("Verification with untrusted signer should fail")
+	}
+}
+
+/***********************************************************************************************************************
+ * Private
+ **********************************************************************************************************************/
+
+func (reader *failingReadSeeker) Read(data []byte) (n int, err error) {
+	if reader.offset >= reader.failOffset {
+		return 0, errors.New("read failed")
+	}
+
+	if int64(len(data)) > reader.failOffset-reader.offset {
+		data = data[:reader.failOffset-reader.offset]
+	}
+
+	n, err = reader.ReadSeeker.Read(data)
+
+	reader.offset += int64(n)
+
+	return n, err
+}
+
+func writeTestFile(t *testing.T, name string, data []byte) (fileName string) {
+	t.Helper()
+
+	fileName = path.Join(workDir, name)
+
+	if err := ioutil.WriteFile(fileName, data, filePerm); err != nil {
+		t.Fatalf("Can't write test file: %s", err)
+	}
+
+	return fileName
+}
+
+func writeOCIBlob(t *testing.T, imagePath, mediaType string, data []byte) (descriptor image.OCIDescriptor) {
+	t.Helper()
+
+	digest := sha256.Sum256(data)
+
+	descriptor = image.OCIDescriptor{
+		MediaType: mediaType,
+		Digest:    "sha256:" + hex.EncodeToString(digest[:]),
+		Size:      int64(len(data)),
+	}
+
+	blobPath, err := image.GetOCIBlobPath(imagePath, descriptor.Digest)
+	if err != nil {
+		t.Fatalf("Can't get blob path: %s", err)
+	}
+
+	if err = os.MkdirAll(path.Dir(blobPath), 0o755); err != nil {
+		t.Fatalf("Can't create blobs dir: %s", err)
+	}
+
+	if err = ioutil.WriteFile(blobPath, data, filePerm); err != nil {
+		t.Fatalf("Can't write blob: %s", err)
+	}
+
+	return descriptor
+}
+
+func toJSON(t *testing.T, value interface{}) string {
+	t.Helper()
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		t.Fatalf("Can't marshal value: %s", err)
+	}
+
+	return string(data)
+}
+
+func createBsdiffPatch(t *testing.T, ctrl [][3]int64, diff, extra []byte, newSize int64) (patch []byte) {
+	t.Helper()
+
+	offtout := func(value int64) []byte {
+		data := make([]byte, 8)
+
+		if value < 0 {
+			binary.LittleEndian.PutUint64(data, uint64(-value)|1<<63)
+		} else {
+			binary.LittleEndian.PutUint64(data, uint64(value))
+		}
+
+		return data
+	}
+
+	compress := func(data []byte) []byte {
+		command := exec.Command("bzip2", "-c")
+		command.Stdin = bytes.NewReader(data)
+
+		output, err := command.Output()
+		if err != nil {
+			t.Fatalf("Can't run bzip2: %s", err)
+		}
+
+		return output
+	}
+
+	var ctrlData []byte
+
+	for _, item := range ctrl {
+		ctrlData = append(ctrlData, append(append(offtout(item[0]), offtout(item[1])...), offtout(item[2])...)...)
+	}
+
+	ctrlBlock, diffBlock := compress(ctrlData), compress(diff)
+
+	patch = append([]byte("BSDIFF40"), offtout(int64(len(ctrlBlock)))...)
+	patch = append(patch, offtout(int64(len(diffBlock)))...)
+	patch = append(patch, offtout(newSize)...)
+	patch = append(patch, ctrlBlock...)
+	patch = append(patch, diffBlock...)
+
+	return append(patch, compress(extra)...)
+}
+
+// createGPTDisk creates disk image with primary GPT. Backup GPT is not created as it is not used by image package.
+func createGPTDisk(t *testing.T, name string, sectors int64, partitions []testGPTPartition) (fileName string) {
+	t.Helper()
+
+	const (
+		sectorSize   = 512
+		entriesCount = 128
+		entrySize    = 128
+	)
+
+	disk := make([]byte, sectors*sectorSize)
+	entries := disk[2*sectorSize : 2*sectorSize+entriesCount*entrySize]
+
+	for i, partition := range partitions {
+		entry := entries[i*entrySize:]
+
+		copy(entry[0:16], encodeGUID(t, partition.typeGUID))
+		copy(entry[16:32], encodeGUID(t, partition.partUUID))
+		binary.LittleEndian.PutUint64(entry[32:], partition.first)
+		binary.LittleEndian.PutUint64(entry[40:], partition.last)
+
+		for j, char := range utf16.Encode([]rune(partition.label)) {
+			binary.LittleEndian.PutUint16(entry[56+j*2:], char)
+		}
+	}
+
+	header := disk[sectorSize : sectorSize+92]
+
+	copy(header[0:8], "EFI PART")
+	binary.LittleEndian.PutUint32(header[8:], 0x00010000)
+	binary.LittleEndian.PutUint32(header[12:], 92)
+	binary.LittleEndian.PutUint64(header[24:], 1)
+	binary.LittleEndian.PutUint64(header[32:], uint64(sectors-1))
+	binary.LittleEndian.PutUint64(header[40:], 34)
+	binary.LittleEndian.PutUint64(header[48:], uint64(sectors-34))
+	binary.LittleEndian.PutUint64(header[72:], 2)
+	binary.LittleEndian.PutUint32(header[80:], entriesCount)
+	binary.LittleEndian.PutUint32(header[84:], entrySize)
+	binary.LittleEndian.PutUint32(header[88:], crc32.ChecksumIEEE(entries))
+	binary.LittleEndian.PutUint32(header[16:], crc32.ChecksumIEEE(header))
+
+	return writeTestFile(t, name, disk)
+}
+
+func encodeGUID(t *testing.T, guid string) (data []byte) {
+	t.Helper()
+
+	data, err := hex.DecodeString(strings.ReplaceAll(guid, "-", ""))
+	if err != nil || len(data) != 16 {
+		t.Fatalf("Invalid GUID: %s", guid)
+	}
+
+	// First three GUID fields are stored in little endian
+	data[0], data[1], data[2], data[3] = data[3], data[2], data[1], data[0]
+	data[4], data[5] = data[5], data[4]
+	data[6], data[7] = data[7], data[6]
+
+	return data
+}
+
+func createTestCertificate(
+	t *testing.T, commonName string, parentKey *ecdsa.PrivateKey, parent *x509.Certificate,
+) (key *ecdsa.PrivateKey, cert *x509.Certificate) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Can't generate key: %s", err)
+	}
+
+	keyID := sha256.Sum256([]byte(commonName))
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: commonName},
+		SubjectKeyId:          keyID[:20],
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  parent == nil,
+	}
+
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatalf("Can't create certificate: %s", err)
+	}
+
+	if cert, err = x509.ParseCertificate(der); err != nil {
+		t.Fatalf("Can't parse certificate: %s", err)
+	}
+
+	return key, cert
+}
@@ -0,0 +1,203 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2022 Renesas Electronics Corporation.
+// Copyright (C) 2022 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package image
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/aoscloud/aos_common/aoserrors"
+	"github.com/aoscloud/aos_common/utils/contextreader"
+)
+
+/***********************************************************************************************************************
+ * Consts
+ **********************************************************************************************************************/
+
+// DefaultJournalSyncInterval default number of bytes between journal updates.
+const DefaultJournalSyncInterval = 16 * 1024 * 1024
+
+const journalFilePerm = 0o600
+
+/***********************************************************************************************************************
+ * Types
+ **********************************************************************************************************************/
+
+// InstallJournal install journal content.
+type InstallJournal struct {
+	Device  string `json:"device"`
+	ImageID string `json:"imageId"`
+	Offset  int64  `json:"offset"`
+}
+
+/***********************************************************************************************************************
+ * Public
+ **********************************************************************************************************************/
+
+// InstallToDevice writes image to device and records the last synced offset in journal file. If journal for the same
+// device and image ID exists, installation is resumed from the recorded offset. Journal is updated each
+// opts.SyncInterval bytes (DefaultJournalSyncInterval if not set) and removed on success. Returns image size.
+func InstallToDevice(ctx context.Context, src io.ReadSeeker, device, imageID, journalFile string,
+	opts DeviceWriteOptions) (size int64, err error) {
+	if opts, err = prepareDeviceWriteOptions(opts); err != nil {
+		return 0, err
+	}
+
+	if opts.SyncInterval == 0 {
+		opts.SyncInterval = DefaultJournalSyncInterval
+	}
+
+	journal := InstallJournal{Device: device, ImageID: imageID}
+
+	if journal.Offset, err = getResumeOffset(journalFile, journal); err != nil {
+		return 0, err
+	}
+
+	if journal.Offset != 0 {
+		log.WithFields(log.Fields{"device": device, "offset": journal.Offset}).Info("Resume image installation")
+	}
+
+	if _, err = src.Seek(journal.Offset, io.SeekStart); err != nil {
+		return 0, aoserrors.Wrap(err)
+	}
+
+	writer, err := newDeviceWriter(device, journal.Offset, opts)
+	if err != nil {
+		return 0, err
+	}
+	defer writer.file.Close()
+
+	writer.syncCbk = func(offset int64) error {
+		journal.Offset = offset
+
+		return writeJournal(journalFile, journal)
+	}
+
+	if err = writer.write(contextreader.New(ctx, src)); err != nil {
+		return 0, err
+	}
+
+	if err = writer.file.Close(); err != nil {
+		return 0, aoserrors.Wrap(err)
+	}
+
+	size = writer.offset + writer.written
+
+	if opts.Verify {
+		if err = verifyDeviceSource(ctx, device, src, size, opts); err != nil {
+			// Restart installation from the beginning next time
+			_ = os.Remove(journalFile)
+
+			return 0, err
+		}
+	}
+
+	if err = os.Remove(journalFile); err != nil && !os.IsNotExist(err) {
+		return 0, aoserrors.Wrap(err)
+	}
+
+	return size, nil
+}
+
+/***********************************************************************************************************************
+ * Private
+ **********************************************************************************************************************/
+
+func getResumeOffset(journalFile string, journal InstallJournal) (offset int64, err error) {
+	data, err := ioutil.ReadFile(journalFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+
+		return 0, aoserrors.Wrap(err)
+	}
+
+	var storedJournal InstallJournal
+
+	if err = json.Unmarshal(data, &storedJournal); err != nil {
+		log.WithField("file", journalFile).Warnf("Can't parse install journal: %s", err)
+
+		return 0, nil
+	}
+
+	if storedJournal.Device != journal.Device || storedJournal.ImageID != journal.ImageID ||
+		storedJournal.Offset < 0 {
+		return 0, nil
+	}
+
+	return storedJournal.Offset, nil
+}
+
+// writeJournal atomically replaces journal file: writes temporary file, syncs it and renames.
+func writeJournal(journalFile string, journal InstallJournal) (err error) {
+	data, err := json.Marshal(journal)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	tmpFile := journalFile + ".tmp"
+
+	file, err := os.OpenFile(tmpFile, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, journalFilePerm)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+	defer file.Close()
+
+	if _, err = file.Write(data); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	if err = file.Sync(); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	if err = os.Rename(tmpFile, journalFile); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	dir, err := os.Open(filepath.Dir(journalFile))
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+	defer dir.Close()
+
+	return aoserrors.Wrap(dir.Sync())
+}
+
+func verifyDeviceSource(
+	ctx context.Context, device string, src io.ReadSeeker, size int64, opts DeviceWriteOptions) (err error) {
+	if _, err = src.Seek(0, io.SeekStart); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	hashState := sha256.New()
+
+	if _, err = io.Copy(hashState, io.LimitReader(contextreader.New(ctx, src), size)); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	return verifyDevice(ctx, device, 0, size, hashState.Sum(nil), opts)
+}
@@ -0,0 +1,331 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2022 Renesas Electronics Corporation.
+// Copyright (C) 2022 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package image
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aoscloud/aos_common/aoserrors"
+	"github.com/aoscloud/aos_common/utils/contextreader"
+)
+
+/***********************************************************************************************************************
+ * Consts
+ **********************************************************************************************************************/
+
+// OCI media types.
+const (
+	MediaTypeImageManifest          = "application/vnd.oci.image.manifest.v1+json"
+	MediaTypeImageIndex             = "application/vnd.oci.image.index.v1+json"
+	MediaTypeImageConfig            = "application/vnd.oci.image.config.v1+json"
+	MediaTypeImageLayer             = "application/vnd.oci.image.layer.v1.tar"
+	MediaTypeImageLayerGzip         = "application/vnd.oci.image.layer.v1.tar+gzip"
+	MediaTypeImageLayerZstd         = "application/vnd.oci.image.layer.v1.tar+zstd"
+	MediaTypeImageLayerNonDistr     = "application/vnd.oci.image.layer.nondistributable.v1.tar"
+	MediaTypeImageLayerNonDistrGzip = "application/vnd.oci.image.layer.nondistributable.v1.tar+gzip"
+	MediaTypeImageLayerNonDistrZstd = "application/vnd.oci.image.layer.nondistributable.v1.tar+zstd"
+)
+
+// OCI layout file names.
+const (
+	OCIManifestFile = "manifest.json"
+	OCIIndexFile    = "index.json"
+	OCIBlobsDir     = "blobs"
+)
+
+const ociSchemaVersion = 2
+
+/***********************************************************************************************************************
+ * Types
+ **********************************************************************************************************************/
+
+// OCIDescriptor OCI content descriptor.
+type OCIDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	URLs        []string          `json:"urls,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Platform    *OCIPlatform      `json:"platform,omitempty"`
+}
+
+// OCIPlatform OCI platform.
+type OCIPlatform struct {
+	Architecture string   `json:"architecture"`
+	OS           string   `json:"os"`
+	OSVersion    string   `json:"os.version,omitempty"`  // nolint:tagliatelle // defined by OCI spec
+	OSFeatures   []string `json:"os.features,omitempty"` // nolint:tagliatelle // defined by OCI spec
+	Variant      string   `json:"variant,omitempty"`
+}
+
+// OCIManifest OCI image manifest.
+type OCIManifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType,omitempty"`
+	Config        OCIDescriptor     `json:"config"`
+	Layers        []OCIDescriptor   `json:"layers"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+// OCIIndex OCI image index.
+type OCIIndex struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType,omitempty"`
+	Manifests     []OCIDescriptor   `json:"manifests"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+/***********************************************************************************************************************
+ * Vars
+ **********************************************************************************************************************/
+
+// nolint:gochecknoglobals
+var (
+	digestAlgorithms = map[string]func() hash.Hash{
+		"sha256": sha256.New,
+		"sha512": sha512.New,
+	}
+
+	layerMediaTypes = map[string]bool{
+		MediaTypeImageLayer:             true,
+		MediaTypeImageLayerGzip:         true,
+		MediaTypeImageLayerZstd:         true,
+		MediaTypeImageLayerNonDistr:     true,
+		MediaTypeImageLayerNonDistrGzip: true,
+		MediaTypeImageLayerNonDistrZstd: true,
+	}
+)
+
+/***********************************************************************************************************************
+ * Public
+ **********************************************************************************************************************/
+
+// ParseOCIManifest parses and validates OCI image manifest file.
+func ParseOCIManifest(fileName string) (manifest OCIManifest, err error) {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return manifest, aoserrors.Wrap(err)
+	}
+
+	if err = json.Unmarshal(data, &manifest); err != nil {
+		return manifest, aoserrors.Wrap(err)
+	}
+
+	if err = manifest.Validate(); err != nil {
+		return manifest, err
+	}
+
+	return manifest, nil
+}
+
+// ParseOCIIndex parses and validates OCI image index file.
+func ParseOCIIndex(fileName string) (index OCIIndex, err error) {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return index, aoserrors.Wrap(err)
+	}
+
+	if err = json.Unmarshal(data, &index); err != nil {
+		return index, aoserrors.Wrap(err)
+	}
+
+	if index.SchemaVersion != ociSchemaVersion {
+		return index, aoserrors.Errorf("unsupported index schema version: %d", index.SchemaVersion)
+	}
+
+	if index.MediaType != "" && index.MediaType != MediaTypeImageIndex {
+		return index, aoserrors.Errorf("wrong index media type: %s", index.MediaType)
+	}
+
+	for _, manifest := range index.Manifests {
+		if err = ValidateDigest(manifest.Digest); err != nil {
+			return index, err
+		}
+	}
+
+	return index, nil
+}
+
+// ValidateOCIImage validates unpacked OCI image: parses image manifest and verifies config and layers blobs.
+// Image manifest is taken from manifest.json file or, if it is absent, from the first index.json manifest.
+func ValidateOCIImage(ctx context.Context, imagePath string) (manifest OCIManifest, err error) {
+	manifestFile := filepath.Join(imagePath, OCIManifestFile)
+
+	if _, err = os.Stat(manifestFile); os.IsNotExist(err) {
+		if manifestFile, err = getIndexManifestFile(ctx, imagePath); err != nil {
+			return manifest, err
+		}
+	}
+
+	if manifest, err = ParseOCIManifest(manifestFile); err != nil {
+		return manifest, err
+	}
+
+	if err = VerifyOCIBlob(ctx, imagePath, manifest.Config); err != nil {
+		return manifest, err
+	}
+
+	for _, layer := range manifest.Layers {
+		if err = VerifyOCIBlob(ctx, imagePath, layer); err != nil {
+			return manifest, err
+		}
+	}
+
+	return manifest, nil
+}
+
+// VerifyOCIBlob verifies that blob referenced by descriptor matches descriptor size and digest.
+func VerifyOCIBlob(ctx context.Context, imagePath string, descriptor OCIDescriptor) (err error) {
+	blobPath, err := GetOCIBlobPath(imagePath, descriptor.Digest)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(blobPath)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+	defer file.Close()
+
+	algorithm, encoded := splitDigest(descriptor.Digest)
+	hash := digestAlgorithms[algorithm]()
+
+	size, err := io.Copy(hash, contextreader.New(ctx, file))
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	if size != descriptor.Size {
+		return aoserrors.Errorf("blob size mismatch: %s", descriptor.Digest)
+	}
+
+	if hex.EncodeToString(hash.Sum(nil)) != encoded {
+		return aoserrors.Errorf("blob digest mismatch: %s", descriptor.Digest)
+	}
+
+	return nil
+}
+
+// GetOCIBlobPath returns blob path for digest.
+func GetOCIBlobPath(imagePath, digest string) (blobPath string, err error) {
+	if err = ValidateDigest(digest); err != nil {
+		return "", err
+	}
+
+	algorithm, encoded := splitDigest(digest)
+
+	return filepath.Join(imagePath, OCIBlobsDir, algorithm, encoded), nil
+}
+
+// ValidateDigest checks if digest has valid format and supported algorithm.
+func ValidateDigest(digest string) (err error) {
+	algorithm, encoded := splitDigest(digest)
+
+	newHash, ok := digestAlgorithms[algorithm]
+	if !ok {
+		return aoserrors.Errorf("unsupported digest algorithm: %s", digest)
+	}
+
+	if len(encoded) != hex.EncodedLen(newHash().Size()) || strings.ToLower(encoded) != encoded {
+		return aoserrors.Errorf("invalid digest: %s", digest)
+	}
+
+	if _, err = hex.DecodeString(encoded); err != nil {
+		return aoserrors.Errorf("invalid digest: %s", digest)
+	}
+
+	return nil
+}
+
+// Validate checks manifest schema version, media types and descriptors digests.
+func (manifest *OCIManifest) Validate() (err error) {
+	if manifest.SchemaVersion != ociSchemaVersion {
+		return aoserrors.Errorf("unsupported manifest schema version: %d", manifest.SchemaVersion)
+	}
+
+	if manifest.MediaType != "" && manifest.MediaType != MediaTypeImageManifest {
+		return aoserrors.Errorf("wrong manifest media type: %s", manifest.MediaType)
+	}
+
+	if manifest.Config.MediaType != MediaTypeImageConfig {
+		return aoserrors.Errorf("wrong config media type: %s", manifest.Config.MediaType)
+	}
+
+	if err = ValidateDigest(manifest.Config.Digest); err != nil {
+		return err
+	}
+
+	if len(manifest.Layers) == 0 {
+		return aoserrors.New("no layers in manifest")
+	}
+
+	for _, layer := range manifest.Layers {
+		if !layerMediaTypes[layer.MediaType] {
+			return aoserrors.Errorf("wrong layer media type: %s", layer.MediaType)
+		}
+
+		if err = ValidateDigest(layer.Digest); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/***********************************************************************************************************************
+ * Private
+ **********************************************************************************************************************/
+
+func getIndexManifestFile(ctx context.Context, imagePath string) (manifestFile string, err error) {
+	index, err := ParseOCIIndex(filepath.Join(imagePath, OCIIndexFile))
+	if err != nil {
+		return "", err
+	}
+
+	for _, descriptor := range index.Manifests {
+		if descriptor.MediaType != MediaTypeImageManifest {
+			continue
+		}
+
+		if err = VerifyOCIBlob(ctx, imagePath, descriptor); err != nil {
+			return "", err
+		}
+
+		return GetOCIBlobPath(imagePath, descriptor.Digest)
+	}
+
+	return "", aoserrors.New("no image manifest in index")
+}
+
+func splitDigest(digest string) (algorithm, encoded string) {
+	if index := strings.Index(digest, ":"); index >= 0 {
+		return digest[:index], digest[index+1:]
+	}
+
+	return digest, ""
+}
@@ -0,0 +1,194 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2022 Renesas Electronics Corporation.
+// Copyright (C) 2022 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package image
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/aoscloud/aos_common/aoserrors"
+	"github.com/aoscloud/aos_common/utils/contextreader"
+	"github.com/aoscloud/aos_common/utils/cryptutils"
+)
+
+/***********************************************************************************************************************
+ * Types
+ **********************************************************************************************************************/
+
+// Pipeline processes artifact by chain of streaming stages in a single pass.
+type Pipeline struct {
+	stages []pipelineStage
+}
+
+// ArtifactDescriptor describes how artifact should be processed.
+type ArtifactDescriptor struct {
+	// FileInfo info of the artifact as it is received. Not verified if nil.
+	FileInfo *FileInfo
+	// DecryptParams artifact decryption parameters. Artifact is not encrypted if nil.
+	DecryptParams *cryptutils.DecryptParams
+	// Compression artifact compression.
+	Compression string
+	// ContentInfo info of decrypted and decompressed content. Not verified if nil.
+	ContentInfo *FileInfo
+}
+
+type pipelineStage func(ctx context.Context, reader io.Reader) (io.Reader, error)
+
+type pipelineReader struct {
+	reader  io.Reader
+	closers []io.Closer
+}
+
+type verifyReader struct {
+	reader     io.Reader
+	calculator *FileInfoCalculator
+	fileInfo   FileInfo
+}
+
+/***********************************************************************************************************************
+ * Public
+ **********************************************************************************************************************/
+
+// NewPipeline creates empty pipeline. Stages are applied in the order they are added.
+func NewPipeline() (pipeline *Pipeline) {
+	return &Pipeline{}
+}
+
+// NewArtifactPipeline creates pipeline configured from artifact descriptor: verify received artifact, decrypt,
+// decompress and verify content.
+func NewArtifactPipeline(descriptor ArtifactDescriptor) (pipeline *Pipeline) {
+	pipeline = NewPipeline()
+
+	if descriptor.FileInfo != nil {
+		pipeline.Verify(*descriptor.FileInfo)
+	}
+
+	if descriptor.DecryptParams != nil {
+		pipeline.Decrypt(*descriptor.DecryptParams)
+	}
+
+	pipeline.Decompress(descriptor.Compression)
+
+	if descriptor.ContentInfo != nil {
+		pipeline.Verify(*descriptor.ContentInfo)
+	}
+
+	return pipeline
+}
+
+// Decrypt adds AES decryption stage.
+func (pipeline *Pipeline) Decrypt(params cryptutils.DecryptParams) *Pipeline {
+	pipeline.stages = append(pipeline.stages, func(ctx context.Context, reader io.Reader) (io.Reader, error) {
+		decryptReader, err := cryptutils.NewDecryptReader(reader, params)
+		if err != nil {
+			return nil, aoserrors.Wrap(err)
+		}
+
+		return decryptReader, nil
+	})
+
+	return pipeline
+}
+
+// Decompress adds decompression stage (see NewDecompressReader).
+func (pipeline *Pipeline) Decompress(compression string) *Pipeline {
+	pipeline.stages = append(pipeline.stages, func(ctx context.Context, reader io.Reader) (io.Reader, error) {
+		return NewDecompressReader(ctx, reader, compression)
+	})
+
+	return pipeline
+}
+
+// Verify adds stage which verifies data passed through it against file info. Verification error is returned when
+// the whole data is read.
+func (pipeline *Pipeline) Verify(fileInfo FileInfo) *Pipeline {
+	pipeline.stages = append(pipeline.stages, func(ctx context.Context, reader io.Reader) (io.Reader, error) {
+		return &verifyReader{reader: reader, calculator: NewFileInfoCalculator(), fileInfo: fileInfo}, nil
+	})
+
+	return pipeline
+}
+
+// Reader returns reader which provides src data processed by pipeline stages. Reader should be closed to release
+// stages resources.
+func (pipeline *Pipeline) Reader(ctx context.Context, src io.Reader) (reader io.ReadCloser, err error) {
+	result := &pipelineReader{reader: contextreader.New(ctx, src)}
+
+	for _, stage := range pipeline.stages {
+		if result.reader, err = stage(ctx, result.reader); err != nil {
+			result.Close()
+
+			return nil, err
+		}
+
+		if closer, ok := result.reader.(io.Closer); ok {
+			result.closers = append(result.closers, closer)
+		}
+	}
+
+	return result, nil
+}
+
+// Process processes src data by pipeline stages and writes result to dst. Returns number of written bytes.
+func (pipeline *Pipeline) Process(ctx context.Context, src io.Reader, dst io.Writer) (written int64, err error) {
+	reader, err := pipeline.Reader(ctx, src)
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+
+	if written, err = io.Copy(dst, reader); err != nil {
+		return written, aoserrors.Wrap(err)
+	}
+
+	return written, nil
+}
+
+/***********************************************************************************************************************
+ * Private
+ **********************************************************************************************************************/
+
+func (reader *verifyReader) Read(data []byte) (n int, err error) {
+	n, err = reader.reader.Read(data)
+
+	// calculator Write never returns an error
+	_, _ = reader.calculator.Write(data[:n])
+
+	if errors.Is(err, io.EOF) {
+		if checkErr := reader.calculator.Check(reader.fileInfo); checkErr != nil {
+			return n, checkErr
+		}
+	}
+
+	return n, err // nolint:wrapcheck // io.Reader should return unwrapped io.EOF
+}
+
+func (reader *pipelineReader) Read(data []byte) (n int, err error) {
+	return reader.reader.Read(data) // nolint:wrapcheck // io.Reader should return unwrapped io.EOF
+}
+
+func (reader *pipelineReader) Close() (err error) {
+	for i := len(reader.closers) - 1; i >= 0; i-- {
+		if closeErr := reader.closers[i].Close(); closeErr != nil && err == nil {
+			err = aoserrors.Wrap(closeErr)
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,184 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2022 Renesas Electronics Corporation.
+// Copyright (C) 2022 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package image
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"strings"
+
+	"github.com/aoscloud/aos_common/aoserrors"
+	"github.com/aoscloud/aos_common/utils/cryptutils"
+)
+
+/***********************************************************************************************************************
+ * Consts
+ **********************************************************************************************************************/
+
+// Metadata signature algorithms.
+const (
+	SignatureRSASHA256   = "RSA/SHA256"
+	SignatureRSASHA384   = "RSA/SHA384"
+	SignatureRSASHA512   = "RSA/SHA512"
+	SignatureECDSASHA256 = "ECDSA/SHA256"
+	SignatureECDSASHA384 = "ECDSA/SHA384"
+	SignatureECDSASHA512 = "ECDSA/SHA512"
+)
+
+/***********************************************************************************************************************
+ * Types
+ **********************************************************************************************************************/
+
+// MetadataSignature detached signature of image metadata.
+type MetadataSignature struct {
+	// KeyID signer key ID: hex encoded subject key ID or SHA-256 fingerprint of signer certificate. If empty, the
+	// first certificate is used as signer.
+	KeyID string `json:"keyId,omitempty"`
+	// Algorithm signature algorithm.
+	Algorithm string `json:"alg"`
+	// Value signature value.
+	Value []byte `json:"value"`
+	// Certificates DER encoded signer and intermediate certificates.
+	Certificates [][]byte `json:"certificates"`
+}
+
+/***********************************************************************************************************************
+ * Vars
+ **********************************************************************************************************************/
+
+// nolint:gochecknoglobals
+var signatureHashes = map[string]crypto.Hash{
+	"SHA256": crypto.SHA256,
+	"SHA384": crypto.SHA384,
+	"SHA512": crypto.SHA512,
+}
+
+/***********************************************************************************************************************
+ * Public
+ **********************************************************************************************************************/
+
+// VerifyMetadataSignature verifies metadata signature. Signer certificate is selected by key ID and verified against
+// trust store using signature certificates as intermediates. Returns signer certificate.
+func VerifyMetadataSignature(
+	metadata []byte, signature MetadataSignature, trustStore *x509.CertPool) (signer *x509.Certificate, err error) {
+	certs := make([]*x509.Certificate, 0, len(signature.Certificates))
+
+	for _, data := range signature.Certificates {
+		cert, err := x509.ParseCertificate(data)
+		if err != nil {
+			return nil, aoserrors.Wrap(err)
+		}
+
+		certs = append(certs, cert)
+	}
+
+	if signer, err = findSignerCertificate(certs, signature.KeyID); err != nil {
+		return nil, err
+	}
+
+	intermediates := x509.NewCertPool()
+
+	for _, cert := range certs {
+		if cert != signer {
+			intermediates.AddCert(cert)
+		}
+	}
+
+	if _, err = signer.Verify(x509.VerifyOptions{
+		Roots:         trustStore,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	hashAlg, err := getSignatureHash(signature.Algorithm, signer.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	hashState := hashAlg.New()
+
+	// hash Write never returns an error
+	_, _ = hashState.Write(metadata)
+
+	if err = cryptutils.VerifyDigestSignature(
+		signer.PublicKey, hashAlg, hashState.Sum(nil), signature.Value); err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	return signer, nil
+}
+
+/***********************************************************************************************************************
+ * Private
+ **********************************************************************************************************************/
+
+func findSignerCertificate(certs []*x509.Certificate, keyID string) (signer *x509.Certificate, err error) {
+	if len(certs) == 0 {
+		return nil, aoserrors.New("no signature certificates")
+	}
+
+	if keyID == "" {
+		return certs[0], nil
+	}
+
+	for _, cert := range certs {
+		fingerprint := sha256.Sum256(cert.Raw)
+
+		if strings.EqualFold(keyID, hex.EncodeToString(cert.SubjectKeyId)) ||
+			strings.EqualFold(keyID, hex.EncodeToString(fingerprint[:])) {
+			return cert, nil
+		}
+	}
+
+	return nil, aoserrors.Errorf("signer certificate with key ID %s not found", keyID)
+}
+
+func getSignatureHash(algorithm string, publicKey crypto.PublicKey) (hashAlg crypto.Hash, err error) {
+	items := strings.Split(algorithm, "/")
+	if len(items) != 2 { // nolint:gomnd // key algorithm/hash algorithm
+		return 0, aoserrors.Errorf("invalid signature algorithm: %s", algorithm)
+	}
+
+	switch publicKey.(type) {
+	case *rsa.PublicKey:
+		if items[0] != "RSA" {
+			return 0, aoserrors.Errorf("signature algorithm %s doesn't match RSA key", algorithm)
+		}
+
+	case *ecdsa.PublicKey:
+		if items[0] != "ECDSA" {
+			return 0, aoserrors.Errorf("signature algorithm %s doesn't match ECDSA key", algorithm)
+		}
+
+	default:
+		return 0, aoserrors.New("unsupported public key type")
+	}
+
+	hashAlg, ok := signatureHashes[items[1]]
+	if !ok {
+		return 0, aoserrors.Errorf("unsupported signature hash algorithm: %s", items[1])
+	}
+
+	return hashAlg, nil
+}
@@ -0,0 +1,1031 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2022 Renesas Electronics Corporation.
+// Copyright (C) 2022 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package image
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/aoscloud/aos_common/aoserrors"
+)
+
+/***********************************************************************************************************************
+ * Consts
+ **********************************************************************************************************************/
+
+const (
+	squashFSMagic        = 0x73717368
+	squashFSVersionMajor = 4
+
+	squashFSCompressionGzip = 1
+
+	squashFSMinBlockSize = 4 * 1024
+	squashFSMaxBlockSize = 1024 * 1024
+
+	squashFSMetadataSize         = 8192
+	squashFSMetadataUncompressed = 0x8000
+	squashFSDataUncompressed     = 0x1000000
+	squashFSDataSizeMask         = 0xffffff
+	squashFSNoFragment           = 0xffffffff
+	squashFSFragmentsPerBlock    = squashFSMetadataSize / 16
+	squashFSIDsPerBlock          = squashFSMetadataSize / 4
+	squashFSDirListingOffset     = 3
+	squashFSMaxDirHeaderCount    = 256
+	squashFSMaxDirDepth          = 256
+)
+
+const (
+	squashFSTypeDir = iota + 1
+	squashFSTypeFile
+	squashFSTypeSymlink
+	squashFSTypeBlockDev
+	squashFSTypeCharDev
+	squashFSTypeFifo
+	squashFSTypeSocket
+	squashFSTypeExtDir
+	squashFSTypeExtFile
+	squashFSTypeExtSymlink
+	squashFSTypeExtBlockDev
+	squashFSTypeExtCharDev
+	squashFSTypeExtFifo
+	squashFSTypeExtSocket
+)
+
+/***********************************************************************************************************************
+ * Types
+ **********************************************************************************************************************/
+
+// SquashFS squashfs image reader.
+type SquashFS struct {
+	file       *os.File
+	size       int64
+	superBlock squashFSSuperBlock
+	ids        []uint32
+	fragments  []squashFSFragment
+}
+
+// SquashFSEntry squashfs image entry.
+type SquashFSEntry struct {
+	// Path entry path relative to image root.
+	Path       string
+	Mode       os.FileMode
+	UID        uint32
+	GID        uint32
+	ModTime    time.Time
+	Size       int64
+	LinkTarget string
+	Device     uint32
+
+	inode *squashFSInode
+}
+
+type squashFSSuperBlock struct {
+	Magic             uint32
+	InodeCount        uint32
+	ModTime           uint32
+	BlockSize         uint32
+	FragmentCount     uint32
+	Compression       uint16
+	BlockLog          uint16
+	Flags             uint16
+	IDCount           uint16
+	VersionMajor      uint16
+	VersionMinor      uint16
+	RootInode         uint64
+	BytesUsed         uint64
+	IDTableStart      uint64
+	XattrIDTableStart uint64
+	InodeTableStart   uint64
+	DirTableStart     uint64
+	FragmentTable     uint64
+	ExportTableStart  uint64
+}
+
+type squashFSFragment struct {
+	Start  uint64
+	Size   uint32
+	Unused uint32
+}
+
+type squashFSInodeHeader struct {
+	Type        uint16
+	Permissions uint16
+	UIDIndex    uint16
+	GIDIndex    uint16
+	ModTime     uint32
+	InodeNumber uint32
+}
+
+type squashFSInode struct {
+	squashFSInodeHeader
+
+	size        uint64
+	blocksStart uint64
+	blockSizes  []uint32
+	fragment    uint32
+	fragOffset  uint32
+	dirStart    uint32
+	dirOffset   uint16
+	linkTarget  string
+	device      uint32
+}
+
+type squashFSDirHeader struct {
+	Count       uint32
+	Start       uint32
+	InodeNumber uint32
+}
+
+type squashFSDirEntry struct {
+	Offset      uint16
+	InodeOffset int16
+	Type        uint16
+	NameSize    uint16
+}
+
+type squashFSWalker struct {
+	walkFunc    func(entry SquashFSEntry) error
+	visitedDirs map[uint32]struct{}
+}
+
+type metadataReader struct {
+	squashFS  *SquashFS
+	nextBlock int64
+	data      []byte
+}
+
+/***********************************************************************************************************************
+ * Public
+ **********************************************************************************************************************/
+
+// OpenSquashFS opens squashfs image. Only gzip compressed or uncompressed images are supported.
+func OpenSquashFS(fileName string) (squashFS *SquashFS, err error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	squashFS = &SquashFS{file: file}
+
+	defer func() {
+		if err != nil {
+			file.Close()
+		}
+	}()
+
+	if err = binary.Read(
+		io.NewSectionReader(file, 0, int64(binary.Size(squashFS.superBlock))), binary.LittleEndian,
+		&squashFS.superBlock); err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	if squashFS.superBlock.Magic != squashFSMagic {
+		return nil, aoserrors.New("not a squashfs image")
+	}
+
+	if squashFS.superBlock.VersionMajor != squashFSVersionMajor {
+		return nil, aoserrors.Errorf("unsupported squashfs version: %d.%d",
+			squashFS.superBlock.VersionMajor, squashFS.superBlock.VersionMinor)
+	}
+
+	if squashFS.superBlock.Compression != squashFSCompressionGzip {
+		return nil, aoserrors.Errorf("unsupported squashfs compression: %d", squashFS.superBlock.Compression)
+	}
+
+	if err = squashFS.validateSuperBlock(); err != nil {
+		return nil, err
+	}
+
+	if squashFS.ids, err = squashFS.readIDTable(); err != nil {
+		return nil, err
+	}
+
+	if squashFS.fragments, err = squashFS.readFragmentTable(); err != nil {
+		return nil, err
+	}
+
+	return squashFS, nil
+}
+
+// Close closes squashfs image.
+func (squashFS *SquashFS) Close() (err error) {
+	return aoserrors.Wrap(squashFS.file.Close())
+}
+
+// Walk walks image entries in lexical order. Directory entry is reported before its content.
+func (squashFS *SquashFS) Walk(walkFunc func(entry SquashFSEntry) error) (err error) {
+	root, err := squashFS.readInode(squashFS.superBlock.RootInode)
+	if err != nil {
+		return err
+	}
+
+	rootEntry, err := squashFS.createEntry("/", root)
+	if err != nil {
+		return err
+	}
+
+	if err = walkFunc(rootEntry); err != nil {
+		return err
+	}
+
+	walker := &squashFSWalker{walkFunc: walkFunc, visitedDirs: make(map[uint32]struct{})}
+
+	return squashFS.walkDir(walker, "/", root, 0)
+}
+
+// List returns all image entries.
+func (squashFS *SquashFS) List() (entries []SquashFSEntry, err error) {
+	if err = squashFS.Walk(func(entry SquashFSEntry) error {
+		entries = append(entries, entry)
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// WriteFile writes regular file content to writer.
+func (squashFS *SquashFS) WriteFile(ctx context.Context, entry SquashFSEntry, writer io.Writer) (err error) {
+	if entry.inode == nil || !entry.Mode.IsRegular() {
+		return aoserrors.Errorf("not a regular file: %s", entry.Path)
+	}
+
+	inode := entry.inode
+	position := int64(inode.blocksStart)
+	remaining := int64(inode.size)
+	blockSize := int64(squashFS.superBlock.BlockSize)
+
+	for _, size := range inode.blockSizes {
+		if ctx.Err() != nil {
+			return aoserrors.Wrap(ctx.Err())
+		}
+
+		var data []byte
+
+		if size&squashFSDataSizeMask == 0 {
+			// Sparse block
+			data = make([]byte, minInt64(blockSize, remaining))
+		} else if data, err = squashFS.readDataBlock(position, size); err != nil {
+			return err
+		}
+
+		position += int64(size & squashFSDataSizeMask)
+
+		if int64(len(data)) > remaining {
+			data = data[:remaining]
+		}
+
+		if _, err = writer.Write(data); err != nil {
+			return aoserrors.Wrap(err)
+		}
+
+		remaining -= int64(len(data))
+	}
+
+	if inode.fragment != squashFSNoFragment && remaining > 0 {
+		if int(inode.fragment) >= len(squashFS.fragments) {
+			return aoserrors.Errorf("wrong fragment index: %d", inode.fragment)
+		}
+
+		fragment := squashFS.fragments[inode.fragment]
+
+		data, err := squashFS.readDataBlock(int64(fragment.Start), fragment.Size)
+		if err != nil {
+			return err
+		}
+
+		if int64(inode.fragOffset)+remaining > int64(len(data)) {
+			return aoserrors.New("wrong fragment offset")
+		}
+
+		if _, err = writer.Write(data[inode.fragOffset : int64(inode.fragOffset)+remaining]); err != nil {
+			return aoserrors.Wrap(err)
+		}
+
+		remaining = 0
+	}
+
+	if remaining != 0 {
+		return aoserrors.Errorf("file data is truncated: %s", entry.Path)
+	}
+
+	return nil
+}
+
+// Extract extracts image content to destination folder. Owner is restored only if called by root.
+func (squashFS *SquashFS) Extract(ctx context.Context, destination string) (err error) {
+	var (
+		dirs      []SquashFSEntry
+		hardLinks = make(map[uint32]string)
+	)
+
+	if err = squashFS.Walk(func(entry SquashFSEntry) error {
+		if ctx.Err() != nil {
+			return aoserrors.Wrap(ctx.Err())
+		}
+
+		itemPath, err := getItemPath(destination, entry.Path)
+		if err != nil {
+			return err
+		}
+
+		if err = checkNoSymlinks(destination, itemPath); err != nil {
+			return err
+		}
+
+		if entry.Mode.IsDir() {
+			dirs = append(dirs, entry)
+		}
+
+		if linkPath, ok := hardLinks[entry.inode.InodeNumber]; ok {
+			return aoserrors.Wrap(os.Link(linkPath, itemPath))
+		}
+
+		if err = squashFS.extractEntry(ctx, entry, itemPath); err != nil {
+			return err
+		}
+
+		if entry.Mode.IsRegular() {
+			hardLinks[entry.inode.InodeNumber] = itemPath
+		}
+
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	// Set directories attributes at the end as extracting content changes directory modification time
+	for i := len(dirs) - 1; i >= 0; i-- {
+		itemPath, err := getItemPath(destination, dirs[i].Path)
+		if err != nil {
+			return err
+		}
+
+		if err = setEntryAttributes(dirs[i], itemPath); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ExtractSquashFS extracts squashfs image to destination folder.
+func ExtractSquashFS(ctx context.Context, source, destination string) (err error) {
+	if _, err = os.Stat(destination); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	squashFS, err := OpenSquashFS(source)
+	if err != nil {
+		return err
+	}
+	defer squashFS.Close()
+
+	return squashFS.Extract(ctx, destination)
+}
+
+/***********************************************************************************************************************
+ * Private
+ **********************************************************************************************************************/
+
+func (squashFS *SquashFS) validateSuperBlock() (err error) {
+	info, err := squashFS.file.Stat()
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	squashFS.size = info.Size()
+
+	blockSize := squashFS.superBlock.BlockSize
+
+	if blockSize < squashFSMinBlockSize || blockSize > squashFSMaxBlockSize || blockSize&(blockSize-1) != 0 ||
+		uint32(1)<<squashFS.superBlock.BlockLog != blockSize {
+		return aoserrors.Errorf("wrong squashfs block size: %d, block log: %d", blockSize, squashFS.superBlock.BlockLog)
+	}
+
+	if squashFS.superBlock.BytesUsed > uint64(squashFS.size) {
+		return aoserrors.Errorf("squashfs image is truncated: %d bytes used, %d bytes available",
+			squashFS.superBlock.BytesUsed, squashFS.size)
+	}
+
+	// Each fragment entry takes 16 bytes in the image
+	if uint64(squashFS.superBlock.FragmentCount)*16 > uint64(squashFS.size) {
+		return aoserrors.Errorf("wrong squashfs fragment count: %d", squashFS.superBlock.FragmentCount)
+	}
+
+	return nil
+}
+
+func (squashFS *SquashFS) readIDTable() (ids []uint32, err error) {
+	count := int(squashFS.superBlock.IDCount)
+	ids = make([]uint32, count)
+
+	if err = squashFS.readLookupTable(
+		int64(squashFS.superBlock.IDTableStart), (count+squashFSIDsPerBlock-1)/squashFSIDsPerBlock, ids); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+func (squashFS *SquashFS) readFragmentTable() (fragments []squashFSFragment, err error) {
+	count := int(squashFS.superBlock.FragmentCount)
+	if count == 0 {
+		return nil, nil
+	}
+
+	fragments = make([]squashFSFragment, count)
+
+	if err = squashFS.readLookupTable(int64(squashFS.superBlock.FragmentTable),
+		(count+squashFSFragmentsPerBlock-1)/squashFSFragmentsPerBlock, fragments); err != nil {
+		return nil, err
+	}
+
+	return fragments, nil
+}
+
+func (squashFS *SquashFS) readLookupTable(tableStart int64, blockCount int, data interface{}) (err error) {
+	if blockCount == 0 {
+		return nil
+	}
+
+	blocks := make([]uint64, blockCount)
+
+	if err = binary.Read(io.NewSectionReader(squashFS.file, tableStart, int64(blockCount*8)), binary.LittleEndian,
+		blocks); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	// Table entries are stored in consecutive metadata blocks starting from first block
+	if err = binary.Read(squashFS.newMetadataReader(int64(blocks[0])), binary.LittleEndian, data); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	return nil
+}
+
+func (squashFS *SquashFS) newMetadataReader(blockStart int64) (reader *metadataReader) {
+	return &metadataReader{squashFS: squashFS, nextBlock: blockStart}
+}
+
+func (squashFS *SquashFS) newMetadataReaderAt(blockStart int64, offset int) (reader *metadataReader, err error) {
+	reader = squashFS.newMetadataReader(blockStart)
+
+	if _, err = io.CopyN(ioutil.Discard, reader, int64(offset)); err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	return reader, nil
+}
+
+func (reader *metadataReader) Read(data []byte) (n int, err error) {
+	if len(reader.data) == 0 {
+		if reader.data, reader.nextBlock, err = reader.squashFS.readMetadataBlock(reader.nextBlock); err != nil {
+			return 0, err
+		}
+	}
+
+	n = copy(data, reader.data)
+	reader.data = reader.data[n:]
+
+	return n, nil
+}
+
+func (squashFS *SquashFS) readMetadataBlock(position int64) (data []byte, nextBlock int64, err error) {
+	var header uint16
+
+	if err = binary.Read(io.NewSectionReader(squashFS.file, position, 2), binary.LittleEndian, &header); err != nil {
+		return nil, 0, aoserrors.Wrap(err)
+	}
+
+	size := int64(header &^ squashFSMetadataUncompressed)
+
+	if data, err = squashFS.readBlock(
+		position+2, size, header&squashFSMetadataUncompressed == 0, squashFSMetadataSize); err != nil {
+		return nil, 0, err
+	}
+
+	return data, position + 2 + size, nil
+}
+
+func (squashFS *SquashFS) readDataBlock(position int64, size uint32) (data []byte, err error) {
+	return squashFS.readBlock(position, int64(size&squashFSDataSizeMask), size&squashFSDataUncompressed == 0,
+		int64(squashFS.superBlock.BlockSize))
+}
+
+func (squashFS *SquashFS) readBlock(position, size int64, compressed bool, maxSize int64) (data []byte, err error) {
+	if position < 0 || position+size > squashFS.size {
+		return nil, aoserrors.Errorf("block is out of image: position %d, size %d", position, size)
+	}
+
+	data = make([]byte, size)
+
+	if _, err = squashFS.file.ReadAt(data, position); err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	if !compressed {
+		return data, nil
+	}
+
+	zlibReader, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+	defer zlibReader.Close()
+
+	if data, err = ioutil.ReadAll(io.LimitReader(zlibReader, maxSize)); err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	return data, nil
+}
+
+func (squashFS *SquashFS) readInode(ref uint64) (inode *squashFSInode, err error) {
+	reader, err := squashFS.newMetadataReaderAt(
+		int64(squashFS.superBlock.InodeTableStart+ref>>16), int(ref&0xffff)) // nolint:gomnd // inode ref format
+	if err != nil {
+		return nil, err
+	}
+
+	inode = &squashFSInode{fragment: squashFSNoFragment}
+
+	if err = binary.Read(reader, binary.LittleEndian, &inode.squashFSInodeHeader); err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	switch inode.Type {
+	case squashFSTypeDir:
+		err = inode.readDir(reader)
+
+	case squashFSTypeExtDir:
+		err = inode.readExtDir(reader)
+
+	case squashFSTypeFile:
+		err = inode.readFile(reader, squashFS.superBlock.BlockSize, squashFS.size)
+
+	case squashFSTypeExtFile:
+		err = inode.readExtFile(reader, squashFS.superBlock.BlockSize, squashFS.size)
+
+	case squashFSTypeSymlink, squashFSTypeExtSymlink:
+		err = inode.readSymlink(reader, squashFS.size)
+
+	case squashFSTypeBlockDev, squashFSTypeCharDev, squashFSTypeExtBlockDev, squashFSTypeExtCharDev:
+		err = inode.readDevice(reader)
+
+	case squashFSTypeFifo, squashFSTypeSocket, squashFSTypeExtFifo, squashFSTypeExtSocket:
+
+	default:
+		err = aoserrors.Errorf("unsupported inode type: %d", inode.Type)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return inode, nil
+}
+
+func (inode *squashFSInode) readDir(reader io.Reader) (err error) {
+	var dir struct {
+		BlockStart  uint32
+		LinkCount   uint32
+		Size        uint16
+		BlockOffset uint16
+		ParentInode uint32
+	}
+
+	if err = binary.Read(reader, binary.LittleEndian, &dir); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	inode.dirStart, inode.dirOffset, inode.size = dir.BlockStart, dir.BlockOffset, uint64(dir.Size)
+
+	return nil
+}
+
+func (inode *squashFSInode) readExtDir(reader io.Reader) (err error) {
+	var dir struct {
+		LinkCount   uint32
+		Size        uint32
+		BlockStart  uint32
+		ParentInode uint32
+		IndexCount  uint16
+		BlockOffset uint16
+		XattrIndex  uint32
+	}
+
+	if err = binary.Read(reader, binary.LittleEndian, &dir); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	inode.dirStart, inode.dirOffset, inode.size = dir.BlockStart, dir.BlockOffset, uint64(dir.Size)
+
+	return nil
+}
+
+func (inode *squashFSInode) readFile(reader io.Reader, blockSize uint32, imageSize int64) (err error) {
+	var file struct {
+		BlocksStart uint32
+		Fragment    uint32
+		FragOffset  uint32
+		Size        uint32
+	}
+
+	if err = binary.Read(reader, binary.LittleEndian, &file); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	inode.blocksStart, inode.fragment, inode.fragOffset, inode.size = uint64(file.BlocksStart), file.Fragment,
+		file.FragOffset, uint64(file.Size)
+
+	return inode.readBlockSizes(reader, blockSize, imageSize)
+}
+
+func (inode *squashFSInode) readExtFile(reader io.Reader, blockSize uint32, imageSize int64) (err error) {
+	var file struct {
+		BlocksStart uint64
+		Size        uint64
+		Sparse      uint64
+		LinkCount   uint32
+		Fragment    uint32
+		FragOffset  uint32
+		XattrIndex  uint32
+	}
+
+	if err = binary.Read(reader, binary.LittleEndian, &file); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	inode.blocksStart, inode.fragment, inode.fragOffset, inode.size = file.BlocksStart, file.Fragment,
+		file.FragOffset, file.Size
+
+	return inode.readBlockSizes(reader, blockSize, imageSize)
+}
+
+func (inode *squashFSInode) readBlockSizes(reader io.Reader, blockSize uint32, imageSize int64) (err error) {
+	count := inode.size / uint64(blockSize)
+
+	if inode.fragment == squashFSNoFragment && inode.size%uint64(blockSize) != 0 {
+		count++
+	}
+
+	// Each block size takes 4 bytes in the image
+	if count*4 > uint64(imageSize) {
+		return aoserrors.Errorf("wrong file size: %d", inode.size)
+	}
+
+	inode.blockSizes = make([]uint32, count)
+
+	if err = binary.Read(reader, binary.LittleEndian, inode.blockSizes); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	return nil
+}
+
+func (inode *squashFSInode) readSymlink(reader io.Reader, imageSize int64) (err error) {
+	var symlink struct {
+		LinkCount  uint32
+		TargetSize uint32
+	}
+
+	if err = binary.Read(reader, binary.LittleEndian, &symlink); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	if int64(symlink.TargetSize) > imageSize {
+		return aoserrors.Errorf("wrong symlink target size: %d", symlink.TargetSize)
+	}
+
+	target := make([]byte, symlink.TargetSize)
+
+	if _, err = io.ReadFull(reader, target); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	inode.linkTarget, inode.size = string(target), uint64(symlink.TargetSize)
+
+	return nil
+}
+
+func (inode *squashFSInode) readDevice(reader io.Reader) (err error) {
+	var device struct {
+		LinkCount uint32
+		Device    uint32
+	}
+
+	if err = binary.Read(reader, binary.LittleEndian, &device); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	inode.device = device.Device
+
+	return nil
+}
+
+func (squashFS *SquashFS) walkDir(walker *squashFSWalker, dirPath string, dir *squashFSInode, depth int) (err error) {
+	if depth > squashFSMaxDirDepth {
+		return aoserrors.Errorf("directory depth exceeds limit: %s", dirPath)
+	}
+
+	// Directory can't be referenced twice in valid image: it would create loop
+	if _, ok := walker.visitedDirs[dir.InodeNumber]; ok {
+		return aoserrors.Errorf("directory loop detected: %s", dirPath)
+	}
+
+	walker.visitedDirs[dir.InodeNumber] = struct{}{}
+
+	if dir.size <= squashFSDirListingOffset {
+		return nil
+	}
+
+	reader, err := squashFS.newMetadataReaderAt(
+		int64(squashFS.superBlock.DirTableStart)+int64(dir.dirStart), int(dir.dirOffset))
+	if err != nil {
+		return err
+	}
+
+	listing := io.LimitReader(reader, int64(dir.size-squashFSDirListingOffset))
+
+	for {
+		var header squashFSDirHeader
+
+		if err = binary.Read(listing, binary.LittleEndian, &header); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+
+			return aoserrors.Wrap(err)
+		}
+
+		if header.Count >= squashFSMaxDirHeaderCount {
+			return aoserrors.Errorf("wrong directory header count: %d", header.Count)
+		}
+
+		for i := uint32(0); i <= header.Count; i++ {
+			var dirEntry squashFSDirEntry
+
+			if err = binary.Read(listing, binary.LittleEndian, &dirEntry); err != nil {
+				return aoserrors.Wrap(err)
+			}
+
+			name := make([]byte, int(dirEntry.NameSize)+1)
+
+			if _, err = io.ReadFull(listing, name); err != nil {
+				return aoserrors.Wrap(err)
+			}
+
+			if err = validateEntryName(string(name)); err != nil {
+				return err
+			}
+
+			if err = squashFS.walkDirEntry(walker, path.Join(dirPath, string(name)),
+				uint64(header.Start)<<16|uint64(dirEntry.Offset), depth); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (squashFS *SquashFS) walkDirEntry(walker *squashFSWalker, entryPath string, ref uint64, depth int) (err error) {
+	inode, err := squashFS.readInode(ref)
+	if err != nil {
+		return err
+	}
+
+	entry, err := squashFS.createEntry(entryPath, inode)
+	if err != nil {
+		return err
+	}
+
+	if err = walker.walkFunc(entry); err != nil {
+		return err
+	}
+
+	if entry.Mode.IsDir() {
+		return squashFS.walkDir(walker, entryPath, inode, depth+1)
+	}
+
+	return nil
+}
+
+// checkNoSymlinks checks that item path components inside destination are not symlinks, so extracted entry can't
+// be written outside of destination.
+func checkNoSymlinks(destination, itemPath string) (err error) {
+	relPath, err := filepath.Rel(destination, itemPath)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	if relPath == "." {
+		return nil
+	}
+
+	if relPath == ".." || strings.HasPrefix(relPath, "../") {
+		return aoserrors.Errorf("item path is outside of destination: %s", itemPath)
+	}
+
+	currentPath := destination
+
+	for _, component := range strings.Split(relPath, "/") {
+		currentPath = filepath.Join(currentPath, component)
+
+		info, err := os.Lstat(currentPath)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+
+			return aoserrors.Wrap(err)
+		}
+
+		if info.Mode()&os.ModeSymlink != 0 {
+			return aoserrors.Errorf("item path contains symlink: %s", currentPath)
+		}
+	}
+
+	return nil
+}
+
+func validateEntryName(name string) (err error) {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, "/\x00") {
+		return aoserrors.Errorf("illegal entry name: %q", name)
+	}
+
+	return nil
+}
+
+func (squashFS *SquashFS) createEntry(entryPath string, inode *squashFSInode) (entry SquashFSEntry, err error) {
+	if int(inode.UIDIndex) >= len(squashFS.ids) || int(inode.GIDIndex) >= len(squashFS.ids) {
+		return entry, aoserrors.New("wrong inode id index")
+	}
+
+	entry = SquashFSEntry{
+		Path:       entryPath,
+		Mode:       getSquashFSFileMode(inode.Type, inode.Permissions),
+		UID:        squashFS.ids[inode.UIDIndex],
+		GID:        squashFS.ids[inode.GIDIndex],
+		ModTime:    time.Unix(int64(inode.ModTime), 0),
+		LinkTarget: inode.linkTarget,
+		Device:     inode.device,
+		inode:      inode,
+	}
+
+	if entry.Mode.IsRegular() {
+		entry.Size = int64(inode.size)
+	}
+
+	return entry, nil
+}
+
+func (squashFS *SquashFS) extractEntry(ctx context.Context, entry SquashFSEntry, itemPath string) (err error) {
+	switch {
+	case entry.Mode.IsDir():
+		if err = os.MkdirAll(itemPath, entry.Mode.Perm()); err != nil {
+			return aoserrors.Wrap(err)
+		}
+
+		return nil
+
+	case entry.Mode.IsRegular():
+		file, err := os.OpenFile(itemPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY|syscall.O_NOFOLLOW, entry.Mode.Perm())
+		if err != nil {
+			return aoserrors.Wrap(err)
+		}
+		defer file.Close()
+
+		if err = squashFS.WriteFile(ctx, entry, file); err != nil {
+			return err
+		}
+
+	case entry.Mode&os.ModeSymlink != 0:
+		if err = os.Symlink(entry.LinkTarget, itemPath); err != nil {
+			return aoserrors.Wrap(err)
+		}
+
+	default:
+		if err = syscall.Mknod(itemPath, getUnixMode(entry.Mode), int(entry.Device)); err != nil {
+			return aoserrors.Wrap(err)
+		}
+	}
+
+	return setEntryAttributes(entry, itemPath)
+}
+
+func setEntryAttributes(entry SquashFSEntry, itemPath string) (err error) {
+	if os.Geteuid() == 0 {
+		if err = os.Lchown(itemPath, int(entry.UID), int(entry.GID)); err != nil {
+			return aoserrors.Wrap(err)
+		}
+	}
+
+	if entry.Mode&os.ModeSymlink != 0 {
+		return nil
+	}
+
+	// Chmod is required to restore mode cleared by umask and special bits
+	if err = os.Chmod(itemPath, entry.Mode&(os.ModePerm|os.ModeSetuid|os.ModeSetgid|os.ModeSticky)); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	if err = os.Chtimes(itemPath, entry.ModTime, entry.ModTime); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	return nil
+}
+
+func getSquashFSFileMode(inodeType, permissions uint16) (mode os.FileMode) {
+	mode = os.FileMode(permissions) & os.ModePerm
+
+	if permissions&syscall.S_ISUID != 0 {
+		mode |= os.ModeSetuid
+	}
+
+	if permissions&syscall.S_ISGID != 0 {
+		mode |= os.ModeSetgid
+	}
+
+	if permissions&syscall.S_ISVTX != 0 {
+		mode |= os.ModeSticky
+	}
+
+	switch inodeType {
+	case squashFSTypeDir, squashFSTypeExtDir:
+		mode |= os.ModeDir
+
+	case squashFSTypeSymlink, squashFSTypeExtSymlink:
+		mode |= os.ModeSymlink
+
+	case squashFSTypeBlockDev, squashFSTypeExtBlockDev:
+		mode |= os.ModeDevice
+
+	case squashFSTypeCharDev, squashFSTypeExtCharDev:
+		mode |= os.ModeDevice | os.ModeCharDevice
+
+	case squashFSTypeFifo, squashFSTypeExtFifo:
+		mode |= os.ModeNamedPipe
+
+	case squashFSTypeSocket, squashFSTypeExtSocket:
+		mode |= os.ModeSocket
+	}
+
+	return mode
+}
+
+func getUnixMode(mode os.FileMode) (unixMode uint32) {
+	unixMode = uint32(mode.Perm())
+
+	switch {
+	case mode&os.ModeCharDevice != 0:
+		unixMode |= syscall.S_IFCHR
+
+	case mode&os.ModeDevice != 0:
+		unixMode |= syscall.S_IFBLK
+
+	case mode&os.ModeNamedPipe != 0:
+		unixMode |= syscall.S_IFIFO
+
+	case mode&os.ModeSocket != 0:
+		unixMode |= syscall.S_IFSOCK
+	}
+
+	return unixMode
+}
+
+func minInt64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+
+	return b
+}
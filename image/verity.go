@@ -0,0 +1,469 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2022 Renesas Electronics Corporation.
+// Copyright (C) 2022 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package image
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"hash"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/aoscloud/aos_common/aoserrors"
+	"github.com/aoscloud/aos_common/utils/contextreader"
+)
+
+/***********************************************************************************************************************
+ * Consts
+ **********************************************************************************************************************/
+
+// Verity hash algorithms.
+const (
+	VerityHashSHA256 = "sha256"
+	VerityHashSHA512 = "sha512"
+)
+
+const (
+	// DefaultVerityBlockSize default verity data and hash block size.
+	DefaultVerityBlockSize = 4096
+	// DefaultVeritySaltSize default verity salt size.
+	DefaultVeritySaltSize = 32
+)
+
+const (
+	veritySignature      = "verity\x00\x00"
+	veritySuperblockSize = 512
+	verityVersion        = 1
+	verityHashType       = 1
+	verityMaxSaltSize    = 256
+	verityAlgorithmSize  = 32
+	verityFilePerm       = 0o600
+)
+
+/***********************************************************************************************************************
+ * Types
+ **********************************************************************************************************************/
+
+// VerityOptions dm-verity hash tree options. Defaults match veritysetup defaults.
+type VerityOptions struct {
+	// HashAlgorithm hash algorithm: VerityHashSHA256 (default) or VerityHashSHA512.
+	HashAlgorithm string
+	// DataBlockSize data block size. DefaultVerityBlockSize is used if not set.
+	DataBlockSize int
+	// HashBlockSize hash block size. DefaultVerityBlockSize is used if not set.
+	HashBlockSize int
+	// DataBlocks number of data blocks to protect. Whole data file is used if not set.
+	DataBlocks int64
+	// Salt salt. Random salt of DefaultVeritySaltSize is generated if nil.
+	Salt []byte
+	// HashOffset offset of hash area in hash file. Allows to put hash tree into the same file after data.
+	HashOffset int64
+	// NoSuperblock don't write (on generation) or read (on verification) verity superblock.
+	NoSuperblock bool
+}
+
+// VerityInfo generated hash tree info required to set up dm-verity device.
+type VerityInfo struct {
+	RootHash      []byte
+	Salt          []byte
+	HashAlgorithm string
+	DataBlockSize int
+	HashBlockSize int
+	DataBlocks    int64
+	// HashOffset offset of hash tree in hash file (without superblock).
+	HashOffset int64
+	// HashSize size of hash area including superblock.
+	HashSize int64
+}
+
+type verityParams struct {
+	newHash       func() hash.Hash
+	salt          []byte
+	dataBlockSize int
+	hashBlockSize int
+	dataBlocks    int64
+}
+
+type veritySuperblock struct {
+	Signature     [8]byte
+	Version       uint32
+	HashType      uint32
+	UUID          [16]byte
+	Algorithm     [verityAlgorithmSize]byte
+	DataBlockSize uint32
+	HashBlockSize uint32
+	DataBlocks    uint64
+	SaltSize      uint16
+	Pad1          [6]byte
+	Salt          [verityMaxSaltSize]byte
+	Pad2          [168]byte
+}
+
+/***********************************************************************************************************************
+ * Public
+ **********************************************************************************************************************/
+
+// GenerateVerity generates dm-verity hash tree (format 1) of data file and writes it to hash file. Hash file may be
+// the same as data file if hash offset is beyond protected data. Generated hash tree is compatible with veritysetup.
+func GenerateVerity(ctx context.Context, dataFile, hashFile string, opts VerityOptions) (info VerityInfo, err error) {
+	if opts, err = prepareVerityOptions(opts, dataFile); err != nil {
+		return info, err
+	}
+
+	if opts.Salt == nil {
+		opts.Salt = make([]byte, DefaultVeritySaltSize)
+
+		if _, err = rand.Read(opts.Salt); err != nil {
+			return info, aoserrors.Wrap(err)
+		}
+	}
+
+	params, err := newVerityParams(opts)
+	if err != nil {
+		return info, err
+	}
+
+	levels, rootHash, err := calculateVerityTree(ctx, dataFile, params)
+	if err != nil {
+		return info, err
+	}
+
+	info = VerityInfo{
+		RootHash:      rootHash,
+		Salt:          opts.Salt,
+		HashAlgorithm: opts.HashAlgorithm,
+		DataBlockSize: opts.DataBlockSize,
+		HashBlockSize: opts.HashBlockSize,
+		DataBlocks:    opts.DataBlocks,
+		HashOffset:    verityTreeOffset(opts),
+	}
+
+	file, err := os.OpenFile(hashFile, os.O_CREATE|os.O_WRONLY, verityFilePerm)
+	if err != nil {
+		return info, aoserrors.Wrap(err)
+	}
+	defer file.Close()
+
+	if !opts.NoSuperblock {
+		if _, err = file.WriteAt(createVeritySuperblock(opts), opts.HashOffset); err != nil {
+			return info, aoserrors.Wrap(err)
+		}
+	}
+
+	offset := info.HashOffset
+
+	// Levels are stored from the top one
+	for i := len(levels) - 1; i >= 0; i-- {
+		if _, err = file.WriteAt(levels[i], offset); err != nil {
+			return info, aoserrors.Wrap(err)
+		}
+
+		offset += int64(len(levels[i]))
+	}
+
+	if err = file.Sync(); err != nil {
+		return info, aoserrors.Wrap(err)
+	}
+
+	info.HashSize = offset - opts.HashOffset
+
+	return info, aoserrors.Wrap(file.Close())
+}
+
+// VerifyVerity verifies data file against dm-verity hash tree stored in hash file and root hash. If superblock is
+// used, verity parameters are read from it.
+func VerifyVerity(ctx context.Context, dataFile, hashFile string, rootHash []byte, opts VerityOptions) (err error) {
+	file, err := os.Open(hashFile)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+	defer file.Close()
+
+	if !opts.NoSuperblock {
+		if opts, err = readVeritySuperblock(file, opts); err != nil {
+			return err
+		}
+	}
+
+	if opts, err = prepareVerityOptions(opts, dataFile); err != nil {
+		return err
+	}
+
+	params, err := newVerityParams(opts)
+	if err != nil {
+		return err
+	}
+
+	levels, calculatedRootHash, err := calculateVerityTree(ctx, dataFile, params)
+	if err != nil {
+		return err
+	}
+
+	offset := verityTreeOffset(opts)
+
+	for i := len(levels) - 1; i >= 0; i-- {
+		storedLevel := make([]byte, len(levels[i]))
+
+		if _, err = file.ReadAt(storedLevel, offset); err != nil {
+			return aoserrors.Wrap(err)
+		}
+
+		if !bytes.Equal(storedLevel, levels[i]) {
+			return aoserrors.New("verity hash tree mismatch")
+		}
+
+		offset += int64(len(levels[i]))
+	}
+
+	if !bytes.Equal(calculatedRootHash, rootHash) {
+		return aoserrors.New("verity root hash mismatch")
+	}
+
+	return nil
+}
+
+/***********************************************************************************************************************
+ * Private
+ **********************************************************************************************************************/
+
+func prepareVerityOptions(opts VerityOptions, dataFile string) (preparedOpts VerityOptions, err error) {
+	if opts.HashAlgorithm == "" {
+		opts.HashAlgorithm = VerityHashSHA256
+	}
+
+	if opts.DataBlockSize == 0 {
+		opts.DataBlockSize = DefaultVerityBlockSize
+	}
+
+	if opts.HashBlockSize == 0 {
+		opts.HashBlockSize = DefaultVerityBlockSize
+	}
+
+	if !isPowerOfTwo(opts.DataBlockSize) || !isPowerOfTwo(opts.HashBlockSize) ||
+		opts.HashBlockSize < veritySuperblockSize {
+		return opts, aoserrors.New("invalid verity block size")
+	}
+
+	if len(opts.Salt) > verityMaxSaltSize {
+		return opts, aoserrors.New("verity salt is too long")
+	}
+
+	if opts.DataBlocks == 0 {
+		stat, err := os.Stat(dataFile)
+		if err != nil {
+			return opts, aoserrors.Wrap(err)
+		}
+
+		// Data file may contain hash tree, use file size only if hash offset is not set
+		size := stat.Size()
+		if opts.HashOffset != 0 && opts.HashOffset < size {
+			size = opts.HashOffset
+		}
+
+		if size%int64(opts.DataBlockSize) != 0 {
+			return opts, aoserrors.New("data size is not multiple of verity data block size")
+		}
+
+		opts.DataBlocks = size / int64(opts.DataBlockSize)
+	}
+
+	if opts.DataBlocks <= 0 {
+		return opts, aoserrors.New("no verity data blocks")
+	}
+
+	return opts, nil
+}
+
+func newVerityParams(opts VerityOptions) (params verityParams, err error) {
+	params = verityParams{
+		salt: opts.Salt, dataBlockSize: opts.DataBlockSize, hashBlockSize: opts.HashBlockSize,
+		dataBlocks: opts.DataBlocks,
+	}
+
+	switch opts.HashAlgorithm {
+	case VerityHashSHA256:
+		params.newHash = sha256.New
+
+	case VerityHashSHA512:
+		params.newHash = sha512.New
+
+	default:
+		return params, aoserrors.Errorf("unsupported verity hash algorithm: %s", opts.HashAlgorithm)
+	}
+
+	if params.newHash().Size() > opts.HashBlockSize {
+		return params, aoserrors.New("verity hash block size is too small")
+	}
+
+	return params, nil
+}
+
+func verityTreeOffset(opts VerityOptions) (offset int64) {
+	if opts.NoSuperblock {
+		return opts.HashOffset
+	}
+
+	hashBlockSize := int64(opts.HashBlockSize)
+
+	return (opts.HashOffset + veritySuperblockSize + hashBlockSize - 1) / hashBlockSize * hashBlockSize
+}
+
+// calculateVerityTree returns hash tree levels starting from the level which hashes data blocks.
+func calculateVerityTree(
+	ctx context.Context, dataFile string, params verityParams) (levels [][]byte, rootHash []byte, err error) {
+	file, err := os.Open(dataFile)
+	if err != nil {
+		return nil, nil, aoserrors.Wrap(err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReaderSize(contextreader.New(ctx, file), params.dataBlockSize)
+
+	// Single data block is hashed directly without hash tree
+	if params.dataBlocks == 1 {
+		block := make([]byte, params.dataBlockSize)
+
+		if _, err = io.ReadFull(reader, block); err != nil {
+			return nil, nil, aoserrors.Wrap(err)
+		}
+
+		return nil, params.hashBlock(block), nil
+	}
+
+	level, err := params.hashLevel(reader, params.dataBlockSize, params.dataBlocks)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	levels = append(levels, level)
+
+	for len(level) > params.hashBlockSize {
+		if level, err = params.hashLevel(bytes.NewReader(level), params.hashBlockSize,
+			int64(len(level)/params.hashBlockSize)); err != nil {
+			return nil, nil, err
+		}
+
+		levels = append(levels, level)
+	}
+
+	return levels, params.hashBlock(level), nil
+}
+
+func (params verityParams) hashLevel(reader io.Reader, blockSize int, blocks int64) (level []byte, err error) {
+	digestSize := params.newHash().Size()
+	hashesPerBlock := int64(params.hashBlockSize / digestSize)
+	levelBlocks := (blocks + hashesPerBlock - 1) / hashesPerBlock
+
+	level = make([]byte, 0, levelBlocks*int64(params.hashBlockSize))
+	block := make([]byte, blockSize)
+
+	for i := int64(0); i < blocks; i++ {
+		if _, err = io.ReadFull(reader, block); err != nil {
+			return nil, aoserrors.Wrap(err)
+		}
+
+		level = append(level, params.hashBlock(block)...)
+
+		// Pad hash block with zeros
+		if remainder := len(level) % params.hashBlockSize; remainder != 0 &&
+			((i+1)%hashesPerBlock == 0 || i == blocks-1) {
+			level = append(level, make([]byte, params.hashBlockSize-remainder)...)
+		}
+	}
+
+	return level, nil
+}
+
+func (params verityParams) hashBlock(block []byte) (digest []byte) {
+	hashState := params.newHash()
+
+	// hash Write never returns an error
+	_, _ = hashState.Write(params.salt)
+	_, _ = hashState.Write(block)
+
+	return hashState.Sum(nil)
+}
+
+func createVeritySuperblock(opts VerityOptions) (data []byte) {
+	superblock := veritySuperblock{
+		Version:       verityVersion,
+		HashType:      verityHashType,
+		DataBlockSize: uint32(opts.DataBlockSize),
+		HashBlockSize: uint32(opts.HashBlockSize),
+		DataBlocks:    uint64(opts.DataBlocks),
+		SaltSize:      uint16(len(opts.Salt)),
+	}
+
+	copy(superblock.Signature[:], veritySignature)
+	copy(superblock.Algorithm[:], opts.HashAlgorithm)
+	copy(superblock.Salt[:], opts.Salt)
+
+	// UUID is used by veritysetup to identify hash device only
+	_, _ = rand.Read(superblock.UUID[:])
+
+	buffer := bytes.NewBuffer(make([]byte, 0, veritySuperblockSize))
+
+	// Write to bytes buffer never fails
+	_ = binary.Write(buffer, binary.LittleEndian, &superblock)
+
+	return buffer.Bytes()
+}
+
+func readVeritySuperblock(file *os.File, opts VerityOptions) (superblockOpts VerityOptions, err error) {
+	data := make([]byte, veritySuperblockSize)
+
+	if _, err = file.ReadAt(data, opts.HashOffset); err != nil {
+		return opts, aoserrors.Wrap(err)
+	}
+
+	var superblock veritySuperblock
+
+	if err = binary.Read(bytes.NewReader(data), binary.LittleEndian, &superblock); err != nil {
+		return opts, aoserrors.Wrap(err)
+	}
+
+	if string(superblock.Signature[:]) != veritySignature {
+		return opts, aoserrors.New("verity superblock not found")
+	}
+
+	if superblock.Version != verityVersion || superblock.HashType != verityHashType {
+		return opts, aoserrors.New("unsupported verity format")
+	}
+
+	if superblock.SaltSize > verityMaxSaltSize {
+		return opts, aoserrors.New("invalid verity salt size")
+	}
+
+	opts.HashAlgorithm = strings.TrimRight(string(superblock.Algorithm[:]), "\x00")
+	opts.DataBlockSize = int(superblock.DataBlockSize)
+	opts.HashBlockSize = int(superblock.HashBlockSize)
+	opts.DataBlocks = int64(superblock.DataBlocks)
+	opts.Salt = superblock.Salt[:superblock.SaltSize]
+
+	return opts, nil
+}
+
+func isPowerOfTwo(value int) bool {
+	return value > 0 && value&(value-1) == 0
+}
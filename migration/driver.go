@@ -0,0 +1,459 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2022 Renesas Electronics Corporation.
+// Copyright (C) 2022 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migration
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"syscall"
+
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/aoscloud/aos_common/aoserrors"
+)
+
+/***********************************************************************************************************************
+ * Consts
+ **********************************************************************************************************************/
+
+const (
+	migrationsTable = "schema_migrations"
+	checksumsTable  = "schema_migrations_checksums"
+	lockFilePerm    = 0o600
+)
+
+/***********************************************************************************************************************
+ * Types
+ **********************************************************************************************************************/
+
+// dialect database specific parts of migration driver.
+type dialect interface {
+	name() string
+	createVersionTableQuery(table string) string
+	insertVersionQuery(table string) string
+	createChecksumTableQuery(table string) string
+	upsertChecksumQuery(table string) string
+	deleteChecksumsQuery(table string) string
+	lock(conn *sql.Conn, table string) (unlock func() error, err error)
+}
+
+// dbDriver migrate database driver which works on top of provided database instance. All queries are done on the
+// single dedicated connection: session locks are held by it and it doesn't deadlock when the pool size is limited.
+type dbDriver struct {
+	db       *sql.DB
+	conn     *sql.Conn
+	dialect  dialect
+	table    string
+	isLocked bool
+	unlock   func() error
+}
+
+type sqliteDialect struct{}
+
+type postgresDialect struct{}
+
+/***********************************************************************************************************************
+ * Private
+ **********************************************************************************************************************/
+
+func getDialect(db *sql.DB) (dbDialect dialect, err error) {
+	switch db.Driver().(type) {
+	case *sqlite3.SQLiteDriver:
+		return &sqliteDialect{}, nil
+
+	case *pq.Driver:
+		return &postgresDialect{}, nil
+
+	default:
+		return nil, aoserrors.Errorf("unsupported database driver: %v", reflect.TypeOf(db.Driver()))
+	}
+}
+
+func newDBDriver(db *sql.DB) (driver *dbDriver, err error) {
+	dbDialect, err := getDialect(db)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	if err = conn.PingContext(context.Background()); err != nil {
+		conn.Close()
+
+		return nil, aoserrors.Wrap(err)
+	}
+
+	driver = &dbDriver{db: db, conn: conn, dialect: dbDialect, table: migrationsTable}
+
+	if err = driver.ensureVersionTable(); err != nil {
+		conn.Close()
+
+		return nil, err
+	}
+
+	return driver, nil
+}
+
+// release returns driver connection to the pool.
+func (driver *dbDriver) release() (err error) {
+	return aoserrors.Wrap(driver.conn.Close())
+}
+
+func (driver *dbDriver) ensureVersionTable() (err error) {
+	if err = driver.Lock(); err != nil {
+		return err
+	}
+
+	defer func() {
+		if unlockErr := driver.Unlock(); unlockErr != nil {
+			err = aoserrors.Append(err, unlockErr)
+		}
+	}()
+
+	if _, err = driver.conn.ExecContext(context.Background(), driver.dialect.createVersionTableQuery(driver.table)); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	if _, err = driver.conn.ExecContext(context.Background(), driver.dialect.createChecksumTableQuery(checksumsTable)); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	return nil
+}
+
+func (driver *dbDriver) verifyChecksums(src source.Driver) (err error) {
+	rows, err := driver.conn.QueryContext(context.Background(), "SELECT version, checksum FROM "+checksumsTable)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			version         uint
+			appliedChecksum string
+		)
+
+		if err = rows.Scan(&version, &appliedChecksum); err != nil {
+			return aoserrors.Wrap(err)
+		}
+
+		checksum, err := getScriptChecksum(src, version)
+		if err != nil {
+			// Script is not shipped anymore, nothing to compare
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+
+			return err
+		}
+
+		if checksum == appliedChecksum {
+			continue
+		}
+
+		if getChecksumMode() == ChecksumModeWarn {
+			log.Warnf("Migration script of version %d differs from applied one", version)
+
+			continue
+		}
+
+		return aoserrors.Errorf("migration script of version %d differs from applied one", version)
+	}
+
+	return aoserrors.Wrap(rows.Err())
+}
+
+// syncChecksums records checksums of scripts applied after fromVersion and removes checksums of reverted ones.
+func (driver *dbDriver) syncChecksums(src source.Driver, fromVersion uint) (err error) {
+	version, dirty, err := driver.Version()
+	if err != nil {
+		return err
+	}
+
+	if dirty {
+		return nil
+	}
+
+	if _, err = driver.conn.ExecContext(context.Background(), driver.dialect.deleteChecksumsQuery(checksumsTable), version); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	for appliedVersion := fromVersion; int(appliedVersion) < version; {
+		if appliedVersion, err = src.Next(appliedVersion); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+
+			return aoserrors.Wrap(err)
+		}
+
+		if int(appliedVersion) > version {
+			return nil
+		}
+
+		checksum, err := getScriptChecksum(src, appliedVersion)
+		if err != nil {
+			return err
+		}
+
+		if _, err = driver.conn.ExecContext(context.Background(),
+			driver.dialect.upsertChecksumQuery(checksumsTable), appliedVersion, checksum); err != nil {
+			return aoserrors.Wrap(err)
+		}
+	}
+
+	return nil
+}
+
+func (driver *dbDriver) Open(url string) (database.Driver, error) {
+	return nil, aoserrors.New("open by URL is not supported")
+}
+
+func (driver *dbDriver) Close() error {
+	return aoserrors.Wrap(driver.db.Close())
+}
+
+func (driver *dbDriver) Lock() (err error) {
+	if driver.isLocked {
+		return database.ErrLocked
+	}
+
+	if driver.unlock, err = driver.dialect.lock(driver.conn, driver.table); err != nil {
+		return err
+	}
+
+	driver.isLocked = true
+
+	return nil
+}
+
+func (driver *dbDriver) Unlock() (err error) {
+	if !driver.isLocked {
+		return nil
+	}
+
+	driver.isLocked = false
+
+	return driver.unlock()
+}
+
+func (driver *dbDriver) Run(migration io.Reader) (err error) {
+	query, err := ioutil.ReadAll(migration)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	tx, err := driver.conn.BeginTx(context.Background(), nil)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	if _, err = tx.Exec(string(query)); err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			err = aoserrors.Append(err, rollbackErr)
+		}
+
+		return aoserrors.Wrap(&database.Error{OrigErr: err, Query: query})
+	}
+
+	return aoserrors.Wrap(tx.Commit())
+}
+
+func (driver *dbDriver) SetVersion(version int, dirty bool) (err error) {
+	tx, err := driver.conn.BeginTx(context.Background(), nil)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	defer func() {
+		if err != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil {
+				err = aoserrors.Append(err, rollbackErr)
+			}
+		}
+	}()
+
+	if _, err = tx.Exec("DELETE FROM " + driver.table); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	// Keep dirty nil version to not lose failed down migration of the first version
+	if version >= 0 || (version == database.NilVersion && dirty) {
+		if _, err = tx.Exec(driver.dialect.insertVersionQuery(driver.table), version, dirty); err != nil {
+			return aoserrors.Wrap(err)
+		}
+	}
+
+	return aoserrors.Wrap(tx.Commit())
+}
+
+func (driver *dbDriver) Version() (version int, dirty bool, err error) {
+	if err = driver.conn.QueryRowContext(context.Background(),
+		"SELECT version, dirty FROM "+driver.table+" LIMIT 1").Scan(&version, &dirty); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return database.NilVersion, false, nil
+		}
+
+		return 0, false, aoserrors.Wrap(err)
+	}
+
+	return version, dirty, nil
+}
+
+func (driver *dbDriver) Drop() error {
+	return aoserrors.New("drop is not supported")
+}
+
+func (*sqliteDialect) name() string {
+	return "sqlite3"
+}
+
+func (*sqliteDialect) createVersionTableQuery(table string) string {
+	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (version uint64, dirty bool);
+		CREATE UNIQUE INDEX IF NOT EXISTS version_unique ON %s (version);`, table, table)
+}
+
+func (*sqliteDialect) insertVersionQuery(table string) string {
+	return fmt.Sprintf("INSERT INTO %s (version, dirty) VALUES (?, ?)", table)
+}
+
+func (*sqliteDialect) createChecksumTableQuery(table string) string {
+	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (version uint64 PRIMARY KEY, checksum TEXT)", table)
+}
+
+func (*sqliteDialect) upsertChecksumQuery(table string) string {
+	return fmt.Sprintf("INSERT OR REPLACE INTO %s (version, checksum) VALUES (?, ?)", table)
+}
+
+func (*sqliteDialect) deleteChecksumsQuery(table string) string {
+	return fmt.Sprintf("DELETE FROM %s WHERE version > ?", table)
+}
+
+func (*sqliteDialect) lock(conn *sql.Conn, table string) (unlock func() error, err error) {
+	var (
+		seq            int
+		name, fileName string
+	)
+
+	if err = conn.QueryRowContext(context.Background(), "PRAGMA database_list").Scan(&seq, &name, &fileName); err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	// In-memory database can't be shared between processes
+	if fileName == "" {
+		return func() error { return nil }, nil
+	}
+
+	lockFile, err := os.OpenFile(fileName+"."+table+".lock", os.O_CREATE|os.O_RDWR, lockFilePerm)
+	if err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	// Blocks until other migrator releases the lock
+	if err = syscall.Flock(int(lockFile.Fd()), syscall.LOCK_EX); err != nil {
+		lockFile.Close()
+
+		return nil, aoserrors.Wrap(err)
+	}
+
+	return func() (err error) {
+		defer lockFile.Close()
+
+		return aoserrors.Wrap(syscall.Flock(int(lockFile.Fd()), syscall.LOCK_UN))
+	}, nil
+}
+
+func (*postgresDialect) name() string {
+	return "postgres"
+}
+
+func (*postgresDialect) createVersionTableQuery(table string) string {
+	return fmt.Sprintf(
+		"CREATE TABLE IF NOT EXISTS %s (version bigint NOT NULL PRIMARY KEY, dirty boolean NOT NULL)", table)
+}
+
+func (*postgresDialect) insertVersionQuery(table string) string {
+	return fmt.Sprintf("INSERT INTO %s (version, dirty) VALUES ($1, $2)", table)
+}
+
+func (*postgresDialect) createChecksumTableQuery(table string) string {
+	return fmt.Sprintf(
+		"CREATE TABLE IF NOT EXISTS %s (version bigint NOT NULL PRIMARY KEY, checksum text NOT NULL)", table)
+}
+
+func (*postgresDialect) upsertChecksumQuery(table string) string {
+	return fmt.Sprintf(`INSERT INTO %s (version, checksum) VALUES ($1, $2)
+		ON CONFLICT (version) DO UPDATE SET checksum = EXCLUDED.checksum`, table)
+}
+
+func (*postgresDialect) deleteChecksumsQuery(table string) string {
+	return fmt.Sprintf("DELETE FROM %s WHERE version > $1", table)
+}
+
+func (*postgresDialect) lock(conn *sql.Conn, table string) (unlock func() error, err error) {
+	lockID, err := database.GenerateAdvisoryLockId(table)
+	if err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	// Advisory lock blocks until other migrator releases it. It belongs to the session, so lock and unlock are done on
+	// the driver connection.
+	if _, err = conn.ExecContext(context.Background(), "SELECT pg_advisory_lock($1)", lockID); err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	return func() (err error) {
+		if _, err = conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", lockID); err != nil {
+			return aoserrors.Wrap(err)
+		}
+
+		return nil
+	}, nil
+}
+
+func getScriptChecksum(src source.Driver, version uint) (checksum string, err error) {
+	reader, _, err := src.ReadUp(version)
+	if err != nil {
+		return "", aoserrors.Wrap(err)
+	}
+	defer reader.Close()
+
+	hash := sha256.New()
+
+	if _, err = io.Copy(hash, reader); err != nil {
+		return "", aoserrors.Wrap(err)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -24,12 +24,12 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
 
 	"github.com/golang-migrate/migrate/v4"
-	"github.com/golang-migrate/migrate/v4/database/sqlite3"
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/source"
 	_ "github.com/golang-migrate/migrate/v4/source/file" // use blank import to init migrate
-	_ "github.com/lib/pq"
-	_ "github.com/mattn/go-sqlite3"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/aoscloud/aos_common/aoserrors"
@@ -41,69 +41,107 @@ import (
 
 const folderPerm = 0o755
 
+// Checksum modes.
+const (
+	// ChecksumModeStrict fails migration if applied script was changed.
+	ChecksumModeStrict ChecksumMode = iota
+	// ChecksumModeWarn logs warning if applied script was changed.
+	ChecksumModeWarn
+)
+
 /***********************************************************************************************************************
- * Public
+ * Types
  **********************************************************************************************************************/
 
-// DoMigrate does migration on provided database.
-func DoMigrate(sql *sql.DB, migrationPath string, migrateVersion uint) (err error) {
-	log.Debugf("Db Migration start migration to %d", int(migrateVersion))
-
-	m, err := getMigrationFromInstance(sql, migrationPath)
-	if err != nil {
-		return aoserrors.Wrap(err)
-	}
+// ChecksumMode defines behavior on applied migration script change.
+type ChecksumMode int32
 
-	version, dirty, err := m.Version()
-	if errors.Is(err, migrate.ErrNilVersion) {
-		version = 0
+// Plan migration plan.
+type Plan struct {
+	CurrentVersion uint
+	TargetVersion  uint
+	Up             bool
+	Scripts        []PlanScript
+}
 
-		log.Debugf("Migration version was not set. Setting initial version %d", version)
+// PlanScript migration script to be applied: up script of version for up migration and down script for down one.
+type PlanScript struct {
+	Version    uint
+	Identifier string
+}
 
-		if err = m.Force(int(version)); err != nil {
-			return aoserrors.Wrap(err)
-		}
-	} else if err != nil {
-		return aoserrors.Wrap(err)
-	}
+/***********************************************************************************************************************
+ * Vars
+ **********************************************************************************************************************/
 
-	if dirty {
-		return aoserrors.New("can't update, db is dirty")
-	}
+// nolint:gochecknoglobals
+var checksumMode int32
 
-	log.Debugf("Got database version: %d", version)
+/***********************************************************************************************************************
+ * Public
+ **********************************************************************************************************************/
 
-	if version == migrateVersion {
-		log.Debugf("No migration needed. db version is: %d", int(migrateVersion))
+// SetChecksumMode sets behavior on applied migration script change. Checksum of each applied up script is recorded and
+// compared with shipped script before migration.
+func SetChecksumMode(mode ChecksumMode) {
+	atomic.StoreInt32(&checksumMode, int32(mode))
+}
 
-		return nil
+// DoMigrate does migration on provided database.
+func DoMigrate(sql *sql.DB, migrationPath string, migrateVersion uint) (err error) {
+	src, err := getFileSource(migrationPath)
+	if err != nil {
+		return err
 	}
+	defer src.Close()
 
-	if err = m.Migrate(migrateVersion); errors.Is(err, migrate.ErrNoChange) {
-		log.Debugf("No migration needed. db version is: %d", int(migrateVersion))
+	return doMigrate(sql, src, migrateVersion)
+}
 
-		return nil
+// MigrateTo migrates database to the specified version. Each up migration in the range should have paired down
+// script. If migration fails, database is rolled back to the version it had before migration.
+func MigrateTo(sql *sql.DB, migrationPath string, migrateVersion uint) (err error) {
+	src, err := getFileSource(migrationPath)
+	if err != nil {
+		return err
 	}
+	defer src.Close()
 
-	if err == nil {
-		log.Debugf("Migration successful, db version is: %d", int(migrateVersion))
+	return migrateTo(sql, src, migrateVersion)
+}
+
+// Down rolls back the specified number of applied migrations.
+func Down(sql *sql.DB, migrationPath string, steps uint) (err error) {
+	src, err := getFileSource(migrationPath)
+	if err != nil {
+		return err
 	}
+	defer src.Close()
 
-	return aoserrors.Wrap(err)
+	return down(sql, src, steps)
 }
 
 // SetDatabaseVersion sets the database version.
 func SetDatabaseVersion(sql *sql.DB, migrationPath string, version uint) (err error) {
-	m, err := getMigrationFromInstance(sql, migrationPath)
+	src, err := getFileSource(migrationPath)
 	if err != nil {
-		return aoserrors.Wrap(err)
+		return err
 	}
+	defer src.Close()
 
-	if err = m.Force(int(version)); err != nil {
-		return aoserrors.Wrap(err)
+	return setDatabaseVersion(sql, src, version)
+}
+
+// GetMigrationPlan returns migration scripts which would be applied to migrate database to the specified version.
+// The database is not changed.
+func GetMigrationPlan(sql *sql.DB, migrationPath string, migrateVersion uint) (plan Plan, err error) {
+	src, err := getFileSource(migrationPath)
+	if err != nil {
+		return plan, err
 	}
+	defer src.Close()
 
-	return nil
+	return getMigrationPlan(sql, src, migrateVersion)
 }
 
 // MergeMigrationFiles merged the migration files with the previous state.
@@ -186,23 +224,348 @@ func copyFile(src string, dst string) (err error) {
 	return aoserrors.Wrap(err)
 }
 
-func getMigrationFromInstance(sql *sql.DB, mergedMigrationPath string) (migration *migrate.Migrate, err error) {
-	absMergedMigrationPath, err := filepath.Abs(mergedMigrationPath)
+func getChecksumMode() ChecksumMode {
+	return ChecksumMode(atomic.LoadInt32(&checksumMode))
+}
+
+func doMigrate(sql *sql.DB, src source.Driver, migrateVersion uint) (err error) {
+	log.Debugf("Db Migration start migration to %d", int(migrateVersion))
+
+	m, driver, err := getMigration(sql, src)
 	if err != nil {
-		return nil, aoserrors.Wrap(err)
+		return aoserrors.Wrap(err)
 	}
 
-	driver, err := sqlite3.WithInstance(sql, &sqlite3.Config{})
+	defer func() {
+		err = aoserrors.Append(err, driver.release())
+	}()
+
+	version, err := getVersion(m)
 	if err != nil {
-		return nil, aoserrors.Wrap(err)
+		return err
 	}
 
-	m, err := migrate.NewWithDatabaseInstance(
-		"file://"+absMergedMigrationPath,
-		"sqlite3", driver)
+	log.Debugf("Got database version: %d", version)
+
+	if err = driver.verifyChecksums(src); err != nil {
+		return err
+	}
+
+	defer func() {
+		err = aoserrors.Append(err, driver.syncChecksums(src, version))
+	}()
+
+	if version == migrateVersion {
+		log.Debugf("No migration needed. db version is: %d", int(migrateVersion))
+
+		return nil
+	}
+
+	if err = m.Migrate(migrateVersion); errors.Is(err, migrate.ErrNoChange) {
+		log.Debugf("No migration needed. db version is: %d", int(migrateVersion))
+
+		return nil
+	}
+
+	if err == nil {
+		log.Debugf("Migration successful, db version is: %d", int(migrateVersion))
+	}
+
+	return aoserrors.Wrap(err)
+}
+
+func migrateTo(sql *sql.DB, src source.Driver, migrateVersion uint) (err error) {
+	log.Debugf("Db migration to %d", migrateVersion)
+
+	m, driver, err := getMigration(sql, src)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	defer func() {
+		err = aoserrors.Append(err, driver.release())
+	}()
+
+	version, err := getVersion(m)
+	if err != nil {
+		return err
+	}
+
+	if err = driver.verifyChecksums(src); err != nil {
+		return err
+	}
+
+	defer func() {
+		err = aoserrors.Append(err, driver.syncChecksums(src, version))
+	}()
+
+	if version == migrateVersion {
+		log.Debugf("No migration needed. db version is: %d", migrateVersion)
+
+		return nil
+	}
+
+	if migrateVersion > version {
+		if err = checkDownMigrations(src, version, migrateVersion); err != nil {
+			return err
+		}
+	}
+
+	if err = m.Migrate(migrateVersion); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		log.Errorf("Migration to %d failed: %v", migrateVersion, err)
+
+		if rollbackErr := rollbackMigration(m, src, version, migrateVersion > version); rollbackErr != nil {
+			return aoserrors.Append(aoserrors.Wrap(err), rollbackErr)
+		}
+
+		return aoserrors.Wrap(err)
+	}
+
+	log.Debugf("Migration successful, db version is: %d", migrateVersion)
+
+	return nil
+}
+
+func down(sql *sql.DB, src source.Driver, steps uint) (err error) {
+	log.Debugf("Db migration down %d steps", steps)
+
+	m, driver, err := getMigration(sql, src)
 	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	defer func() {
+		err = aoserrors.Append(err, driver.release())
+	}()
+
+	version, err := getVersion(m)
+	if err != nil {
+		return err
+	}
+
+	if err = driver.verifyChecksums(src); err != nil {
+		return err
+	}
+
+	defer func() {
+		err = aoserrors.Append(err, driver.syncChecksums(src, version))
+	}()
+
+	if err = m.Steps(-int(steps)); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return aoserrors.Wrap(err)
+	}
+
+	return nil
+}
+
+// getVersion returns current database version. Initial version is set if database has no version.
+func getVersion(m *migrate.Migrate) (version uint, err error) {
+	version, dirty, err := m.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		version = 0
+
+		log.Debugf("Migration version was not set. Setting initial version %d", version)
+
+		if err = m.Force(int(version)); err != nil {
+			return 0, aoserrors.Wrap(err)
+		}
+
+		return version, nil
+	}
+
+	if err != nil {
+		return 0, aoserrors.Wrap(err)
+	}
+
+	if dirty {
+		return 0, aoserrors.New("can't update, db is dirty")
+	}
+
+	return version, nil
+}
+
+func setDatabaseVersion(sql *sql.DB, src source.Driver, version uint) (err error) {
+	m, driver, err := getMigration(sql, src)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	defer func() {
+		err = aoserrors.Append(err, driver.release())
+	}()
+
+	if err = m.Force(int(version)); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	return nil
+}
+
+func getMigrationPlan(sql *sql.DB, src source.Driver, migrateVersion uint) (plan Plan, err error) {
+	m, driver, err := getMigration(sql, src)
+	if err != nil {
+		return plan, aoserrors.Wrap(err)
+	}
+
+	defer func() {
+		err = aoserrors.Append(err, driver.release())
+	}()
+
+	version, dirty, err := m.Version()
+	if err != nil && !errors.Is(err, migrate.ErrNilVersion) {
+		return plan, aoserrors.Wrap(err)
+	}
+
+	if dirty {
+		return plan, aoserrors.New("db is dirty")
+	}
+
+	plan = Plan{CurrentVersion: version, TargetVersion: migrateVersion, Up: migrateVersion > version}
+
+	if plan.Up {
+		for version < migrateVersion {
+			if version, err = src.Next(version); err != nil {
+				return plan, aoserrors.Errorf("version %d not found: %v", migrateVersion, err)
+			}
+
+			if version > migrateVersion {
+				return plan, aoserrors.Errorf("version %d not found", migrateVersion)
+			}
+
+			if err = addPlanScript(&plan, src, version); err != nil {
+				return plan, err
+			}
+		}
+
+		return plan, nil
+	}
+
+	for version > migrateVersion {
+		if err = addPlanScript(&plan, src, version); err != nil {
+			return plan, err
+		}
+
+		if version, err = src.Prev(version); err != nil {
+			return plan, aoserrors.Errorf("version %d not found: %v", migrateVersion, err)
+		}
+
+		if version < migrateVersion {
+			return plan, aoserrors.Errorf("version %d not found", migrateVersion)
+		}
+	}
+
+	return plan, nil
+}
+
+func addPlanScript(plan *Plan, src source.Driver, version uint) (err error) {
+	read := src.ReadDown
+	if plan.Up {
+		read = src.ReadUp
+	}
+
+	reader, identifier, err := read(version)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	reader.Close()
+
+	plan.Scripts = append(plan.Scripts, PlanScript{Version: version, Identifier: identifier})
+
+	return nil
+}
+
+func getFileSource(migrationPath string) (src source.Driver, err error) {
+	absMigrationPath, err := filepath.Abs(migrationPath)
+	if err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	if src, err = source.Open("file://" + absMigrationPath); err != nil {
 		return nil, aoserrors.Wrap(err)
 	}
 
-	return m, nil
+	return src, nil
+}
+
+func checkDownMigrations(src source.Driver, fromVersion, toVersion uint) (err error) {
+	for version := fromVersion; version < toVersion; {
+		if version, err = src.Next(version); err != nil {
+			return aoserrors.Wrap(err)
+		}
+
+		if version > toVersion {
+			break
+		}
+
+		reader, _, readErr := src.ReadDown(version)
+		if readErr != nil {
+			return aoserrors.Errorf("no down migration for version %d: %v", version, readErr)
+		}
+
+		reader.Close()
+	}
+
+	return nil
+}
+
+func rollbackMigration(m *migrate.Migrate, src source.Driver, initialVersion uint, up bool) (err error) {
+	log.Warnf("Rollback db to version %d", initialVersion)
+
+	version, dirty, err := m.Version()
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	// Each migration is executed in transaction, so failed migration doesn't change the db. Set clean version
+	// according to the actual db state.
+	if dirty {
+		var cleanVersion int
+
+		if up {
+			prevVersion, err := src.Prev(version)
+
+			switch {
+			case errors.Is(err, os.ErrNotExist):
+				cleanVersion = database.NilVersion
+
+			case err != nil:
+				return aoserrors.Wrap(err)
+
+			default:
+				cleanVersion = int(prevVersion)
+			}
+		} else {
+			nextVersion, err := src.Next(version)
+			if err != nil {
+				return aoserrors.Wrap(err)
+			}
+
+			cleanVersion = int(nextVersion)
+		}
+
+		if err = m.Force(cleanVersion); err != nil {
+			return aoserrors.Wrap(err)
+		}
+	}
+
+	if err = m.Migrate(initialVersion); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return aoserrors.Wrap(err)
+	}
+
+	return nil
+}
+
+func getMigration(
+	sql *sql.DB, src source.Driver) (migration *migrate.Migrate, driver *dbDriver, err error) {
+	if driver, err = newDBDriver(sql); err != nil {
+		return nil, nil, err
+	}
+
+	// migrate.Migrate is not closed as it closes the source and the provided database
+	if migration, err = migrate.NewWithInstance("source", src, driver.dialect.name(), driver); err != nil {
+		return nil, nil, aoserrors.Append(aoserrors.Wrap(err), driver.release())
+	}
+
+	return migration, driver, nil
 }
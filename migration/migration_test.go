@@ -24,7 +24,9 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"reflect"
 	"sort"
+	"sync"
 	"testing"
 
 	_ "github.com/mattn/go-sqlite3" // ignore lint
@@ -270,6 +272,348 @@ func TestMergeMigrationFiles(t *testing.T) {
 	}
 }
 
+func TestMigrateToRollback(t *testing.T) {
+	if err := os.MkdirAll(testFolder, folderPerm); err != nil {
+		t.Fatalf("Error creating directory: %s", err)
+	}
+
+	defer func() {
+		if err := os.RemoveAll(testFolder); err != nil {
+			t.Fatalf("Error cleaning up: %s", err)
+		}
+	}()
+
+	var (
+		currentVersion uint = 1
+		nextVersion    uint = 25
+		dbName              = path.Join(testFolder, "test.db")
+		migrationPath       = path.Join(testFolder, "migrations")
+	)
+
+	if err := createTestDB(dbName, currentVersion); err != nil {
+		t.Fatalf("Error preparing test db, err %s", err)
+	}
+
+	if err := generatePairedMigrationFiles(nextVersion, migrationPath); err != nil {
+		t.Fatalf("Can't generate migration files for ver %d", nextVersion)
+	}
+
+	if err := breakMigrationVersion(13, migrationPath); err != nil {
+		t.Fatalf("Can't break migration files for ver %d", nextVersion)
+	}
+
+	sqlite, err := getSQLConnection(dbName)
+	if err != nil {
+		t.Fatalf("Can't create database connection: %s", err)
+	}
+	defer sqlite.Close()
+
+	if err = migration.SetDatabaseVersion(sqlite, migrationPath, currentVersion); err != nil {
+		t.Fatalf("Can't set database version: %s", err)
+	}
+
+	if err = migration.MigrateTo(sqlite, migrationPath, nextVersion); err == nil {
+		t.Fatal("Migration is expected to be failed")
+	}
+
+	checkOperationVersion(t, sqlite, dbName, currentVersion)
+
+	if err = generatePairedMigrationFiles(nextVersion, migrationPath); err != nil {
+		t.Fatalf("Can't generate migration files for ver %d", nextVersion)
+	}
+
+	if err = migration.MigrateTo(sqlite, migrationPath, nextVersion); err != nil {
+		t.Fatalf("Can't migrate database: %s", err)
+	}
+
+	checkOperationVersion(t, sqlite, dbName, nextVersion)
+
+	if err = migration.Down(sqlite, migrationPath, 5); err != nil {
+		t.Fatalf("Can't migrate database down: %s", err)
+	}
+
+	checkOperationVersion(t, sqlite, dbName, nextVersion-5)
+
+	// Up migration without paired down script is not allowed
+	if err = os.Remove(filepath.Join(migrationPath, fmt.Sprintf("%d_update.down.sql", nextVersion-2))); err != nil {
+		t.Fatalf("Can't remove down migration: %s", err)
+	}
+
+	if err = migration.MigrateTo(sqlite, migrationPath, nextVersion); err == nil {
+		t.Fatal("Migration is expected to be failed")
+	}
+
+	checkOperationVersion(t, sqlite, dbName, nextVersion-5)
+}
+
+func TestMigrateToFreshDB(t *testing.T) {
+	if err := os.MkdirAll(testFolder, folderPerm); err != nil {
+		t.Fatalf("Error creating directory: %s", err)
+	}
+
+	defer func() {
+		if err := os.RemoveAll(testFolder); err != nil {
+			t.Fatalf("Error cleaning up: %s", err)
+		}
+	}()
+
+	var (
+		nextVersion   uint = 5
+		dbName             = path.Join(testFolder, "test.db")
+		migrationPath      = path.Join(testFolder, "migrations")
+	)
+
+	if err := createTestDB(dbName, 0); err != nil {
+		t.Fatalf("Error preparing test db, err %s", err)
+	}
+
+	if err := generatePairedMigrationFiles(nextVersion, migrationPath); err != nil {
+		t.Fatalf("Can't generate migration files for ver %d", nextVersion)
+	}
+
+	sqlite, err := getSQLConnection(dbName)
+	if err != nil {
+		t.Fatalf("Can't create database connection: %s", err)
+	}
+	defer sqlite.Close()
+
+	if err = migration.MigrateTo(sqlite, migrationPath, nextVersion); err != nil {
+		t.Fatalf("Can't migrate database: %s", err)
+	}
+
+	checkOperationVersion(t, sqlite, dbName, nextVersion)
+
+	if _, err = sqlite.Exec("UPDATE schema_migrations SET dirty = 1"); err != nil {
+		t.Fatalf("Can't set dirty flag: %s", err)
+	}
+
+	if err = migration.Down(sqlite, migrationPath, 1); err == nil {
+		t.Error("Migration down of dirty db is expected to be failed")
+	}
+
+	if version, err := getOperationVersion(sqlite); err != nil || version != int(nextVersion) {
+		t.Errorf("Wrong operation version: %d, %v", version, err)
+	}
+}
+
+func TestMigrationPlan(t *testing.T) {
+	if err := os.MkdirAll(testFolder, folderPerm); err != nil {
+		t.Fatalf("Error creating directory: %s", err)
+	}
+
+	defer func() {
+		if err := os.RemoveAll(testFolder); err != nil {
+			t.Fatalf("Error cleaning up: %s", err)
+		}
+	}()
+
+	var (
+		currentVersion uint = 3
+		dbName              = path.Join(testFolder, "test.db")
+		migrationPath       = path.Join(testFolder, "migrations")
+	)
+
+	if err := createTestDB(dbName, currentVersion); err != nil {
+		t.Fatalf("Error preparing test db, err %s", err)
+	}
+
+	if err := generatePairedMigrationFiles(10, migrationPath); err != nil {
+		t.Fatalf("Can't generate migration files: %s", err)
+	}
+
+	sqlite, err := getSQLConnection(dbName)
+	if err != nil {
+		t.Fatalf("Can't create database connection: %s", err)
+	}
+	defer sqlite.Close()
+
+	if err = migration.SetDatabaseVersion(sqlite, migrationPath, currentVersion); err != nil {
+		t.Fatalf("Can't set database version: %s", err)
+	}
+
+	testData := []struct {
+		targetVersion uint
+		up            bool
+		versions      []uint
+	}{
+		{targetVersion: 6, up: true, versions: []uint{4, 5, 6}},
+		{targetVersion: 1, up: false, versions: []uint{3, 2}},
+		{targetVersion: 3},
+	}
+
+	for _, item := range testData {
+		plan, err := migration.GetMigrationPlan(sqlite, migrationPath, item.targetVersion)
+		if err != nil {
+			t.Fatalf("Can't get migration plan: %s", err)
+		}
+
+		if plan.CurrentVersion != currentVersion || plan.TargetVersion != item.targetVersion || plan.Up != item.up {
+			t.Errorf("Wrong migration plan: %v", plan)
+		}
+
+		versions := make([]uint, 0, len(plan.Scripts))
+
+		for _, script := range plan.Scripts {
+			if script.Identifier != "update" {
+				t.Errorf("Wrong script identifier: %s", script.Identifier)
+			}
+
+			versions = append(versions, script.Version)
+		}
+
+		if !reflect.DeepEqual(versions, item.versions) && len(versions)+len(item.versions) != 0 {
+			t.Errorf("Wrong plan versions: %v", versions)
+		}
+	}
+
+	if _, err = migration.GetMigrationPlan(sqlite, migrationPath, 11); err == nil {
+		t.Error("Error expected for unknown version")
+	}
+
+	checkOperationVersion(t, sqlite, dbName, currentVersion)
+}
+
+func TestConcurrentMigration(t *testing.T) {
+	if err := os.MkdirAll(testFolder, folderPerm); err != nil {
+		t.Fatalf("Error creating directory: %s", err)
+	}
+
+	defer func() {
+		if err := os.RemoveAll(testFolder); err != nil {
+			t.Fatalf("Error cleaning up: %s", err)
+		}
+	}()
+
+	var (
+		currentVersion uint = 1
+		nextVersion    uint = 25
+		numMigrators        = 4
+		dbName              = path.Join(testFolder, "test.db")
+		migrationPath       = path.Join(testFolder, "migrations")
+	)
+
+	if err := createTestDB(dbName, currentVersion); err != nil {
+		t.Fatalf("Error preparing test db, err %s", err)
+	}
+
+	if err := generatePairedMigrationFiles(nextVersion, migrationPath); err != nil {
+		t.Fatalf("Can't generate migration files for ver %d", nextVersion)
+	}
+
+	sqlite, err := getSQLConnection(dbName)
+	if err != nil {
+		t.Fatalf("Can't create database connection: %s", err)
+	}
+	defer sqlite.Close()
+
+	if err = migration.SetDatabaseVersion(sqlite, migrationPath, currentVersion); err != nil {
+		t.Fatalf("Can't set database version: %s", err)
+	}
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < numMigrators; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			migratorDB, err := getSQLConnection(dbName)
+			if err != nil {
+				t.Errorf("Can't create database connection: %s", err)
+
+				return
+			}
+			defer migratorDB.Close()
+
+			if err = migration.MigrateTo(migratorDB, migrationPath, nextVersion); err != nil {
+				t.Errorf("Can't migrate database: %s", err)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	checkOperationVersion(t, sqlite, dbName, nextVersion)
+}
+
+func TestMigrationChecksum(t *testing.T) {
+	if err := os.MkdirAll(testFolder, folderPerm); err != nil {
+		t.Fatalf("Error creating directory: %s", err)
+	}
+
+	defer func() {
+		if err := os.RemoveAll(testFolder); err != nil {
+			t.Fatalf("Error cleaning up: %s", err)
+		}
+	}()
+
+	var (
+		currentVersion uint = 1
+		dbName              = path.Join(testFolder, "test.db")
+		migrationPath       = path.Join(testFolder, "migrations")
+		changedScript       = filepath.Join(migrationPath, "3_update.up.sql")
+	)
+
+	if err := createTestDB(dbName, currentVersion); err != nil {
+		t.Fatalf("Error preparing test db, err %s", err)
+	}
+
+	if err := generatePairedMigrationFiles(10, migrationPath); err != nil {
+		t.Fatalf("Can't generate migration files: %s", err)
+	}
+
+	sqlite, err := getSQLConnection(dbName)
+	if err != nil {
+		t.Fatalf("Can't create database connection: %s", err)
+	}
+	defer sqlite.Close()
+
+	if err = migration.SetDatabaseVersion(sqlite, migrationPath, currentVersion); err != nil {
+		t.Fatalf("Can't set database version: %s", err)
+	}
+
+	if err = migration.MigrateTo(sqlite, migrationPath, 5); err != nil {
+		t.Fatalf("Can't migrate database: %s", err)
+	}
+
+	if err = writeToFile(changedScript, "UPDATE testing SET version = 3; -- changed"); err != nil {
+		t.Fatalf("Can't change migration script: %s", err)
+	}
+
+	if err = migration.MigrateTo(sqlite, migrationPath, 6); err == nil {
+		t.Fatal("Migration with changed script is expected to be failed")
+	}
+
+	checkOperationVersion(t, sqlite, dbName, 5)
+
+	migration.SetChecksumMode(migration.ChecksumModeWarn)
+	defer migration.SetChecksumMode(migration.ChecksumModeStrict)
+
+	if err = migration.MigrateTo(sqlite, migrationPath, 6); err != nil {
+		t.Fatalf("Can't migrate database: %s", err)
+	}
+
+	checkOperationVersion(t, sqlite, dbName, 6)
+
+	// Reverted and applied again script gets new checksum
+	if err = migration.Down(sqlite, migrationPath, 4); err != nil {
+		t.Fatalf("Can't migrate database down: %s", err)
+	}
+
+	migration.SetChecksumMode(migration.ChecksumModeStrict)
+
+	if err = migration.MigrateTo(sqlite, migrationPath, 4); err != nil {
+		t.Fatalf("Can't migrate database: %s", err)
+	}
+
+	if err = migration.MigrateTo(sqlite, migrationPath, 7); err != nil {
+		t.Fatalf("Can't migrate database: %s", err)
+	}
+
+	checkOperationVersion(t, sqlite, dbName, 7)
+}
+
 /***********************************************************************************************************************
  * Private
  **********************************************************************************************************************/
@@ -374,6 +718,27 @@ func generateMigrationFiles(verTo uint, path string) (err error) {
 	return nil
 }
 
+func generatePairedMigrationFiles(verTo uint, path string) (err error) {
+	if err = os.MkdirAll(path, folderPerm); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	for i := 0; i <= int(verTo); i++ {
+		upPath := filepath.Join(path, fmt.Sprintf("%d_update.up.sql", i))
+		downPath := filepath.Join(path, fmt.Sprintf("%d_update.down.sql", i))
+
+		if err = writeToFile(upPath, fmt.Sprintf("UPDATE testing SET version = %d;", i)); err != nil {
+			return err
+		}
+
+		if err = writeToFile(downPath, fmt.Sprintf("UPDATE testing SET version = %d;", i-1)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func removeMigrationDataFromDB(sqlite *sql.DB) (err error) {
 	_, err = sqlite.Exec("DROP TABLE IF EXISTS schema_migrations")
 
@@ -453,6 +818,23 @@ func checkDBVersion(t *testing.T, currentVersion uint, name string) {
 	}
 }
 
+func checkOperationVersion(t *testing.T, sqlite *sql.DB, name string, version uint) {
+	t.Helper()
+
+	if err := compareDBVersions(version, name); err != nil {
+		t.Errorf("Compare error: %s", err)
+	}
+
+	operationVersion, err := getOperationVersion(sqlite)
+	if err != nil {
+		t.Fatalf("Can't get operation version: %s", err)
+	}
+
+	if operationVersion != int(version) {
+		t.Errorf("Wrong operation version: %d", operationVersion)
+	}
+}
+
 func testMigration(t *testing.T, currentVersion uint, nextVersion uint) {
 	t.Helper()
 
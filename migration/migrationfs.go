@@ -0,0 +1,105 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2022 Renesas Electronics Corporation.
+// Copyright (C) 2022 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.16
+// +build go1.16
+
+package migration
+
+import (
+	"database/sql"
+	"io/fs"
+	"net/http"
+	"path"
+
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/httpfs"
+
+	"github.com/aoscloud/aos_common/aoserrors"
+)
+
+/***********************************************************************************************************************
+ * Public
+ **********************************************************************************************************************/
+
+// DoMigrateFS does migration on provided database using migrations from file system, e.g. embed.FS.
+func DoMigrateFS(sql *sql.DB, migrationFS fs.FS, migrationPath string, migrateVersion uint) (err error) {
+	src, err := getFSSource(migrationFS, migrationPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	return doMigrate(sql, src, migrateVersion)
+}
+
+// MigrateToFS migrates database to the specified version using migrations from file system, e.g. embed.FS.
+func MigrateToFS(sql *sql.DB, migrationFS fs.FS, migrationPath string, migrateVersion uint) (err error) {
+	src, err := getFSSource(migrationFS, migrationPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	return migrateTo(sql, src, migrateVersion)
+}
+
+// DownFS rolls back the specified number of applied migrations using migrations from file system, e.g. embed.FS.
+func DownFS(sql *sql.DB, migrationFS fs.FS, migrationPath string, steps uint) (err error) {
+	src, err := getFSSource(migrationFS, migrationPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	return down(sql, src, steps)
+}
+
+// SetDatabaseVersionFS sets the database version using migrations from file system, e.g. embed.FS.
+func SetDatabaseVersionFS(sql *sql.DB, migrationFS fs.FS, migrationPath string, version uint) (err error) {
+	src, err := getFSSource(migrationFS, migrationPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	return setDatabaseVersion(sql, src, version)
+}
+
+// GetMigrationPlanFS returns migration plan using migrations from file system, e.g. embed.FS.
+func GetMigrationPlanFS(
+	sql *sql.DB, migrationFS fs.FS, migrationPath string, migrateVersion uint) (plan Plan, err error) {
+	src, err := getFSSource(migrationFS, migrationPath)
+	if err != nil {
+		return plan, err
+	}
+	defer src.Close()
+
+	return getMigrationPlan(sql, src, migrateVersion)
+}
+
+/***********************************************************************************************************************
+ * Private
+ **********************************************************************************************************************/
+
+func getFSSource(migrationFS fs.FS, migrationPath string) (src source.Driver, err error) {
+	if src, err = httpfs.New(http.FS(migrationFS), path.Join("/", migrationPath)); err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	return src, nil
+}
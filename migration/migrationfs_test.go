@@ -0,0 +1,95 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2022 Renesas Electronics Corporation.
+// Copyright (C) 2022 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.16
+// +build go1.16
+
+package migration_test
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"testing"
+	"testing/fstest"
+
+	"github.com/aoscloud/aos_common/migration"
+)
+
+/***********************************************************************************************************************
+ * Public
+ **********************************************************************************************************************/
+
+func TestMigrateFS(t *testing.T) {
+	if err := os.MkdirAll(testFolder, folderPerm); err != nil {
+		t.Fatalf("Error creating directory: %s", err)
+	}
+
+	defer func() {
+		if err := os.RemoveAll(testFolder); err != nil {
+			t.Fatalf("Error cleaning up: %s", err)
+		}
+	}()
+
+	var (
+		currentVersion uint = 1
+		nextVersion    uint = 10
+		dbName              = path.Join(testFolder, "test.db")
+		migrationFS         = fstest.MapFS{}
+	)
+
+	for i := 0; i <= int(nextVersion); i++ {
+		migrationFS[fmt.Sprintf("migrations/%d_update.up.sql", i)] = &fstest.MapFile{
+			Data: []byte(fmt.Sprintf("UPDATE testing SET version = %d;", i)),
+		}
+		migrationFS[fmt.Sprintf("migrations/%d_update.down.sql", i)] = &fstest.MapFile{
+			Data: []byte(fmt.Sprintf("UPDATE testing SET version = %d;", i-1)),
+		}
+	}
+
+	if err := createTestDB(dbName, currentVersion); err != nil {
+		t.Fatalf("Error preparing test db, err %s", err)
+	}
+
+	sqlite, err := getSQLConnection(dbName)
+	if err != nil {
+		t.Fatalf("Can't create database connection: %s", err)
+	}
+	defer sqlite.Close()
+
+	if err = migration.SetDatabaseVersionFS(sqlite, migrationFS, "migrations", currentVersion); err != nil {
+		t.Fatalf("Can't set database version: %s", err)
+	}
+
+	if err = migration.DoMigrateFS(sqlite, migrationFS, "migrations", nextVersion); err != nil {
+		t.Fatalf("Can't migrate database: %s", err)
+	}
+
+	checkOperationVersion(t, sqlite, dbName, nextVersion)
+
+	if err = migration.DownFS(sqlite, migrationFS, "migrations", 2); err != nil {
+		t.Fatalf("Can't migrate database down: %s", err)
+	}
+
+	checkOperationVersion(t, sqlite, dbName, nextVersion-2)
+
+	if err = migration.MigrateToFS(sqlite, migrationFS, "migrations", currentVersion); err != nil {
+		t.Fatalf("Can't migrate database: %s", err)
+	}
+
+	checkOperationVersion(t, sqlite, dbName, currentVersion)
+}
@@ -0,0 +1,438 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2022 Renesas Electronics Corporation.
+// Copyright (C) 2022 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migration_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/aoscloud/aos_common/aoserrors"
+	"github.com/aoscloud/aos_common/migration"
+)
+
+/***********************************************************************************************************************
+ * Consts
+ **********************************************************************************************************************/
+
+const (
+	postgresURLEnv      = "AOS_TEST_POSTGRES_URL"
+	postgresTestTimeout = 10 * time.Second
+)
+
+/***********************************************************************************************************************
+ * Types
+ **********************************************************************************************************************/
+
+// fakePostgres emulates postgres server state required by migration driver and records executed queries.
+type fakePostgres struct {
+	sync.Mutex
+
+	queries    []string
+	hasVersion bool
+	version    int64
+	dirty      bool
+	checksums  map[int64]string
+	locked     bool
+	lockOwner  *fakePostgresConn
+}
+
+type fakePostgresConnector struct {
+	server *fakePostgres
+}
+
+type fakePostgresConn struct {
+	server *fakePostgres
+}
+
+type fakePostgresRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+/***********************************************************************************************************************
+ * Vars
+ **********************************************************************************************************************/
+
+// nolint:gochecknoglobals
+var spaceRegexp = regexp.MustCompile(`\s+`)
+
+/***********************************************************************************************************************
+ * Tests
+ **********************************************************************************************************************/
+
+func TestPostgresDialect(t *testing.T) {
+	migrationPath := createPostgresMigrations(t, 3, "UPDATE testing SET version = %d;")
+
+	server := &fakePostgres{checksums: make(map[int64]string)}
+
+	db := sql.OpenDB(&fakePostgresConnector{server: server})
+	defer db.Close()
+
+	if err := migration.DoMigrate(db, migrationPath, 3); err != nil {
+		t.Fatalf("Can't migrate database: %s", err)
+	}
+
+	if !server.hasVersion || server.version != 3 || server.dirty {
+		t.Errorf("Wrong database version: %d, dirty: %v", server.version, server.dirty)
+	}
+
+	if len(server.checksums) != 3 {
+		t.Errorf("Wrong checksums count: %d", len(server.checksums))
+	}
+
+	if server.locked {
+		t.Error("Advisory lock is not released")
+	}
+
+	for _, query := range []string{
+		"CREATE TABLE IF NOT EXISTS schema_migrations (version bigint NOT NULL PRIMARY KEY, dirty boolean NOT NULL)",
+		"CREATE TABLE IF NOT EXISTS schema_migrations_checksums " +
+			"(version bigint NOT NULL PRIMARY KEY, checksum text NOT NULL)",
+		"SELECT pg_advisory_lock($1)",
+		"SELECT pg_advisory_unlock($1)",
+		"INSERT INTO schema_migrations (version, dirty) VALUES ($1, $2)",
+		"INSERT INTO schema_migrations_checksums (version, checksum) VALUES ($1, $2) " +
+			"ON CONFLICT (version) DO UPDATE SET checksum = EXCLUDED.checksum",
+		"DELETE FROM schema_migrations_checksums WHERE version > $1",
+		"UPDATE testing SET version = 3;",
+	} {
+		if !server.hasQuery(query) {
+			t.Errorf("Query is not executed: %s", query)
+		}
+	}
+
+	if err := migration.Down(db, migrationPath, 2); err != nil {
+		t.Fatalf("Can't migrate database down: %s", err)
+	}
+
+	if server.version != 1 || server.dirty {
+		t.Errorf("Wrong database version: %d, dirty: %v", server.version, server.dirty)
+	}
+
+	if len(server.checksums) != 1 {
+		t.Errorf("Checksums of reverted migrations are not removed: %v", server.checksums)
+	}
+}
+
+func TestPostgresSingleConnection(t *testing.T) {
+	migrationPath := createPostgresMigrations(t, 3, "UPDATE testing SET version = %d;")
+
+	server := &fakePostgres{checksums: make(map[int64]string)}
+
+	db := sql.OpenDB(&fakePostgresConnector{server: server})
+	defer db.Close()
+
+	db.SetMaxOpenConns(1)
+
+	done := make(chan error, 1)
+
+	go func() {
+		if err := migration.DoMigrate(db, migrationPath, 3); err != nil {
+			done <- err
+			return
+		}
+
+		done <- migration.Down(db, migrationPath, 1)
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Can't migrate database: %s", err)
+		}
+
+	case <-time.After(postgresTestTimeout):
+		t.Fatal("Migration deadlocked with single connection pool")
+	}
+
+	if server.version != 2 || server.dirty {
+		t.Errorf("Wrong database version: %d, dirty: %v", server.version, server.dirty)
+	}
+
+	if server.locked {
+		t.Error("Advisory lock is not released")
+	}
+
+	// Connection should be returned to the pool
+	if _, err := db.Exec("SELECT 1"); err != nil {
+		t.Errorf("Can't use database after migration: %s", err)
+	}
+}
+
+func TestPostgresIntegration(t *testing.T) {
+	postgresURL := os.Getenv(postgresURLEnv)
+	if postgresURL == "" {
+		t.Skipf("%s is not set", postgresURLEnv)
+	}
+
+	db, err := sql.Open("postgres", postgresURL)
+	if err != nil {
+		t.Fatalf("Can't open database: %s", err)
+	}
+	defer db.Close()
+
+	cleanup := func() {
+		for _, table := range []string{"schema_migrations", "schema_migrations_checksums", "aos_migration_test"} {
+			if _, err := db.Exec("DROP TABLE IF EXISTS " + table); err != nil {
+				t.Errorf("Can't drop table: %s", err)
+			}
+		}
+	}
+
+	cleanup()
+	defer cleanup()
+
+	if _, err = db.Exec("CREATE TABLE aos_migration_test (version bigint NOT NULL)"); err != nil {
+		t.Fatalf("Can't create test table: %s", err)
+	}
+
+	if _, err = db.Exec("INSERT INTO aos_migration_test (version) VALUES (0)"); err != nil {
+		t.Fatalf("Can't init test table: %s", err)
+	}
+
+	migrationPath := createPostgresMigrations(t, 5, "UPDATE aos_migration_test SET version = %d;")
+
+	if err = migration.MigrateTo(db, migrationPath, 5); err != nil {
+		t.Fatalf("Can't migrate database: %s", err)
+	}
+
+	checkPostgresVersion(t, db, 5)
+
+	if err = migration.Down(db, migrationPath, 2); err != nil {
+		t.Fatalf("Can't migrate database down: %s", err)
+	}
+
+	checkPostgresVersion(t, db, 3)
+
+	if err = migration.DoMigrate(db, migrationPath, 5); err != nil {
+		t.Fatalf("Can't migrate database: %s", err)
+	}
+
+	checkPostgresVersion(t, db, 5)
+}
+
+/***********************************************************************************************************************
+ * Private
+ **********************************************************************************************************************/
+
+func createPostgresMigrations(t *testing.T, version int, script string) (migrationPath string) {
+	t.Helper()
+
+	migrationPath, err := ioutil.TempDir("", "postgres_migration_")
+	if err != nil {
+		t.Fatalf("Can't create migration dir: %s", err)
+	}
+
+	t.Cleanup(func() { os.RemoveAll(migrationPath) })
+
+	for i := 0; i <= version; i++ {
+		for fileName, content := range map[string]string{
+			fmt.Sprintf("%d_update.up.sql", i):   fmt.Sprintf(script, i),
+			fmt.Sprintf("%d_update.down.sql", i): fmt.Sprintf(script, i-1),
+		} {
+			if err = ioutil.WriteFile(filepath.Join(migrationPath, fileName), []byte(content), 0o600); err != nil {
+				t.Fatalf("Can't write migration file: %s", err)
+			}
+		}
+	}
+
+	return migrationPath
+}
+
+func checkPostgresVersion(t *testing.T, db *sql.DB, expectedVersion int) {
+	t.Helper()
+
+	var version int
+
+	if err := db.QueryRow("SELECT version FROM aos_migration_test").Scan(&version); err != nil {
+		t.Fatalf("Can't get test table version: %s", err)
+	}
+
+	if version != expectedVersion {
+		t.Errorf("Wrong test table version: %d", version)
+	}
+
+	var dirty bool
+
+	if err := db.QueryRow("SELECT version, dirty FROM schema_migrations").Scan(&version, &dirty); err != nil {
+		t.Fatalf("Can't get migration version: %s", err)
+	}
+
+	if version != expectedVersion || dirty {
+		t.Errorf("Wrong migration version: %d, dirty: %v", version, dirty)
+	}
+}
+
+func (server *fakePostgres) hasQuery(query string) bool {
+	server.Lock()
+	defer server.Unlock()
+
+	for _, executed := range server.queries {
+		if executed == query {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (server *fakePostgres) exec(conn *fakePostgresConn, query string, args []driver.NamedValue) (err error) {
+	server.Lock()
+	defer server.Unlock()
+
+	query = strings.TrimSpace(spaceRegexp.ReplaceAllString(query, " "))
+	server.queries = append(server.queries, query)
+
+	// Emulate advisory lock: other sessions can't modify the database while it is locked
+	if server.locked && server.lockOwner != conn {
+		return aoserrors.Errorf("query is executed outside of lock session: %s", query)
+	}
+
+	switch {
+	case strings.HasPrefix(query, "SELECT pg_advisory_lock("):
+		if server.locked {
+			return aoserrors.New("already locked")
+		}
+
+		server.locked, server.lockOwner = true, conn
+
+	case strings.HasPrefix(query, "SELECT pg_advisory_unlock("):
+		server.locked, server.lockOwner = false, nil
+
+	case query == "DELETE FROM schema_migrations":
+		server.hasVersion = false
+
+	case strings.HasPrefix(query, "INSERT INTO schema_migrations (version, dirty)"):
+		server.hasVersion, server.version, server.dirty = true, args[0].Value.(int64), args[1].Value.(bool)
+
+	case strings.HasPrefix(query, "INSERT INTO schema_migrations_checksums"):
+		server.checksums[args[0].Value.(int64)] = args[1].Value.(string)
+
+	case strings.HasPrefix(query, "DELETE FROM schema_migrations_checksums WHERE version >"):
+		for version := range server.checksums {
+			if version > args[0].Value.(int64) {
+				delete(server.checksums, version)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (server *fakePostgres) query(query string) (rows driver.Rows, err error) {
+	server.Lock()
+	defer server.Unlock()
+
+	switch query {
+	case "SELECT version, dirty FROM schema_migrations LIMIT 1":
+		versionRows := &fakePostgresRows{columns: []string{"version", "dirty"}}
+
+		if server.hasVersion {
+			versionRows.values = append(versionRows.values, []driver.Value{server.version, server.dirty})
+		}
+
+		return versionRows, nil
+
+	case "SELECT version, checksum FROM schema_migrations_checksums":
+		checksumRows := &fakePostgresRows{columns: []string{"version", "checksum"}}
+
+		for version, checksum := range server.checksums {
+			checksumRows.values = append(checksumRows.values, []driver.Value{version, checksum})
+		}
+
+		return checksumRows, nil
+
+	default:
+		return nil, aoserrors.Errorf("unexpected query: %s", query)
+	}
+}
+
+func (connector *fakePostgresConnector) Connect(context.Context) (driver.Conn, error) {
+	return &fakePostgresConn{server: connector.server}, nil
+}
+
+// Driver returns postgres driver to make migration use postgres dialect.
+func (connector *fakePostgresConnector) Driver() driver.Driver {
+	return &pq.Driver{}
+}
+
+func (conn *fakePostgresConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, aoserrors.New("prepare is not supported")
+}
+
+func (conn *fakePostgresConn) Close() error {
+	return nil
+}
+
+func (conn *fakePostgresConn) Begin() (driver.Tx, error) {
+	return conn, nil
+}
+
+func (conn *fakePostgresConn) Commit() error {
+	return nil
+}
+
+func (conn *fakePostgresConn) Rollback() error {
+	return nil
+}
+
+func (conn *fakePostgresConn) ExecContext(
+	ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if err := conn.server.exec(conn, query, args); err != nil {
+		return nil, err
+	}
+
+	return driver.RowsAffected(0), nil
+}
+
+func (conn *fakePostgresConn) QueryContext(
+	ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return conn.server.query(query)
+}
+
+func (rows *fakePostgresRows) Columns() []string {
+	return rows.columns
+}
+
+func (rows *fakePostgresRows) Close() error {
+	return nil
+}
+
+func (rows *fakePostgresRows) Next(dest []driver.Value) error {
+	if len(rows.values) == 0 {
+		return io.EOF
+	}
+
+	copy(dest, rows.values[0])
+	rows.values = rows.values[1:]
+
+	return nil
+}
@@ -19,11 +19,30 @@ package action
 
 import (
 	"container/list"
+	"context"
+	"encoding/json"
 	"sync"
 
+	log "github.com/sirupsen/logrus"
+
 	"github.com/aoscloud/aos_common/aoserrors"
 )
 
+/***********************************************************************************************************************
+ * Consts
+ **********************************************************************************************************************/
+
+// Action priorities.
+const (
+	PriorityLow Priority = iota - 1
+	PriorityNormal
+	PriorityHigh
+)
+
+// maxSkipCount number of times waiting action may be skipped by higher priority actions before it is executed
+// regardless of priority.
+const maxSkipCount = 8
+
 /***********************************************************************************************************************
  * Types
  **********************************************************************************************************************/
@@ -33,18 +52,56 @@ type Handler struct {
 	sync.Mutex
 
 	maxConcurrentActions int
+	storage              Storage
+	nextSeq              uint64
+	pendingActions       []Info
 	wg                   sync.WaitGroup
 	waitQueue            *list.List
 	workQueue            *list.List
 }
 
+// Param action handler parameters.
+type Param struct {
+	// MaxConcurrentActions max number of concurrently executed actions. Not limited if 0.
+	MaxConcurrentActions int
+	// Storage persists actions executed with ExecutePersistent. Actions are not persisted if not set.
+	Storage Storage
+}
+
+// Info persistent action info. It should contain enough data to restore the action after restart.
+type Info struct {
+	Seq      uint64          `json:"seq"`
+	ID       string          `json:"id"`
+	Priority Priority        `json:"priority"`
+	Type     string          `json:"type"`
+	Data     json.RawMessage `json:"data,omitempty"`
+}
+
+// Storage action persistent storage.
+type Storage interface {
+	AddAction(info Info) (err error)
+	RemoveAction(seq uint64) (err error)
+	GetActions() (infos []Info, err error)
+}
+
 // Func action function type.
 type Func func(id string) (err error)
 
+// ContextFunc action function type with context. Context is canceled when the action is canceled.
+type ContextFunc func(ctx context.Context, id string) (err error)
+
+// Priority action priority. Waiting actions with higher priority are executed first.
+type Priority int
+
 type action struct {
-	id       string
-	doAction Func
-	channel  chan error
+	id         string
+	priority   Priority
+	skipCount  int
+	doAction   ContextFunc
+	ctx        context.Context
+	cancelFunc context.CancelFunc
+	channel    chan error
+	info       *Info
 }
 
 /***********************************************************************************************************************
@@ -62,27 +119,125 @@ func New(maxConcurrentActions int) (handler *Handler) {
 	return handler
 }
 
-// Execute executes action.
+// NewWithParam creates new action handler with parameters. Actions pending in the storage are executed on Restore.
+func NewWithParam(param Param) (handler *Handler, err error) {
+	handler = New(param.MaxConcurrentActions)
+
+	if param.Storage == nil {
+		return handler, nil
+	}
+
+	handler.storage = param.Storage
+
+	if handler.pendingActions, err = handler.storage.GetActions(); err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	for _, info := range handler.pendingActions {
+		if info.Seq >= handler.nextSeq {
+			handler.nextSeq = info.Seq + 1
+		}
+	}
+
+	return handler, nil
+}
+
+// Execute executes action with normal priority.
 func (handler *Handler) Execute(id string, doAction Func) (channel <-chan error) {
+	return handler.ExecutePriority(id, PriorityNormal, doAction)
+}
+
+// ExecutePriority executes action with specified priority.
+func (handler *Handler) ExecutePriority(id string, priority Priority, doAction Func) (channel <-chan error) {
+	return handler.ExecuteContext(context.Background(), id, priority, func(ctx context.Context, id string) error {
+		return doAction(id)
+	})
+}
+
+// ExecuteContext executes action with specified priority and context. Action is not started if ctx is done while
+// it is waiting in the queue.
+func (handler *Handler) ExecuteContext(
+	ctx context.Context, id string, priority Priority, doAction ContextFunc) (channel <-chan error) {
 	handler.Lock()
 	defer handler.Unlock()
 
-	handler.wg.Add(1)
+	return handler.execute(ctx, id, priority, doAction, nil)
+}
+
+// ExecutePersistent executes action which is kept in the storage until it is finished or canceled.
+// Info ID and priority are used as action id and priority.
+func (handler *Handler) ExecutePersistent(
+	ctx context.Context, info Info, doAction ContextFunc) (channel <-chan error) {
+	handler.Lock()
+	defer handler.Unlock()
 
-	newAction := action{
-		id:       id,
-		doAction: doAction,
-		channel:  make(chan error, 1),
+	if handler.storage != nil {
+		info.Seq = handler.nextSeq
+		handler.nextSeq++
+
+		if err := handler.storage.AddAction(info); err != nil {
+			log.WithField("id", info.ID).Errorf("Can't store action: %s", err)
+		}
 	}
 
-	if handler.isIDInWorkQueue(newAction.id) ||
-		(handler.workQueue.Len() >= handler.maxConcurrentActions && handler.maxConcurrentActions != 0) {
-		handler.waitQueue.PushBack(newAction)
-	} else {
-		go handler.processAction(handler.workQueue.PushBack(newAction))
+	return handler.execute(ctx, info.ID, info.Priority, doAction, &info)
+}
+
+// Restore executes actions left in the storage by previous run. restoreAction should return nil if the action is
+// not relevant anymore, such action is removed from the storage.
+func (handler *Handler) Restore(ctx context.Context, restoreAction func(info Info) ContextFunc) {
+	handler.Lock()
+	defer handler.Unlock()
+
+	for _, info := range handler.pendingActions {
+		info := info
+
+		log.WithFields(log.Fields{"id": info.ID, "type": info.Type}).Debug("Restore action")
+
+		doAction := restoreAction(info)
+		if doAction == nil {
+			handler.removeStoredAction(&info)
+
+			continue
+		}
+
+		go func(channel <-chan error) {
+			if err := <-channel; err != nil {
+				log.WithField("id", info.ID).Errorf("Restored action failed: %s", err)
+			}
+		}(handler.execute(ctx, info.ID, info.Priority, doAction, &info))
 	}
 
-	return newAction.channel
+	handler.pendingActions = nil
+}
+
+// Cancel cancels all queued and in-flight actions with specified id. Queued actions are removed from the queue,
+// in-flight actions get their context canceled. Removed actions report context.Canceled error.
+func (handler *Handler) Cancel(id string) {
+	handler.Lock()
+	defer handler.Unlock()
+
+	for item := handler.workQueue.Front(); item != nil; item = item.Next() {
+		if currentAction := item.Value.(*action); currentAction.id == id {
+			currentAction.cancelFunc()
+		}
+	}
+
+	for item := handler.waitQueue.Front(); item != nil; {
+		nextItem := item.Next()
+
+		if waitAction := item.Value.(*action); waitAction.id == id {
+			handler.waitQueue.Remove(item)
+
+			waitAction.cancelFunc()
+			handler.removeStoredAction(waitAction.info)
+			waitAction.finish(aoserrors.Wrap(context.Canceled))
+
+			handler.wg.Done()
+		}
+
+		item = nextItem
+	}
 }
 
 // Wait waits all actions are executed.
@@ -94,9 +249,35 @@ func (handler *Handler) Wait() {
  * Private
  **********************************************************************************************************************/
 
+func (handler *Handler) execute(
+	ctx context.Context, id string, priority Priority, doAction ContextFunc, info *Info) (channel <-chan error) {
+	handler.wg.Add(1)
+
+	actionCtx, cancelFunc := context.WithCancel(ctx)
+
+	newAction := &action{
+		id:         id,
+		priority:   priority,
+		doAction:   doAction,
+		ctx:        actionCtx,
+		cancelFunc: cancelFunc,
+		channel:    make(chan error, 1),
+		info:       info,
+	}
+
+	if handler.isIDInWorkQueue(newAction.id) ||
+		(handler.workQueue.Len() >= handler.maxConcurrentActions && handler.maxConcurrentActions != 0) {
+		handler.waitQueue.PushBack(newAction)
+	} else {
+		go handler.processAction(handler.workQueue.PushBack(newAction))
+	}
+
+	return newAction.channel
+}
+
 func (handler *Handler) isIDInWorkQueue(id string) (result bool) {
 	for item := handler.workQueue.Front(); item != nil; item = item.Next() {
-		if item.Value.(action).id == id {
+		if item.Value.(*action).id == id {
 			return true
 		}
 	}
@@ -107,35 +288,73 @@ func (handler *Handler) isIDInWorkQueue(id string) (result bool) {
 func (handler *Handler) processAction(item *list.Element) {
 	defer handler.wg.Done()
 
-	var actionError error
+	currentAction := item.Value.(*action)
 
-	currentAction, ok := item.Value.(action)
-	if ok {
-		actionError = currentAction.doAction(currentAction.id)
-	} else {
-		actionError = aoserrors.New("wrong action type")
+	actionError := aoserrors.Wrap(currentAction.ctx.Err())
+	if actionError == nil {
+		actionError = currentAction.doAction(currentAction.ctx, currentAction.id)
 	}
 
-	currentAction.channel <- actionError
-	close(currentAction.channel)
+	currentAction.cancelFunc()
+	handler.removeStoredAction(currentAction.info)
+	currentAction.finish(actionError)
 
 	handler.Lock()
 	defer handler.Unlock()
 
 	handler.workQueue.Remove(item)
 
+	if nextItem := handler.getNextWaitItem(); nextItem != nil {
+		go handler.processAction(handler.workQueue.PushBack(handler.waitQueue.Remove(nextItem)))
+	}
+}
+
+func (handler *Handler) getNextWaitItem() (nextItem *list.Element) {
 	for waitItem := handler.waitQueue.Front(); waitItem != nil; waitItem = waitItem.Next() {
-		waitAction, ok := waitItem.Value.(action)
-		if !ok {
-			continue
-		}
+		waitAction := waitItem.Value.(*action)
 
 		if handler.isIDInWorkQueue(waitAction.id) {
 			continue
 		}
 
-		go handler.processAction(handler.workQueue.PushBack(handler.waitQueue.Remove(waitItem)))
+		// Starved action is executed regardless of priority
+		if waitAction.skipCount >= maxSkipCount {
+			return waitItem
+		}
 
-		break
+		if nextItem == nil || waitAction.priority > nextItem.Value.(*action).priority {
+			nextItem = waitItem
+		}
 	}
+
+	if nextItem == nil {
+		return nil
+	}
+
+	nextPriority := nextItem.Value.(*action).priority
+
+	for waitItem := handler.waitQueue.Front(); waitItem != nextItem; waitItem = waitItem.Next() {
+		waitAction := waitItem.Value.(*action)
+
+		if waitAction.priority < nextPriority && !handler.isIDInWorkQueue(waitAction.id) {
+			waitAction.skipCount++
+		}
+	}
+
+	return nextItem
+}
+
+func (handler *Handler) removeStoredAction(info *Info) {
+	if info == nil || handler.storage == nil {
+		return
+	}
+
+	if err := handler.storage.RemoveAction(info.Seq); err != nil {
+		log.WithField("id", info.ID).Errorf("Can't remove stored action: %s", err)
+	}
+}
+
+func (currentAction *action) finish(err error) {
+	currentAction.channel <- err
+	close(currentAction.channel)
 }
@@ -18,7 +18,11 @@
 package action_test
 
 import (
+	"context"
 	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"sync"
 	"testing"
 
@@ -97,3 +101,235 @@ func TestExecuteChannel(t *testing.T) {
 
 	wg.Wait()
 }
+
+func TestExecutePriority(t *testing.T) {
+	actionHandler := action.New(1)
+
+	releaseChannel := make(chan struct{})
+
+	actionHandler.Execute("blocker", func(id string) (err error) {
+		<-releaseChannel
+
+		return nil
+	})
+
+	var (
+		mutex  sync.Mutex
+		result []string
+	)
+
+	doAction := func(id string) (err error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		result = append(result, id)
+
+		return nil
+	}
+
+	actionHandler.ExecutePriority("low", action.PriorityLow, doAction)
+	actionHandler.ExecutePriority("normal", action.PriorityNormal, doAction)
+	actionHandler.ExecutePriority("high", action.PriorityHigh, doAction)
+
+	close(releaseChannel)
+
+	actionHandler.Wait()
+
+	expectedResult := []string{"high", "normal", "low"}
+
+	if len(result) != len(expectedResult) {
+		t.Fatalf("Wrong result len: %d", len(result))
+	}
+
+	for i, id := range expectedResult {
+		if result[i] != id {
+			t.Errorf("Wrong execution order: %v", result)
+
+			break
+		}
+	}
+}
+
+func TestExecuteStarvation(t *testing.T) {
+	actionHandler := action.New(1)
+
+	var (
+		mutex  sync.Mutex
+		result []string
+	)
+
+	releaseChannel := make(chan struct{})
+
+	actionHandler.Execute("blocker", func(id string) (err error) {
+		<-releaseChannel
+
+		return nil
+	})
+
+	actionHandler.ExecutePriority("low", action.PriorityLow, func(id string) (err error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		result = append(result, id)
+
+		return nil
+	})
+
+	// Each high priority action queues next one, so low priority action is always skipped
+	var queueHigh func(id string) (err error)
+
+	count := 0
+
+	queueHigh = func(id string) (err error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		result = append(result, id)
+
+		if count++; count < 20 {
+			actionHandler.ExecutePriority("high", action.PriorityHigh, queueHigh)
+		}
+
+		return nil
+	}
+
+	actionHandler.ExecutePriority("high", action.PriorityHigh, queueHigh)
+
+	close(releaseChannel)
+
+	actionHandler.Wait()
+
+	for i, id := range result {
+		if id == "low" {
+			if i == len(result)-1 {
+				t.Error("Low priority action is starved")
+			}
+
+			return
+		}
+	}
+
+	t.Error("Low priority action is not executed")
+}
+
+func TestCancel(t *testing.T) {
+	actionHandler := action.New(1)
+
+	startedChannel := make(chan struct{})
+
+	inFlightChannel := actionHandler.ExecuteContext(context.Background(), "inFlight", action.PriorityNormal,
+		func(ctx context.Context, id string) (err error) {
+			close(startedChannel)
+
+			<-ctx.Done()
+
+			return aoserrors.Wrap(ctx.Err())
+		})
+
+	queuedChannel := actionHandler.Execute("queued", func(id string) (err error) {
+		t.Error("Canceled action should not be executed")
+
+		return nil
+	})
+
+	otherChannel := actionHandler.Execute("other", func(id string) (err error) { return nil })
+
+	<-startedChannel
+
+	actionHandler.Cancel("queued")
+	actionHandler.Cancel("inFlight")
+
+	if err := <-queuedChannel; !errors.Is(err, context.Canceled) {
+		t.Errorf("Wrong queued action error: %v", err)
+	}
+
+	if err := <-inFlightChannel; !errors.Is(err, context.Canceled) {
+		t.Errorf("Wrong in-flight action error: %v", err)
+	}
+
+	if err := <-otherChannel; err != nil {
+		t.Errorf("Other action error: %s", err)
+	}
+
+	actionHandler.Wait()
+}
+
+func TestPersistentActions(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "action_")
+	if err != nil {
+		t.Fatalf("Can't create tmp dir: %s", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	storageFile := filepath.Join(tmpDir, "actions.json")
+
+	storage, err := action.NewJSONStorage(storageFile)
+	if err != nil {
+		t.Fatalf("Can't create storage: %s", err)
+	}
+
+	actionHandler, err := action.NewWithParam(action.Param{MaxConcurrentActions: 1, Storage: storage})
+	if err != nil {
+		t.Fatalf("Can't create action handler: %s", err)
+	}
+
+	releaseChannel := make(chan struct{})
+
+	doAction := func(ctx context.Context, id string) (err error) {
+		<-releaseChannel
+
+		return nil
+	}
+
+	actionHandler.ExecutePersistent(context.Background(),
+		action.Info{ID: "install", Type: "install", Data: []byte(`{"version":1}`)}, doAction)
+	actionHandler.ExecutePersistent(context.Background(),
+		action.Info{ID: "remove", Type: "remove"}, doAction)
+
+	// Simulate restart: create new handler on the same storage file
+
+	restoredStorage, err := action.NewJSONStorage(storageFile)
+	if err != nil {
+		t.Fatalf("Can't create storage: %s", err)
+	}
+
+	restoredHandler, err := action.NewWithParam(action.Param{Storage: restoredStorage})
+	if err != nil {
+		t.Fatalf("Can't create action handler: %s", err)
+	}
+
+	var restored []string
+
+	restoredHandler.Restore(context.Background(), func(info action.Info) action.ContextFunc {
+		restored = append(restored, info.Type)
+
+		if info.Type != "install" {
+			return nil
+		}
+
+		if string(info.Data) != `{"version":1}` {
+			t.Errorf("Wrong action data: %s", string(info.Data))
+		}
+
+		return func(ctx context.Context, id string) (err error) { return nil }
+	})
+
+	restoredHandler.Wait()
+
+	if len(restored) != 2 || restored[0] != "install" || restored[1] != "remove" {
+		t.Errorf("Wrong restored actions: %v", restored)
+	}
+
+	infos, err := restoredStorage.GetActions()
+	if err != nil {
+		t.Fatalf("Can't get actions: %s", err)
+	}
+
+	if len(infos) != 0 {
+		t.Errorf("Wrong stored actions count: %d", len(infos))
+	}
+
+	close(releaseChannel)
+
+	actionHandler.Wait()
+}
@@ -0,0 +1,140 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/aoscloud/aos_common/aoserrors"
+)
+
+/***********************************************************************************************************************
+ * Consts
+ **********************************************************************************************************************/
+
+const storagePerm = 0o600
+
+/***********************************************************************************************************************
+ * Types
+ **********************************************************************************************************************/
+
+// JSONStorage stores actions in JSON journal file. File is replaced atomically on each change.
+type JSONStorage struct {
+	sync.Mutex
+
+	fileName string
+	infos    []Info
+}
+
+/***********************************************************************************************************************
+ * Public
+ **********************************************************************************************************************/
+
+// NewJSONStorage creates JSON storage. Actions are loaded from the file if it exists.
+func NewJSONStorage(fileName string) (storage *JSONStorage, err error) {
+	storage = &JSONStorage{fileName: fileName}
+
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return storage, nil
+		}
+
+		return nil, aoserrors.Wrap(err)
+	}
+
+	if err = json.Unmarshal(data, &storage.infos); err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	return storage, nil
+}
+
+// AddAction adds action to the storage.
+func (storage *JSONStorage) AddAction(info Info) (err error) {
+	storage.Lock()
+	defer storage.Unlock()
+
+	storage.infos = append(storage.infos, info)
+
+	return storage.save()
+}
+
+// RemoveAction removes action from the storage.
+func (storage *JSONStorage) RemoveAction(seq uint64) (err error) {
+	storage.Lock()
+	defer storage.Unlock()
+
+	for i, info := range storage.infos {
+		if info.Seq == seq {
+			storage.infos = append(storage.infos[:i], storage.infos[i+1:]...)
+
+			return storage.save()
+		}
+	}
+
+	return aoserrors.Errorf("action %d not found", seq)
+}
+
+// GetActions returns stored actions in order they were added.
+func (storage *JSONStorage) GetActions() (infos []Info, err error) {
+	storage.Lock()
+	defer storage.Unlock()
+
+	return append([]Info(nil), storage.infos...), nil
+}
+
+/***********************************************************************************************************************
+ * Private
+ **********************************************************************************************************************/
+
+func (storage *JSONStorage) save() (err error) {
+	data, err := json.Marshal(storage.infos)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	tmpFileName := storage.fileName + ".tmp"
+
+	file, err := os.OpenFile(tmpFileName, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, storagePerm)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	if _, err = file.Write(data); err == nil {
+		err = file.Sync()
+	}
+
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	if err = os.Rename(tmpFileName, storage.fileName); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	return nil
+}
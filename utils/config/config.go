@@ -0,0 +1,327 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package config loads component JSON configs with environment overrides and validation.
+package config
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/aoscloud/aos_common/aoserrors"
+	"github.com/aoscloud/aos_common/aostypes"
+)
+
+/***********************************************************************************************************************
+ * Consts
+ **********************************************************************************************************************/
+
+const (
+	validateTag = "validate"
+	jsonTag     = "json"
+)
+
+/***********************************************************************************************************************
+ * Vars
+ **********************************************************************************************************************/
+
+// nolint:gochecknoglobals // used for type checks
+var (
+	unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	durationType    = reflect.TypeOf(time.Duration(0))
+	aosDurationType = reflect.TypeOf(aostypes.Duration{})
+	sizeType        = reflect.TypeOf(aostypes.Size(0))
+)
+
+/***********************************************************************************************************************
+ * Public
+ **********************************************************************************************************************/
+
+// Load loads JSON config from file. config should be a pointer to struct initialized with default values.
+// Loaded values are overridden by environment variables named envPrefix and upper snake case JSON field path,
+// e.g. AOS_SM_MONITORING_POLL_PERIOD for monitoring.pollPeriod, then config is validated.
+func Load(fileName, envPrefix string, config interface{}) (err error) {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	if err = json.Unmarshal(data, config); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	value, err := getStructValue(config)
+	if err != nil {
+		return err
+	}
+
+	if envPrefix != "" {
+		if err = applyEnv(value, envPrefix); err != nil {
+			return err
+		}
+	}
+
+	return Validate(config)
+}
+
+// Validate validates config according to validate tags. Supported rules: required - field should not be empty,
+// min=X and max=X - limits of numeric, duration and size values or length of strings, slices and maps,
+// e.g. `validate:"required,min=1s"`, `validate:"max=1GiB"`.
+func Validate(config interface{}) (err error) {
+	value, err := getStructValue(config)
+	if err != nil {
+		return err
+	}
+
+	return validateStruct(value, "")
+}
+
+/***********************************************************************************************************************
+ * Private
+ **********************************************************************************************************************/
+
+func getStructValue(config interface{}) (value reflect.Value, err error) {
+	value = reflect.ValueOf(config)
+
+	if value.Kind() == reflect.Ptr {
+		value = value.Elem()
+	}
+
+	if value.Kind() != reflect.Struct {
+		return value, aoserrors.New("config should be a struct")
+	}
+
+	return value, nil
+}
+
+func isNestedStruct(value reflect.Value) (nested bool) {
+	return value.Kind() == reflect.Struct && !reflect.PtrTo(value.Type()).Implements(unmarshalerType)
+}
+
+func applyEnv(value reflect.Value, prefix string) (err error) {
+	for i := 0; i < value.NumField(); i++ {
+		field, fieldType := value.Field(i), value.Type().Field(i)
+
+		if fieldType.PkgPath != "" || fieldType.Tag.Get(jsonTag) == "-" {
+			continue
+		}
+
+		envName := prefix + "_" + toSnakeCase(getFieldName(fieldType))
+
+		if isNestedStruct(field) {
+			if err = applyEnv(field, envName); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		envValue, ok := os.LookupEnv(envName)
+		if !ok {
+			continue
+		}
+
+		log.WithField("name", envName).Debug("Override config value from environment")
+
+		if err = setValue(field, envValue); err != nil {
+			return aoserrors.Errorf("invalid %s value: %s", envName, err)
+		}
+	}
+
+	return nil
+}
+
+func setValue(field reflect.Value, rawValue string) (err error) {
+	if field.Kind() == reflect.String && !reflect.PtrTo(field.Type()).Implements(unmarshalerType) {
+		field.SetString(rawValue)
+
+		return nil
+	}
+
+	if field.Type() == durationType {
+		duration, err := time.ParseDuration(rawValue)
+		if err != nil {
+			return aoserrors.Wrap(err)
+		}
+
+		field.SetInt(int64(duration))
+
+		return nil
+	}
+
+	// Try raw JSON first (numbers, bools, arrays, objects), then JSON string (durations, sizes etc.)
+	if err = json.Unmarshal([]byte(rawValue), field.Addr().Interface()); err != nil {
+		quotedValue, _ := json.Marshal(rawValue)
+
+		if quotedErr := json.Unmarshal(quotedValue, field.Addr().Interface()); quotedErr != nil {
+			return aoserrors.Wrap(err)
+		}
+	}
+
+	return nil
+}
+
+func validateStruct(value reflect.Value, path string) (err error) {
+	for i := 0; i < value.NumField(); i++ {
+		field, fieldType := value.Field(i), value.Type().Field(i)
+
+		if fieldType.PkgPath != "" {
+			continue
+		}
+
+		fieldPath := getFieldName(fieldType)
+		if path != "" {
+			fieldPath = path + "." + fieldPath
+		}
+
+		if rules, ok := fieldType.Tag.Lookup(validateTag); ok {
+			if err = validateField(field, fieldPath, rules); err != nil {
+				return err
+			}
+		}
+
+		if isNestedStruct(field) {
+			if err = validateStruct(field, fieldPath); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func validateField(field reflect.Value, path, rules string) (err error) {
+	for _, rule := range strings.Split(rules, ",") {
+		name, limit := rule, ""
+
+		if pos := strings.Index(rule, "="); pos >= 0 {
+			name, limit = rule[:pos], rule[pos+1:]
+		}
+
+		switch name {
+		case "required":
+			if field.IsZero() {
+				return aoserrors.Errorf("%s is required", path)
+			}
+
+		case "min", "max":
+			if err = checkLimit(field, path, name, limit); err != nil {
+				return err
+			}
+
+		case "":
+
+		default:
+			return aoserrors.Errorf("unsupported validation rule %s for %s", rule, path)
+		}
+	}
+
+	return nil
+}
+
+func checkLimit(field reflect.Value, path, name, limitStr string) (err error) {
+	value, ok := getNumericValue(field)
+	if !ok {
+		return aoserrors.Errorf("%s rule is not supported for %s", name, path)
+	}
+
+	var limit float64
+
+	if field.Type() == durationType || field.Type() == aosDurationType {
+		duration, err := time.ParseDuration(limitStr)
+		if err != nil {
+			return aoserrors.Errorf("invalid %s limit for %s: %s", name, path, err)
+		}
+
+		limit = float64(duration)
+	} else if field.Type() == sizeType {
+		size, err := aostypes.ParseSize(limitStr)
+		if err != nil {
+			return aoserrors.Errorf("invalid %s limit for %s: %s", name, path, err)
+		}
+
+		limit = float64(size)
+	} else if limit, err = strconv.ParseFloat(limitStr, 64); err != nil {
+		return aoserrors.Errorf("invalid %s limit for %s: %s", name, path, err)
+	}
+
+	if name == "min" && value < limit {
+		return aoserrors.Errorf("%s should be at least %s", path, limitStr)
+	}
+
+	if name == "max" && value > limit {
+		return aoserrors.Errorf("%s should be at most %s", path, limitStr)
+	}
+
+	return nil
+}
+
+func getNumericValue(field reflect.Value) (value float64, ok bool) {
+	if field.Type() == aosDurationType {
+		return float64(field.Interface().(aostypes.Duration).Duration), true
+	}
+
+	switch field.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(field.Int()), true
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(field.Uint()), true
+
+	case reflect.Float32, reflect.Float64:
+		return field.Float(), true
+
+	case reflect.String, reflect.Slice, reflect.Map:
+		return float64(field.Len()), true
+
+	default:
+		return 0, false
+	}
+}
+
+func getFieldName(field reflect.StructField) (name string) {
+	if tag := strings.Split(field.Tag.Get(jsonTag), ",")[0]; tag != "" && tag != "-" {
+		return tag
+	}
+
+	return field.Name
+}
+
+func toSnakeCase(name string) (snakeName string) {
+	var builder strings.Builder
+
+	runes := []rune(name)
+
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) &&
+			(unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+			builder.WriteRune('_')
+		}
+
+		builder.WriteRune(unicode.ToUpper(r))
+	}
+
+	return builder.String()
+}
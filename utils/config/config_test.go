@@ -0,0 +1,202 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aoscloud/aos_common/aoserrors"
+	"github.com/aoscloud/aos_common/aostypes"
+	"github.com/aoscloud/aos_common/utils/config"
+)
+
+/***********************************************************************************************************************
+ * Types
+ **********************************************************************************************************************/
+
+type testMonitoring struct {
+	PollPeriod aostypes.Duration `json:"pollPeriod" validate:"min=1s"`
+	MaxOffset  int               `json:"maxOffset" validate:"max=100"`
+}
+
+type testConfig struct {
+	WorkingDir string         `json:"workingDir" validate:"required"`
+	IAMServer  string         `json:"iamServer"`
+	Timeout    time.Duration  `json:"timeout"`
+	Hosts      []string       `json:"hosts"`
+	Enabled    bool           `json:"enabled"`
+	Quota      aostypes.Size  `json:"quota" validate:"max=1GiB"`
+	Monitoring testMonitoring `json:"monitoring"`
+}
+
+/***********************************************************************************************************************
+ * Tests
+ **********************************************************************************************************************/
+
+func TestLoad(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "config_")
+	if err != nil {
+		t.Fatalf("Can't create tmp dir: %s", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	configFile := filepath.Join(tmpDir, "config.json")
+
+	if err = ioutil.WriteFile(configFile, []byte(`{
+		"workingDir": "/var/aos",
+		"monitoring": {"maxOffset": 10}
+	}`), 0o600); err != nil {
+		t.Fatalf("Can't write config: %s", err)
+	}
+
+	envs := map[string]string{
+		"AOS_TEST_IAM_SERVER":             "localhost:8090",
+		"AOS_TEST_TIMEOUT":                "30s",
+		"AOS_TEST_HOSTS":                  `["host1","host2"]`,
+		"AOS_TEST_ENABLED":                "true",
+		"AOS_TEST_QUOTA":                  "512MiB",
+		"AOS_TEST_MONITORING_POLL_PERIOD": "1m",
+	}
+
+	for name, value := range envs {
+		os.Setenv(name, value)
+		defer os.Unsetenv(name)
+	}
+
+	cfg := testConfig{Monitoring: testMonitoring{PollPeriod: aostypes.Duration{Duration: 10 * time.Second}}}
+
+	if err = config.Load(configFile, "AOS_TEST", &cfg); err != nil {
+		t.Fatalf("Can't load config: %s", err)
+	}
+
+	if cfg.WorkingDir != "/var/aos" || cfg.IAMServer != "localhost:8090" || cfg.Timeout != 30*time.Second ||
+		len(cfg.Hosts) != 2 || !cfg.Enabled || cfg.Monitoring.PollPeriod.Duration != time.Minute ||
+		cfg.Monitoring.MaxOffset != 10 || cfg.Quota != 512*aostypes.MiB {
+		t.Errorf("Wrong config: %+v", cfg)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	data := []struct {
+		config testConfig
+		valid  bool
+	}{
+		{config: testConfig{WorkingDir: "/var/aos", Monitoring: testMonitoring{
+			PollPeriod: aostypes.Duration{Duration: time.Second},
+		}}, valid: true},
+		{config: testConfig{Monitoring: testMonitoring{
+			PollPeriod: aostypes.Duration{Duration: time.Second},
+		}}, valid: false},
+		{config: testConfig{WorkingDir: "/var/aos", Monitoring: testMonitoring{
+			PollPeriod: aostypes.Duration{Duration: time.Millisecond},
+		}}, valid: false},
+		{config: testConfig{WorkingDir: "/var/aos", Monitoring: testMonitoring{
+			PollPeriod: aostypes.Duration{Duration: time.Second}, MaxOffset: 101,
+		}}, valid: false},
+		{config: testConfig{WorkingDir: "/var/aos", Quota: 2 * aostypes.GiB, Monitoring: testMonitoring{
+			PollPeriod: aostypes.Duration{Duration: time.Second},
+		}}, valid: false},
+	}
+
+	for i, item := range data {
+		if err := config.Validate(&item.config); (err == nil) != item.valid {
+			t.Errorf("Wrong validation result for item %d: %v", i, err)
+		}
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "config_")
+	if err != nil {
+		t.Fatalf("Can't create tmp dir: %s", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	configFile := filepath.Join(tmpDir, "config.json")
+
+	writeConfig := func(data string) {
+		t.Helper()
+
+		if err := ioutil.WriteFile(configFile, []byte(data), 0o600); err != nil {
+			t.Fatalf("Can't write config: %s", err)
+		}
+	}
+
+	writeConfig(`{"workingDir": "/var/aos1", "monitoring": {"pollPeriod": "1s"}}`)
+
+	watcher, err := config.NewWatcher(configFile, "", func() interface{} { return &testConfig{} })
+	if err != nil {
+		t.Fatalf("Can't create watcher: %s", err)
+	}
+	defer watcher.Close()
+
+	changeChannel := make(chan string, 10)
+
+	watcher.Subscribe(func(newConfig interface{}) error {
+		workingDir := newConfig.(*testConfig).WorkingDir
+
+		changeChannel <- workingDir
+
+		if workingDir == "/var/rejected" {
+			return aoserrors.New("config rejected")
+		}
+
+		return nil
+	})
+
+	waitChange := func(expected string) {
+		t.Helper()
+
+		select {
+		case workingDir := <-changeChannel:
+			if workingDir != expected {
+				t.Errorf("Wrong working dir: %s", workingDir)
+			}
+
+		case <-time.After(2 * time.Second):
+			t.Fatal("Wait config change timeout")
+		}
+	}
+
+	writeConfig(`{"workingDir": "/var/aos2", "monitoring": {"pollPeriod": "1s"}}`)
+	waitChange("/var/aos2")
+
+	// Invalid config is not delivered
+	writeConfig(`{"monitoring": {"pollPeriod": "1s"}}`)
+
+	select {
+	case <-changeChannel:
+		t.Error("Invalid config should not be delivered")
+
+	case <-time.After(500 * time.Millisecond):
+	}
+
+	// Rejected config is rolled back
+	writeConfig(`{"workingDir": "/var/rejected", "monitoring": {"pollPeriod": "1s"}}`)
+	waitChange("/var/rejected")
+
+	time.Sleep(100 * time.Millisecond)
+
+	if workingDir := watcher.Config().(*testConfig).WorkingDir; workingDir != "/var/aos2" {
+		t.Errorf("Wrong current working dir: %s", workingDir)
+	}
+}
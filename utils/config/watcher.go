@@ -0,0 +1,222 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/aoscloud/aos_common/aoserrors"
+)
+
+/***********************************************************************************************************************
+ * Consts
+ **********************************************************************************************************************/
+
+const (
+	debounceTime      = 200 * time.Millisecond
+	inotifyBufferSize = 4096
+	inotifyMask       = syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO | syscall.IN_CREATE
+)
+
+/***********************************************************************************************************************
+ * Types
+ **********************************************************************************************************************/
+
+// ChangeFunc is called with new config. If it returns error, new config is rolled back.
+type ChangeFunc func(config interface{}) (err error)
+
+// Watcher watches config file and delivers new validated config to subscribers.
+type Watcher struct {
+	sync.Mutex
+
+	fileName    string
+	envPrefix   string
+	newConfig   func() interface{}
+	config      interface{}
+	subscribers []ChangeFunc
+	inotify     *os.File
+	timer       *time.Timer
+	wg          sync.WaitGroup
+	reloadMutex sync.Mutex
+}
+
+/***********************************************************************************************************************
+ * Public
+ **********************************************************************************************************************/
+
+// NewWatcher loads config and starts watching config file. newConfig should return pointer to struct initialized
+// with default values. Config is loaded in the same way as by Load.
+func NewWatcher(fileName, envPrefix string, newConfig func() interface{}) (watcher *Watcher, err error) {
+	watcher = &Watcher{fileName: fileName, envPrefix: envPrefix, newConfig: newConfig}
+
+	watcher.config = newConfig()
+
+	if err = Load(fileName, envPrefix, watcher.config); err != nil {
+		return nil, err
+	}
+
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	watcher.inotify = os.NewFile(uintptr(fd), "inotify")
+
+	// Watch directory to handle editors and tools which replace config file
+	if _, err = syscall.InotifyAddWatch(fd, filepath.Dir(fileName), inotifyMask); err != nil {
+		watcher.inotify.Close()
+
+		return nil, aoserrors.Wrap(err)
+	}
+
+	watcher.wg.Add(1)
+
+	go watcher.handleEvents()
+
+	return watcher, nil
+}
+
+// Close stops watching config file.
+func (watcher *Watcher) Close() {
+	watcher.inotify.Close()
+	watcher.wg.Wait()
+
+	watcher.Lock()
+	defer watcher.Unlock()
+
+	if watcher.timer != nil {
+		watcher.timer.Stop()
+	}
+}
+
+// Config returns current config.
+func (watcher *Watcher) Config() (config interface{}) {
+	watcher.Lock()
+	defer watcher.Unlock()
+
+	return watcher.config
+}
+
+// Subscribe subscribes to config changes.
+func (watcher *Watcher) Subscribe(onChange ChangeFunc) {
+	watcher.Lock()
+	defer watcher.Unlock()
+
+	watcher.subscribers = append(watcher.subscribers, onChange)
+}
+
+/***********************************************************************************************************************
+ * Private
+ **********************************************************************************************************************/
+
+func (watcher *Watcher) handleEvents() {
+	defer watcher.wg.Done()
+
+	buffer := make([]byte, inotifyBufferSize)
+	baseName := filepath.Base(watcher.fileName)
+
+	for {
+		n, err := watcher.inotify.Read(buffer)
+		if err != nil {
+			return
+		}
+
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buffer[offset])) // nolint:gosec // inotify event parsing
+			nameStart := offset + syscall.SizeofInotifyEvent
+			nameEnd := nameStart + int(event.Len)
+
+			if nameEnd > n {
+				break
+			}
+
+			if name := string(trimZeros(buffer[nameStart:nameEnd])); name == baseName {
+				watcher.scheduleReload()
+			}
+
+			offset = nameEnd
+		}
+	}
+}
+
+func (watcher *Watcher) scheduleReload() {
+	watcher.Lock()
+	defer watcher.Unlock()
+
+	if watcher.timer != nil {
+		watcher.timer.Reset(debounceTime)
+
+		return
+	}
+
+	watcher.timer = time.AfterFunc(debounceTime, watcher.reload)
+}
+
+func (watcher *Watcher) reload() {
+	watcher.reloadMutex.Lock()
+	defer watcher.reloadMutex.Unlock()
+
+	log.WithField("file", watcher.fileName).Debug("Reload config")
+
+	newConfig := watcher.newConfig()
+
+	if err := Load(watcher.fileName, watcher.envPrefix, newConfig); err != nil {
+		log.Errorf("Can't reload config, keep previous one: %s", err)
+
+		return
+	}
+
+	watcher.Lock()
+	prevConfig, subscribers := watcher.config, append([]ChangeFunc(nil), watcher.subscribers...)
+	watcher.Unlock()
+
+	for i, onChange := range subscribers {
+		if err := onChange(newConfig); err != nil {
+			log.Errorf("Config is not applied, rollback to previous one: %s", err)
+
+			for _, applied := range subscribers[:i] {
+				if err := applied(prevConfig); err != nil {
+					log.Errorf("Can't rollback config: %s", err)
+				}
+			}
+
+			return
+		}
+	}
+
+	watcher.Lock()
+	watcher.config = newConfig
+	watcher.Unlock()
+}
+
+func trimZeros(data []byte) (trimmed []byte) {
+	for i, b := range data {
+		if b == 0 {
+			return data[:i]
+		}
+	}
+
+	return data
+}
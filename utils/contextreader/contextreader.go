@@ -19,7 +19,9 @@ package contextreader
 
 import (
 	"context"
+	"errors"
 	"io"
+	"time"
 )
 
 /***********************************************************************************************************************
@@ -28,8 +30,21 @@ import (
 
 // ContextReader context reader instance.
 type ContextReader struct {
-	ctx    context.Context
-	reader io.Reader
+	ctx          context.Context
+	reader       io.Reader
+	rateLimiters []*RateLimiter
+	progress     *progress
+}
+
+// Param context reader and writer parameters.
+type Param struct {
+	// RateLimiters limit bandwidth. Limiter can be shared between readers and writers to apply common limit.
+	RateLimiters []*RateLimiter
+	// OnProgress is called with total transferred bytes every ProgressBytes bytes or ProgressInterval time and at the
+	// end of reading. It is called on each read or write if neither ProgressBytes nor ProgressInterval is set.
+	OnProgress       ProgressFunc
+	ProgressBytes    int64
+	ProgressInterval time.Duration
 }
 
 /***********************************************************************************************************************
@@ -38,9 +53,16 @@ type ContextReader struct {
 
 // New creates new context reader.
 func New(ctx context.Context, reader io.Reader) (contextReader io.Reader) {
+	return NewWithParam(ctx, reader, Param{})
+}
+
+// NewWithParam creates new context reader with specified parameters.
+func NewWithParam(ctx context.Context, reader io.Reader, param Param) (contextReader io.Reader) {
 	return &ContextReader{
-		ctx:    ctx,
-		reader: reader,
+		ctx:          ctx,
+		reader:       reader,
+		rateLimiters: param.RateLimiters,
+		progress:     newProgress(param),
 	}
 }
 
@@ -50,6 +72,21 @@ func (contextReader *ContextReader) Read(p []byte) (n int, err error) {
 		return 0, contextReader.ctx.Err() // nolint:wrapcheck // error not properly handled by io.Copy
 
 	default:
-		return contextReader.reader.Read(p) // nolint:wrapcheck // error not properly handled by io.Copy
 	}
+
+	p = p[:limitSize(len(p), contextReader.rateLimiters)]
+
+	if n, err = contextReader.reader.Read(p); n > 0 {
+		contextReader.progress.update(n)
+
+		if waitErr := waitRateLimiters(contextReader.ctx, n, contextReader.rateLimiters); waitErr != nil {
+			return n, waitErr
+		}
+	}
+
+	if errors.Is(err, io.EOF) {
+		contextReader.progress.done()
+	}
+
+	return n, err // nolint:wrapcheck // error not properly handled by io.Copy
 }
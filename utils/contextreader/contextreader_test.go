@@ -0,0 +1,121 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextreader_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/aoscloud/aos_common/utils/contextreader"
+)
+
+/***********************************************************************************************************************
+ * Tests
+ **********************************************************************************************************************/
+
+func TestRateLimit(t *testing.T) {
+	const rate = 100 * 1024
+
+	data := make([]byte, 2*rate)
+	limiter := contextreader.NewRateLimiter(rate)
+
+	startTime := time.Now()
+
+	reader := contextreader.NewWithParam(context.Background(), bytes.NewReader(data),
+		contextreader.Param{RateLimiters: []*contextreader.RateLimiter{limiter}})
+
+	if _, err := io.Copy(ioutil.Discard, reader); err != nil {
+		t.Fatalf("Can't copy data: %s", err)
+	}
+
+	if duration := time.Since(startTime); duration < 900*time.Millisecond || duration > 2*time.Second {
+		t.Errorf("Wrong read duration: %v", duration)
+	}
+
+	limiter.SetRate(0)
+
+	startTime = time.Now()
+
+	writer := contextreader.NewWriterWithParam(context.Background(), ioutil.Discard,
+		contextreader.Param{RateLimiters: []*contextreader.RateLimiter{limiter}})
+
+	if _, err := writer.Write(data); err != nil {
+		t.Fatalf("Can't write data: %s", err)
+	}
+
+	if duration := time.Since(startTime); duration > 100*time.Millisecond {
+		t.Errorf("Write should not be limited: %v", duration)
+	}
+}
+
+func TestWriterCancel(t *testing.T) {
+	ctx, cancelFunc := context.WithCancel(context.Background())
+
+	writer := contextreader.NewWriterWithParam(ctx, ioutil.Discard, contextreader.Param{
+		RateLimiters: []*contextreader.RateLimiter{contextreader.NewRateLimiter(1024)},
+	})
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		cancelFunc()
+	}()
+
+	n, err := writer.Write(make([]byte, 10*1024))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Context canceled error expected: %v", err)
+	}
+
+	if n >= 10*1024 {
+		t.Errorf("Write should be interrupted: %d", n)
+	}
+}
+
+func TestProgress(t *testing.T) {
+	var reported []int64
+
+	reader := contextreader.NewWithParam(context.Background(), bytes.NewReader(make([]byte, 10050)),
+		contextreader.Param{
+			OnProgress:    func(transferred int64) { reported = append(reported, transferred) },
+			ProgressBytes: 1000,
+		})
+
+	buffer := make([]byte, 100)
+
+	for {
+		if _, err := reader.Read(buffer); err != nil {
+			if !errors.Is(err, io.EOF) {
+				t.Fatalf("Can't read data: %s", err)
+			}
+
+			break
+		}
+	}
+
+	if len(reported) != 11 {
+		t.Fatalf("Wrong progress reports count: %d", len(reported))
+	}
+
+	if reported[0] != 1000 || reported[len(reported)-1] != 10050 {
+		t.Errorf("Wrong progress reports: %v", reported)
+	}
+}
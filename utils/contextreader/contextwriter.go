@@ -0,0 +1,84 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextreader
+
+import (
+	"context"
+	"io"
+)
+
+/***********************************************************************************************************************
+ * Types
+ **********************************************************************************************************************/
+
+// ContextWriter context writer instance.
+type ContextWriter struct {
+	ctx          context.Context
+	writer       io.Writer
+	rateLimiters []*RateLimiter
+	progress     *progress
+}
+
+/***********************************************************************************************************************
+ * Public
+ **********************************************************************************************************************/
+
+// NewWriter creates new context writer.
+func NewWriter(ctx context.Context, writer io.Writer) (contextWriter io.Writer) {
+	return NewWriterWithParam(ctx, writer, Param{})
+}
+
+// NewWriterWithParam creates new context writer with specified parameters.
+func NewWriterWithParam(ctx context.Context, writer io.Writer, param Param) (contextWriter io.Writer) {
+	return &ContextWriter{
+		ctx:          ctx,
+		writer:       writer,
+		rateLimiters: param.RateLimiters,
+		progress:     newProgress(param),
+	}
+}
+
+func (contextWriter *ContextWriter) Write(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		select {
+		case <-contextWriter.ctx.Done():
+			return n, contextWriter.ctx.Err() // nolint:wrapcheck // error not properly handled by io.Copy
+
+		default:
+		}
+
+		size := limitSize(len(p), contextWriter.rateLimiters)
+
+		if err = waitRateLimiters(contextWriter.ctx, size, contextWriter.rateLimiters); err != nil {
+			return n, err
+		}
+
+		written, writeErr := contextWriter.writer.Write(p[:size])
+
+		n += written
+		p = p[written:]
+
+		contextWriter.progress.update(written)
+
+		if writeErr != nil {
+			return n, writeErr // nolint:wrapcheck // error not properly handled by io.Copy
+		}
+	}
+
+	return n, nil
+}
@@ -0,0 +1,89 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextreader
+
+import (
+	"time"
+)
+
+/***********************************************************************************************************************
+ * Types
+ **********************************************************************************************************************/
+
+// ProgressFunc progress callback. Receives total transferred bytes.
+type ProgressFunc func(transferred int64)
+
+type progress struct {
+	onProgress   ProgressFunc
+	bytes        int64
+	interval     time.Duration
+	transferred  int64
+	lastReported int64
+	lastTime     time.Time
+}
+
+/***********************************************************************************************************************
+ * Private
+ **********************************************************************************************************************/
+
+func newProgress(param Param) (result *progress) {
+	if param.OnProgress == nil {
+		return nil
+	}
+
+	return &progress{
+		onProgress: param.OnProgress,
+		bytes:      param.ProgressBytes,
+		interval:   param.ProgressInterval,
+		lastTime:   time.Now(),
+	}
+}
+
+func (progress *progress) update(n int) {
+	if progress == nil || n == 0 {
+		return
+	}
+
+	progress.transferred += int64(n)
+
+	if progress.bytes == 0 && progress.interval == 0 {
+		progress.report()
+
+		return
+	}
+
+	if (progress.bytes != 0 && progress.transferred-progress.lastReported >= progress.bytes) ||
+		(progress.interval != 0 && time.Since(progress.lastTime) >= progress.interval) {
+		progress.report()
+	}
+}
+
+func (progress *progress) done() {
+	if progress == nil || progress.transferred == progress.lastReported {
+		return
+	}
+
+	progress.report()
+}
+
+func (progress *progress) report() {
+	progress.lastReported = progress.transferred
+	progress.lastTime = time.Now()
+
+	progress.onProgress(progress.transferred)
+}
@@ -0,0 +1,145 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextreader
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+/***********************************************************************************************************************
+ * Types
+ **********************************************************************************************************************/
+
+// RateLimiter token bucket bandwidth limiter. Bucket size is equal to one second of transfer.
+type RateLimiter struct {
+	sync.Mutex
+	rate   int64
+	tokens float64
+	last   time.Time
+}
+
+/***********************************************************************************************************************
+ * Public
+ **********************************************************************************************************************/
+
+// NewRateLimiter creates new rate limiter. Rate is in bytes per second, 0 means unlimited.
+func NewRateLimiter(rate int64) (limiter *RateLimiter) {
+	return &RateLimiter{rate: rate, tokens: float64(rate), last: time.Now()}
+}
+
+// SetRate changes rate at runtime. Rate is in bytes per second, 0 means unlimited.
+func (limiter *RateLimiter) SetRate(rate int64) {
+	limiter.Lock()
+	defer limiter.Unlock()
+
+	limiter.refill()
+
+	limiter.rate = rate
+
+	if limiter.tokens > float64(rate) {
+		limiter.tokens = float64(rate)
+	}
+}
+
+// Rate returns current rate.
+func (limiter *RateLimiter) Rate() (rate int64) {
+	limiter.Lock()
+	defer limiter.Unlock()
+
+	return limiter.rate
+}
+
+// Wait waits until n bytes can be transferred or ctx is done.
+func (limiter *RateLimiter) Wait(ctx context.Context, n int) (err error) {
+	limiter.Lock()
+
+	if limiter.rate == 0 {
+		limiter.Unlock()
+
+		return nil
+	}
+
+	limiter.refill()
+
+	limiter.tokens -= float64(n)
+
+	var delay time.Duration
+
+	if limiter.tokens < 0 {
+		delay = time.Duration(-limiter.tokens / float64(limiter.rate) * float64(time.Second))
+	}
+
+	limiter.Unlock()
+
+	if delay == 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+
+	case <-ctx.Done():
+		return ctx.Err() // nolint:wrapcheck // error not properly handled by io.Copy
+	}
+}
+
+/***********************************************************************************************************************
+ * Private
+ **********************************************************************************************************************/
+
+func (limiter *RateLimiter) refill() {
+	now := time.Now()
+
+	if limiter.rate != 0 {
+		limiter.tokens += now.Sub(limiter.last).Seconds() * float64(limiter.rate)
+
+		if limiter.tokens > float64(limiter.rate) {
+			limiter.tokens = float64(limiter.rate)
+		}
+	}
+
+	limiter.last = now
+}
+
+func limitSize(size int, limiters []*RateLimiter) (result int) {
+	result = size
+
+	for _, limiter := range limiters {
+		if rate := limiter.Rate(); rate != 0 && int64(result) > rate {
+			result = int(rate)
+		}
+	}
+
+	return result
+}
+
+func waitRateLimiters(ctx context.Context, n int, limiters []*RateLimiter) (err error) {
+	for _, limiter := range limiters {
+		if err = limiter.Wait(ctx, n); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,570 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2022 Renesas Electronics Corporation.
+// Copyright (C) 2022 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cryptutils
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"hash"
+	"io"
+	"math/big"
+	"reflect"
+
+	"github.com/aoscloud/aos_common/aoserrors"
+	"github.com/aoscloud/aos_common/utils/contextreader"
+)
+
+/***********************************************************************************************************************
+ * Consts
+ **********************************************************************************************************************/
+
+// CMS PEM block types.
+const (
+	PEMBlockCMS   = "CMS"
+	PEMBlockPKCS7 = "PKCS7"
+)
+
+const asn1TagSet = 0x31
+
+const (
+	pssDefaultSaltLength   = 20
+	pssDefaultTrailerField = 1
+)
+
+/***********************************************************************************************************************
+ * Types
+ **********************************************************************************************************************/
+
+// CMSSignedData parsed CMS signed data.
+type CMSSignedData struct {
+	// Content attached content, empty for detached signature.
+	Content []byte
+	// Certificates certificates included into signed data.
+	Certificates []*x509.Certificate
+
+	contentType asn1.ObjectIdentifier
+	signers     []cmsSignerInfo
+}
+
+type cmsContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,tag:0"`
+}
+
+type cmsSignedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo cmsEncapContentInfo
+	Certificates     asn1.RawValue   `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue   `asn1:"optional,tag:1"`
+	SignerInfos      []cmsSignerInfo `asn1:"set"`
+}
+
+type cmsEncapContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+	EContent     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+type cmsSignerInfo struct {
+	Version            int
+	SID                asn1.RawValue
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type cmsIssuerAndSerial struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type cmsAttribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue `asn1:"set"`
+}
+
+type ecdsaSignature struct {
+	R, S *big.Int
+}
+
+// rsaPSSParams RSASSA-PSS-params (RFC 4055).
+type rsaPSSParams struct {
+	HashAlgorithm    pkix.AlgorithmIdentifier `asn1:"optional,explicit,tag:0"`
+	MaskGenAlgorithm pkix.AlgorithmIdentifier `asn1:"optional,explicit,tag:1"`
+	SaltLength       int                      `asn1:"optional,explicit,tag:2,default:20"`
+	TrailerField     int                      `asn1:"optional,explicit,tag:3,default:1"`
+}
+
+/***********************************************************************************************************************
+ * Vars
+ **********************************************************************************************************************/
+
+// nolint:gochecknoglobals
+var (
+	oidSignedData        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidAttrContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidAttrMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidRSAPSS            = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 10}
+	oidMGF1              = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 8}
+	oidSHA1              = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+
+	cmsDigestAlgorithms = map[string]crypto.Hash{
+		"1.3.14.3.2.26":          crypto.SHA1,
+		"2.16.840.1.101.3.4.2.1": crypto.SHA256,
+		"2.16.840.1.101.3.4.2.2": crypto.SHA384,
+		"2.16.840.1.101.3.4.2.3": crypto.SHA512,
+	}
+
+	// PKCS#1 v1.5 signature algorithms. Zero hash means algorithm doesn't define digest algorithm.
+	cmsRSAPKCS1Algorithms = map[string]crypto.Hash{
+		"1.2.840.113549.1.1.1":  0,
+		"1.2.840.113549.1.1.5":  crypto.SHA1,
+		"1.2.840.113549.1.1.11": crypto.SHA256,
+		"1.2.840.113549.1.1.12": crypto.SHA384,
+		"1.2.840.113549.1.1.13": crypto.SHA512,
+	}
+
+	// ECDSA signature algorithms. Zero hash means algorithm doesn't define digest algorithm.
+	cmsECDSAAlgorithms = map[string]crypto.Hash{
+		"1.2.840.10045.2.1":   0,
+		"1.2.840.10045.4.1":   crypto.SHA1,
+		"1.2.840.10045.4.3.2": crypto.SHA256,
+		"1.2.840.10045.4.3.3": crypto.SHA384,
+		"1.2.840.10045.4.3.4": crypto.SHA512,
+	}
+)
+
+/***********************************************************************************************************************
+ * Public
+ **********************************************************************************************************************/
+
+// ParseCMS parses CMS (PKCS#7) signed data in DER or PEM format.
+func ParseCMS(data []byte) (signedData *CMSSignedData, err error) {
+	if block, _ := pem.Decode(data); block != nil {
+		if block.Type != PEMBlockCMS && block.Type != PEMBlockPKCS7 {
+			return nil, aoserrors.Errorf("unsupported PEM block type: %s", block.Type)
+		}
+
+		data = block.Bytes
+	}
+
+	var contentInfo cmsContentInfo
+
+	if _, err = asn1.Unmarshal(data, &contentInfo); err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	if !contentInfo.ContentType.Equal(oidSignedData) {
+		return nil, aoserrors.Errorf("unsupported CMS content type: %s", contentInfo.ContentType)
+	}
+
+	var rawSignedData cmsSignedData
+
+	if _, err = asn1.Unmarshal(contentInfo.Content.Bytes, &rawSignedData); err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	if len(rawSignedData.SignerInfos) == 0 {
+		return nil, aoserrors.New("no CMS signers found")
+	}
+
+	signedData = &CMSSignedData{
+		contentType: rawSignedData.EncapContentInfo.EContentType,
+		signers:     rawSignedData.SignerInfos,
+	}
+
+	if signedData.Content, err = getCMSContent(rawSignedData.EncapContentInfo.EContent); err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	if len(rawSignedData.Certificates.Bytes) != 0 {
+		if signedData.Certificates, err = x509.ParseCertificates(rawSignedData.Certificates.Bytes); err != nil {
+			return nil, aoserrors.Wrap(err)
+		}
+	}
+
+	return signedData, nil
+}
+
+// Verify verifies signature over attached content and returns signer certificate.
+func (signedData *CMSSignedData) Verify(trustStore *x509.CertPool) (signer *x509.Certificate, err error) {
+	if len(signedData.Content) == 0 {
+		return nil, aoserrors.New("CMS signed data has no attached content")
+	}
+
+	return signedData.VerifyDetached(signedData.Content, trustStore)
+}
+
+// VerifyDetached verifies signature over detached content and returns signer certificate.
+func (signedData *CMSSignedData) VerifyDetached(
+	content []byte, trustStore *x509.CertPool) (signer *x509.Certificate, err error) {
+	return signedData.VerifyReader(context.Background(), bytes.NewReader(content), trustStore)
+}
+
+// VerifyReader verifies signature over content read from reader. It allows to verify large artifacts in streaming
+// mode without loading them into memory.
+func (signedData *CMSSignedData) VerifyReader(
+	ctx context.Context, content io.Reader, trustStore *x509.CertPool) (signer *x509.Certificate, err error) {
+	hashes := make(map[crypto.Hash]hash.Hash)
+	writers := make([]io.Writer, 0, len(signedData.signers))
+
+	for _, signerInfo := range signedData.signers {
+		hashAlg, err := getCMSDigestAlgorithm(signerInfo.DigestAlgorithm)
+		if err != nil {
+			return nil, aoserrors.Wrap(err)
+		}
+
+		if _, ok := hashes[hashAlg]; !ok {
+			hashes[hashAlg] = hashAlg.New()
+			writers = append(writers, hashes[hashAlg])
+		}
+	}
+
+	if _, err = io.Copy(io.MultiWriter(writers...), contextreader.New(ctx, content)); err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	for i, signerInfo := range signedData.signers {
+		hashAlg, _ := getCMSDigestAlgorithm(signerInfo.DigestAlgorithm)
+
+		cert, err := signedData.verifySigner(signerInfo, hashAlg, hashes[hashAlg].Sum(nil), trustStore)
+		if err != nil {
+			return nil, aoserrors.Wrap(err)
+		}
+
+		if i == 0 {
+			signer = cert
+		}
+	}
+
+	return signer, nil
+}
+
+// VerifyDigestSignature verifies RSA PKCS#1 v1.5 or ECDSA signature of digest.
+func VerifyDigestSignature(publicKey crypto.PublicKey, hashAlg crypto.Hash, digest, signature []byte) (err error) {
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		if err = rsa.VerifyPKCS1v15(key, hashAlg, digest, signature); err != nil {
+			return aoserrors.Wrap(err)
+		}
+
+	case *ecdsa.PublicKey:
+		var ecdsaSig ecdsaSignature
+
+		if _, err = asn1.Unmarshal(signature, &ecdsaSig); err != nil {
+			return aoserrors.Wrap(err)
+		}
+
+		if !ecdsa.Verify(key, digest, ecdsaSig.R, ecdsaSig.S) {
+			return aoserrors.New("ECDSA signature verification error")
+		}
+
+	default:
+		return aoserrors.Errorf("unsupported public key type: %v", reflect.TypeOf(publicKey))
+	}
+
+	return nil
+}
+
+/***********************************************************************************************************************
+ * Private
+ **********************************************************************************************************************/
+
+func getCMSContent(eContent asn1.RawValue) (content []byte, err error) {
+	if len(eContent.Bytes) == 0 {
+		return nil, nil
+	}
+
+	if !eContent.IsCompound {
+		var octets []byte
+
+		if _, err = asn1.Unmarshal(eContent.Bytes, &octets); err != nil {
+			return nil, aoserrors.Wrap(err)
+		}
+
+		return octets, nil
+	}
+
+	// Constructed octet string: concatenate all segments
+	rest := eContent.Bytes
+
+	for len(rest) > 0 {
+		var segment asn1.RawValue
+
+		if rest, err = asn1.Unmarshal(rest, &segment); err != nil {
+			return nil, aoserrors.Wrap(err)
+		}
+
+		if !segment.IsCompound {
+			content = append(content, segment.Bytes...)
+
+			continue
+		}
+
+		segmentContent, err := getCMSContent(segment)
+		if err != nil {
+			return nil, aoserrors.Wrap(err)
+		}
+
+		content = append(content, segmentContent...)
+	}
+
+	return content, nil
+}
+
+func getCMSDigestAlgorithm(algorithm pkix.AlgorithmIdentifier) (crypto.Hash, error) {
+	hashAlg, ok := cmsDigestAlgorithms[algorithm.Algorithm.String()]
+	if !ok {
+		return 0, aoserrors.Errorf("unsupported digest algorithm: %s", algorithm.Algorithm)
+	}
+
+	return hashAlg, nil
+}
+
+func (signedData *CMSSignedData) verifySigner(signerInfo cmsSignerInfo, hashAlg crypto.Hash, contentDigest []byte,
+	trustStore *x509.CertPool) (signer *x509.Certificate, err error) {
+	if signer, err = signedData.findSignerCert(signerInfo.SID); err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	intermediates := x509.NewCertPool()
+
+	for _, cert := range signedData.Certificates {
+		intermediates.AddCert(cert)
+	}
+
+	if _, err = signer.Verify(x509.VerifyOptions{
+		Roots:         trustStore,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	signedDigest := contentDigest
+
+	if len(signerInfo.SignedAttrs.FullBytes) != 0 {
+		if signedDigest, err = signedData.checkSignedAttrs(signerInfo.SignedAttrs, hashAlg, contentDigest); err != nil {
+			return nil, aoserrors.Wrap(err)
+		}
+	}
+
+	if err = verifyCMSSignature(signer.PublicKey, signerInfo.SignatureAlgorithm, hashAlg, signedDigest,
+		signerInfo.Signature); err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	return signer, nil
+}
+
+// verifyCMSSignature verifies signature according to signer signature algorithm.
+func verifyCMSSignature(publicKey crypto.PublicKey, algorithm pkix.AlgorithmIdentifier, hashAlg crypto.Hash,
+	digest, signature []byte) (err error) {
+	oid := algorithm.Algorithm.String()
+
+	if algorithm.Algorithm.Equal(oidRSAPSS) {
+		key, ok := publicKey.(*rsa.PublicKey)
+		if !ok {
+			return aoserrors.Errorf("wrong public key type for RSA-PSS signature: %v", reflect.TypeOf(publicKey))
+		}
+
+		var saltLength int
+
+		if saltLength, err = getPSSSaltLength(algorithm.Parameters, hashAlg); err != nil {
+			return err
+		}
+
+		// Zero salt length is treated by rsa package as auto detected salt length
+		if err = rsa.VerifyPSS(key, hashAlg, digest, signature,
+			&rsa.PSSOptions{SaltLength: saltLength, Hash: hashAlg}); err != nil {
+			return aoserrors.Wrap(err)
+		}
+
+		return nil
+	}
+
+	if algHash, ok := cmsRSAPKCS1Algorithms[oid]; ok {
+		if _, ok := publicKey.(*rsa.PublicKey); !ok {
+			return aoserrors.Errorf("wrong public key type for RSA signature: %v", reflect.TypeOf(publicKey))
+		}
+
+		if algHash != 0 && algHash != hashAlg {
+			return aoserrors.Errorf("signature algorithm %s doesn't match digest algorithm", oid)
+		}
+
+		return VerifyDigestSignature(publicKey, hashAlg, digest, signature)
+	}
+
+	if algHash, ok := cmsECDSAAlgorithms[oid]; ok {
+		if _, ok := publicKey.(*ecdsa.PublicKey); !ok {
+			return aoserrors.Errorf("wrong public key type for ECDSA signature: %v", reflect.TypeOf(publicKey))
+		}
+
+		if algHash != 0 && algHash != hashAlg {
+			return aoserrors.Errorf("signature algorithm %s doesn't match digest algorithm", oid)
+		}
+
+		return VerifyDigestSignature(publicKey, hashAlg, digest, signature)
+	}
+
+	return aoserrors.Errorf("unsupported signature algorithm: %s", oid)
+}
+
+// getPSSSaltLength parses RSA-PSS parameters and checks that they match digest algorithm. Go supports only MGF1 with
+// the same hash as the signature hash.
+func getPSSSaltLength(parameters asn1.RawValue, hashAlg crypto.Hash) (saltLength int, err error) {
+	params := rsaPSSParams{SaltLength: pssDefaultSaltLength, TrailerField: pssDefaultTrailerField}
+
+	if len(parameters.FullBytes) == 0 {
+		return 0, aoserrors.New("RSA-PSS parameters are absent")
+	}
+
+	if _, err = asn1.Unmarshal(parameters.FullBytes, &params); err != nil {
+		return 0, aoserrors.Wrap(err)
+	}
+
+	pssHash := params.HashAlgorithm
+
+	if len(pssHash.Algorithm) == 0 {
+		pssHash.Algorithm = oidSHA1
+	}
+
+	if pssHashAlg, err := getCMSDigestAlgorithm(pssHash); err != nil || pssHashAlg != hashAlg {
+		return 0, aoserrors.Errorf("RSA-PSS hash algorithm %s doesn't match digest algorithm", pssHash.Algorithm)
+	}
+
+	mgfHash := pkix.AlgorithmIdentifier{Algorithm: oidSHA1}
+
+	if len(params.MaskGenAlgorithm.Algorithm) != 0 {
+		if !params.MaskGenAlgorithm.Algorithm.Equal(oidMGF1) {
+			return 0, aoserrors.Errorf("unsupported RSA-PSS mask generation algorithm: %s",
+				params.MaskGenAlgorithm.Algorithm)
+		}
+
+		if _, err = asn1.Unmarshal(params.MaskGenAlgorithm.Parameters.FullBytes, &mgfHash); err != nil {
+			return 0, aoserrors.Wrap(err)
+		}
+	}
+
+	if mgfHashAlg, err := getCMSDigestAlgorithm(mgfHash); err != nil || mgfHashAlg != hashAlg {
+		return 0, aoserrors.Errorf("unsupported RSA-PSS MGF1 hash algorithm: %s", mgfHash.Algorithm)
+	}
+
+	if params.TrailerField != pssDefaultTrailerField {
+		return 0, aoserrors.Errorf("unsupported RSA-PSS trailer field: %d", params.TrailerField)
+	}
+
+	if params.SaltLength < 0 {
+		return 0, aoserrors.Errorf("wrong RSA-PSS salt length: %d", params.SaltLength)
+	}
+
+	return params.SaltLength, nil
+}
+
+func (signedData *CMSSignedData) findSignerCert(sid asn1.RawValue) (*x509.Certificate, error) {
+	switch {
+	case sid.Class == asn1.ClassUniversal && sid.Tag == asn1.TagSequence:
+		var issuerAndSerial cmsIssuerAndSerial
+
+		if _, err := asn1.Unmarshal(sid.FullBytes, &issuerAndSerial); err != nil {
+			return nil, aoserrors.Wrap(err)
+		}
+
+		for _, cert := range signedData.Certificates {
+			if bytes.Equal(cert.RawIssuer, issuerAndSerial.Issuer.FullBytes) &&
+				cert.SerialNumber.Cmp(issuerAndSerial.SerialNumber) == 0 {
+				return cert, nil
+			}
+		}
+
+	case sid.Class == asn1.ClassContextSpecific && sid.Tag == 0:
+		for _, cert := range signedData.Certificates {
+			if bytes.Equal(cert.SubjectKeyId, sid.Bytes) {
+				return cert, nil
+			}
+		}
+
+	default:
+		return nil, aoserrors.New("unsupported CMS signer identifier")
+	}
+
+	return nil, aoserrors.New("CMS signer certificate not found")
+}
+
+func (signedData *CMSSignedData) checkSignedAttrs(
+	signedAttrs asn1.RawValue, hashAlg crypto.Hash, contentDigest []byte) (attrsDigest []byte, err error) {
+	// Signed attributes are signed as explicit SET OF instead of implicit [0]
+	attrsData := append([]byte{asn1TagSet}, signedAttrs.FullBytes[1:]...)
+
+	var attrs []cmsAttribute
+
+	if _, err = asn1.UnmarshalWithParams(attrsData, &attrs, "set"); err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	digestFound := false
+
+	for _, attr := range attrs {
+		switch {
+		case attr.Type.Equal(oidAttrMessageDigest):
+			var messageDigest []byte
+
+			if _, err = asn1.Unmarshal(attr.Values.Bytes, &messageDigest); err != nil {
+				return nil, aoserrors.Wrap(err)
+			}
+
+			if !bytes.Equal(messageDigest, contentDigest) {
+				return nil, aoserrors.New("CMS message digest mismatch")
+			}
+
+			digestFound = true
+
+		case attr.Type.Equal(oidAttrContentType):
+			var contentType asn1.ObjectIdentifier
+
+			if _, err = asn1.Unmarshal(attr.Values.Bytes, &contentType); err != nil {
+				return nil, aoserrors.Wrap(err)
+			}
+
+			if !contentType.Equal(signedData.contentType) {
+				return nil, aoserrors.New("CMS content type mismatch")
+			}
+		}
+	}
+
+	if !digestFound {
+		return nil, aoserrors.New("CMS message digest attribute not found")
+	}
+
+	attrsHash := hashAlg.New()
+
+	if _, err = attrsHash.Write(attrsData); err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	return attrsHash.Sum(nil), nil
+}
@@ -323,6 +323,8 @@ func PEMToX509PrivateKey(data []byte) (key crypto.PrivateKey, err error) {
 	block, _ := pem.Decode(data)
 	if block != nil {
 		data = block.Bytes
+
+		defer ZeroBytes(block.Bytes)
 	}
 
 	switch {
@@ -389,6 +391,8 @@ func LoadPrivateKeyFromFile(fileName string) (crypto.PrivateKey, error) {
 		return nil, aoserrors.Wrap(err)
 	}
 
+	defer ZeroBytes(data)
+
 	key, err := PEMToX509PrivateKey(data)
 	if err != nil {
 		return nil, aoserrors.Wrap(err)
@@ -407,10 +411,10 @@ func SavePrivateKeyToFile(fileName string, key crypto.PrivateKey) error {
 
 	switch privateKey := key.(type) {
 	case *rsa.PrivateKey:
-		if err = pem.Encode(file, &pem.Block{
-			Type:  PEMBlockRSAPrivateKey,
-			Bytes: x509.MarshalPKCS1PrivateKey(privateKey),
-		}); err != nil {
+		data := x509.MarshalPKCS1PrivateKey(privateKey)
+		defer ZeroBytes(data)
+
+		if err = pem.Encode(file, &pem.Block{Type: PEMBlockRSAPrivateKey, Bytes: data}); err != nil {
 			return aoserrors.Wrap(err)
 		}
 
@@ -420,6 +424,8 @@ func SavePrivateKeyToFile(fileName string, key crypto.PrivateKey) error {
 			return aoserrors.Wrap(err)
 		}
 
+		defer ZeroBytes(data)
+
 		if err = pem.Encode(file, &pem.Block{Type: PEMBlockECPrivateKey, Bytes: data}); err != nil {
 			return aoserrors.Wrap(err)
 		}
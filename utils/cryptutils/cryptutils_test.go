@@ -19,25 +19,47 @@ package cryptutils_test
 
 import (
 	"bytes"
+	"context"
 	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
+	"net"
 	"net/url"
 	"os"
 	"os/exec"
 	"path"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/aoscloud/aos_common/aoserrors"
 	"github.com/aoscloud/aos_common/utils/cryptutils"
 	"github.com/aoscloud/aos_common/utils/testtools"
 )
 
+/***********************************************************************************************************************
+ * Types
+ **********************************************************************************************************************/
+
+type errorReader struct {
+	err error
+}
+
 /***********************************************************************************************************************
  * Vars
  **********************************************************************************************************************/
@@ -340,6 +362,431 @@ func TestGetTLSConfig(t *testing.T) {
 	}
 }
 
+func TestMutualTLSConfig(t *testing.T) {
+	tlsDir, err := ioutil.TempDir(tmpDir, "mtlsconfig")
+	if err != nil {
+		t.Fatalf("Can't create TLS config dir: %s", err)
+	}
+
+	defer os.RemoveAll(tlsDir)
+
+	certURL, keyURL, err := createCertFiles(tlsDir)
+	if err != nil {
+		t.Fatalf("Can't create certificate files: %s", err)
+	}
+
+	cryptoContext, err := cryptutils.NewCryptoContext("")
+	if err != nil {
+		t.Fatalf("Can't create crypto context: %s", err)
+	}
+	defer cryptoContext.Close()
+
+	tlsConfig, err := cryptoContext.NewMutualTLSConfig(certURL, keyURL, nil)
+	if err != nil {
+		t.Fatalf("Can't get mutual TLS config: %s", err)
+	}
+
+	if tlsConfig.GetCertificate == nil || tlsConfig.GetClientCertificate == nil {
+		t.Fatal("Certificate callbacks are not set")
+	}
+
+	provider, err := cryptoContext.NewCertificateProvider(certURL, keyURL)
+	if err != nil {
+		t.Fatalf("Can't create certificate provider: %s", err)
+	}
+
+	initialCert, err := provider.GetCertificate(nil)
+	if err != nil {
+		t.Fatalf("Can't get certificate: %s", err)
+	}
+
+	if _, _, err = createCertFiles(tlsDir); err != nil {
+		t.Fatalf("Can't create certificate files: %s", err)
+	}
+
+	if err = provider.Reload(); err != nil {
+		t.Fatalf("Can't reload certificate: %s", err)
+	}
+
+	renewedCert, err := provider.GetClientCertificate(nil)
+	if err != nil {
+		t.Fatalf("Can't get certificate: %s", err)
+	}
+
+	if bytes.Equal(initialCert.Certificate[0], renewedCert.Certificate[0]) {
+		t.Error("Certificate is not renewed")
+	}
+}
+
+func TestCMSSignature(t *testing.T) {
+	cmsDir, err := ioutil.TempDir(tmpDir, "cms")
+	if err != nil {
+		t.Fatalf("Can't create CMS dir: %s", err)
+	}
+
+	defer os.RemoveAll(cmsDir)
+
+	content := []byte("This is update metadata content")
+	contentFile := path.Join(cmsDir, "content")
+
+	if err = ioutil.WriteFile(contentFile, content, 0o600); err != nil {
+		t.Fatalf("Can't write content: %s", err)
+	}
+
+	type cmsTest struct {
+		name             string
+		keyArgs          []string
+		signArgs         []string
+		attached         bool
+		wrongData        bool
+		unknownAlgorithm bool
+	}
+
+	testData := []cmsTest{
+		{name: "RSA detached", keyArgs: []string{"-newkey", "rsa:2048"}},
+		{name: "RSA attached", keyArgs: []string{"-newkey", "rsa:2048"}, signArgs: []string{"-nodetach"}, attached: true},
+		{name: "RSA no attributes", keyArgs: []string{"-newkey", "rsa:2048"}, signArgs: []string{"-noattr"}},
+		{name: "ECDSA detached", keyArgs: []string{"-newkey", "ec", "-pkeyopt", "ec_paramgen_curve:P-256"}},
+		{name: "wrong content", keyArgs: []string{"-newkey", "rsa:2048"}, wrongData: true},
+		{
+			name: "RSA-PSS", keyArgs: []string{"-newkey", "rsa:2048"},
+			signArgs: []string{"-keyopt", "rsa_padding_mode:pss"},
+		},
+		{
+			name: "RSA-PSS SHA384", keyArgs: []string{"-newkey", "rsa:2048"},
+			signArgs: []string{"-md", "sha384", "-keyopt", "rsa_padding_mode:pss", "-keyopt", "rsa_pss_saltlen:20"},
+		},
+		{
+			name: "ECDSA SHA512", keyArgs: []string{"-newkey", "ec", "-pkeyopt", "ec_paramgen_curve:P-384"},
+			signArgs: []string{"-md", "sha512"},
+		},
+		{name: "unknown algorithm", keyArgs: []string{"-newkey", "rsa:2048"}, unknownAlgorithm: true},
+	}
+
+	for _, test := range testData {
+		certFile := path.Join(cmsDir, "cert.pem")
+		keyFile := path.Join(cmsDir, "key.pem")
+		signatureFile := path.Join(cmsDir, "signature.der")
+
+		args := append([]string{"req", "-x509", "-nodes", "-subj", "/CN=signer", "-days", "1",
+			"-keyout", keyFile, "-out", certFile}, test.keyArgs...)
+
+		if out, err := exec.Command("openssl", args...).CombinedOutput(); err != nil {
+			t.Fatalf("Can't create signer certificate: %s, %s", out, err)
+		}
+
+		args = append([]string{"cms", "-sign", "-binary", "-in", contentFile, "-signer", certFile,
+			"-inkey", keyFile, "-outform", "DER", "-out", signatureFile}, test.signArgs...)
+
+		if out, err := exec.Command("openssl", args...).CombinedOutput(); err != nil {
+			t.Fatalf("Can't sign content: %s, %s", out, err)
+		}
+
+		signature, err := ioutil.ReadFile(signatureFile)
+		if err != nil {
+			t.Fatalf("Can't read signature: %s", err)
+		}
+
+		if test.unknownAlgorithm {
+			// Signer info is the last one: replace its rsaEncryption signature algorithm by unknown OID
+			rsaEncryption := []byte{0x06, 0x09, 0x2a, 0x86, 0x48, 0x86, 0xf7, 0x0d, 0x01, 0x01, 0x01}
+
+			index := bytes.LastIndex(signature, rsaEncryption)
+			if index < 0 {
+				t.Fatalf("Signature algorithm not found. Test: %s", test.name)
+			}
+
+			signature[index+len(rsaEncryption)-1] = 0x63
+		}
+
+		certs, err := cryptutils.LoadCertificateFromFile(certFile)
+		if err != nil {
+			t.Fatalf("Can't load certificate: %s", err)
+		}
+
+		trustStore := x509.NewCertPool()
+		trustStore.AddCert(certs[0])
+
+		signedData, err := cryptutils.ParseCMS(signature)
+		if err != nil {
+			t.Fatalf("Can't parse CMS: %s. Test: %s", err, test.name)
+		}
+
+		var signer *x509.Certificate
+
+		switch {
+		case test.attached:
+			if !bytes.Equal(signedData.Content, content) {
+				t.Errorf("Wrong attached content. Test: %s", test.name)
+			}
+
+			signer, err = signedData.Verify(trustStore)
+
+		case test.wrongData:
+			signer, err = signedData.VerifyDetached([]byte("wrong content"), trustStore)
+
+		default:
+			signer, err = signedData.VerifyReader(context.Background(), bytes.NewReader(content), trustStore)
+		}
+
+		if test.wrongData || test.unknownAlgorithm {
+			if err == nil {
+				t.Errorf("Error expected. Test: %s", test.name)
+			}
+
+			if test.unknownAlgorithm && err != nil && !strings.Contains(err.Error(), "unsupported signature algorithm") {
+				t.Errorf("Unsupported signature algorithm error expected: %s", err)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("Can't verify signature: %s. Test: %s", err, test.name)
+
+			continue
+		}
+
+		if !signer.Equal(certs[0]) {
+			t.Errorf("Wrong signer certificate. Test: %s", test.name)
+		}
+
+		if _, err = signedData.VerifyDetached(content, x509.NewCertPool()); err == nil {
+			t.Errorf("Error expected for untrusted signer. Test: %s", test.name)
+		}
+	}
+}
+
+func TestDecryptReader(t *testing.T) {
+	key := make([]byte, 32)
+	iv := make([]byte, 16)
+
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("Can't generate key: %s", err)
+	}
+
+	if _, err := rand.Read(iv); err != nil {
+		t.Fatalf("Can't generate IV: %s", err)
+	}
+
+	for _, size := range []int{0, 1, 15, 16, 17, 1000, 4096, 100000} {
+		plainText := make([]byte, size)
+
+		if _, err := rand.Read(plainText); err != nil {
+			t.Fatalf("Can't generate data: %s", err)
+		}
+
+		// CBC
+
+		cmd := exec.Command("openssl", "enc", "-aes-256-cbc", "-K", hex.EncodeToString(key),
+			"-iv", hex.EncodeToString(iv))
+		cmd.Stdin = bytes.NewReader(plainText)
+
+		cipherText, err := cmd.Output()
+		if err != nil {
+			t.Fatalf("Can't encrypt data: %s", err)
+		}
+
+		reader, err := cryptutils.NewDecryptReader(bytes.NewReader(cipherText), cryptutils.DecryptParams{
+			Mode: cryptutils.ModeCBC, Key: key, IV: iv, ChunkSize: 1000,
+		})
+		if err != nil {
+			t.Fatalf("Can't create decrypt reader: %s", err)
+		}
+
+		decrypted, err := ioutil.ReadAll(reader)
+		if err != nil {
+			t.Fatalf("Can't decrypt CBC data: %s", err)
+		}
+
+		if !bytes.Equal(decrypted, plainText) {
+			t.Errorf("Decrypted CBC data mismatch, size: %d", size)
+		}
+
+		// GCM
+
+		const chunkSize = 1024
+
+		if cipherText, err = encryptGCMChunks(key, iv[:12], plainText, chunkSize); err != nil {
+			t.Fatalf("Can't encrypt data: %s", err)
+		}
+
+		if reader, err = cryptutils.NewDecryptReader(bytes.NewReader(cipherText), cryptutils.DecryptParams{
+			Mode: cryptutils.ModeGCM, Key: key, IV: iv[:12], ChunkSize: chunkSize,
+		}); err != nil {
+			t.Fatalf("Can't create decrypt reader: %s", err)
+		}
+
+		if decrypted, err = ioutil.ReadAll(reader); err != nil {
+			t.Fatalf("Can't decrypt GCM data: %s", err)
+		}
+
+		if !bytes.Equal(decrypted, plainText) {
+			t.Errorf("Decrypted GCM data mismatch, size: %d", size)
+		}
+
+		if size <= chunkSize {
+			continue
+		}
+
+		// Truncated GCM stream should fail
+
+		if reader, err = cryptutils.NewDecryptReader(bytes.NewReader(cipherText[:chunkSize+16]),
+			cryptutils.DecryptParams{Mode: cryptutils.ModeGCM, Key: key, IV: iv[:12], ChunkSize: chunkSize}); err != nil {
+			t.Fatalf("Can't create decrypt reader: %s", err)
+		}
+
+		if _, err = ioutil.ReadAll(reader); err == nil {
+			t.Errorf("Error expected for truncated GCM data, size: %d", size)
+		}
+
+		// Source error should not be treated as end of data
+
+		if reader, err = cryptutils.NewDecryptReader(
+			io.MultiReader(bytes.NewReader(cipherText[:chunkSize]), &errorReader{err: io.ErrUnexpectedEOF}),
+			cryptutils.DecryptParams{Mode: cryptutils.ModeGCM, Key: key, IV: iv[:12], ChunkSize: chunkSize}); err != nil {
+			t.Fatalf("Can't create decrypt reader: %s", err)
+		}
+
+		if _, err = ioutil.ReadAll(reader); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("Source error expected: %v", err)
+		}
+	}
+}
+
+func TestSecretBytes(t *testing.T) {
+	data := []byte("secret key material")
+
+	cryptutils.ZeroBytes(data)
+
+	if !bytes.Equal(data, make([]byte, len(data))) {
+		t.Error("Data is not wiped")
+	}
+
+	data = []byte("secret key material")
+	secret := cryptutils.NewSecretBytes(data)
+
+	cryptutils.ZeroBytes(data)
+
+	secretData := secret.Bytes()
+
+	if !bytes.Equal(secretData, []byte("secret key material")) {
+		t.Error("Wrong secret data")
+	}
+
+	secret.Wipe()
+
+	if secret.Len() != 0 {
+		t.Error("Secret is not wiped")
+	}
+
+	if !bytes.Equal(secretData, make([]byte, len(secretData))) {
+		t.Error("Secret data is not wiped")
+	}
+
+	if err := secret.Close(); err != nil {
+		t.Errorf("Can't close secret: %s", err)
+	}
+}
+
+func TestSecretBytesFinalizer(t *testing.T) {
+	// Keep only secret data to let secret be garbage collected
+	secretData := cryptutils.NewSecretBytes([]byte("secret key material")).Bytes()
+
+	for i := 0; i < 100; i++ {
+		runtime.GC()
+
+		if bytes.Equal(secretData, make([]byte, len(secretData))) {
+			return
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Error("Secret data is not wiped by finalizer")
+}
+
+func TestCreateCSR(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Can't generate key: %s", err)
+	}
+
+	uri, err := url.Parse("urn:aos:unit:12345")
+	if err != nil {
+		t.Fatalf("Can't parse URI: %s", err)
+	}
+
+	customOID := asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 21579, 1}
+
+	csrPEM, err := cryptutils.CreateCSR(key, pkix.Name{CommonName: "unit", Organization: []string{"EPAM"}},
+		cryptutils.CSROptions{
+			DNSNames:           []string{"unit.local"},
+			IPAddresses:        []net.IP{net.ParseIP("10.0.0.1")},
+			URIs:               []*url.URL{uri},
+			ExtKeyUsages:       []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+			CustomExtKeyUsages: []asn1.ObjectIdentifier{customOID},
+			ExtraExtensions:    []pkix.Extension{{Id: customOID, Value: []byte{0x05, 0x00}}},
+		})
+	if err != nil {
+		t.Fatalf("Can't create CSR: %s", err)
+	}
+
+	block, _ := pem.Decode(csrPEM)
+	if block == nil || block.Type != cryptutils.PEMBlockCertificateRequest {
+		t.Fatal("Wrong CSR PEM format")
+	}
+
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		t.Fatalf("Can't parse CSR: %s", err)
+	}
+
+	if err = csr.CheckSignature(); err != nil {
+		t.Errorf("Wrong CSR signature: %s", err)
+	}
+
+	if csr.Subject.CommonName != "unit" {
+		t.Errorf("Wrong common name: %s", csr.Subject.CommonName)
+	}
+
+	if len(csr.DNSNames) != 1 || csr.DNSNames[0] != "unit.local" {
+		t.Errorf("Wrong DNS names: %v", csr.DNSNames)
+	}
+
+	if len(csr.IPAddresses) != 1 || !csr.IPAddresses[0].Equal(net.ParseIP("10.0.0.1")) {
+		t.Errorf("Wrong IP addresses: %v", csr.IPAddresses)
+	}
+
+	if len(csr.URIs) != 1 || csr.URIs[0].String() != uri.String() {
+		t.Errorf("Wrong URIs: %v", csr.URIs)
+	}
+
+	var extKeyUsages []asn1.ObjectIdentifier
+
+	customFound := false
+
+	for _, extension := range csr.Extensions {
+		if extension.Id.Equal(asn1.ObjectIdentifier{2, 5, 29, 37}) {
+			if _, err = asn1.Unmarshal(extension.Value, &extKeyUsages); err != nil {
+				t.Fatalf("Can't parse extended key usage: %s", err)
+			}
+		}
+
+		if extension.Id.Equal(customOID) {
+			customFound = true
+		}
+	}
+
+	if len(extKeyUsages) != 3 || !extKeyUsages[2].Equal(customOID) {
+		t.Errorf("Wrong extended key usages: %v", extKeyUsages)
+	}
+
+	if !customFound {
+		t.Error("Custom extension not found")
+	}
+}
+
 /***********************************************************************************************************************
  * Private
  **********************************************************************************************************************/
@@ -357,3 +804,86 @@ func savePEMFile(data []byte) (fileName string, err error) {
 
 	return file.Name(), nil
 }
+
+func createCertFiles(dir string) (certURLStr, keyURLStr string, err error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return "", "", aoserrors.Wrap(err)
+	}
+
+	keyURL := url.URL{Scheme: cryptutils.SchemeFile, Path: path.Join(dir, "key."+cryptutils.PEMExt)}
+	certURL := url.URL{Scheme: cryptutils.SchemeFile, Path: path.Join(dir, "cert."+cryptutils.PEMExt)}
+
+	if err = os.RemoveAll(keyURL.Path); err != nil {
+		return "", "", aoserrors.Wrap(err)
+	}
+
+	if err = os.RemoveAll(certURL.Path); err != nil {
+		return "", "", aoserrors.Wrap(err)
+	}
+
+	if err = cryptutils.SavePrivateKeyToFile(keyURL.Path, key); err != nil {
+		return "", "", aoserrors.Wrap(err)
+	}
+
+	csr, err := testtools.CreateCSR(key)
+	if err != nil {
+		return "", "", aoserrors.Wrap(err)
+	}
+
+	cert, err := testtools.CreateCertificate(dir, csr)
+	if err != nil {
+		return "", "", aoserrors.Wrap(err)
+	}
+
+	x509Cert, err := cryptutils.PEMToX509Cert(cert)
+	if err != nil {
+		return "", "", aoserrors.Wrap(err)
+	}
+
+	if err = cryptutils.SaveCertificateToFile(certURL.Path, x509Cert); err != nil {
+		return "", "", aoserrors.Wrap(err)
+	}
+
+	return certURL.String(), keyURL.String(), nil
+}
+
+func encryptGCMChunks(key, iv, plainText []byte, chunkSize int) (cipherText []byte, err error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	for counter := uint32(0); ; counter++ {
+		chunk := plainText
+		additionalData := []byte{1}
+
+		if len(chunk) > chunkSize {
+			chunk = plainText[:chunkSize]
+			additionalData[0] = 0
+		}
+
+		plainText = plainText[len(chunk):]
+
+		nonce := append([]byte{}, iv...)
+		nonce[8] ^= byte(counter >> 24)
+		nonce[9] ^= byte(counter >> 16)
+		nonce[10] ^= byte(counter >> 8)
+		nonce[11] ^= byte(counter)
+
+		cipherText = aead.Seal(cipherText, nonce, chunk, additionalData)
+
+		if additionalData[0] == 1 {
+			return cipherText, nil
+		}
+	}
+}
+
+func (reader *errorReader) Read(p []byte) (n int, err error) {
+	return 0, reader.err
+}
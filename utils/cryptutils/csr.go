@@ -0,0 +1,129 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2022 Renesas Electronics Corporation.
+// Copyright (C) 2022 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cryptutils
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"net"
+	"net/url"
+
+	"github.com/aoscloud/aos_common/aoserrors"
+)
+
+/***********************************************************************************************************************
+ * Types
+ **********************************************************************************************************************/
+
+// CSROptions CSR options.
+type CSROptions struct {
+	DNSNames    []string
+	IPAddresses []net.IP
+	URIs        []*url.URL
+	// ExtKeyUsages extended key usages added as extended key usage extension.
+	ExtKeyUsages []x509.ExtKeyUsage
+	// CustomExtKeyUsages custom extended key usage OIDs added to extended key usage extension.
+	CustomExtKeyUsages []asn1.ObjectIdentifier
+	// ExtraExtensions extensions added to CSR as is.
+	ExtraExtensions []pkix.Extension
+}
+
+/***********************************************************************************************************************
+ * Vars
+ **********************************************************************************************************************/
+
+// nolint:gochecknoglobals
+var (
+	oidExtensionExtKeyUsage = asn1.ObjectIdentifier{2, 5, 29, 37}
+
+	extKeyUsageOIDs = map[x509.ExtKeyUsage]asn1.ObjectIdentifier{
+		x509.ExtKeyUsageAny:             {2, 5, 29, 37, 0},
+		x509.ExtKeyUsageServerAuth:      {1, 3, 6, 1, 5, 5, 7, 3, 1},
+		x509.ExtKeyUsageClientAuth:      {1, 3, 6, 1, 5, 5, 7, 3, 2},
+		x509.ExtKeyUsageCodeSigning:     {1, 3, 6, 1, 5, 5, 7, 3, 3},
+		x509.ExtKeyUsageEmailProtection: {1, 3, 6, 1, 5, 5, 7, 3, 4},
+		x509.ExtKeyUsageIPSECEndSystem:  {1, 3, 6, 1, 5, 5, 7, 3, 5},
+		x509.ExtKeyUsageIPSECTunnel:     {1, 3, 6, 1, 5, 5, 7, 3, 6},
+		x509.ExtKeyUsageIPSECUser:       {1, 3, 6, 1, 5, 5, 7, 3, 7},
+		x509.ExtKeyUsageTimeStamping:    {1, 3, 6, 1, 5, 5, 7, 3, 8},
+		x509.ExtKeyUsageOCSPSigning:     {1, 3, 6, 1, 5, 5, 7, 3, 9},
+	}
+)
+
+/***********************************************************************************************************************
+ * Public
+ **********************************************************************************************************************/
+
+// CreateCSR creates PEM encoded certificate signing request.
+func CreateCSR(key crypto.PrivateKey, subject pkix.Name, opts CSROptions) (csr []byte, err error) {
+	template := &x509.CertificateRequest{
+		Subject:         subject,
+		DNSNames:        opts.DNSNames,
+		IPAddresses:     opts.IPAddresses,
+		URIs:            opts.URIs,
+		ExtraExtensions: opts.ExtraExtensions,
+	}
+
+	if len(opts.ExtKeyUsages) != 0 || len(opts.CustomExtKeyUsages) != 0 {
+		extension, err := createExtKeyUsageExtension(opts.ExtKeyUsages, opts.CustomExtKeyUsages)
+		if err != nil {
+			return nil, aoserrors.Wrap(err)
+		}
+
+		template.ExtraExtensions = append(template.ExtraExtensions, extension)
+	}
+
+	csrDER, err := x509.CreateCertificateRequest(rand.Reader, template, key)
+	if err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: PEMBlockCertificateRequest, Bytes: csrDER}), nil
+}
+
+/***********************************************************************************************************************
+ * Private
+ **********************************************************************************************************************/
+
+func createExtKeyUsageExtension(
+	usages []x509.ExtKeyUsage, customUsages []asn1.ObjectIdentifier) (extension pkix.Extension, err error) {
+	oids := make([]asn1.ObjectIdentifier, 0, len(usages)+len(customUsages))
+
+	for _, usage := range usages {
+		oid, ok := extKeyUsageOIDs[usage]
+		if !ok {
+			return extension, aoserrors.Errorf("unsupported extended key usage: %d", usage)
+		}
+
+		oids = append(oids, oid)
+	}
+
+	oids = append(oids, customUsages...)
+
+	if extension.Value, err = asn1.Marshal(oids); err != nil {
+		return extension, aoserrors.Wrap(err)
+	}
+
+	extension.Id = oidExtensionExtKeyUsage
+
+	return extension, nil
+}
@@ -0,0 +1,301 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2022 Renesas Electronics Corporation.
+// Copyright (C) 2022 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cryptutils
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/aoscloud/aos_common/aoserrors"
+)
+
+/***********************************************************************************************************************
+ * Consts
+ **********************************************************************************************************************/
+
+// AES block cipher modes.
+const (
+	ModeCBC = "CBC"
+	ModeGCM = "GCM"
+)
+
+// DefaultDecryptChunkSize default decrypt chunk size.
+const DefaultDecryptChunkSize = 64 * 1024
+
+const (
+	gcmNonceSize   = 12
+	gcmCounterSize = 4
+)
+
+/***********************************************************************************************************************
+ * Types
+ **********************************************************************************************************************/
+
+// DecryptParams decrypt parameters.
+//
+// For GCM mode the ciphertext is a sequence of chunks. Each chunk contains ChunkSize bytes of encrypted data (the last
+// chunk may be shorter) followed by authentication tag. Chunk nonce is IV with big-endian chunk index XORed into its
+// last 4 bytes. Additional data of the last chunk is 0x01 and 0x00 for other chunks, which protects against stream
+// truncation.
+type DecryptParams struct {
+	Mode      string
+	Key       []byte
+	IV        []byte
+	ChunkSize int
+}
+
+type cbcDecryptReader struct {
+	source    io.Reader
+	mode      cipher.BlockMode
+	buffer    []byte
+	pending   []byte
+	lastBlock []byte
+	eof       bool
+}
+
+type gcmDecryptReader struct {
+	source    *bufio.Reader
+	aead      cipher.AEAD
+	iv        []byte
+	buffer    []byte
+	pending   []byte
+	chunkSize int
+	counter   uint32
+	eof       bool
+}
+
+/***********************************************************************************************************************
+ * Public
+ **********************************************************************************************************************/
+
+// NewDecryptReader creates reader which decrypts data read from source reader on the fly.
+func NewDecryptReader(source io.Reader, params DecryptParams) (reader io.Reader, err error) {
+	block, err := aes.NewCipher(params.Key)
+	if err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	if params.ChunkSize <= 0 {
+		params.ChunkSize = DefaultDecryptChunkSize
+	}
+
+	switch params.Mode {
+	case ModeCBC:
+		if len(params.IV) != block.BlockSize() {
+			return nil, aoserrors.New("wrong IV size")
+		}
+
+		// align chunk to block size
+		chunkSize := (params.ChunkSize + block.BlockSize() - 1) / block.BlockSize() * block.BlockSize()
+
+		return &cbcDecryptReader{
+			source: source,
+			mode:   cipher.NewCBCDecrypter(block, params.IV),
+			buffer: make([]byte, chunkSize),
+		}, nil
+
+	case ModeGCM:
+		if len(params.IV) != gcmNonceSize {
+			return nil, aoserrors.New("wrong IV size")
+		}
+
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, aoserrors.Wrap(err)
+		}
+
+		return &gcmDecryptReader{
+			source:    bufio.NewReader(source),
+			aead:      aead,
+			iv:        params.IV,
+			buffer:    make([]byte, params.ChunkSize+aead.Overhead()),
+			chunkSize: params.ChunkSize,
+		}, nil
+
+	default:
+		return nil, aoserrors.Errorf("unsupported decrypt mode: %s", params.Mode)
+	}
+}
+
+func (reader *cbcDecryptReader) Read(p []byte) (n int, err error) {
+	for len(reader.pending) == 0 {
+		if reader.eof {
+			return 0, io.EOF
+		}
+
+		if err = reader.decryptChunk(); err != nil {
+			return 0, err
+		}
+	}
+
+	n = copy(p, reader.pending)
+	reader.pending = reader.pending[n:]
+
+	return n, nil
+}
+
+func (reader *gcmDecryptReader) Read(p []byte) (n int, err error) {
+	for len(reader.pending) == 0 {
+		if reader.eof {
+			return 0, io.EOF
+		}
+
+		if err = reader.decryptChunk(); err != nil {
+			return 0, err
+		}
+	}
+
+	n = copy(p, reader.pending)
+	reader.pending = reader.pending[n:]
+
+	return n, nil
+}
+
+/***********************************************************************************************************************
+ * Private
+ **********************************************************************************************************************/
+
+func (reader *cbcDecryptReader) decryptChunk() (err error) {
+	readCount, err := readChunk(reader.source, reader.buffer)
+	if err != nil {
+		if !errors.Is(err, io.EOF) {
+			return err
+		}
+
+		reader.eof = true
+	}
+
+	blockSize := reader.mode.BlockSize()
+
+	if readCount%blockSize != 0 {
+		return aoserrors.New("ciphertext is not a multiple of the block size")
+	}
+
+	data := reader.buffer[:readCount]
+
+	reader.mode.CryptBlocks(data, data)
+
+	// Keep last block until end of stream to remove padding
+	data = append(reader.lastBlock, data...)
+
+	if !reader.eof {
+		reader.pending = data[:len(data)-blockSize]
+		reader.lastBlock = append([]byte{}, data[len(data)-blockSize:]...)
+
+		return nil
+	}
+
+	if len(data) == 0 {
+		return aoserrors.New("empty ciphertext")
+	}
+
+	if reader.pending, err = removePKCS7Padding(data, blockSize); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	return nil
+}
+
+func (reader *gcmDecryptReader) decryptChunk() (err error) {
+	readCount, err := readChunk(reader.source, reader.buffer)
+	if err != nil {
+		if !errors.Is(err, io.EOF) {
+			return err
+		}
+
+		reader.eof = true
+	}
+
+	if !reader.eof {
+		if _, err = reader.source.Peek(1); errors.Is(err, io.EOF) {
+			reader.eof = true
+		}
+	}
+
+	if readCount < reader.aead.Overhead() {
+		return aoserrors.New("ciphertext chunk is too short")
+	}
+
+	additionalData := []byte{0}
+
+	if reader.eof {
+		additionalData[0] = 1
+	}
+
+	nonce := make([]byte, gcmNonceSize)
+	copy(nonce, reader.iv)
+
+	counter := make([]byte, gcmCounterSize)
+	binary.BigEndian.PutUint32(counter, reader.counter)
+
+	for i := range counter {
+		nonce[gcmNonceSize-gcmCounterSize+i] ^= counter[i]
+	}
+
+	if reader.pending, err = reader.aead.Open(
+		reader.buffer[:0], nonce, reader.buffer[:readCount], additionalData); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	reader.counter++
+
+	return nil
+}
+
+// readChunk reads source until buffer is full. Unlike io.ReadFull, it returns io.EOF if source ends before buffer is
+// full and doesn't treat source errors, e.g. io.ErrUnexpectedEOF of truncated HTTP body, as end of data.
+func readChunk(source io.Reader, buffer []byte) (n int, err error) {
+	for n < len(buffer) {
+		count, err := source.Read(buffer[n:])
+
+		n += count
+
+		if err == io.EOF { // nolint:errorlint // only plain EOF is end of data
+			return n, io.EOF
+		}
+
+		if err != nil {
+			return n, aoserrors.Wrap(err)
+		}
+	}
+
+	return n, nil
+}
+
+func removePKCS7Padding(data []byte, blockSize int) ([]byte, error) {
+	if len(data) == 0 || len(data)%blockSize != 0 {
+		return nil, aoserrors.New("wrong padded data size")
+	}
+
+	padSize := int(data[len(data)-1])
+
+	if padSize == 0 || padSize > blockSize {
+		return nil, aoserrors.New("wrong padding")
+	}
+
+	if !bytes.Equal(data[len(data)-padSize:], bytes.Repeat([]byte{byte(padSize)}, padSize)) {
+		return nil, aoserrors.New("wrong padding")
+	}
+
+	return data[:len(data)-padSize], nil
+}
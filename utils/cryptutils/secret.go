@@ -0,0 +1,95 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2022 Renesas Electronics Corporation.
+// Copyright (C) 2022 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cryptutils
+
+import (
+	"runtime"
+	"sync"
+)
+
+/***********************************************************************************************************************
+ * Types
+ **********************************************************************************************************************/
+
+// SecretBytes holds sensitive data (keys, passwords etc.) and wipes it on Wipe, Close or when it is garbage
+// collected.
+type SecretBytes struct {
+	sync.Mutex
+
+	data []byte
+}
+
+/***********************************************************************************************************************
+ * Public
+ **********************************************************************************************************************/
+
+// ZeroBytes wipes byte slice content.
+func ZeroBytes(data []byte) {
+	for i := range data {
+		data[i] = 0
+	}
+
+	runtime.KeepAlive(data)
+}
+
+// NewSecretBytes creates secret bytes from copy of data. Caller remains owner of data and should wipe it.
+func NewSecretBytes(data []byte) (secret *SecretBytes) {
+	secret = &SecretBytes{data: make([]byte, len(data))}
+
+	copy(secret.data, data)
+
+	runtime.SetFinalizer(secret, (*SecretBytes).Wipe)
+
+	return secret
+}
+
+// Bytes returns secret data. Returned slice is valid until Wipe or Close is called or secret is garbage collected:
+// secret should be kept alive while slice is used.
+func (secret *SecretBytes) Bytes() (data []byte) {
+	secret.Lock()
+	defer secret.Unlock()
+
+	return secret.data
+}
+
+// Len returns secret data length.
+func (secret *SecretBytes) Len() (length int) {
+	secret.Lock()
+	defer secret.Unlock()
+
+	return len(secret.data)
+}
+
+// Close wipes secret data. It allows to use secret as io.Closer.
+func (secret *SecretBytes) Close() (err error) {
+	secret.Wipe()
+
+	return nil
+}
+
+// Wipe wipes secret data.
+func (secret *SecretBytes) Wipe() {
+	secret.Lock()
+	defer secret.Unlock()
+
+	ZeroBytes(secret.data)
+
+	secret.data = nil
+
+	runtime.SetFinalizer(secret, nil)
+}
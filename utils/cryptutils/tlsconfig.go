@@ -0,0 +1,155 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2022 Renesas Electronics Corporation.
+// Copyright (C) 2022 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cryptutils
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/aoscloud/aos_common/aoserrors"
+)
+
+/***********************************************************************************************************************
+ * Consts
+ **********************************************************************************************************************/
+
+const certCheckInterval = 1 * time.Minute
+
+/***********************************************************************************************************************
+ * Types
+ **********************************************************************************************************************/
+
+// CertificateProvider provides TLS certificate and reloads it when it is renewed in the storage.
+type CertificateProvider struct {
+	sync.Mutex
+
+	cryptoContext *CryptoContext
+	certURL       string
+	keyURL        string
+	certificate   *tls.Certificate
+	checkTime     time.Time
+}
+
+/***********************************************************************************************************************
+ * Public
+ **********************************************************************************************************************/
+
+// NewCertificateProvider creates certificate provider for certificate and key URLs.
+func (cryptoContext *CryptoContext) NewCertificateProvider(
+	certURLStr, keyURLStr string) (provider *CertificateProvider, err error) {
+	provider = &CertificateProvider{cryptoContext: cryptoContext, certURL: certURLStr, keyURL: keyURLStr}
+
+	if err = provider.Reload(); err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	return provider, nil
+}
+
+// NewMutualTLSConfig returns mutual TLS config which picks up rotated certificates without restart.
+// If caPool is nil, crypto context root CA pool is used.
+func (cryptoContext *CryptoContext) NewMutualTLSConfig(
+	certURLStr, keyURLStr string, caPool *x509.CertPool) (*tls.Config, error) {
+	provider, err := cryptoContext.NewCertificateProvider(certURLStr, keyURLStr)
+	if err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	if caPool == nil {
+		caPool = cryptoContext.rootCertPool
+	}
+
+	return &tls.Config{
+		GetCertificate:       provider.GetCertificate,
+		GetClientCertificate: provider.GetClientCertificate,
+		RootCAs:              caPool,
+		ClientCAs:            caPool,
+		ClientAuth:           tls.RequireAndVerifyClientCert,
+		MinVersion:           tls.VersionTLS12,
+	}, nil
+}
+
+// GetCertificate returns server certificate. Used as tls.Config GetCertificate callback.
+func (provider *CertificateProvider) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return provider.getCertificate()
+}
+
+// GetClientCertificate returns client certificate. Used as tls.Config GetClientCertificate callback.
+func (provider *CertificateProvider) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return provider.getCertificate()
+}
+
+// Reload reloads certificate and key from the storage.
+func (provider *CertificateProvider) Reload() (err error) {
+	provider.Lock()
+	defer provider.Unlock()
+
+	return provider.reload()
+}
+
+/***********************************************************************************************************************
+ * Private
+ **********************************************************************************************************************/
+
+func (provider *CertificateProvider) getCertificate() (*tls.Certificate, error) {
+	provider.Lock()
+	defer provider.Unlock()
+
+	if time.Since(provider.checkTime) >= certCheckInterval {
+		if err := provider.checkRenewal(); err != nil {
+			// Keep using current certificate if the storage is temporary unavailable
+			log.WithField("certURL", provider.certURL).Errorf("Can't check certificate renewal: %s", err)
+		}
+	}
+
+	return provider.certificate, nil
+}
+
+func (provider *CertificateProvider) checkRenewal() (err error) {
+	provider.checkTime = time.Now()
+
+	certs, err := provider.cryptoContext.LoadCertificateByURL(provider.certURL)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	if len(provider.certificate.Certificate) != 0 && bytes.Equal(certs[0].Raw, provider.certificate.Certificate[0]) {
+		return nil
+	}
+
+	log.WithField("certURL", provider.certURL).Info("Certificate renewed")
+
+	return provider.reload()
+}
+
+func (provider *CertificateProvider) reload() (err error) {
+	certificate, err := provider.cryptoContext.getTLSCertificate(provider.certURL, provider.keyURL)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	provider.certificate = &certificate
+	provider.checkTime = time.Now()
+
+	return nil
+}
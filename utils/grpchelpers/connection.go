@@ -0,0 +1,225 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchelpers
+
+import (
+	"context"
+	"crypto/tls"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials"
+
+	"github.com/aoscloud/aos_common/aoserrors"
+	"github.com/aoscloud/aos_common/utils/cryptutils"
+	"github.com/aoscloud/aos_common/utils/retryhelper"
+)
+
+/***********************************************************************************************************************
+ * Consts
+ **********************************************************************************************************************/
+
+const (
+	defaultMultiplier        = 2.0
+	defaultMaxDelay          = 2 * time.Minute
+	defaultMinConnectTimeout = 20 * time.Second
+)
+
+/***********************************************************************************************************************
+ * Types
+ **********************************************************************************************************************/
+
+// ConnParam client connection parameters.
+type ConnParam struct {
+	// CryptoContext provides TLS credentials. Insecure connection is used if not set.
+	CryptoContext *cryptutils.CryptoContext
+	// CertURL and KeyURL client certificate and key for mutual TLS. Server only TLS is used if not set.
+	// Renewed certificate is picked up on next connection without recreating the client.
+	CertURL string
+	KeyURL  string
+	// Backoff reconnect backoff. Attempt timeout is used as min connect timeout. Default backoff is used if initial
+	// interval is not set.
+	Backoff retryhelper.Backoff
+	// OnStateChange is called on each connection state change.
+	OnStateChange func(state connectivity.State)
+	// DialOptions additional dial options, e.g. interceptors.
+	DialOptions []grpc.DialOption
+}
+
+// Connection managed gRPC client connection. The connection is reconnected automatically according to backoff and
+// can be used by generated clients directly.
+type Connection struct {
+	*grpc.ClientConn
+
+	cancelFunc context.CancelFunc
+	wg         sync.WaitGroup
+}
+
+/***********************************************************************************************************************
+ * Public
+ **********************************************************************************************************************/
+
+// NewConnection creates new managed connection. Connection is established in background, use WaitReady to wait
+// until it is ready.
+func NewConnection(url string, param ConnParam) (connection *Connection, err error) {
+	log.WithField("url", url).Debug("Create gRPC connection")
+
+	credentialsOption, err := getCredentials(param)
+	if err != nil {
+		return nil, err
+	}
+
+	options := append([]grpc.DialOption{
+		credentialsOption, grpc.WithConnectParams(getConnectParams(param.Backoff)),
+	}, param.DialOptions...)
+
+	clientConn, err := grpc.Dial(url, options...)
+	if err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	ctx, cancelFunc := context.WithCancel(context.Background())
+
+	connection = &Connection{ClientConn: clientConn, cancelFunc: cancelFunc}
+
+	connection.wg.Add(1)
+
+	go connection.watchState(ctx, url, param.OnStateChange)
+
+	return connection, nil
+}
+
+// WaitReady waits until connection is ready or ctx is done.
+func (connection *Connection) WaitReady(ctx context.Context) (err error) {
+	for {
+		state := connection.GetState()
+
+		switch state {
+		case connectivity.Ready:
+			return nil
+
+		case connectivity.Idle:
+			connection.Connect()
+
+		case connectivity.Shutdown:
+			return aoserrors.New("connection is closed")
+
+		case connectivity.Connecting, connectivity.TransientFailure:
+		}
+
+		if !connection.WaitForStateChange(ctx, state) {
+			return aoserrors.Wrap(ctx.Err())
+		}
+	}
+}
+
+// Close closes connection.
+func (connection *Connection) Close() (err error) {
+	connection.cancelFunc()
+
+	err = connection.ClientConn.Close()
+
+	connection.wg.Wait()
+
+	return aoserrors.Wrap(err)
+}
+
+/***********************************************************************************************************************
+ * Private
+ **********************************************************************************************************************/
+
+func getCredentials(param ConnParam) (option grpc.DialOption, err error) {
+	if param.CryptoContext == nil {
+		return grpc.WithInsecure(), nil
+	}
+
+	var tlsConfig *tls.Config
+
+	if param.CertURL != "" {
+		tlsConfig, err = param.CryptoContext.NewMutualTLSConfig(param.CertURL, param.KeyURL, nil)
+	} else {
+		tlsConfig, err = param.CryptoContext.GetClientTLSConfig()
+	}
+
+	if err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	return grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)), nil
+}
+
+func getConnectParams(retryBackoff retryhelper.Backoff) (params grpc.ConnectParams) {
+	params = grpc.ConnectParams{Backoff: backoff.DefaultConfig, MinConnectTimeout: defaultMinConnectTimeout}
+
+	if retryBackoff.InitialInterval == 0 {
+		return params
+	}
+
+	params.Backoff = backoff.Config{
+		BaseDelay:  retryBackoff.InitialInterval,
+		Multiplier: retryBackoff.Multiplier,
+		Jitter:     backoff.DefaultConfig.Jitter,
+		MaxDelay:   retryBackoff.MaxInterval,
+	}
+
+	if params.Backoff.Multiplier == 0 {
+		params.Backoff.Multiplier = defaultMultiplier
+	}
+
+	if params.Backoff.MaxDelay == 0 {
+		params.Backoff.MaxDelay = defaultMaxDelay
+	}
+
+	if retryBackoff.Jitter == retryhelper.JitterNone {
+		params.Backoff.Jitter = 0
+	}
+
+	if retryBackoff.AttemptTimeout != 0 {
+		params.MinConnectTimeout = retryBackoff.AttemptTimeout
+	}
+
+	return params
+}
+
+func (connection *Connection) watchState(
+	ctx context.Context, url string, onStateChange func(state connectivity.State)) {
+	defer connection.wg.Done()
+
+	for {
+		state := connection.GetState()
+
+		log.WithFields(log.Fields{"url": url, "state": state}).Debug("gRPC connection state changed")
+
+		if onStateChange != nil {
+			onStateChange(state)
+		}
+
+		// Reconnect idle connection without waiting for RPC
+		if state == connectivity.Idle {
+			connection.Connect()
+		}
+
+		if state == connectivity.Shutdown || !connection.WaitForStateChange(ctx, state) {
+			return
+		}
+	}
+}
@@ -0,0 +1,279 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchelpers_test
+
+import (
+	"context"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/empty"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+
+	"github.com/aoscloud/aos_common/aoserrors"
+	pb "github.com/aoscloud/aos_common/api/iamanager/v2"
+	"github.com/aoscloud/aos_common/utils/grpchelpers"
+	"github.com/aoscloud/aos_common/utils/retryhelper"
+)
+
+/***********************************************************************************************************************
+ * Consts
+ **********************************************************************************************************************/
+
+const serverURL = "localhost:8093"
+
+/***********************************************************************************************************************
+ * Types
+ **********************************************************************************************************************/
+
+type testServer struct {
+	pb.UnimplementedIAMPublicServiceServer
+	grpcServer *grpc.Server
+	panic      bool
+}
+
+/***********************************************************************************************************************
+ * Init
+ **********************************************************************************************************************/
+
+func init() {
+	log.SetFormatter(&log.TextFormatter{
+		DisableTimestamp: false,
+		TimestampFormat:  "2006-01-02 15:04:05.000",
+		FullTimestamp:    true,
+	})
+	log.SetLevel(log.DebugLevel)
+	log.SetOutput(os.Stdout)
+}
+
+/***********************************************************************************************************************
+ * Tests
+ **********************************************************************************************************************/
+
+func TestConnection(t *testing.T) {
+	stateChannel := make(chan connectivity.State, 100)
+
+	connection, err := grpchelpers.NewConnection(serverURL, grpchelpers.ConnParam{
+		Backoff:       retryhelper.Backoff{InitialInterval: 100 * time.Millisecond, MaxInterval: 200 * time.Millisecond},
+		OnStateChange: func(state connectivity.State) { stateChannel <- state },
+	})
+	if err != nil {
+		t.Fatalf("Can't create connection: %s", err)
+	}
+	defer connection.Close()
+
+	ctx, cancelFunc := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancelFunc()
+
+	if err = connection.WaitReady(ctx); err == nil {
+		t.Error("Connection should not be ready without server")
+	}
+
+	server, err := newTestServer(serverURL)
+	if err != nil {
+		t.Fatalf("Can't create test server: %s", err)
+	}
+
+	waitReady(t, connection, stateChannel)
+
+	if _, err = pb.NewIAMPublicServiceClient(connection).GetAPIVersion(
+		context.Background(), &empty.Empty{}); err != nil {
+		t.Errorf("Can't get API version: %s", err)
+	}
+
+	// Connection should be restored after server restart
+
+	server.close()
+
+	if server, err = newTestServer(serverURL); err != nil {
+		t.Fatalf("Can't create test server: %s", err)
+	}
+	defer server.close()
+
+	waitReady(t, connection, stateChannel)
+}
+
+func TestInterceptors(t *testing.T) {
+	const token = "validToken"
+
+	metricChannel := make(chan codes.Code, 10)
+
+	server, err := newTestServer(serverURL,
+		grpc.UnaryInterceptor(grpchelpers.UnaryServerInterceptor(grpchelpers.ServerInterceptorParam{
+			OnMetric: func(method string, duration time.Duration, code codes.Code) { metricChannel <- code },
+			Authenticate: func(ctx context.Context, receivedToken string) (context.Context, error) {
+				if receivedToken != token {
+					return nil, aoserrors.New("invalid token")
+				}
+
+				return ctx, nil
+			},
+		})))
+	if err != nil {
+		t.Fatalf("Can't create test server: %s", err)
+	}
+	defer server.close()
+
+	data := []struct {
+		token string
+		panic bool
+		code  codes.Code
+	}{
+		{token: token, code: codes.OK},
+		{token: "", code: codes.Unauthenticated},
+		{token: "invalidToken", code: codes.Unauthenticated},
+		{token: token, panic: true, code: codes.Internal},
+	}
+
+	for _, item := range data {
+		server.panic = item.panic
+
+		param := grpchelpers.ClientInterceptorParam{}
+
+		if item.token != "" {
+			clientToken := item.token
+			param.GetToken = func(context.Context) (string, error) { return clientToken, nil }
+		}
+
+		connection, err := grpchelpers.NewConnection(serverURL, grpchelpers.ConnParam{
+			DialOptions: []grpc.DialOption{grpc.WithUnaryInterceptor(grpchelpers.UnaryClientInterceptor(param))},
+		})
+		if err != nil {
+			t.Fatalf("Can't create connection: %s", err)
+		}
+
+		_, err = pb.NewIAMPublicServiceClient(connection).GetAPIVersion(context.Background(), &empty.Empty{})
+
+		connection.Close()
+
+		if code := status.Code(err); code != item.code {
+			t.Errorf("Wrong call code: %s", code)
+		}
+
+		select {
+		case code := <-metricChannel:
+			if code != item.code {
+				t.Errorf("Wrong metric code: %s", code)
+			}
+
+		case <-time.After(time.Second):
+			t.Error("Wait metric timeout")
+		}
+	}
+}
+
+func TestServer(t *testing.T) {
+	server, err := grpchelpers.NewServer(grpchelpers.ServerParam{})
+	if err != nil {
+		t.Fatalf("Can't create server: %s", err)
+	}
+
+	serveErr := make(chan error, 1)
+
+	go func() { serveErr <- server.ListenAndServe(serverURL) }()
+
+	connection, err := grpchelpers.NewConnection(serverURL, grpchelpers.ConnParam{})
+	if err != nil {
+		t.Fatalf("Can't create connection: %s", err)
+	}
+	defer connection.Close()
+
+	ctx, cancelFunc := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelFunc()
+
+	response, err := grpc_health_v1.NewHealthClient(connection).Check(
+		ctx, &grpc_health_v1.HealthCheckRequest{}, grpc.WaitForReady(true))
+	if err != nil {
+		t.Fatalf("Can't check health: %s", err)
+	}
+
+	if response.Status != grpc_health_v1.HealthCheckResponse_SERVING {
+		t.Errorf("Wrong health status: %s", response.Status)
+	}
+
+	server.Close()
+
+	if err = <-serveErr; err != nil {
+		t.Errorf("Serve error: %s", err)
+	}
+}
+
+/***********************************************************************************************************************
+ * Private
+ **********************************************************************************************************************/
+
+func newTestServer(url string, opts ...grpc.ServerOption) (server *testServer, err error) {
+	listener, err := net.Listen("tcp", url)
+	if err != nil {
+		return nil, err
+	}
+
+	server = &testServer{grpcServer: grpc.NewServer(opts...)}
+
+	pb.RegisterIAMPublicServiceServer(server.grpcServer, server)
+
+	go func() {
+		if err := server.grpcServer.Serve(listener); err != nil {
+			log.Errorf("Can't serve grpc server: %s", err)
+		}
+	}()
+
+	return server, nil
+}
+
+func (server *testServer) close() {
+	server.grpcServer.Stop()
+}
+
+func (server *testServer) GetAPIVersion(context.Context, *empty.Empty) (*pb.APIVersion, error) {
+	if server.panic {
+		panic("test panic")
+	}
+
+	return &pb.APIVersion{Version: 1}, nil
+}
+
+func waitReady(t *testing.T, connection *grpchelpers.Connection, stateChannel <-chan connectivity.State) {
+	t.Helper()
+
+	ctx, cancelFunc := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelFunc()
+
+	if err := connection.WaitReady(ctx); err != nil {
+		t.Fatalf("Connection is not ready: %s", err)
+	}
+
+	for {
+		select {
+		case state := <-stateChannel:
+			if state == connectivity.Ready {
+				return
+			}
+
+		case <-ctx.Done():
+			t.Fatal("Waiting ready state timeout")
+		}
+	}
+}
@@ -0,0 +1,232 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchelpers
+
+import (
+	"context"
+	"runtime/debug"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+/***********************************************************************************************************************
+ * Consts
+ **********************************************************************************************************************/
+
+// TokenMetadataKey metadata key of IAM token.
+const TokenMetadataKey = "authorization"
+
+/***********************************************************************************************************************
+ * Types
+ **********************************************************************************************************************/
+
+// MetricFunc is called after each call with call latency and result code.
+type MetricFunc func(method string, duration time.Duration, code codes.Code)
+
+// ServerInterceptorParam server interceptors parameters.
+type ServerInterceptorParam struct {
+	// OnMetric collects call metrics.
+	OnMetric MetricFunc
+	// Authenticate verifies token of incoming call and returns context passed to the handler, e.g. with caller
+	// identity. Calls are not authenticated if not set.
+	Authenticate func(ctx context.Context, token string) (newCtx context.Context, err error)
+	// SkipAuthMethods full method names which are not authenticated, e.g. "/iamanager.v2.IAMPublicService/GetCert".
+	SkipAuthMethods []string
+}
+
+// ClientInterceptorParam client interceptors parameters.
+type ClientInterceptorParam struct {
+	// OnMetric collects call metrics.
+	OnMetric MetricFunc
+	// GetToken returns token added to outgoing calls. Token is not added if not set.
+	GetToken func(ctx context.Context) (token string, err error)
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+/***********************************************************************************************************************
+ * Public
+ **********************************************************************************************************************/
+
+// UnaryServerInterceptor returns server interceptor which logs calls, collects metrics, recovers from handler panic
+// and authenticates calls.
+func UnaryServerInterceptor(param ServerInterceptorParam) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (rsp interface{}, err error) {
+		startTime := time.Now()
+
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				err = panicError(info.FullMethod, recovered)
+			}
+
+			finishCall(info.FullMethod, startTime, err, param.OnMetric)
+		}()
+
+		if ctx, err = param.authenticate(ctx, info.FullMethod); err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor returns stream server interceptor which logs calls, collects metrics, recovers from
+// handler panic and authenticates calls.
+func StreamServerInterceptor(param ServerInterceptorParam) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler) (err error) {
+		startTime := time.Now()
+
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				err = panicError(info.FullMethod, recovered)
+			}
+
+			finishCall(info.FullMethod, startTime, err, param.OnMetric)
+		}()
+
+		ctx, err := param.authenticate(stream.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+
+		return handler(srv, &serverStream{ServerStream: stream, ctx: ctx})
+	}
+}
+
+// UnaryClientInterceptor returns client interceptor which logs calls, collects metrics and adds token to calls.
+func UnaryClientInterceptor(param ClientInterceptorParam) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker, opts ...grpc.CallOption) (err error) {
+		startTime := time.Now()
+
+		defer func() { finishCall(method, startTime, err, param.OnMetric) }()
+
+		if ctx, err = param.addToken(ctx); err != nil {
+			return err
+		}
+
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// StreamClientInterceptor returns stream client interceptor which logs stream creation, collects metrics of stream
+// creation and adds token to calls.
+func StreamClientInterceptor(param ClientInterceptorParam) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string,
+		streamer grpc.Streamer, opts ...grpc.CallOption) (stream grpc.ClientStream, err error) {
+		startTime := time.Now()
+
+		defer func() { finishCall(method, startTime, err, param.OnMetric) }()
+
+		if ctx, err = param.addToken(ctx); err != nil {
+			return nil, err
+		}
+
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+}
+
+// Context returns stream context.
+func (stream *serverStream) Context() context.Context {
+	return stream.ctx
+}
+
+/***********************************************************************************************************************
+ * Private
+ **********************************************************************************************************************/
+
+func (param ServerInterceptorParam) authenticate(
+	ctx context.Context, method string) (newCtx context.Context, err error) {
+	if param.Authenticate == nil {
+		return ctx, nil
+	}
+
+	for _, skipMethod := range param.SkipAuthMethods {
+		if skipMethod == method {
+			return ctx, nil
+		}
+	}
+
+	var token string
+
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(TokenMetadataKey); len(values) > 0 {
+			token = values[0]
+		}
+	}
+
+	if token == "" {
+		return nil, status.Error(codes.Unauthenticated, "token is missing")
+	}
+
+	if newCtx, err = param.Authenticate(ctx, token); err != nil {
+		if _, ok := status.FromError(err); ok {
+			return nil, err
+		}
+
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	return newCtx, nil
+}
+
+func (param ClientInterceptorParam) addToken(ctx context.Context) (newCtx context.Context, err error) {
+	if param.GetToken == nil {
+		return ctx, nil
+	}
+
+	token, err := param.GetToken(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	return metadata.AppendToOutgoingContext(ctx, TokenMetadataKey, token), nil
+}
+
+func panicError(method string, recovered interface{}) (err error) {
+	log.WithField("method", method).Errorf("Call panic: %v\n%s", recovered, debug.Stack())
+
+	return status.Errorf(codes.Internal, "panic: %v", recovered)
+}
+
+func finishCall(method string, startTime time.Time, err error, onMetric MetricFunc) {
+	duration := time.Since(startTime)
+	code := status.Code(err)
+
+	logEntry := log.WithFields(log.Fields{"method": method, "duration": duration, "code": code})
+
+	if err != nil {
+		logEntry.Debugf("Call failed: %s", err)
+	} else {
+		logEntry.Debug("Call finished")
+	}
+
+	if onMetric != nil {
+		onMetric(method, duration, code)
+	}
+}
@@ -0,0 +1,180 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchelpers
+
+import (
+	"crypto/tls"
+	"net"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/keepalive"
+
+	"github.com/aoscloud/aos_common/aoserrors"
+	"github.com/aoscloud/aos_common/utils/cryptutils"
+)
+
+/***********************************************************************************************************************
+ * Consts
+ **********************************************************************************************************************/
+
+const (
+	defaultMaxMessageSize   = 16 * 1024 * 1024
+	defaultKeepAliveTime    = 1 * time.Minute
+	defaultKeepAliveTimeout = 20 * time.Second
+	defaultMinPingInterval  = 10 * time.Second
+)
+
+/***********************************************************************************************************************
+ * Types
+ **********************************************************************************************************************/
+
+// ServerParam gRPC server parameters.
+type ServerParam struct {
+	// CryptoContext provides TLS credentials. Insecure server is created if not set.
+	CryptoContext *cryptutils.CryptoContext
+	// CertURL and KeyURL server certificate and key. Renewed certificate is picked up without server restart.
+	CertURL string
+	KeyURL  string
+	// MutualTLS requires and verifies client certificate.
+	MutualTLS bool
+	// MaxMessageSize max receive and send message size. Default size is used if not set.
+	MaxMessageSize int
+	// KeepAliveTime and KeepAliveTimeout server keepalive ping interval and ping ack timeout.
+	KeepAliveTime    time.Duration
+	KeepAliveTimeout time.Duration
+	// MinPingInterval min allowed client ping interval. Clients pinging more often are disconnected.
+	MinPingInterval time.Duration
+	// ServerOptions additional server options, e.g. interceptors.
+	ServerOptions []grpc.ServerOption
+}
+
+// Server gRPC server with registered health service.
+type Server struct {
+	*grpc.Server
+
+	// Health health service. Use it to set serving status of registered services.
+	Health *health.Server
+}
+
+/***********************************************************************************************************************
+ * Public
+ **********************************************************************************************************************/
+
+// NewServer creates new gRPC server. Services should be registered before ListenAndServe is called.
+func NewServer(param ServerParam) (server *Server, err error) {
+	options, err := getServerOptions(param)
+	if err != nil {
+		return nil, err
+	}
+
+	server = &Server{Server: grpc.NewServer(options...), Health: health.NewServer()}
+
+	grpc_health_v1.RegisterHealthServer(server.Server, server.Health)
+
+	return server, nil
+}
+
+// ListenAndServe listens on url and serves incoming connections. It blocks until server is stopped.
+func (server *Server) ListenAndServe(url string) (err error) {
+	log.WithField("url", url).Debug("Start gRPC server")
+
+	listener, err := net.Listen("tcp", url)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	if err = server.Serve(listener); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	return nil
+}
+
+// Close sets all services not serving and gracefully stops the server.
+func (server *Server) Close() {
+	log.Debug("Close gRPC server")
+
+	server.Health.Shutdown()
+	server.GracefulStop()
+}
+
+/***********************************************************************************************************************
+ * Private
+ **********************************************************************************************************************/
+
+func getServerOptions(param ServerParam) (options []grpc.ServerOption, err error) {
+	if param.MaxMessageSize == 0 {
+		param.MaxMessageSize = defaultMaxMessageSize
+	}
+
+	if param.KeepAliveTime == 0 {
+		param.KeepAliveTime = defaultKeepAliveTime
+	}
+
+	if param.KeepAliveTimeout == 0 {
+		param.KeepAliveTimeout = defaultKeepAliveTimeout
+	}
+
+	if param.MinPingInterval == 0 {
+		param.MinPingInterval = defaultMinPingInterval
+	}
+
+	options = []grpc.ServerOption{
+		grpc.MaxRecvMsgSize(param.MaxMessageSize),
+		grpc.MaxSendMsgSize(param.MaxMessageSize),
+		grpc.KeepaliveParams(keepalive.ServerParameters{
+			Time: param.KeepAliveTime, Timeout: param.KeepAliveTimeout,
+		}),
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime: param.MinPingInterval, PermitWithoutStream: true,
+		}),
+	}
+
+	if param.CryptoContext != nil {
+		tlsConfig, err := getServerTLSConfig(param)
+		if err != nil {
+			return nil, err
+		}
+
+		options = append(options, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+
+	return append(options, param.ServerOptions...), nil
+}
+
+func getServerTLSConfig(param ServerParam) (tlsConfig *tls.Config, err error) {
+	if param.MutualTLS {
+		if tlsConfig, err = param.CryptoContext.NewMutualTLSConfig(param.CertURL, param.KeyURL, nil); err != nil {
+			return nil, aoserrors.Wrap(err)
+		}
+
+		return tlsConfig, nil
+	}
+
+	provider, err := param.CryptoContext.NewCertificateProvider(param.CertURL, param.KeyURL)
+	if err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	return &tls.Config{GetCertificate: provider.GetCertificate, MinVersion: tls.VersionTLS12}, nil
+}
@@ -0,0 +1,220 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"unicode"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/aoscloud/aos_common/aoserrors"
+)
+
+/***********************************************************************************************************************
+ * Consts
+ **********************************************************************************************************************/
+
+const (
+	defaultJournalSocket = "/run/systemd/journal/socket"
+	journalFieldPrefix   = "AOS_"
+	journalTmpDir        = "/dev/shm"
+)
+
+// Syslog priorities.
+const (
+	priorityEmerg = iota
+	priorityAlert
+	priorityCrit
+	priorityErr
+	priorityWarning
+	priorityNotice
+	priorityInfo
+	priorityDebug
+)
+
+/***********************************************************************************************************************
+ * Types
+ **********************************************************************************************************************/
+
+// JournaldHook logrus hook which writes entries to journald using native protocol.
+type JournaldHook struct {
+	identifier string
+	addr       *net.UnixAddr
+	conn       *net.UnixConn
+}
+
+/***********************************************************************************************************************
+ * Public
+ **********************************************************************************************************************/
+
+// NewJournaldHook creates journald hook. Entry fields are written as AOS_<FIELD> journal fields, e.g. unitID as
+// AOS_UNIT_ID. Default journal socket is used if socketPath is empty. Set logger output to ioutil.Discard to avoid
+// duplicated logs.
+func NewJournaldHook(identifier, socketPath string) (hook *JournaldHook, err error) {
+	if socketPath == "" {
+		socketPath = defaultJournalSocket
+	}
+
+	hook = &JournaldHook{identifier: identifier, addr: &net.UnixAddr{Name: socketPath, Net: "unixgram"}}
+
+	// Connection is not connected as file descriptor can't be passed over connected datagram socket
+	if hook.conn, err = net.ListenUnixgram("unixgram", &net.UnixAddr{Net: "unixgram"}); err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	return hook, nil
+}
+
+// Close closes journal connection.
+func (hook *JournaldHook) Close() (err error) {
+	return aoserrors.Wrap(hook.conn.Close())
+}
+
+// Levels returns hook levels.
+func (hook *JournaldHook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+// Fire writes log entry to journal.
+func (hook *JournaldHook) Fire(entry *log.Entry) (err error) {
+	var buffer bytes.Buffer
+
+	writeJournalField(&buffer, "MESSAGE", entry.Message)
+	writeJournalField(&buffer, "PRIORITY", strconv.Itoa(getPriority(entry.Level)))
+
+	if hook.identifier != "" {
+		writeJournalField(&buffer, "SYSLOG_IDENTIFIER", hook.identifier)
+	}
+
+	for key, value := range entry.Data {
+		writeJournalField(&buffer, journalFieldPrefix+getJournalFieldName(key), fmt.Sprint(value))
+	}
+
+	if _, err = hook.conn.WriteToUnix(buffer.Bytes(), hook.addr); err == nil {
+		return nil
+	}
+
+	if !errors.Is(err, syscall.EMSGSIZE) && !errors.Is(err, syscall.ENOBUFS) {
+		return aoserrors.Wrap(err)
+	}
+
+	return hook.sendLarge(buffer.Bytes())
+}
+
+/***********************************************************************************************************************
+ * Private
+ **********************************************************************************************************************/
+
+// sendLarge passes entry which doesn't fit into datagram through file descriptor.
+func (hook *JournaldHook) sendLarge(data []byte) (err error) {
+	file, err := ioutil.TempFile(journalTmpDir, "journal")
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+	defer file.Close()
+
+	if err = os.Remove(file.Name()); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	if _, err = file.Write(data); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	if _, _, err = hook.conn.WriteMsgUnix(nil, syscall.UnixRights(int(file.Fd())), hook.addr); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	return nil
+}
+
+func getPriority(level log.Level) (priority int) {
+	switch level {
+	case log.PanicLevel:
+		return priorityEmerg
+
+	case log.FatalLevel:
+		return priorityCrit
+
+	case log.ErrorLevel:
+		return priorityErr
+
+	case log.WarnLevel:
+		return priorityWarning
+
+	case log.InfoLevel:
+		return priorityInfo
+
+	case log.DebugLevel, log.TraceLevel:
+		return priorityDebug
+
+	default:
+		return priorityNotice
+	}
+}
+
+// writeJournalField writes field in journal native format. Values containing new line are written in binary form.
+func writeJournalField(buffer *bytes.Buffer, name, value string) {
+	buffer.WriteString(name)
+
+	if !strings.ContainsRune(value, '\n') {
+		buffer.WriteByte('=')
+		buffer.WriteString(value)
+		buffer.WriteByte('\n')
+
+		return
+	}
+
+	buffer.WriteByte('\n')
+	_ = binary.Write(buffer, binary.LittleEndian, uint64(len(value)))
+	buffer.WriteString(value)
+	buffer.WriteByte('\n')
+}
+
+// getJournalFieldName converts field key to journal field name: upper case letters, digits and underscores.
+func getJournalFieldName(key string) (name string) {
+	var builder strings.Builder
+
+	runes := []rune(key)
+
+	for i, r := range runes {
+		switch {
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			if i > 0 && unicode.IsUpper(r) && unicode.IsLower(runes[i-1]) {
+				builder.WriteRune('_')
+			}
+
+			builder.WriteRune(unicode.ToUpper(r))
+
+		default:
+			builder.WriteRune('_')
+		}
+	}
+
+	return builder.String()
+}
@@ -0,0 +1,193 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package logging configures logrus with standard Aos fields and propagates log fields through context.
+package logging
+
+import (
+	"context"
+	"io"
+	"os"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/aoscloud/aos_common/aoserrors"
+)
+
+/***********************************************************************************************************************
+ * Consts
+ **********************************************************************************************************************/
+
+// Standard Aos log fields.
+const (
+	FieldComponent     = "component"
+	FieldUnitID        = "unitID"
+	FieldInstanceID    = "instanceID"
+	FieldCorrelationID = "correlationID"
+)
+
+const timestampFormat = "2006-01-02 15:04:05.000"
+
+/***********************************************************************************************************************
+ * Types
+ **********************************************************************************************************************/
+
+// Param logging parameters.
+type Param struct {
+	// Component component name added to each log entry.
+	Component string
+	// UnitID unit ID added to each log entry.
+	UnitID string
+	// Level log level, e.g. "debug". Info level is used if not set.
+	Level string
+	// JSON enables JSON output.
+	JSON bool
+	// Output log output. Stdout is used if not set.
+	Output io.Writer
+}
+
+type contextKey struct{}
+
+type fieldsHook struct {
+	sync.RWMutex
+
+	fields log.Fields
+}
+
+/***********************************************************************************************************************
+ * Vars
+ **********************************************************************************************************************/
+
+// nolint:gochecknoglobals // hook of standard logger is installed once
+var (
+	standardHook     = &fieldsHook{fields: log.Fields{}}
+	standardHookOnce sync.Once
+)
+
+/***********************************************************************************************************************
+ * Public
+ **********************************************************************************************************************/
+
+// Init configures standard logger.
+func Init(param Param) (err error) {
+	level := log.InfoLevel
+
+	if param.Level != "" {
+		if level, err = log.ParseLevel(param.Level); err != nil {
+			return aoserrors.Wrap(err)
+		}
+	}
+
+	output := param.Output
+	if output == nil {
+		output = os.Stdout
+	}
+
+	if param.JSON {
+		log.SetFormatter(&log.JSONFormatter{TimestampFormat: timestampFormat})
+	} else {
+		log.SetFormatter(&log.TextFormatter{
+			DisableTimestamp: false,
+			TimestampFormat:  timestampFormat,
+			FullTimestamp:    true,
+		})
+	}
+
+	log.SetLevel(level)
+	log.SetOutput(output)
+
+	fields := log.Fields{}
+
+	if param.Component != "" {
+		fields[FieldComponent] = param.Component
+	}
+
+	if param.UnitID != "" {
+		fields[FieldUnitID] = param.UnitID
+	}
+
+	standardHook.setFields(fields)
+
+	standardHookOnce.Do(func() { log.AddHook(standardHook) })
+
+	return nil
+}
+
+// WithFields returns context which carries log fields in addition to fields of parent context.
+func WithFields(ctx context.Context, fields log.Fields) context.Context {
+	ctxFields := log.Fields{}
+
+	if parentFields, ok := ctx.Value(contextKey{}).(log.Fields); ok {
+		for key, value := range parentFields {
+			ctxFields[key] = value
+		}
+	}
+
+	for key, value := range fields {
+		ctxFields[key] = value
+	}
+
+	return context.WithValue(ctx, contextKey{}, ctxFields)
+}
+
+// WithInstanceID returns context which carries instance ID log field.
+func WithInstanceID(ctx context.Context, instanceID string) context.Context {
+	return WithFields(ctx, log.Fields{FieldInstanceID: instanceID})
+}
+
+// WithCorrelationID returns context which carries correlation ID log field.
+func WithCorrelationID(ctx context.Context, correlationID string) context.Context {
+	return WithFields(ctx, log.Fields{FieldCorrelationID: correlationID})
+}
+
+// FromContext returns log entry with fields carried by context.
+func FromContext(ctx context.Context) (entry *log.Entry) {
+	fields, _ := ctx.Value(contextKey{}).(log.Fields)
+
+	return log.WithFields(fields)
+}
+
+// Levels returns hook levels.
+func (hook *fieldsHook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+// Fire adds standard fields to log entry.
+func (hook *fieldsHook) Fire(entry *log.Entry) (err error) {
+	hook.RLock()
+	defer hook.RUnlock()
+
+	for key, value := range hook.fields {
+		if _, ok := entry.Data[key]; !ok {
+			entry.Data[key] = value
+		}
+	}
+
+	return nil
+}
+
+/***********************************************************************************************************************
+ * Private
+ **********************************************************************************************************************/
+
+func (hook *fieldsHook) setFields(fields log.Fields) {
+	hook.Lock()
+	defer hook.Unlock()
+
+	hook.fields = fields
+}
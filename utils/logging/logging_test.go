@@ -0,0 +1,321 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/aoscloud/aos_common/utils/logging"
+)
+
+/***********************************************************************************************************************
+ * Tests
+ **********************************************************************************************************************/
+
+func TestContextFields(t *testing.T) {
+	var output bytes.Buffer
+
+	if err := logging.Init(logging.Param{
+		Component: "sm", UnitID: "unit0", Level: "debug", JSON: true, Output: &output,
+	}); err != nil {
+		t.Fatalf("Can't init logging: %s", err)
+	}
+
+	ctx := logging.WithCorrelationID(logging.WithInstanceID(context.Background(), "instance0"), "request0")
+
+	logging.FromContext(ctx).WithField("key", "value").Debug("Test message")
+
+	var entry map[string]interface{}
+
+	if err := json.Unmarshal(output.Bytes(), &entry); err != nil {
+		t.Fatalf("Can't parse log entry: %s", err)
+	}
+
+	expectedFields := map[string]string{
+		logging.FieldComponent:     "sm",
+		logging.FieldUnitID:        "unit0",
+		logging.FieldInstanceID:    "instance0",
+		logging.FieldCorrelationID: "request0",
+		"key":                      "value",
+		"msg":                      "Test message",
+		"level":                    "debug",
+	}
+
+	for key, value := range expectedFields {
+		if entry[key] != value {
+			t.Errorf("Wrong %s field: %v", key, entry[key])
+		}
+	}
+
+	// Explicit field overrides standard one
+
+	output.Reset()
+
+	log.WithField(logging.FieldComponent, "other").Info("Test message")
+
+	if err := json.Unmarshal(output.Bytes(), &entry); err != nil {
+		t.Fatalf("Can't parse log entry: %s", err)
+	}
+
+	if entry[logging.FieldComponent] != "other" {
+		t.Errorf("Wrong component field: %v", entry[logging.FieldComponent])
+	}
+}
+
+func TestJournaldHook(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "logging_")
+	if err != nil {
+		t.Fatalf("Can't create tmp dir: %s", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	socketPath := filepath.Join(tmpDir, "journal.sock")
+
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socketPath, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("Can't create journal socket: %s", err)
+	}
+	defer conn.Close()
+
+	hook, err := logging.NewJournaldHook("aos_test", socketPath)
+	if err != nil {
+		t.Fatalf("Can't create journald hook: %s", err)
+	}
+	defer hook.Close()
+
+	logger := log.New()
+
+	logger.SetOutput(ioutil.Discard)
+	logger.AddHook(hook)
+
+	logger.WithField("unitID", "unit0").Warn("First line\nSecond line")
+
+	fields := readJournalEntry(t, conn)
+
+	expectedFields := map[string]string{
+		"MESSAGE":           "First line\nSecond line",
+		"PRIORITY":          "4",
+		"SYSLOG_IDENTIFIER": "aos_test",
+		"AOS_UNIT_ID":       "unit0",
+	}
+
+	for key, value := range expectedFields {
+		if fields[key] != value {
+			t.Errorf("Wrong %s field: %s", key, fields[key])
+		}
+	}
+
+	// Large entry is passed through file descriptor
+
+	largeMessage := strings.Repeat("a", 1024*1024)
+
+	logger.Error(largeMessage)
+
+	if fields = readJournalEntry(t, conn); fields["MESSAGE"] != largeMessage || fields["PRIORITY"] != "3" {
+		t.Error("Wrong large entry")
+	}
+}
+
+func TestRotatingWriter(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "logging_")
+	if err != nil {
+		t.Fatalf("Can't create tmp dir: %s", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	logFile := filepath.Join(tmpDir, "test.log")
+
+	writer, err := logging.NewRotatingWriter(logFile, logging.RotateParam{
+		MaxSize: 10, MaxFiles: 2, Compress: true, SyncPolicy: logging.SyncOnRotate,
+	})
+	if err != nil {
+		t.Fatalf("Can't create rotating writer: %s", err)
+	}
+	defer writer.Close()
+
+	for _, line := range []string{"line1\n", "line2\n", "line3\n", "line4\n"} {
+		if _, err = writer.Write([]byte(line)); err != nil {
+			t.Fatalf("Can't write log: %s", err)
+		}
+	}
+
+	expectedFiles := map[string]string{
+		logFile:           "line4\n",
+		logFile + ".1.gz": "line3\n",
+		logFile + ".2.gz": "line2\n",
+		logFile + ".3.gz": "",
+		logFile + ".1":    "",
+	}
+
+	for fileName, content := range expectedFiles {
+		data, err := readLogFile(fileName)
+
+		if content == "" {
+			if !os.IsNotExist(err) {
+				t.Errorf("File %s should not exist", fileName)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("Can't read log file: %s", err)
+
+			continue
+		}
+
+		if data != content {
+			t.Errorf("Wrong %s content: %s", fileName, data)
+		}
+	}
+}
+
+func TestRotatingWriterMaxAge(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "logging_")
+	if err != nil {
+		t.Fatalf("Can't create tmp dir: %s", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	logFile := filepath.Join(tmpDir, "test.log")
+
+	if err = ioutil.WriteFile(logFile, []byte("old\n"), 0o600); err != nil {
+		t.Fatalf("Can't write log file: %s", err)
+	}
+
+	oldTime := time.Now().Add(-2 * time.Hour)
+
+	if err = os.Chtimes(logFile, oldTime, oldTime); err != nil {
+		t.Fatalf("Can't change log file time: %s", err)
+	}
+
+	writer, err := logging.NewRotatingWriter(logFile, logging.RotateParam{MaxAge: time.Hour, MaxFiles: 1})
+	if err != nil {
+		t.Fatalf("Can't create rotating writer: %s", err)
+	}
+	defer writer.Close()
+
+	if _, err = writer.Write([]byte("new\n")); err != nil {
+		t.Fatalf("Can't write log: %s", err)
+	}
+
+	for fileName, content := range map[string]string{logFile: "new\n", logFile + ".1": "old\n"} {
+		if data, err := readLogFile(fileName); err != nil || data != content {
+			t.Errorf("Wrong %s content: %s, %v", fileName, data, err)
+		}
+	}
+}
+
+/***********************************************************************************************************************
+ * Private
+ **********************************************************************************************************************/
+
+func readLogFile(fileName string) (content string, err error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	var reader io.Reader = file
+
+	if strings.HasSuffix(fileName, ".gz") {
+		if reader, err = gzip.NewReader(file); err != nil {
+			return "", err
+		}
+	}
+
+	data, err := ioutil.ReadAll(reader)
+
+	return string(data), err
+}
+
+func readJournalEntry(t *testing.T, conn *net.UnixConn) (fields map[string]string) {
+	t.Helper()
+
+	buffer, oob := make([]byte, 64*1024), make([]byte, syscall.CmsgSpace(4))
+
+	n, oobn, _, _, err := conn.ReadMsgUnix(buffer, oob)
+	if err != nil {
+		t.Fatalf("Can't read journal entry: %s", err)
+	}
+
+	data := buffer[:n]
+
+	if oobn > 0 {
+		messages, err := syscall.ParseSocketControlMessage(oob[:oobn])
+		if err != nil || len(messages) == 0 {
+			t.Fatalf("Can't parse control message: %v", err)
+		}
+
+		fds, err := syscall.ParseUnixRights(&messages[0])
+		if err != nil || len(fds) == 0 {
+			t.Fatalf("Can't parse unix rights: %v", err)
+		}
+
+		file := os.NewFile(uintptr(fds[0]), "journal")
+		defer file.Close()
+
+		// Passed file shares offset with the writer, journald reads it from the beginning as well
+		if _, err = file.Seek(0, io.SeekStart); err != nil {
+			t.Fatalf("Can't seek journal file: %s", err)
+		}
+
+		if data, err = ioutil.ReadAll(file); err != nil {
+			t.Fatalf("Can't read journal file: %s", err)
+		}
+	}
+
+	fields = make(map[string]string)
+
+	for len(data) > 0 {
+		lineEnd := bytes.IndexByte(data, '\n')
+		if lineEnd < 0 {
+			t.Fatal("Wrong journal entry format")
+		}
+
+		if pos := bytes.IndexByte(data[:lineEnd], '='); pos >= 0 {
+			fields[string(data[:pos])] = string(data[pos+1 : lineEnd])
+			data = data[lineEnd+1:]
+
+			continue
+		}
+
+		name := string(data[:lineEnd])
+		size := binary.LittleEndian.Uint64(data[lineEnd+1 : lineEnd+9])
+		fields[name] = string(data[lineEnd+9 : lineEnd+9+int(size)])
+		data = data[lineEnd+9+int(size)+1:]
+	}
+
+	return fields
+}
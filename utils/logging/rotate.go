@@ -0,0 +1,280 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aoscloud/aos_common/aoserrors"
+)
+
+/***********************************************************************************************************************
+ * Consts
+ **********************************************************************************************************************/
+
+// Sync policies.
+const (
+	// SyncNever relies on OS to flush written data.
+	SyncNever SyncPolicy = iota
+	// SyncOnRotate syncs file before rotation and on close.
+	SyncOnRotate
+	// SyncEveryWrite syncs file after each write.
+	SyncEveryWrite
+)
+
+const (
+	logFilePerm      = 0o644
+	compressedSuffix = ".gz"
+)
+
+/***********************************************************************************************************************
+ * Types
+ **********************************************************************************************************************/
+
+// SyncPolicy defines when written data is synced to the storage.
+type SyncPolicy int
+
+// RotateParam rotating writer parameters.
+type RotateParam struct {
+	// MaxSize max file size in bytes. Size is not limited if 0.
+	MaxSize int64
+	// MaxAge max time since the file is opened. Age is not limited if 0.
+	MaxAge time.Duration
+	// MaxFiles number of rotated files to keep: file.1 is the newest one.
+	MaxFiles int
+	// Compress compresses rotated files with gzip.
+	Compress bool
+	// SyncPolicy defines when written data is synced.
+	SyncPolicy SyncPolicy
+}
+
+// RotatingWriter log file writer with size and age based rotation. It can be used as logrus output.
+type RotatingWriter struct {
+	sync.Mutex
+
+	fileName string
+	param    RotateParam
+	file     *os.File
+	size     int64
+	openTime time.Time
+}
+
+/***********************************************************************************************************************
+ * Public
+ **********************************************************************************************************************/
+
+// NewRotatingWriter creates rotating writer. Existing file is appended.
+func NewRotatingWriter(fileName string, param RotateParam) (writer *RotatingWriter, err error) {
+	writer = &RotatingWriter{fileName: fileName, param: param}
+
+	if err = writer.open(); err != nil {
+		return nil, err
+	}
+
+	return writer, nil
+}
+
+// Write writes data to the file. File is rotated before writing if data doesn't fit into max size or file is too old.
+func (writer *RotatingWriter) Write(data []byte) (n int, err error) {
+	writer.Lock()
+	defer writer.Unlock()
+
+	if writer.needRotate(int64(len(data))) {
+		if err = writer.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err = writer.file.Write(data)
+	writer.size += int64(n)
+
+	if err != nil {
+		return n, aoserrors.Wrap(err)
+	}
+
+	if writer.param.SyncPolicy == SyncEveryWrite {
+		if err = writer.file.Sync(); err != nil {
+			return n, aoserrors.Wrap(err)
+		}
+	}
+
+	return n, nil
+}
+
+// Rotate rotates file.
+func (writer *RotatingWriter) Rotate() (err error) {
+	writer.Lock()
+	defer writer.Unlock()
+
+	return writer.rotate()
+}
+
+// Close closes the file.
+func (writer *RotatingWriter) Close() (err error) {
+	writer.Lock()
+	defer writer.Unlock()
+
+	return writer.close()
+}
+
+/***********************************************************************************************************************
+ * Private
+ **********************************************************************************************************************/
+
+func (writer *RotatingWriter) open() (err error) {
+	if writer.file, err = os.OpenFile(
+		writer.fileName, os.O_CREATE|os.O_WRONLY|os.O_APPEND, logFilePerm); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	info, err := writer.file.Stat()
+	if err != nil {
+		writer.file.Close()
+
+		return aoserrors.Wrap(err)
+	}
+
+	writer.size = info.Size()
+	writer.openTime = time.Now()
+
+	// Existing file age is counted from its last modification as creation time is not available
+	if writer.size > 0 {
+		writer.openTime = info.ModTime()
+	}
+
+	return nil
+}
+
+func (writer *RotatingWriter) close() (err error) {
+	if writer.param.SyncPolicy != SyncNever {
+		if syncErr := writer.file.Sync(); syncErr != nil {
+			err = aoserrors.Wrap(syncErr)
+		}
+	}
+
+	if closeErr := writer.file.Close(); closeErr != nil && err == nil {
+		err = aoserrors.Wrap(closeErr)
+	}
+
+	return err
+}
+
+func (writer *RotatingWriter) needRotate(size int64) (rotate bool) {
+	if writer.size == 0 {
+		return false
+	}
+
+	if writer.param.MaxSize != 0 && writer.size+size > writer.param.MaxSize {
+		return true
+	}
+
+	return writer.param.MaxAge != 0 && time.Since(writer.openTime) > writer.param.MaxAge
+}
+
+func (writer *RotatingWriter) rotate() (err error) {
+	// Reopen file even if close or shift failed to keep logging
+	closeErr := writer.close()
+	shiftErr := writer.shiftFiles()
+
+	return aoserrors.Join(closeErr, shiftErr, writer.open())
+}
+
+func (writer *RotatingWriter) shiftFiles() (err error) {
+	if writer.param.MaxFiles == 0 {
+		return removeFile(writer.fileName)
+	}
+
+	if err = removeFile(writer.getRotatedName(writer.param.MaxFiles)); err != nil {
+		return err
+	}
+
+	for i := writer.param.MaxFiles - 1; i > 0; i-- {
+		if err = os.Rename(writer.getRotatedName(i), writer.getRotatedName(i+1)); err != nil &&
+			!errors.Is(err, os.ErrNotExist) {
+			return aoserrors.Wrap(err)
+		}
+	}
+
+	if !writer.param.Compress {
+		if err = os.Rename(writer.fileName, writer.getRotatedName(1)); err != nil {
+			return aoserrors.Wrap(err)
+		}
+
+		return nil
+	}
+
+	if err = compressFile(writer.fileName, writer.getRotatedName(1)); err != nil {
+		return err
+	}
+
+	return removeFile(writer.fileName)
+}
+
+func (writer *RotatingWriter) getRotatedName(index int) (name string) {
+	name = writer.fileName + "." + strconv.Itoa(index)
+
+	if writer.param.Compress {
+		name += compressedSuffix
+	}
+
+	return name
+}
+
+func compressFile(src, dst string) (err error) {
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+	defer srcFile.Close()
+
+	dstFile, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, logFilePerm)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+	defer dstFile.Close()
+
+	gzipWriter := gzip.NewWriter(dstFile)
+
+	if _, err = io.Copy(gzipWriter, srcFile); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	if err = gzipWriter.Close(); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	if err = dstFile.Sync(); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	return nil
+}
+
+func removeFile(name string) (err error) {
+	if err = os.Remove(name); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return aoserrors.Wrap(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,176 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2022 Renesas Electronics Corporation.
+// Copyright (C) 2022 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package retryhelper
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/aoscloud/aos_common/aoserrors"
+)
+
+/***********************************************************************************************************************
+ * Consts
+ **********************************************************************************************************************/
+
+// Jitter modes.
+const (
+	// JitterNone no jitter: delay is exactly calculated exponential interval.
+	JitterNone JitterMode = iota
+	// JitterFull delay is random value in range [0, interval].
+	JitterFull
+	// JitterEqual delay is random value in range [interval/2, interval].
+	JitterEqual
+)
+
+const defaultMultiplier = 2.0
+
+/***********************************************************************************************************************
+ * Types
+ **********************************************************************************************************************/
+
+// JitterMode backoff jitter mode.
+type JitterMode int
+
+// Backoff exponential backoff configuration.
+type Backoff struct {
+	// InitialInterval delay before first retry.
+	InitialInterval time.Duration
+	// Multiplier interval multiplier applied on each retry. Default multiplier (2) is used if not set.
+	Multiplier float64
+	// MaxInterval max delay between retries. Not limited if 0.
+	MaxInterval time.Duration
+	// MaxElapsedTime max total time of all attempts. Not limited if 0.
+	MaxElapsedTime time.Duration
+	// MaxTry max number of attempts. Not limited if 0.
+	MaxTry int
+	// Jitter randomization mode applied to calculated interval.
+	Jitter JitterMode
+	// AttemptTimeout timeout of each attempt. Attempt context is canceled when timeout expires. Not limited if 0.
+	AttemptTimeout time.Duration
+}
+
+/***********************************************************************************************************************
+ * Public
+ **********************************************************************************************************************/
+
+// RetryWithBackoff performs operation with exponential backoff. Operation is not retried if it returns error marked
+// as permanent (see aoserrors.Permanent).
+func RetryWithBackoff(ctx context.Context, retryFunc func() error,
+	retryCbk func(retryCount int, delay time.Duration, err error), backoff Backoff) (err error) {
+	return RetryContext(ctx, func(context.Context) error { return retryFunc() }, retryCbk, backoff)
+}
+
+// RetryContext performs operation with exponential backoff. Each attempt receives own context derived from ctx and
+// limited by backoff attempt timeout: attempt which exceeds the timeout should return on context cancel and is
+// retried. Operation is not retried if it returns error marked as permanent (see aoserrors.Permanent).
+func RetryContext(ctx context.Context, retryFunc func(ctx context.Context) error,
+	retryCbk func(retryCount int, delay time.Duration, err error), backoff Backoff) (err error) {
+	startTime := time.Now()
+
+	for try := 1; ; try++ {
+		if err = performAttempt(ctx, retryFunc, backoff.AttemptTimeout); err == nil {
+			return nil
+		}
+
+		if !aoserrors.IsRetryable(err) || (backoff.MaxTry != 0 && try >= backoff.MaxTry) {
+			break
+		}
+
+		delay := backoff.Delay(try)
+
+		if backoff.MaxElapsedTime != 0 && time.Since(startTime)+delay > backoff.MaxElapsedTime {
+			break
+		}
+
+		if ctx.Err() == nil && retryCbk != nil {
+			retryCbk(try, delay, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return aoserrors.Wrap(ctx.Err())
+
+		case <-time.After(delay):
+		}
+	}
+
+	return aoserrors.Wrap(err)
+}
+
+// Interval returns delay before retry without jitter applied.
+func (backoff Backoff) Interval(retryCount int) (interval time.Duration) {
+	multiplier := backoff.Multiplier
+	if multiplier == 0 {
+		multiplier = defaultMultiplier
+	}
+
+	value := float64(backoff.InitialInterval) * math.Pow(multiplier, float64(retryCount-1))
+
+	if backoff.MaxInterval != 0 && value > float64(backoff.MaxInterval) {
+		return backoff.MaxInterval
+	}
+
+	if value > math.MaxInt64 {
+		return time.Duration(math.MaxInt64)
+	}
+
+	return time.Duration(value)
+}
+
+// Delay returns delay before retry with jitter applied.
+func (backoff Backoff) Delay(retryCount int) (delay time.Duration) {
+	interval := backoff.Interval(retryCount)
+
+	switch backoff.Jitter {
+	case JitterFull:
+		return randomDuration(interval)
+
+	case JitterEqual:
+		return interval/2 + randomDuration(interval-interval/2)
+
+	default:
+		return interval
+	}
+}
+
+/***********************************************************************************************************************
+ * Private
+ **********************************************************************************************************************/
+
+func performAttempt(
+	ctx context.Context, retryFunc func(ctx context.Context) error, timeout time.Duration) (err error) {
+	if timeout == 0 {
+		return retryFunc(ctx)
+	}
+
+	attemptCtx, cancelFunc := context.WithTimeout(ctx, timeout)
+	defer cancelFunc()
+
+	return retryFunc(attemptCtx)
+}
+
+func randomDuration(maxDuration time.Duration) (duration time.Duration) {
+	if maxDuration <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(maxDuration) + 1)) // nolint:gosec // jitter doesn't require secure random
+}
@@ -0,0 +1,193 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2022 Renesas Electronics Corporation.
+// Copyright (C) 2022 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package retryhelper
+
+import (
+	"sync"
+	"time"
+
+	"github.com/aoscloud/aos_common/aoserrors"
+)
+
+/***********************************************************************************************************************
+ * Consts
+ **********************************************************************************************************************/
+
+// Circuit breaker states.
+const (
+	// CircuitClosed calls are passed through.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen calls are rejected with ErrCircuitOpen.
+	CircuitOpen
+	// CircuitHalfOpen one trial call is passed through to check if the service is recovered.
+	CircuitHalfOpen
+)
+
+/***********************************************************************************************************************
+ * Types
+ **********************************************************************************************************************/
+
+// CircuitState circuit breaker state.
+type CircuitState int
+
+// CircuitBreaker rejects calls fast after number of consecutive failures to protect the failing service.
+type CircuitBreaker struct {
+	sync.Mutex
+
+	failureThreshold int
+	window           time.Duration
+	coolDown         time.Duration
+
+	state         CircuitState
+	failures      int
+	firstFailure  time.Time
+	openTime      time.Time
+	trialInFlight bool
+}
+
+/***********************************************************************************************************************
+ * Vars
+ **********************************************************************************************************************/
+
+// ErrCircuitOpen returned when call is rejected by open circuit breaker.
+var ErrCircuitOpen = aoserrors.New("circuit breaker is open") // nolint:gochecknoglobals
+
+/***********************************************************************************************************************
+ * Public
+ **********************************************************************************************************************/
+
+// NewCircuitBreaker creates circuit breaker. Circuit breaker trips after failureThreshold consecutive failures
+// within window (window is not limited if 0) and half-opens after coolDown.
+func NewCircuitBreaker(failureThreshold int, window, coolDown time.Duration) (breaker *CircuitBreaker) {
+	return &CircuitBreaker{failureThreshold: failureThreshold, window: window, coolDown: coolDown}
+}
+
+// Execute calls operation if circuit breaker allows it and records the result.
+func (breaker *CircuitBreaker) Execute(operation func() error) (err error) {
+	if err = breaker.allow(); err != nil {
+		return err
+	}
+
+	err = operation()
+
+	breaker.record(err)
+
+	return err
+}
+
+// State returns current circuit breaker state.
+func (breaker *CircuitBreaker) State() (state CircuitState) {
+	breaker.Lock()
+	defer breaker.Unlock()
+
+	breaker.updateState()
+
+	return breaker.state
+}
+
+// Reset resets circuit breaker to closed state.
+func (breaker *CircuitBreaker) Reset() {
+	breaker.Lock()
+	defer breaker.Unlock()
+
+	breaker.close()
+}
+
+func (state CircuitState) String() string {
+	return [...]string{"closed", "open", "half-open"}[state]
+}
+
+/***********************************************************************************************************************
+ * Private
+ **********************************************************************************************************************/
+
+func (breaker *CircuitBreaker) allow() (err error) {
+	breaker.Lock()
+	defer breaker.Unlock()
+
+	breaker.updateState()
+
+	switch breaker.state {
+	case CircuitOpen:
+		return ErrCircuitOpen
+
+	case CircuitHalfOpen:
+		if breaker.trialInFlight {
+			return ErrCircuitOpen
+		}
+
+		breaker.trialInFlight = true
+	}
+
+	return nil
+}
+
+func (breaker *CircuitBreaker) record(err error) {
+	breaker.Lock()
+	defer breaker.Unlock()
+
+	if breaker.state == CircuitHalfOpen {
+		breaker.trialInFlight = false
+
+		if err != nil {
+			breaker.open()
+		} else {
+			breaker.close()
+		}
+
+		return
+	}
+
+	if err == nil {
+		breaker.failures = 0
+
+		return
+	}
+
+	now := time.Now()
+
+	if breaker.failures == 0 || (breaker.window != 0 && now.Sub(breaker.firstFailure) > breaker.window) {
+		breaker.failures = 0
+		breaker.firstFailure = now
+	}
+
+	breaker.failures++
+
+	if breaker.failures >= breaker.failureThreshold {
+		breaker.open()
+	}
+}
+
+func (breaker *CircuitBreaker) updateState() {
+	if breaker.state == CircuitOpen && time.Since(breaker.openTime) >= breaker.coolDown {
+		breaker.state = CircuitHalfOpen
+		breaker.trialInFlight = false
+	}
+}
+
+func (breaker *CircuitBreaker) open() {
+	breaker.state = CircuitOpen
+	breaker.openTime = time.Now()
+	breaker.failures = 0
+}
+
+func (breaker *CircuitBreaker) close() {
+	breaker.state = CircuitClosed
+	breaker.failures = 0
+	breaker.trialInFlight = false
+}
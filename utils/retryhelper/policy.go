@@ -0,0 +1,142 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2022 Renesas Electronics Corporation.
+// Copyright (C) 2022 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package retryhelper
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/aoscloud/aos_common/aoserrors"
+	"github.com/aoscloud/aos_common/aostypes"
+)
+
+/***********************************************************************************************************************
+ * Types
+ **********************************************************************************************************************/
+
+// Policy retry policy configuration. Policy can be loaded from component config.
+type Policy struct {
+	InitialInterval aostypes.Duration `json:"initialInterval"`
+	Multiplier      float64           `json:"multiplier,omitempty"`
+	MaxInterval     aostypes.Duration `json:"maxInterval,omitempty"`
+	MaxElapsedTime  aostypes.Duration `json:"maxElapsedTime,omitempty"`
+	MaxTry          int               `json:"maxTry,omitempty"`
+	Jitter          JitterMode        `json:"jitter,omitempty"`
+	AttemptTimeout  aostypes.Duration `json:"attemptTimeout,omitempty"`
+
+	// OnRetry called before each retry.
+	OnRetry func(info RetryInfo) `json:"-"`
+	// OnGiveUp called when operation is failed and not retried anymore.
+	OnGiveUp func(info RetryInfo) `json:"-"`
+}
+
+// RetryInfo retry hook info.
+type RetryInfo struct {
+	Attempt int
+	Delay   time.Duration
+	Err     error
+}
+
+/***********************************************************************************************************************
+ * Vars
+ **********************************************************************************************************************/
+
+// nolint:gochecknoglobals
+var jitterModeNames = map[JitterMode]string{
+	JitterNone:  "none",
+	JitterFull:  "full",
+	JitterEqual: "equal",
+}
+
+/***********************************************************************************************************************
+ * Public
+ **********************************************************************************************************************/
+
+// Backoff returns backoff configuration defined by policy.
+func (policy Policy) Backoff() (backoff Backoff) {
+	return Backoff{
+		InitialInterval: policy.InitialInterval.Duration,
+		Multiplier:      policy.Multiplier,
+		MaxInterval:     policy.MaxInterval.Duration,
+		MaxElapsedTime:  policy.MaxElapsedTime.Duration,
+		MaxTry:          policy.MaxTry,
+		Jitter:          policy.Jitter,
+		AttemptTimeout:  policy.AttemptTimeout.Duration,
+	}
+}
+
+// Do performs operation according to policy.
+func (policy Policy) Do(ctx context.Context, retryFunc func(ctx context.Context) error) (err error) {
+	attempt := 0
+
+	if err = RetryContext(ctx, func(ctx context.Context) error {
+		attempt++
+
+		return retryFunc(ctx)
+	}, func(retryCount int, delay time.Duration, err error) {
+		if policy.OnRetry != nil {
+			policy.OnRetry(RetryInfo{Attempt: retryCount, Delay: delay, Err: err})
+		}
+	}, policy.Backoff()); err != nil {
+		if policy.OnGiveUp != nil {
+			policy.OnGiveUp(RetryInfo{Attempt: attempt, Err: err})
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// String returns jitter mode name.
+func (mode JitterMode) String() string {
+	if name, ok := jitterModeNames[mode]; ok {
+		return name
+	}
+
+	return "unknown"
+}
+
+// MarshalJSON marshals jitter mode as name.
+func (mode JitterMode) MarshalJSON() (b []byte, err error) {
+	if b, err = json.Marshal(mode.String()); err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	return b, nil
+}
+
+// UnmarshalJSON unmarshals jitter mode from name.
+func (mode *JitterMode) UnmarshalJSON(b []byte) (err error) {
+	var name string
+
+	if err = json.Unmarshal(b, &name); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	for value, valueName := range jitterModeNames {
+		if valueName == name {
+			*mode = value
+
+			return nil
+		}
+	}
+
+	return aoserrors.Errorf("invalid jitter mode: %s", name)
+}
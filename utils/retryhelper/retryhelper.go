@@ -20,8 +20,6 @@ package retryhelper
 import (
 	"context"
 	"time"
-
-	"github.com/aoscloud/aos_common/aoserrors"
 )
 
 /***********************************************************************************************************************
@@ -38,43 +36,15 @@ const (
  * Public
  **********************************************************************************************************************/
 
-// Retry performs operation defined number of times with configured delay.
+// Retry performs operation defined number of times with configured delay. Delay is doubled on each retry and
+// limited by maxDelay. Operation is not retried if it returns error marked as permanent (see aoserrors.Permanent).
 func Retry(ctx context.Context, retryFunc func() error, retryCbk func(retryCount int, delay time.Duration, err error),
 	maxTry int, delay, maxDelay time.Duration) (err error) {
-	try := 1
-
-	for {
-		if err = retryFunc(); err == nil {
-			return nil
-		}
-
-		if try < maxTry || maxTry == 0 {
-			if ctx.Err() == nil && retryCbk != nil {
-				retryCbk(try, delay, err)
-			}
-
-			select {
-			case <-ctx.Done():
-				return aoserrors.Wrap(ctx.Err())
-
-			case <-time.After(delay):
-			}
-
-			delay *= 2
-
-			if maxDelay != 0 && delay > maxDelay {
-				delay = maxDelay
-			}
-
-			try++
-
-			continue
-		}
-
-		break
-	}
-
-	return aoserrors.Wrap(err)
+	return RetryWithBackoff(ctx, retryFunc, retryCbk, Backoff{
+		InitialInterval: delay,
+		MaxInterval:     maxDelay,
+		MaxTry:          maxTry,
+	})
 }
 
 // DefaultRetry performs operation default number of times with default delay.
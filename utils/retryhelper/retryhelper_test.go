@@ -19,6 +19,8 @@ package retryhelper_test
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"testing"
 	"time"
 
@@ -99,6 +101,243 @@ func TestRetryHelper(t *testing.T) {
 	}
 }
 
+func TestPermanentError(t *testing.T) {
+	callCount := 0
+
+	err := retryhelper.Retry(context.Background(), func() (err error) {
+		callCount++
+
+		return aoserrors.Permanent(aoserrors.New("permanent error"))
+	}, nil, 3, 100*time.Millisecond, 0)
+	if err == nil {
+		t.Error("Error expected")
+	}
+
+	if callCount != 1 {
+		t.Errorf("Wrong call count: %d", callCount)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	backoff := retryhelper.Backoff{
+		InitialInterval: 100 * time.Millisecond,
+		Multiplier:      3,
+		MaxInterval:     1 * time.Second,
+	}
+
+	for i, expectedInterval := range []time.Duration{
+		100 * time.Millisecond, 300 * time.Millisecond, 900 * time.Millisecond, 1 * time.Second, 1 * time.Second,
+	} {
+		if interval := backoff.Interval(i + 1); interval != expectedInterval {
+			t.Errorf("Wrong interval: %v", interval)
+		}
+	}
+
+	for i := 1; i < 100; i++ {
+		backoff.Jitter = retryhelper.JitterFull
+
+		if delay := backoff.Delay(i); delay < 0 || delay > backoff.Interval(i) {
+			t.Errorf("Wrong full jitter delay: %v", delay)
+		}
+
+		backoff.Jitter = retryhelper.JitterEqual
+
+		if delay := backoff.Delay(i); delay < backoff.Interval(i)/2 || delay > backoff.Interval(i) {
+			t.Errorf("Wrong equal jitter delay: %v", delay)
+		}
+	}
+}
+
+func TestMaxElapsedTime(t *testing.T) {
+	callCount := 0
+	startTime := time.Now()
+
+	if err := retryhelper.RetryWithBackoff(context.Background(), func() (err error) {
+		callCount++
+
+		return aoserrors.New("some error occurs")
+	}, nil, retryhelper.Backoff{
+		InitialInterval: 100 * time.Millisecond,
+		MaxElapsedTime:  500 * time.Millisecond,
+		Jitter:          retryhelper.JitterEqual,
+	}); err == nil {
+		t.Error("Error expected")
+	}
+
+	if elapsed := time.Since(startTime); elapsed > 500*time.Millisecond {
+		t.Errorf("Max elapsed time exceeded: %v", elapsed)
+	}
+
+	if callCount < 2 {
+		t.Errorf("Wrong call count: %d", callCount)
+	}
+}
+
+func TestAttemptTimeout(t *testing.T) {
+	callCount := 0
+
+	if err := retryhelper.RetryContext(context.Background(), func(ctx context.Context) (err error) {
+		callCount++
+
+		if callCount == 3 {
+			return nil
+		}
+
+		// Simulate hung attempt
+		<-ctx.Done()
+
+		return aoserrors.Wrap(ctx.Err())
+	}, nil, retryhelper.Backoff{
+		InitialInterval: 10 * time.Millisecond,
+		AttemptTimeout:  100 * time.Millisecond,
+	}); err != nil {
+		t.Errorf("Retry error: %s", err)
+	}
+
+	if callCount != 3 {
+		t.Errorf("Wrong call count: %d", callCount)
+	}
+
+	ctx, cancelFunc := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancelFunc()
+
+	if err := retryhelper.RetryContext(ctx, func(ctx context.Context) (err error) {
+		<-ctx.Done()
+
+		return aoserrors.Wrap(ctx.Err())
+	}, nil, retryhelper.Backoff{
+		InitialInterval: 10 * time.Millisecond,
+		AttemptTimeout:  50 * time.Millisecond,
+	}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Deadline exceeded error expected: %v", err)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	const coolDown = 100 * time.Millisecond
+
+	errFailed := aoserrors.New("operation failed")
+	breaker := retryhelper.NewCircuitBreaker(3, 1*time.Second, coolDown)
+
+	failedFunc := func() error { return errFailed }
+	successFunc := func() error { return nil }
+
+	for i := 0; i < 3; i++ {
+		if err := breaker.Execute(failedFunc); !errors.Is(err, errFailed) {
+			t.Errorf("Operation error expected: %v", err)
+		}
+	}
+
+	if breaker.State() != retryhelper.CircuitOpen {
+		t.Errorf("Wrong circuit state: %s", breaker.State())
+	}
+
+	if err := breaker.Execute(successFunc); !errors.Is(err, retryhelper.ErrCircuitOpen) {
+		t.Errorf("Circuit open error expected: %v", err)
+	}
+
+	time.Sleep(coolDown)
+
+	if breaker.State() != retryhelper.CircuitHalfOpen {
+		t.Errorf("Wrong circuit state: %s", breaker.State())
+	}
+
+	// Failed trial opens circuit again
+
+	if err := breaker.Execute(failedFunc); !errors.Is(err, errFailed) {
+		t.Errorf("Operation error expected: %v", err)
+	}
+
+	if breaker.State() != retryhelper.CircuitOpen {
+		t.Errorf("Wrong circuit state: %s", breaker.State())
+	}
+
+	time.Sleep(coolDown)
+
+	if err := breaker.Execute(successFunc); err != nil {
+		t.Errorf("Execute error: %s", err)
+	}
+
+	if breaker.State() != retryhelper.CircuitClosed {
+		t.Errorf("Wrong circuit state: %s", breaker.State())
+	}
+
+	// Success resets consecutive failures
+
+	for i := 0; i < 4; i++ {
+		operation := failedFunc
+
+		if i == 2 {
+			operation = successFunc
+		}
+
+		_ = breaker.Execute(operation)
+	}
+
+	if breaker.State() != retryhelper.CircuitClosed {
+		t.Errorf("Wrong circuit state: %s", breaker.State())
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	var policy retryhelper.Policy
+
+	if err := json.Unmarshal([]byte(`{
+		"initialInterval": "10ms",
+		"multiplier": 1.5,
+		"maxInterval": "100ms",
+		"maxTry": 3,
+		"jitter": "equal"
+	}`), &policy); err != nil {
+		t.Fatalf("Can't unmarshal policy: %s", err)
+	}
+
+	expectedBackoff := retryhelper.Backoff{
+		InitialInterval: 10 * time.Millisecond,
+		Multiplier:      1.5,
+		MaxInterval:     100 * time.Millisecond,
+		MaxTry:          3,
+		Jitter:          retryhelper.JitterEqual,
+	}
+
+	if policy.Backoff() != expectedBackoff {
+		t.Errorf("Wrong backoff: %v", policy.Backoff())
+	}
+
+	var (
+		retries      []retryhelper.RetryInfo
+		giveUpInfo   *retryhelper.RetryInfo
+		errOperation = aoserrors.New("operation failed")
+	)
+
+	policy.OnRetry = func(info retryhelper.RetryInfo) { retries = append(retries, info) }
+	policy.OnGiveUp = func(info retryhelper.RetryInfo) { giveUpInfo = &info }
+
+	if err := policy.Do(context.Background(), func(context.Context) error {
+		return errOperation
+	}); !errors.Is(err, errOperation) {
+		t.Errorf("Operation error expected: %v", err)
+	}
+
+	if len(retries) != 2 {
+		t.Fatalf("Wrong retries count: %d", len(retries))
+	}
+
+	for i, info := range retries {
+		if info.Attempt != i+1 || info.Delay == 0 || !errors.Is(info.Err, errOperation) {
+			t.Errorf("Wrong retry info: %v", info)
+		}
+	}
+
+	if giveUpInfo == nil || giveUpInfo.Attempt != 3 || !errors.Is(giveUpInfo.Err, errOperation) {
+		t.Errorf("Wrong give up info: %v", giveUpInfo)
+	}
+
+	if err := json.Unmarshal([]byte(`{"jitter": "unknown"}`), &policy); err == nil {
+		t.Error("Error expected")
+	}
+}
+
 /***********************************************************************************************************************
  * Private
  **********************************************************************************************************************/
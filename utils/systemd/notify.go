@@ -0,0 +1,171 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package systemd provides systemd service notification helpers.
+package systemd
+
+import (
+	"context"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/aoscloud/aos_common/aoserrors"
+)
+
+/***********************************************************************************************************************
+ * Consts
+ **********************************************************************************************************************/
+
+// Notification states.
+const (
+	StateReady    = "READY=1"
+	StateStopping = "STOPPING=1"
+	StateWatchdog = "WATCHDOG=1"
+)
+
+const (
+	notifySocketEnv = "NOTIFY_SOCKET"
+	watchdogUSecEnv = "WATCHDOG_USEC"
+	watchdogPIDEnv  = "WATCHDOG_PID"
+)
+
+/***********************************************************************************************************************
+ * Types
+ **********************************************************************************************************************/
+
+// HealthCheckFunc returns error if component is not healthy.
+type HealthCheckFunc func() (err error)
+
+/***********************************************************************************************************************
+ * Public
+ **********************************************************************************************************************/
+
+// Notify sends state to systemd. It does nothing if service is not started by systemd with notify support.
+func Notify(state string) (err error) {
+	socketName := os.Getenv(notifySocketEnv)
+	if socketName == "" {
+		return nil
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socketName, Net: "unixgram"})
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+	defer conn.Close()
+
+	if _, err = conn.Write([]byte(state)); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	return nil
+}
+
+// NotifyReady notifies systemd that service startup is finished.
+func NotifyReady() (err error) {
+	return Notify(StateReady)
+}
+
+// NotifyStopping notifies systemd that service is stopping.
+func NotifyStopping() (err error) {
+	return Notify(StateStopping)
+}
+
+// NotifyWatchdog sends watchdog keepalive to systemd.
+func NotifyWatchdog() (err error) {
+	return Notify(StateWatchdog)
+}
+
+// NotifyStatus sends free-form service status to systemd.
+func NotifyStatus(status string) (err error) {
+	return Notify("STATUS=" + status)
+}
+
+// WatchdogInterval returns systemd watchdog timeout. Zero is returned if watchdog is not enabled for the service.
+func WatchdogInterval() (interval time.Duration, err error) {
+	usecStr := os.Getenv(watchdogUSecEnv)
+	if usecStr == "" {
+		return 0, nil
+	}
+
+	if pidStr := os.Getenv(watchdogPIDEnv); pidStr != "" {
+		pid, err := strconv.Atoi(pidStr)
+		if err != nil {
+			return 0, aoserrors.Wrap(err)
+		}
+
+		if pid != os.Getpid() {
+			return 0, nil
+		}
+	}
+
+	usec, err := strconv.ParseUint(usecStr, 10, 64)
+	if err != nil {
+		return 0, aoserrors.Wrap(err)
+	}
+
+	if usec == 0 {
+		return 0, aoserrors.New("wrong watchdog timeout")
+	}
+
+	return time.Duration(usec) * time.Microsecond, nil
+}
+
+// StartWatchdog starts sending watchdog keepalives at half of watchdog timeout until ctx is done. Keepalive is not
+// sent if healthCheck returns error, so systemd restarts hung service. It does nothing if watchdog is not enabled.
+func StartWatchdog(ctx context.Context, healthCheck HealthCheckFunc) (err error) {
+	interval, err := WatchdogInterval()
+	if err != nil {
+		return err
+	}
+
+	if interval == 0 {
+		return nil
+	}
+
+	log.WithField("interval", interval).Debug("Start systemd watchdog")
+
+	go func() {
+		ticker := time.NewTicker(interval / 2)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if healthCheck != nil {
+					if err := healthCheck(); err != nil {
+						log.Errorf("Health check failed, skip watchdog keepalive: %s", err)
+
+						continue
+					}
+				}
+
+				if err := NotifyWatchdog(); err != nil {
+					log.Errorf("Can't send watchdog keepalive: %s", err)
+				}
+
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return nil
+}
@@ -0,0 +1,142 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package systemd_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aoscloud/aos_common/aoserrors"
+	"github.com/aoscloud/aos_common/utils/systemd"
+)
+
+/***********************************************************************************************************************
+ * Tests
+ **********************************************************************************************************************/
+
+func TestNotify(t *testing.T) {
+	conn := newNotifySocket(t)
+	defer conn.Close()
+
+	if err := systemd.NotifyReady(); err != nil {
+		t.Fatalf("Can't notify ready: %s", err)
+	}
+
+	if state := readState(t, conn); state != systemd.StateReady {
+		t.Errorf("Wrong state: %s", state)
+	}
+
+	if err := systemd.NotifyStatus("updating"); err != nil {
+		t.Fatalf("Can't notify status: %s", err)
+	}
+
+	if state := readState(t, conn); state != "STATUS=updating" {
+		t.Errorf("Wrong state: %s", state)
+	}
+}
+
+func TestWatchdog(t *testing.T) {
+	conn := newNotifySocket(t)
+	defer conn.Close()
+
+	os.Setenv("WATCHDOG_USEC", strconv.Itoa(int((200 * time.Millisecond).Microseconds())))
+	os.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+
+	defer os.Unsetenv("WATCHDOG_USEC")
+	defer os.Unsetenv("WATCHDOG_PID")
+
+	var healthy int32 = 1
+
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+
+	if err := systemd.StartWatchdog(ctx, func() error {
+		if atomic.LoadInt32(&healthy) == 0 {
+			return aoserrors.New("not healthy")
+		}
+
+		return nil
+	}); err != nil {
+		t.Fatalf("Can't start watchdog: %s", err)
+	}
+
+	if state := readState(t, conn); state != systemd.StateWatchdog {
+		t.Errorf("Wrong state: %s", state)
+	}
+
+	atomic.StoreInt32(&healthy, 0)
+
+	// Drain keepalive which may be sent before health state is changed
+	_ = conn.SetReadDeadline(time.Now().Add(150 * time.Millisecond))
+	_, _ = conn.Read(make([]byte, 64))
+
+	_ = conn.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+
+	if _, err := conn.Read(make([]byte, 64)); err == nil {
+		t.Error("Keepalive should not be sent for unhealthy service")
+	}
+}
+
+/***********************************************************************************************************************
+ * Private
+ **********************************************************************************************************************/
+
+func newNotifySocket(t *testing.T) (conn *net.UnixConn) {
+	t.Helper()
+
+	tmpDir, err := ioutil.TempDir("", "systemd_")
+	if err != nil {
+		t.Fatalf("Can't create tmp dir: %s", err)
+	}
+
+	t.Cleanup(func() { os.RemoveAll(tmpDir) })
+
+	socketName := filepath.Join(tmpDir, "notify.sock")
+
+	if conn, err = net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socketName, Net: "unixgram"}); err != nil {
+		t.Fatalf("Can't create notify socket: %s", err)
+	}
+
+	os.Setenv("NOTIFY_SOCKET", socketName)
+
+	t.Cleanup(func() { os.Unsetenv("NOTIFY_SOCKET") })
+
+	return conn
+}
+
+func readState(t *testing.T, conn *net.UnixConn) (state string) {
+	t.Helper()
+
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+
+	buffer := make([]byte, 64)
+
+	n, err := conn.Read(buffer)
+	if err != nil {
+		t.Fatalf("Can't read state: %s", err)
+	}
+
+	return string(buffer[:n])
+}
@@ -19,9 +19,7 @@ package testtools
 
 import (
 	"crypto"
-	"crypto/rand"
-	"crypto/x509"
-	"encoding/pem"
+	"crypto/x509/pkix"
 	"io/ioutil"
 	"os"
 	"os/exec"
@@ -125,13 +123,10 @@ IP.1 = 127.0.0.1`
 
 // CreateCSR creates CSR.
 func CreateCSR(key crypto.PrivateKey) (csr []byte, err error) {
-	csrDER, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{}, key)
-	if err != nil {
+	if csr, err = cryptutils.CreateCSR(key, pkix.Name{}, cryptutils.CSROptions{}); err != nil {
 		return nil, aoserrors.Wrap(err)
 	}
 
-	csr = pem.EncodeToMemory(&pem.Block{Type: cryptutils.PEMBlockCertificateRequest, Bytes: csrDER})
-
 	return csr, nil
 }
 
@@ -0,0 +1,234 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testtools
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+/***********************************************************************************************************************
+ * Consts
+ **********************************************************************************************************************/
+
+const (
+	// UpdateGoldenEnv environment variable which enables golden files update.
+	UpdateGoldenEnv = "AOS_UPDATE_GOLDEN"
+
+	// UpdateGoldenFlag test binary flag which enables golden files update if it is defined by the test.
+	UpdateGoldenFlag = "update"
+
+	goldenFilePerm = 0o644
+	goldenDirPerm  = 0o755
+	maxDiffLines   = 50
+	// maxDiffCells limits memory used by LCS table: bigger diffs are shown from the first difference.
+	maxDiffCells = 1 << 20
+)
+
+/***********************************************************************************************************************
+ * Public
+ **********************************************************************************************************************/
+
+// CompareWithGolden compares got with golden file content. If both are JSON, they are compared after normalization,
+// so key order and formatting don't matter. Golden file is rewritten when test is run with AOS_UPDATE_GOLDEN=1
+// environment variable or with -update flag if the test binary defines it.
+func CompareWithGolden(t testing.TB, got []byte, goldenPath string) {
+	t.Helper()
+
+	if isGoldenUpdate() {
+		if err := os.MkdirAll(filepath.Dir(goldenPath), goldenDirPerm); err != nil {
+			t.Fatalf("Can't create golden dir: %s", err)
+		}
+
+		if err := ioutil.WriteFile(goldenPath, normalizeGolden(got), goldenFilePerm); err != nil {
+			t.Fatalf("Can't write golden file: %s", err)
+		}
+
+		return
+	}
+
+	golden, err := ioutil.ReadFile(goldenPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("Golden file %s not found, run test with %s=1 or -%s to create it", goldenPath,
+				UpdateGoldenEnv, UpdateGoldenFlag)
+		}
+
+		t.Fatalf("Can't read golden file: %s", err)
+	}
+
+	normalizedGot, normalizedGolden := normalizeGolden(got), normalizeGolden(golden)
+
+	if !bytes.Equal(normalizedGot, normalizedGolden) {
+		t.Errorf("Result differs from golden file %s:\n%s", goldenPath,
+			diffLines(string(normalizedGolden), string(normalizedGot)))
+	}
+}
+
+/***********************************************************************************************************************
+ * Private
+ **********************************************************************************************************************/
+
+func isGoldenUpdate() (update bool) {
+	if update, _ = strconv.ParseBool(os.Getenv(UpdateGoldenEnv)); update {
+		return true
+	}
+
+	if updateFlag := flag.Lookup(UpdateGoldenFlag); updateFlag != nil {
+		update, _ = strconv.ParseBool(updateFlag.Value.String())
+	}
+
+	return update
+}
+
+func normalizeGolden(data []byte) (normalized []byte) {
+	var value interface{}
+
+	// Use number to keep big integers and float formatting as is
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	if err := decoder.Decode(&value); err != nil {
+		return data
+	}
+
+	if _, err := decoder.Token(); !errors.Is(err, io.EOF) {
+		return data
+	}
+
+	normalized, err := json.MarshalIndent(value, "", "    ")
+	if err != nil {
+		return data
+	}
+
+	return append(normalized, '\n')
+}
+
+// diffLines returns line diff based on longest common subsequence. Removed lines are prefixed with "-", added
+// lines with "+".
+func diffLines(expected, got string) (diff string) {
+	expectedLines, gotLines := strings.Split(expected, "\n"), strings.Split(got, "\n")
+
+	// Common prefix and suffix don't change the diff but reduce LCS table
+	prefix := 0
+
+	for prefix < len(expectedLines) && prefix < len(gotLines) && expectedLines[prefix] == gotLines[prefix] {
+		prefix++
+	}
+
+	expectedLines, gotLines = expectedLines[prefix:], gotLines[prefix:]
+
+	suffix := 0
+
+	for suffix < len(expectedLines) && suffix < len(gotLines) &&
+		expectedLines[len(expectedLines)-suffix-1] == gotLines[len(gotLines)-suffix-1] {
+		suffix++
+	}
+
+	expectedLines, gotLines = expectedLines[:len(expectedLines)-suffix], gotLines[:len(gotLines)-suffix]
+
+	if len(expectedLines) > 0 && len(gotLines) > maxDiffCells/len(expectedLines) {
+		return diffWindow(prefix, expectedLines, gotLines)
+	}
+
+	lcs := make([][]int, len(expectedLines)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(gotLines)+1)
+	}
+
+	for i := len(expectedLines) - 1; i >= 0; i-- {
+		for j := len(gotLines) - 1; j >= 0; j-- {
+			if expectedLines[i] == gotLines[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var (
+		builder   strings.Builder
+		diffCount int
+	)
+
+	addLine := func(prefix, line string) {
+		if diffCount++; diffCount <= maxDiffLines {
+			fmt.Fprintf(&builder, "%s %s\n", prefix, line)
+		}
+	}
+
+	i, j := 0, 0
+
+	for i < len(expectedLines) || j < len(gotLines) {
+		switch {
+		case i < len(expectedLines) && j < len(gotLines) && expectedLines[i] == gotLines[j]:
+			i++
+			j++
+
+		case i < len(expectedLines) && (j == len(gotLines) || lcs[i+1][j] >= lcs[i][j+1]):
+			addLine("-", expectedLines[i])
+			i++
+
+		default:
+			addLine("+", gotLines[j])
+			j++
+		}
+	}
+
+	if diffCount > maxDiffLines {
+		fmt.Fprintf(&builder, "... %d more lines\n", diffCount-maxDiffLines)
+	}
+
+	return builder.String()
+}
+
+// diffWindow returns lines of both sides starting from the first difference.
+func diffWindow(firstDiff int, expectedLines, gotLines []string) (diff string) {
+	var builder strings.Builder
+
+	fmt.Fprintf(&builder, "diff is too big, showing lines starting from the first difference at line %d\n",
+		firstDiff+1)
+
+	for _, side := range []struct {
+		prefix string
+		lines  []string
+	}{{"-", expectedLines}, {"+", gotLines}} {
+		for i, line := range side.lines {
+			if i == maxDiffLines/2 {
+				fmt.Fprintf(&builder, "... %d more lines\n", len(side.lines)-i)
+
+				break
+			}
+
+			fmt.Fprintf(&builder, "%s %s\n", side.prefix, line)
+		}
+	}
+
+	return builder.String()
+}
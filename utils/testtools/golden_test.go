@@ -0,0 +1,190 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testtools_test
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aoscloud/aos_common/utils/testtools"
+)
+
+/***********************************************************************************************************************
+ * Types
+ **********************************************************************************************************************/
+
+type testRecorder struct {
+	testing.TB
+	errors []string
+}
+
+/***********************************************************************************************************************
+ * Vars
+ **********************************************************************************************************************/
+
+// nolint:gochecknoglobals // test binary flag honoured by CompareWithGolden
+var updateGolden = flag.Bool(testtools.UpdateGoldenFlag, false, "update golden files")
+
+/***********************************************************************************************************************
+ * Tests
+ **********************************************************************************************************************/
+
+func TestGoldenNormalization(t *testing.T) {
+	goldenPath := writeGolden(t, `{"b": 1, "a": 12345678901234567890}`)
+
+	recorder := &testRecorder{TB: t}
+
+	testtools.CompareWithGolden(recorder, []byte(`{"a":12345678901234567890,"b":1}`), goldenPath)
+
+	if len(recorder.errors) != 0 {
+		t.Errorf("Unexpected golden errors: %v", recorder.errors)
+	}
+
+	// Big numbers should not be compared as floats
+	testtools.CompareWithGolden(recorder, []byte(`{"a":12345678901234567891,"b":1}`), goldenPath)
+
+	if len(recorder.errors) == 0 {
+		t.Error("Golden error expected")
+	}
+}
+
+func TestGoldenDiff(t *testing.T) {
+	goldenPath := writeGolden(t, "line1\nline2\nline3\n")
+
+	recorder := &testRecorder{TB: t}
+
+	testtools.CompareWithGolden(recorder, []byte("line1\nchanged\nline3\nline4\n"), goldenPath)
+
+	if len(recorder.errors) != 1 {
+		t.Fatalf("Wrong golden errors count: %d", len(recorder.errors))
+	}
+
+	if !strings.HasSuffix(recorder.errors[0], ":\n- line2\n+ changed\n+ line4\n") {
+		t.Errorf("Wrong golden diff: %s", recorder.errors[0])
+	}
+}
+
+func TestGoldenBigDiff(t *testing.T) {
+	const linesCount = 3000
+
+	var golden, got strings.Builder
+
+	for i := 0; i < linesCount; i++ {
+		fmt.Fprintf(&golden, "line%d\n", i)
+
+		if i < 10 {
+			fmt.Fprintf(&got, "line%d\n", i)
+		} else {
+			fmt.Fprintf(&got, "changed%d\n", i)
+		}
+	}
+
+	recorder := &testRecorder{TB: t}
+
+	testtools.CompareWithGolden(recorder, []byte(got.String()), writeGolden(t, golden.String()))
+
+	if len(recorder.errors) != 1 {
+		t.Fatalf("Wrong golden errors count: %d", len(recorder.errors))
+	}
+
+	if !strings.Contains(recorder.errors[0], "first difference at line 11\n- line10\n") ||
+		!strings.Contains(recorder.errors[0], "\n+ changed10\n") {
+		t.Errorf("Wrong golden diff: %s", recorder.errors[0])
+	}
+
+	if count := strings.Count(recorder.errors[0], "\n"); count > 60 {
+		t.Errorf("Golden diff is too long: %d lines", count)
+	}
+}
+
+func TestGoldenUpdate(t *testing.T) {
+	goldenPath := filepath.Join(writeGolden(t, "old"), "..", "new", "golden.json")
+
+	os.Setenv(testtools.UpdateGoldenEnv, "1")
+	defer os.Unsetenv(testtools.UpdateGoldenEnv)
+
+	testtools.CompareWithGolden(t, []byte(`{"b":1,"a":2}`), goldenPath)
+
+	data, err := ioutil.ReadFile(goldenPath)
+	if err != nil {
+		t.Fatalf("Can't read golden file: %s", err)
+	}
+
+	if string(data) != "{\n    \"a\": 2,\n    \"b\": 1\n}\n" {
+		t.Errorf("Wrong golden file content: %s", data)
+	}
+
+	os.Unsetenv(testtools.UpdateGoldenEnv)
+
+	if *updateGolden {
+		t.Skip("Golden files update is enabled by flag")
+	}
+
+	if err = flag.Set(testtools.UpdateGoldenFlag, "true"); err != nil {
+		t.Fatalf("Can't set update flag: %s", err)
+	}
+
+	defer func() {
+		if err := flag.Set(testtools.UpdateGoldenFlag, "false"); err != nil {
+			t.Errorf("Can't reset update flag: %s", err)
+		}
+	}()
+
+	testtools.CompareWithGolden(t, []byte(`{"c":3}`), goldenPath)
+
+	if data, err = ioutil.ReadFile(goldenPath); err != nil {
+		t.Fatalf("Can't read golden file: %s", err)
+	}
+
+	if string(data) != "{\n    \"c\": 3\n}\n" {
+		t.Errorf("Golden file is not updated by flag: %s", data)
+	}
+}
+
+/***********************************************************************************************************************
+ * Private
+ **********************************************************************************************************************/
+
+func (recorder *testRecorder) Helper() {}
+
+func (recorder *testRecorder) Errorf(format string, args ...interface{}) {
+	recorder.errors = append(recorder.errors, fmt.Sprintf(format, args...))
+}
+
+func writeGolden(t *testing.T, content string) (goldenPath string) {
+	t.Helper()
+
+	tmpDir, err := ioutil.TempDir("", "golden_")
+	if err != nil {
+		t.Fatalf("Can't create tmp dir: %s", err)
+	}
+
+	t.Cleanup(func() { os.RemoveAll(tmpDir) })
+
+	goldenPath = filepath.Join(tmpDir, "golden.txt")
+
+	if err = ioutil.WriteFile(goldenPath, []byte(content), 0o600); err != nil {
+		t.Fatalf("Can't write golden file: %s", err)
+	}
+
+	return goldenPath
+}
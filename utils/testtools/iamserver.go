@@ -0,0 +1,524 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testtools
+
+import (
+	"context"
+	"net"
+	"sync"
+
+	"github.com/golang/protobuf/ptypes/empty"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/aoscloud/aos_common/aoserrors"
+	pb "github.com/aoscloud/aos_common/api/iamanager/v2"
+)
+
+/***********************************************************************************************************************
+ * Consts
+ **********************************************************************************************************************/
+
+const iamAPIVersion = 2
+
+/***********************************************************************************************************************
+ * Types
+ **********************************************************************************************************************/
+
+// TestCall recorded call of test server.
+type TestCall struct {
+	Method  string
+	Request interface{}
+}
+
+// TestIAMServer in-process IAM public service with scriptable responses and call recording.
+type TestIAMServer struct {
+	pb.UnimplementedIAMPublicServiceServer
+	callRecorder
+
+	grpcServer  *grpc.Server
+	systemInfo  *pb.SystemInfo
+	certs       map[string]*pb.GetCertResponse
+	permissions map[string]*pb.PermissionsResponse
+	users       []string
+	subscribers []chan []string
+}
+
+// TestIAMProtectedServer in-process IAM protected service with scriptable responses and call recording.
+type TestIAMProtectedServer struct {
+	pb.UnimplementedIAMProtectedServiceServer
+	callRecorder
+
+	grpcServer *grpc.Server
+	csrs       map[string]string
+	certURLs   map[string]string
+	secrets    map[string]string
+	services   map[string]map[string]*pb.Permissions
+	users      []string
+}
+
+type callRecorder struct {
+	sync.Mutex
+
+	calls  []TestCall
+	errors map[string]error
+}
+
+/***********************************************************************************************************************
+ * Public
+ **********************************************************************************************************************/
+
+// NewTestIAMServer creates and starts test IAM server.
+func NewTestIAMServer(url string) (server *TestIAMServer, err error) {
+	server = &TestIAMServer{
+		systemInfo:  &pb.SystemInfo{},
+		certs:       make(map[string]*pb.GetCertResponse),
+		permissions: make(map[string]*pb.PermissionsResponse),
+	}
+
+	if server.grpcServer, err = startGRPCServer(url, func(grpcServer *grpc.Server) {
+		pb.RegisterIAMPublicServiceServer(grpcServer, server)
+	}); err != nil {
+		return nil, err
+	}
+
+	return server, nil
+}
+
+// Close stops test IAM server.
+func (server *TestIAMServer) Close() {
+	server.grpcServer.Stop()
+}
+
+// SetSystemInfo sets system info response.
+func (server *TestIAMServer) SetSystemInfo(systemID, boardModel string) {
+	server.Lock()
+	defer server.Unlock()
+
+	server.systemInfo = &pb.SystemInfo{SystemId: systemID, BoardModel: boardModel}
+}
+
+// SetCert sets certificate response for certificate type.
+func (server *TestIAMServer) SetCert(certType, certURL, keyURL string) {
+	server.Lock()
+	defer server.Unlock()
+
+	server.certs[certType] = &pb.GetCertResponse{Type: certType, CertUrl: certURL, KeyUrl: keyURL}
+}
+
+// SetPermissions sets permissions response for secret.
+func (server *TestIAMServer) SetPermissions(secret, serviceID string, permissions map[string]string) {
+	server.Lock()
+	defer server.Unlock()
+
+	server.permissions[secret] = &pb.PermissionsResponse{
+		ServiceId: serviceID, Permissions: &pb.Permissions{Permissions: permissions},
+	}
+}
+
+// SetUsers sets users and notifies users changed subscribers.
+func (server *TestIAMServer) SetUsers(users []string) {
+	server.Lock()
+	defer server.Unlock()
+
+	server.users = users
+
+	for _, subscriber := range server.subscribers {
+		select {
+		case subscriber <- users:
+
+		default:
+			log.Warn("Users changed subscriber is not ready")
+		}
+	}
+}
+
+// NewTestIAMProtectedServer creates and starts test IAM protected server.
+func NewTestIAMProtectedServer(url string) (server *TestIAMProtectedServer, err error) {
+	server = &TestIAMProtectedServer{
+		csrs:     make(map[string]string),
+		certURLs: make(map[string]string),
+		secrets:  make(map[string]string),
+		services: make(map[string]map[string]*pb.Permissions),
+	}
+
+	if server.grpcServer, err = startGRPCServer(url, func(grpcServer *grpc.Server) {
+		pb.RegisterIAMProtectedServiceServer(grpcServer, server)
+	}); err != nil {
+		return nil, err
+	}
+
+	return server, nil
+}
+
+// Close stops test IAM protected server.
+func (server *TestIAMProtectedServer) Close() {
+	server.grpcServer.Stop()
+}
+
+// SetCSR sets CSR returned by CreateKey for certificate type.
+func (server *TestIAMProtectedServer) SetCSR(certType, csr string) {
+	server.Lock()
+	defer server.Unlock()
+
+	server.csrs[certType] = csr
+}
+
+// SetCertURL sets certificate URL returned by ApplyCert for certificate type.
+func (server *TestIAMProtectedServer) SetCertURL(certType, certURL string) {
+	server.Lock()
+	defer server.Unlock()
+
+	server.certURLs[certType] = certURL
+}
+
+// SetSecret sets secret returned by RegisterService for service. Random secret is returned if it is not set.
+func (server *TestIAMProtectedServer) SetSecret(serviceID, secret string) {
+	server.Lock()
+	defer server.Unlock()
+
+	server.secrets[serviceID] = secret
+}
+
+// GetServicePermissions returns permissions of registered service.
+func (server *TestIAMProtectedServer) GetServicePermissions(
+	serviceID string) (permissions map[string]*pb.Permissions, ok bool) {
+	server.Lock()
+	defer server.Unlock()
+
+	permissions, ok = server.services[serviceID]
+
+	return permissions, ok
+}
+
+// GetUsers returns users set by SetUsers call.
+func (server *TestIAMProtectedServer) GetUsers() (users []string) {
+	server.Lock()
+	defer server.Unlock()
+
+	return server.users
+}
+
+// SetError sets error returned by method, e.g. "GetCert". Nil err clears the error.
+func (recorder *callRecorder) SetError(method string, err error) {
+	recorder.Lock()
+	defer recorder.Unlock()
+
+	if recorder.errors == nil {
+		recorder.errors = make(map[string]error)
+	}
+
+	recorder.errors[method] = err
+}
+
+// Calls returns recorded calls.
+func (recorder *callRecorder) Calls() (calls []TestCall) {
+	recorder.Lock()
+	defer recorder.Unlock()
+
+	return append([]TestCall(nil), recorder.calls...)
+}
+
+// GetSystemInfo returns system info.
+func (server *TestIAMServer) GetSystemInfo(ctx context.Context, req *empty.Empty) (*pb.SystemInfo, error) {
+	server.Lock()
+	defer server.Unlock()
+
+	if err := server.record("GetSystemInfo", req); err != nil {
+		return nil, err
+	}
+
+	return server.systemInfo, nil
+}
+
+// GetCertTypes returns types of configured certificates.
+func (server *TestIAMServer) GetCertTypes(ctx context.Context, req *empty.Empty) (*pb.CertTypes, error) {
+	server.Lock()
+	defer server.Unlock()
+
+	if err := server.record("GetCertTypes", req); err != nil {
+		return nil, err
+	}
+
+	certTypes := &pb.CertTypes{}
+
+	for certType := range server.certs {
+		certTypes.Types = append(certTypes.Types, certType)
+	}
+
+	return certTypes, nil
+}
+
+// GetCert returns certificate.
+func (server *TestIAMServer) GetCert(ctx context.Context, req *pb.GetCertRequest) (*pb.GetCertResponse, error) {
+	server.Lock()
+	defer server.Unlock()
+
+	if err := server.record("GetCert", req); err != nil {
+		return nil, err
+	}
+
+	cert, ok := server.certs[req.Type]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "certificate %s not found", req.Type)
+	}
+
+	return cert, nil
+}
+
+// GetPermissions returns permissions.
+func (server *TestIAMServer) GetPermissions(
+	ctx context.Context, req *pb.PermissionsRequest) (*pb.PermissionsResponse, error) {
+	server.Lock()
+	defer server.Unlock()
+
+	if err := server.record("GetPermissions", req); err != nil {
+		return nil, err
+	}
+
+	permissions, ok := server.permissions[req.Secret]
+	if !ok {
+		return nil, status.Error(codes.NotFound, "secret not found")
+	}
+
+	return permissions, nil
+}
+
+// GetUsers returns users.
+func (server *TestIAMServer) GetUsers(ctx context.Context, req *empty.Empty) (*pb.Users, error) {
+	server.Lock()
+	defer server.Unlock()
+
+	if err := server.record("GetUsers", req); err != nil {
+		return nil, err
+	}
+
+	return &pb.Users{Users: server.users}, nil
+}
+
+// SubscribeUsersChanged sends users on each SetUsers call.
+func (server *TestIAMServer) SubscribeUsersChanged(
+	req *empty.Empty, stream pb.IAMPublicService_SubscribeUsersChangedServer) (err error) {
+	server.Lock()
+
+	if err = server.record("SubscribeUsersChanged", req); err != nil {
+		server.Unlock()
+
+		return err
+	}
+
+	subscriber := make(chan []string, 1)
+
+	server.subscribers = append(server.subscribers, subscriber)
+
+	server.Unlock()
+
+	defer server.unsubscribe(subscriber)
+
+	for {
+		select {
+		case users := <-subscriber:
+			if err = stream.Send(&pb.Users{Users: users}); err != nil {
+				return aoserrors.Wrap(err)
+			}
+
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+// GetAPIVersion returns IAM API version.
+func (server *TestIAMServer) GetAPIVersion(ctx context.Context, req *empty.Empty) (*pb.APIVersion, error) {
+	server.Lock()
+	defer server.Unlock()
+
+	if err := server.record("GetAPIVersion", req); err != nil {
+		return nil, err
+	}
+
+	return &pb.APIVersion{Version: iamAPIVersion}, nil
+}
+
+// SetOwner accepts any request.
+func (server *TestIAMProtectedServer) SetOwner(ctx context.Context, req *pb.SetOwnerRequest) (*empty.Empty, error) {
+	return server.accept("SetOwner", req)
+}
+
+// Clear accepts any request.
+func (server *TestIAMProtectedServer) Clear(ctx context.Context, req *pb.ClearRequest) (*empty.Empty, error) {
+	return server.accept("Clear", req)
+}
+
+// CreateKey returns scripted CSR.
+func (server *TestIAMProtectedServer) CreateKey(
+	ctx context.Context, req *pb.CreateKeyRequest) (*pb.CreateKeyResponse, error) {
+	server.Lock()
+	defer server.Unlock()
+
+	if err := server.record("CreateKey", req); err != nil {
+		return nil, err
+	}
+
+	csr, ok := server.csrs[req.Type]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "certificate type %s not found", req.Type)
+	}
+
+	return &pb.CreateKeyResponse{Type: req.Type, Csr: csr}, nil
+}
+
+// ApplyCert returns scripted certificate URL.
+func (server *TestIAMProtectedServer) ApplyCert(
+	ctx context.Context, req *pb.ApplyCertRequest) (*pb.ApplyCertResponse, error) {
+	server.Lock()
+	defer server.Unlock()
+
+	if err := server.record("ApplyCert", req); err != nil {
+		return nil, err
+	}
+
+	certURL, ok := server.certURLs[req.Type]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "certificate type %s not found", req.Type)
+	}
+
+	return &pb.ApplyCertResponse{Type: req.Type, CertUrl: certURL}, nil
+}
+
+// EncryptDisk accepts any request.
+func (server *TestIAMProtectedServer) EncryptDisk(
+	ctx context.Context, req *pb.EncryptDiskRequest) (*empty.Empty, error) {
+	return server.accept("EncryptDisk", req)
+}
+
+// FinishProvisioning accepts any request.
+func (server *TestIAMProtectedServer) FinishProvisioning(
+	ctx context.Context, req *empty.Empty) (*empty.Empty, error) {
+	return server.accept("FinishProvisioning", req)
+}
+
+// SetUsers stores users.
+func (server *TestIAMProtectedServer) SetUsers(ctx context.Context, req *pb.Users) (*empty.Empty, error) {
+	server.Lock()
+	defer server.Unlock()
+
+	if err := server.record("SetUsers", req); err != nil {
+		return nil, err
+	}
+
+	server.users = req.Users
+
+	return &empty.Empty{}, nil
+}
+
+// RegisterService registers service and returns its secret.
+func (server *TestIAMProtectedServer) RegisterService(
+	ctx context.Context, req *pb.RegisterServiceRequest) (*pb.RegisterServiceResponse, error) {
+	server.Lock()
+	defer server.Unlock()
+
+	if err := server.record("RegisterService", req); err != nil {
+		return nil, err
+	}
+
+	secret, ok := server.secrets[req.ServiceId]
+	if !ok {
+		secret = uuid.New().String()
+		server.secrets[req.ServiceId] = secret
+	}
+
+	server.services[req.ServiceId] = req.Permissions
+
+	return &pb.RegisterServiceResponse{Secret: secret}, nil
+}
+
+// UnregisterService unregisters service.
+func (server *TestIAMProtectedServer) UnregisterService(
+	ctx context.Context, req *pb.UnregisterServiceRequest) (*empty.Empty, error) {
+	server.Lock()
+	defer server.Unlock()
+
+	if err := server.record("UnregisterService", req); err != nil {
+		return nil, err
+	}
+
+	if _, ok := server.services[req.ServiceId]; !ok {
+		return nil, status.Errorf(codes.NotFound, "service %s not found", req.ServiceId)
+	}
+
+	delete(server.services, req.ServiceId)
+
+	return &empty.Empty{}, nil
+}
+
+/***********************************************************************************************************************
+ * Private
+ **********************************************************************************************************************/
+
+func (server *TestIAMProtectedServer) accept(method string, req interface{}) (*empty.Empty, error) {
+	server.Lock()
+	defer server.Unlock()
+
+	if err := server.record(method, req); err != nil {
+		return nil, err
+	}
+
+	return &empty.Empty{}, nil
+}
+
+func (server *TestIAMServer) unsubscribe(subscriber chan []string) {
+	server.Lock()
+	defer server.Unlock()
+
+	for i, item := range server.subscribers {
+		if item == subscriber {
+			server.subscribers = append(server.subscribers[:i], server.subscribers[i+1:]...)
+
+			break
+		}
+	}
+}
+
+// record should be called under lock.
+func (recorder *callRecorder) record(method string, req interface{}) (err error) {
+	recorder.calls = append(recorder.calls, TestCall{Method: method, Request: req})
+
+	return recorder.errors[method]
+}
+
+func startGRPCServer(url string, register func(grpcServer *grpc.Server)) (grpcServer *grpc.Server, err error) {
+	listener, err := net.Listen("tcp", url)
+	if err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	grpcServer = grpc.NewServer()
+
+	register(grpcServer)
+
+	go func() {
+		if err := grpcServer.Serve(listener); err != nil {
+			log.Errorf("Can't serve test gRPC server: %s", err)
+		}
+	}()
+
+	return grpcServer, nil
+}
@@ -0,0 +1,271 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testtools_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/empty"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/aoscloud/aos_common/aoserrors"
+	pb "github.com/aoscloud/aos_common/api/iamanager/v2"
+	"github.com/aoscloud/aos_common/utils/testtools"
+)
+
+/***********************************************************************************************************************
+ * Consts
+ **********************************************************************************************************************/
+
+const (
+	iamPublicURL    = "localhost:8101"
+	iamProtectedURL = "localhost:8102"
+	smURL           = "localhost:8103"
+	umURL           = "localhost:8104"
+)
+
+const testTimeout = 5 * time.Second
+
+/***********************************************************************************************************************
+ * Tests
+ **********************************************************************************************************************/
+
+func TestIAMServer(t *testing.T) {
+	server, err := testtools.NewTestIAMServer(iamPublicURL)
+	if err != nil {
+		t.Fatalf("Can't create test IAM server: %s", err)
+	}
+	defer server.Close()
+
+	server.SetSystemInfo("systemID", "boardModel")
+	server.SetCert("online", "certURL", "keyURL")
+	server.SetPermissions("secret", "service0", map[string]string{"*": "rw"})
+
+	client := pb.NewIAMPublicServiceClient(dialTestServer(t, iamPublicURL))
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	systemInfo, err := client.GetSystemInfo(ctx, &empty.Empty{})
+	if err != nil {
+		t.Fatalf("Can't get system info: %s", err)
+	}
+
+	if systemInfo.SystemId != "systemID" || systemInfo.BoardModel != "boardModel" {
+		t.Errorf("Wrong system info: %v", systemInfo)
+	}
+
+	cert, err := client.GetCert(ctx, &pb.GetCertRequest{Type: "online"})
+	if err != nil {
+		t.Fatalf("Can't get cert: %s", err)
+	}
+
+	if cert.CertUrl != "certURL" || cert.KeyUrl != "keyURL" {
+		t.Errorf("Wrong cert: %v", cert)
+	}
+
+	if _, err = client.GetCert(ctx, &pb.GetCertRequest{Type: "offline"}); status.Code(err) != codes.NotFound {
+		t.Errorf("Not found error expected: %v", err)
+	}
+
+	permissions, err := client.GetPermissions(ctx, &pb.PermissionsRequest{Secret: "secret", FunctionalServerId: "vis"})
+	if err != nil {
+		t.Fatalf("Can't get permissions: %s", err)
+	}
+
+	if permissions.ServiceId != "service0" || permissions.Permissions.Permissions["*"] != "rw" {
+		t.Errorf("Wrong permissions: %v", permissions)
+	}
+
+	server.SetError("GetAPIVersion", aoserrors.New("test error"))
+
+	if _, err = client.GetAPIVersion(ctx, &empty.Empty{}); err == nil {
+		t.Error("Error expected")
+	}
+
+	stream, err := client.SubscribeUsersChanged(ctx, &empty.Empty{})
+	if err != nil {
+		t.Fatalf("Can't subscribe users changed: %s", err)
+	}
+
+	waitCall(t, server.Calls, "SubscribeUsersChanged")
+
+	server.SetUsers([]string{"user0", "user1"})
+
+	users, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("Can't receive users: %s", err)
+	}
+
+	if len(users.Users) != 2 || users.Users[0] != "user0" || users.Users[1] != "user1" {
+		t.Errorf("Wrong users: %v", users.Users)
+	}
+
+	checkCalls(t, server.Calls(), "GetSystemInfo", "GetCert", "GetCert", "GetPermissions", "GetAPIVersion",
+		"SubscribeUsersChanged")
+}
+
+func TestIAMProtectedServer(t *testing.T) {
+	server, err := testtools.NewTestIAMProtectedServer(iamProtectedURL)
+	if err != nil {
+		t.Fatalf("Can't create test IAM protected server: %s", err)
+	}
+	defer server.Close()
+
+	server.SetCSR("online", "csr")
+	server.SetCertURL("online", "certURL")
+	server.SetSecret("service0", "secret0")
+
+	client := pb.NewIAMProtectedServiceClient(dialTestServer(t, iamProtectedURL))
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	if _, err = client.SetOwner(ctx, &pb.SetOwnerRequest{Type: "online", Password: "password"}); err != nil {
+		t.Errorf("Can't set owner: %s", err)
+	}
+
+	key, err := client.CreateKey(ctx, &pb.CreateKeyRequest{Type: "online"})
+	if err != nil {
+		t.Fatalf("Can't create key: %s", err)
+	}
+
+	if key.Type != "online" || key.Csr != "csr" {
+		t.Errorf("Wrong create key response: %v", key)
+	}
+
+	cert, err := client.ApplyCert(ctx, &pb.ApplyCertRequest{Type: "online", Cert: "cert"})
+	if err != nil {
+		t.Fatalf("Can't apply cert: %s", err)
+	}
+
+	if cert.CertUrl != "certURL" {
+		t.Errorf("Wrong apply cert response: %v", cert)
+	}
+
+	if _, err = client.CreateKey(ctx, &pb.CreateKeyRequest{Type: "offline"}); status.Code(err) != codes.NotFound {
+		t.Errorf("Not found error expected: %v", err)
+	}
+
+	registered, err := client.RegisterService(ctx, &pb.RegisterServiceRequest{
+		ServiceId:   "service0",
+		Permissions: map[string]*pb.Permissions{"vis": {Permissions: map[string]string{"*": "rw"}}},
+	})
+	if err != nil {
+		t.Fatalf("Can't register service: %s", err)
+	}
+
+	if registered.Secret != "secret0" {
+		t.Errorf("Wrong service secret: %s", registered.Secret)
+	}
+
+	if registered, err = client.RegisterService(
+		ctx, &pb.RegisterServiceRequest{ServiceId: "service1"}); err != nil || registered.Secret == "" {
+		t.Errorf("Can't register service: %v", err)
+	}
+
+	permissions, ok := server.GetServicePermissions("service0")
+	if !ok || permissions["vis"].Permissions["*"] != "rw" {
+		t.Errorf("Wrong service permissions: %v", permissions)
+	}
+
+	if _, err = client.UnregisterService(ctx, &pb.UnregisterServiceRequest{ServiceId: "service0"}); err != nil {
+		t.Errorf("Can't unregister service: %s", err)
+	}
+
+	if _, ok = server.GetServicePermissions("service0"); ok {
+		t.Error("Service is not unregistered")
+	}
+
+	if _, err = client.SetUsers(ctx, &pb.Users{Users: []string{"user0"}}); err != nil {
+		t.Errorf("Can't set users: %s", err)
+	}
+
+	if users := server.GetUsers(); len(users) != 1 || users[0] != "user0" {
+		t.Errorf("Wrong users: %v", users)
+	}
+
+	server.SetError("FinishProvisioning", aoserrors.New("test error"))
+
+	if _, err = client.FinishProvisioning(ctx, &empty.Empty{}); err == nil {
+		t.Error("Error expected")
+	}
+
+	checkCalls(t, server.Calls(), "SetOwner", "CreateKey", "ApplyCert", "CreateKey", "RegisterService",
+		"RegisterService", "UnregisterService", "SetUsers", "FinishProvisioning")
+}
+
+/***********************************************************************************************************************
+ * Private
+ **********************************************************************************************************************/
+
+func dialTestServer(t *testing.T, url string) (connection *grpc.ClientConn) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	connection, err := grpc.DialContext(ctx, url, grpc.WithInsecure(), grpc.WithBlock())
+	if err != nil {
+		t.Fatalf("Can't dial test server: %s", err)
+	}
+
+	t.Cleanup(func() { connection.Close() })
+
+	return connection
+}
+
+func waitCall(t *testing.T, getCalls func() []testtools.TestCall, method string) {
+	t.Helper()
+
+	for timeout := time.After(testTimeout); ; {
+		for _, call := range getCalls() {
+			if call.Method == method {
+				return
+			}
+		}
+
+		select {
+		case <-timeout:
+			t.Fatalf("Wait call %s timeout", method)
+
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func checkCalls(t *testing.T, calls []testtools.TestCall, methods ...string) {
+	t.Helper()
+
+	if len(calls) != len(methods) {
+		t.Fatalf("Wrong calls count: %d", len(calls))
+	}
+
+	for i, call := range calls {
+		if call.Method != methods[i] {
+			t.Errorf("Wrong call %d: %s", i, call.Method)
+		}
+
+		if call.Request == nil {
+			t.Errorf("Request of call %s is not recorded", call.Method)
+		}
+	}
+}
@@ -0,0 +1,348 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testtools
+
+import (
+	"context"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/empty"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+
+	"github.com/aoscloud/aos_common/aoserrors"
+	smpb "github.com/aoscloud/aos_common/api/servicemanager/v1"
+	umpb "github.com/aoscloud/aos_common/api/updatemanager/v1"
+)
+
+/***********************************************************************************************************************
+ * Consts
+ **********************************************************************************************************************/
+
+const (
+	umMessagesChannelSize      = 10
+	smNotificationsChannelSize = 10
+)
+
+/***********************************************************************************************************************
+ * Types
+ **********************************************************************************************************************/
+
+// TestSMServer in-process SM service which accepts any request, records calls and emits scripted notifications.
+type TestSMServer struct {
+	smpb.UnimplementedSMServiceServer
+	callRecorder
+
+	grpcServer         *grpc.Server
+	status             *smpb.SMStatus
+	boardConfigVersion string
+	subscribers        []chan *smpb.SMNotifications
+}
+
+// TestUMClient UM stub which registers on UM service, sends scripted update statuses and receives CM messages.
+type TestUMClient struct {
+	connection *grpc.ClientConn
+	stream     umpb.UMService_RegisterUMClient
+	messages   chan *umpb.CMMessages
+}
+
+/***********************************************************************************************************************
+ * Public
+ **********************************************************************************************************************/
+
+// NewTestSMServer creates and starts test SM server.
+func NewTestSMServer(url string) (server *TestSMServer, err error) {
+	server = &TestSMServer{status: &smpb.SMStatus{}}
+
+	if server.grpcServer, err = startGRPCServer(url, func(grpcServer *grpc.Server) {
+		smpb.RegisterSMServiceServer(grpcServer, server)
+	}); err != nil {
+		return nil, err
+	}
+
+	return server, nil
+}
+
+// Close stops test SM server.
+func (server *TestSMServer) Close() {
+	server.grpcServer.Stop()
+}
+
+// SetStatus sets status returned by GetUsersStatus and GetAllStatus.
+func (server *TestSMServer) SetStatus(status *smpb.SMStatus) {
+	server.Lock()
+	defer server.Unlock()
+
+	server.status = status
+}
+
+// SetBoardConfigVersion sets board config vendor version.
+func (server *TestSMServer) SetBoardConfigVersion(vendorVersion string) {
+	server.Lock()
+	defer server.Unlock()
+
+	server.boardConfigVersion = vendorVersion
+}
+
+// SendNotification sends notification to all subscribers.
+func (server *TestSMServer) SendNotification(notification *smpb.SMNotifications) {
+	server.Lock()
+	defer server.Unlock()
+
+	for _, subscriber := range server.subscribers {
+		select {
+		case subscriber <- notification:
+
+		default:
+			log.Warn("SM notifications subscriber is not ready")
+		}
+	}
+}
+
+// GetUsersStatus returns scripted status.
+func (server *TestSMServer) GetUsersStatus(ctx context.Context, req *smpb.Users) (*smpb.SMStatus, error) {
+	return server.getStatus("GetUsersStatus", req)
+}
+
+// GetAllStatus returns scripted status.
+func (server *TestSMServer) GetAllStatus(ctx context.Context, req *empty.Empty) (*smpb.SMStatus, error) {
+	return server.getStatus("GetAllStatus", req)
+}
+
+// GetBoardConfigStatus returns scripted board config status.
+func (server *TestSMServer) GetBoardConfigStatus(
+	ctx context.Context, req *empty.Empty) (*smpb.BoardConfigStatus, error) {
+	return server.getBoardConfigStatus("GetBoardConfigStatus", req)
+}
+
+// CheckBoardConfig accepts any board config.
+func (server *TestSMServer) CheckBoardConfig(
+	ctx context.Context, req *smpb.BoardConfig) (*smpb.BoardConfigStatus, error) {
+	return server.getBoardConfigStatus("CheckBoardConfig", req)
+}
+
+// SetBoardConfig accepts any board config.
+func (server *TestSMServer) SetBoardConfig(ctx context.Context, req *smpb.BoardConfig) (*empty.Empty, error) {
+	return server.accept("SetBoardConfig", req)
+}
+
+// InstallService accepts any service and returns its status.
+func (server *TestSMServer) InstallService(
+	ctx context.Context, req *smpb.InstallServiceRequest) (*smpb.ServiceStatus, error) {
+	server.Lock()
+	defer server.Unlock()
+
+	if err := server.record("InstallService", req); err != nil {
+		return nil, err
+	}
+
+	return &smpb.ServiceStatus{
+		ServiceId: req.ServiceId, AosVersion: req.AosVersion, VendorVersion: req.VendorVersion,
+	}, nil
+}
+
+// RemoveService accepts any request.
+func (server *TestSMServer) RemoveService(ctx context.Context, req *smpb.RemoveServiceRequest) (*empty.Empty, error) {
+	return server.accept("RemoveService", req)
+}
+
+// ServiceStateAcceptance accepts any request.
+func (server *TestSMServer) ServiceStateAcceptance(
+	ctx context.Context, req *smpb.StateAcceptance) (*empty.Empty, error) {
+	return server.accept("ServiceStateAcceptance", req)
+}
+
+// SetServiceState accepts any request.
+func (server *TestSMServer) SetServiceState(ctx context.Context, req *smpb.ServiceState) (*empty.Empty, error) {
+	return server.accept("SetServiceState", req)
+}
+
+// OverrideEnvVars accepts any request.
+func (server *TestSMServer) OverrideEnvVars(
+	ctx context.Context, req *smpb.OverrideEnvVarsRequest) (*smpb.OverrideEnvVarStatus, error) {
+	server.Lock()
+	defer server.Unlock()
+
+	if err := server.record("OverrideEnvVars", req); err != nil {
+		return nil, err
+	}
+
+	return &smpb.OverrideEnvVarStatus{}, nil
+}
+
+// InstallLayer accepts any request.
+func (server *TestSMServer) InstallLayer(ctx context.Context, req *smpb.InstallLayerRequest) (*empty.Empty, error) {
+	return server.accept("InstallLayer", req)
+}
+
+// SubscribeSMNotifications sends notifications passed to SendNotification.
+func (server *TestSMServer) SubscribeSMNotifications(
+	req *empty.Empty, stream smpb.SMService_SubscribeSMNotificationsServer) (err error) {
+	server.Lock()
+
+	if err = server.record("SubscribeSMNotifications", req); err != nil {
+		server.Unlock()
+
+		return err
+	}
+
+	subscriber := make(chan *smpb.SMNotifications, smNotificationsChannelSize)
+
+	server.subscribers = append(server.subscribers, subscriber)
+
+	server.Unlock()
+
+	defer server.unsubscribe(subscriber)
+
+	for {
+		select {
+		case notification := <-subscriber:
+			if err = stream.Send(notification); err != nil {
+				return aoserrors.Wrap(err)
+			}
+
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+// NewTestUMClient connects to UM service and registers with initial status.
+func NewTestUMClient(url string, status *umpb.UpdateStatus) (client *TestUMClient, err error) {
+	client = &TestUMClient{messages: make(chan *umpb.CMMessages, umMessagesChannelSize)}
+
+	if client.connection, err = grpc.Dial(url, grpc.WithInsecure()); err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	if client.stream, err = umpb.NewUMServiceClient(client.connection).RegisterUM(
+		context.Background()); err != nil {
+		client.Close()
+
+		return nil, aoserrors.Wrap(err)
+	}
+
+	if err = client.SendStatus(status); err != nil {
+		client.Close()
+
+		return nil, err
+	}
+
+	go client.receiveMessages()
+
+	return client, nil
+}
+
+// Close closes UM client.
+func (client *TestUMClient) Close() {
+	if client.stream != nil {
+		if err := client.stream.CloseSend(); err != nil {
+			log.Errorf("Can't close UM stream: %s", err)
+		}
+	}
+
+	client.connection.Close()
+}
+
+// SendStatus sends update status.
+func (client *TestUMClient) SendStatus(status *umpb.UpdateStatus) (err error) {
+	if err = client.stream.Send(status); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	return nil
+}
+
+// WaitMessage waits for CM message.
+func (client *TestUMClient) WaitMessage(timeout time.Duration) (message *umpb.CMMessages, err error) {
+	select {
+	case message, ok := <-client.messages:
+		if !ok {
+			return nil, aoserrors.New("UM stream is closed")
+		}
+
+		return message, nil
+
+	case <-time.After(timeout):
+		return nil, aoserrors.New("wait message timeout")
+	}
+}
+
+/***********************************************************************************************************************
+ * Private
+ **********************************************************************************************************************/
+
+func (server *TestSMServer) getStatus(method string, req interface{}) (*smpb.SMStatus, error) {
+	server.Lock()
+	defer server.Unlock()
+
+	if err := server.record(method, req); err != nil {
+		return nil, err
+	}
+
+	return server.status, nil
+}
+
+func (server *TestSMServer) getBoardConfigStatus(method string, req interface{}) (*smpb.BoardConfigStatus, error) {
+	server.Lock()
+	defer server.Unlock()
+
+	if err := server.record(method, req); err != nil {
+		return nil, err
+	}
+
+	return &smpb.BoardConfigStatus{VendorVersion: server.boardConfigVersion}, nil
+}
+
+func (server *TestSMServer) accept(method string, req interface{}) (*empty.Empty, error) {
+	server.Lock()
+	defer server.Unlock()
+
+	if err := server.record(method, req); err != nil {
+		return nil, err
+	}
+
+	return &empty.Empty{}, nil
+}
+
+func (server *TestSMServer) unsubscribe(subscriber chan *smpb.SMNotifications) {
+	server.Lock()
+	defer server.Unlock()
+
+	for i, item := range server.subscribers {
+		if item == subscriber {
+			server.subscribers = append(server.subscribers[:i], server.subscribers[i+1:]...)
+
+			break
+		}
+	}
+}
+
+func (client *TestUMClient) receiveMessages() {
+	defer close(client.messages)
+
+	for {
+		message, err := client.stream.Recv()
+		if err != nil {
+			log.Debugf("UM stream closed: %s", err)
+
+			return
+		}
+
+		client.messages <- message
+	}
+}
@@ -0,0 +1,221 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testtools_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/empty"
+	"google.golang.org/grpc"
+
+	"github.com/aoscloud/aos_common/aoserrors"
+	smpb "github.com/aoscloud/aos_common/api/servicemanager/v1"
+	umpb "github.com/aoscloud/aos_common/api/updatemanager/v1"
+	"github.com/aoscloud/aos_common/utils/testtools"
+)
+
+/***********************************************************************************************************************
+ * Types
+ **********************************************************************************************************************/
+
+// testUMService CM side of UM service: receives statuses and sends messages to registered UM.
+type testUMService struct {
+	umpb.UnimplementedUMServiceServer
+
+	statuses chan *umpb.UpdateStatus
+	messages chan *umpb.CMMessages
+}
+
+/***********************************************************************************************************************
+ * Tests
+ **********************************************************************************************************************/
+
+func TestSMServer(t *testing.T) {
+	server, err := testtools.NewTestSMServer(smURL)
+	if err != nil {
+		t.Fatalf("Can't create test SM server: %s", err)
+	}
+	defer server.Close()
+
+	server.SetStatus(&smpb.SMStatus{Services: []*smpb.ServiceStatus{{ServiceId: "service0", AosVersion: 1}}})
+	server.SetBoardConfigVersion("1.0")
+
+	client := smpb.NewSMServiceClient(dialTestServer(t, smURL))
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	smStatus, err := client.GetAllStatus(ctx, &empty.Empty{})
+	if err != nil {
+		t.Fatalf("Can't get all status: %s", err)
+	}
+
+	if len(smStatus.Services) != 1 || smStatus.Services[0].ServiceId != "service0" {
+		t.Errorf("Wrong SM status: %v", smStatus)
+	}
+
+	boardConfigStatus, err := client.GetBoardConfigStatus(ctx, &empty.Empty{})
+	if err != nil {
+		t.Fatalf("Can't get board config status: %s", err)
+	}
+
+	if boardConfigStatus.VendorVersion != "1.0" {
+		t.Errorf("Wrong board config version: %s", boardConfigStatus.VendorVersion)
+	}
+
+	serviceStatus, err := client.InstallService(ctx, &smpb.InstallServiceRequest{
+		ServiceId: "service1", AosVersion: 2, VendorVersion: "2.0",
+	})
+	if err != nil {
+		t.Fatalf("Can't install service: %s", err)
+	}
+
+	if serviceStatus.ServiceId != "service1" || serviceStatus.AosVersion != 2 || serviceStatus.VendorVersion != "2.0" {
+		t.Errorf("Wrong service status: %v", serviceStatus)
+	}
+
+	server.SetError("RemoveService", aoserrors.New("test error"))
+
+	if _, err = client.RemoveService(ctx, &smpb.RemoveServiceRequest{ServiceId: "service1"}); err == nil {
+		t.Error("Error expected")
+	}
+
+	stream, err := client.SubscribeSMNotifications(ctx, &empty.Empty{})
+	if err != nil {
+		t.Fatalf("Can't subscribe SM notifications: %s", err)
+	}
+
+	waitCall(t, server.Calls, "SubscribeSMNotifications")
+
+	server.SendNotification(&smpb.SMNotifications{
+		SMNotification: &smpb.SMNotifications_Alert{Alert: &smpb.Alert{Tag: "systemAlert"}},
+	})
+
+	notification, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("Can't receive SM notification: %s", err)
+	}
+
+	if notification.GetAlert().GetTag() != "systemAlert" {
+		t.Errorf("Wrong SM notification: %v", notification)
+	}
+
+	checkCalls(t, server.Calls(), "GetAllStatus", "GetBoardConfigStatus", "InstallService", "RemoveService",
+		"SubscribeSMNotifications")
+}
+
+func TestUMClient(t *testing.T) {
+	umService := &testUMService{
+		statuses: make(chan *umpb.UpdateStatus, 1),
+		messages: make(chan *umpb.CMMessages, 1),
+	}
+
+	listener, err := net.Listen("tcp", umURL)
+	if err != nil {
+		t.Fatalf("Can't listen UM URL: %s", err)
+	}
+
+	grpcServer := grpc.NewServer()
+
+	umpb.RegisterUMServiceServer(grpcServer, umService)
+
+	go func() {
+		if err := grpcServer.Serve(listener); err != nil {
+			t.Logf("Can't serve UM service: %s", err)
+		}
+	}()
+
+	defer grpcServer.Stop()
+
+	client, err := testtools.NewTestUMClient(umURL, &umpb.UpdateStatus{UmId: "um0", UmState: umpb.UmState_IDLE})
+	if err != nil {
+		t.Fatalf("Can't create test UM client: %s", err)
+	}
+	defer client.Close()
+
+	if updateStatus := umService.waitStatus(t); updateStatus.UmId != "um0" ||
+		updateStatus.UmState != umpb.UmState_IDLE {
+		t.Errorf("Wrong update status: %v", updateStatus)
+	}
+
+	umService.messages <- &umpb.CMMessages{
+		CMMessage: &umpb.CMMessages_PrepareUpdate{PrepareUpdate: &umpb.PrepareUpdate{}},
+	}
+
+	message, err := client.WaitMessage(testTimeout)
+	if err != nil {
+		t.Fatalf("Can't wait UM message: %s", err)
+	}
+
+	if message.GetPrepareUpdate() == nil {
+		t.Errorf("Wrong UM message: %v", message)
+	}
+
+	if err = client.SendStatus(&umpb.UpdateStatus{UmId: "um0", UmState: umpb.UmState_PREPARED}); err != nil {
+		t.Fatalf("Can't send update status: %s", err)
+	}
+
+	if updateStatus := umService.waitStatus(t); updateStatus.UmState != umpb.UmState_PREPARED {
+		t.Errorf("Wrong update status: %v", updateStatus)
+	}
+}
+
+/***********************************************************************************************************************
+ * Private
+ **********************************************************************************************************************/
+
+func (service *testUMService) RegisterUM(stream umpb.UMService_RegisterUMServer) error {
+	go func() {
+		for {
+			select {
+			case message := <-service.messages:
+				if err := stream.Send(message); err != nil {
+					return
+				}
+
+			case <-stream.Context().Done():
+				return
+			}
+		}
+	}()
+
+	for {
+		updateStatus, err := stream.Recv()
+		if err != nil {
+			return nil
+		}
+
+		service.statuses <- updateStatus
+	}
+}
+
+func (service *testUMService) waitStatus(t *testing.T) (updateStatus *umpb.UpdateStatus) {
+	t.Helper()
+
+	select {
+	case updateStatus = <-service.statuses:
+		return updateStatus
+
+	case <-time.After(testTimeout):
+		t.Fatal("Wait update status timeout")
+
+		return nil
+	}
+}
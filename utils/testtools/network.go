@@ -0,0 +1,145 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testtools
+
+import (
+	"os/exec"
+
+	"github.com/aoscloud/aos_common/aoserrors"
+)
+
+/***********************************************************************************************************************
+ * Types
+ **********************************************************************************************************************/
+
+// TestNetNS test network namespace. Interfaces created inside the namespace are removed with it.
+type TestNetNS struct {
+	Name string
+}
+
+/***********************************************************************************************************************
+ * Public
+ **********************************************************************************************************************/
+
+// NewTestNetNS creates new network namespace with loopback interface up.
+func NewTestNetNS(name string) (netns *TestNetNS, err error) {
+	if err = execCommand("ip", "netns", "add", name); err != nil {
+		return nil, err
+	}
+
+	netns = &TestNetNS{Name: name}
+
+	if err = netns.ip("link", "set", "lo", "up"); err != nil {
+		netns.Close()
+
+		return nil, err
+	}
+
+	return netns, nil
+}
+
+// Close deletes network namespace.
+func (netns *TestNetNS) Close() (err error) {
+	return execCommand("ip", "netns", "delete", netns.Name)
+}
+
+// Command returns command executed inside network namespace.
+func (netns *TestNetNS) Command(name string, arg ...string) (cmd *exec.Cmd) {
+	return exec.Command("ip", append([]string{"netns", "exec", netns.Name, name}, arg...)...)
+}
+
+// AddBridge creates bridge inside network namespace. Address in CIDR notation is optional.
+func (netns *TestNetNS) AddBridge(name, addr string) (err error) {
+	if err = netns.ip("link", "add", name, "type", "bridge"); err != nil {
+		return err
+	}
+
+	return netns.setupInterface(name, addr)
+}
+
+// AddVeth creates veth pair between this namespace and peer namespace. If peer is nil, peer interface is created in
+// current namespace. Addresses in CIDR notation are optional.
+func (netns *TestNetNS) AddVeth(ifName, addr string, peer *TestNetNS, peerIfName, peerAddr string) (err error) {
+	args := []string{"link", "add", ifName, "netns", netns.Name, "type", "veth", "peer", "name", peerIfName}
+
+	if peer != nil {
+		args = append(args, "netns", peer.Name)
+	}
+
+	if err = execCommand("ip", args...); err != nil {
+		return err
+	}
+
+	if err = netns.setupInterface(ifName, addr); err != nil {
+		return err
+	}
+
+	if peer == nil {
+		return setupInterface(nil, peerIfName, peerAddr)
+	}
+
+	return peer.setupInterface(peerIfName, peerAddr)
+}
+
+// SetMaster attaches interface to the bridge inside network namespace.
+func (netns *TestNetNS) SetMaster(ifName, bridge string) (err error) {
+	return netns.ip("link", "set", ifName, "master", bridge)
+}
+
+// EnableNAT enables forwarding and masquerades traffic from subnet going out through outIfName inside network
+// namespace. Host iptables rules are not touched.
+func (netns *TestNetNS) EnableNAT(subnet, outIfName string) (err error) {
+	if err = netns.exec("sysctl", "-w", "net.ipv4.ip_forward=1"); err != nil {
+		return err
+	}
+
+	return netns.exec("iptables", "-t", "nat", "-A", "POSTROUTING", "-s", subnet, "-o", outIfName, "-j", "MASQUERADE")
+}
+
+/***********************************************************************************************************************
+ * Private
+ **********************************************************************************************************************/
+
+func (netns *TestNetNS) exec(name string, arg ...string) (err error) {
+	return execCommand("ip", append([]string{"netns", "exec", netns.Name, name}, arg...)...)
+}
+
+func (netns *TestNetNS) ip(arg ...string) (err error) {
+	return execCommand("ip", append([]string{"-n", netns.Name}, arg...)...)
+}
+
+func (netns *TestNetNS) setupInterface(ifName, addr string) (err error) {
+	return setupInterface([]string{"-n", netns.Name}, ifName, addr)
+}
+
+func setupInterface(ipOptions []string, ifName, addr string) (err error) {
+	if addr != "" {
+		if err = execCommand("ip", append(ipOptions, "addr", "add", addr, "dev", ifName)...); err != nil {
+			return err
+		}
+	}
+
+	return execCommand("ip", append(ipOptions, "link", "set", ifName, "up")...)
+}
+
+func execCommand(name string, arg ...string) (err error) {
+	if output, err := exec.Command(name, arg...).CombinedOutput(); err != nil {
+		return aoserrors.Errorf("%s (%s)", err, string(output))
+	}
+
+	return nil
+}
@@ -0,0 +1,118 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testtools
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/aoscloud/aos_common/aoserrors"
+)
+
+/***********************************************************************************************************************
+ * Consts
+ **********************************************************************************************************************/
+
+const quotaDirPerm = 0o755
+
+/***********************************************************************************************************************
+ * Types
+ **********************************************************************************************************************/
+
+// TmpDirWithQuota temporary directory backed by loop-mounted filesystem of limited size.
+type TmpDirWithQuota struct {
+	Path string
+
+	workDir string
+}
+
+/***********************************************************************************************************************
+ * Public
+ **********************************************************************************************************************/
+
+// NewTmpDirWithQuota creates temporary directory on filesystem of size bytes. Available space is a bit smaller due
+// to filesystem metadata.
+func NewTmpDirWithQuota(size int64) (dir *TmpDirWithQuota, err error) {
+	workDir, err := ioutil.TempDir("", "aos_quota_")
+	if err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	dir = &TmpDirWithQuota{Path: filepath.Join(workDir, "mount"), workDir: workDir}
+
+	defer func() {
+		if err != nil {
+			if err := os.RemoveAll(workDir); err != nil {
+				log.Errorf("Remove error: %s", err)
+			}
+		}
+	}()
+
+	imagePath := filepath.Join(workDir, "image")
+
+	if err = createImageFile(imagePath, size); err != nil {
+		return nil, err
+	}
+
+	if err = execCommand("mkfs.ext4", "-q", "-F", "-m", "0", imagePath); err != nil {
+		return nil, err
+	}
+
+	if err = os.MkdirAll(dir.Path, quotaDirPerm); err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	if err = execCommand("mount", "-o", "loop", imagePath, dir.Path); err != nil {
+		return nil, err
+	}
+
+	return dir, nil
+}
+
+// Close unmounts and removes temporary directory.
+func (dir *TmpDirWithQuota) Close() (err error) {
+	if err = execCommand("umount", dir.Path); err != nil {
+		return err
+	}
+
+	if err = os.RemoveAll(dir.workDir); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	return nil
+}
+
+/***********************************************************************************************************************
+ * Private
+ **********************************************************************************************************************/
+
+func createImageFile(path string, size int64) (err error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+	defer file.Close()
+
+	if err = file.Truncate(size); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,207 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package wschunk splits large web socket messages into chunks and reassembles them on receiving side.
+//
+// Chunk is sent as binary message with the following layout:
+// magic (4 bytes) | message ID (16 bytes) | chunk index (4 bytes) | chunks count (4 bytes) | message type (1 byte) |
+// payload.
+package wschunk
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/aoscloud/aos_common/aoserrors"
+)
+
+/***********************************************************************************************************************
+ * Consts
+ **********************************************************************************************************************/
+
+const (
+	magic     = "AOSC"
+	idLen     = 16
+	headerLen = len(magic) + idLen + 4 + 4 + 1
+)
+
+const (
+	// MinChunkSize min chunk payload size.
+	MinChunkSize = 64
+	// MaxChunksCount max number of chunks in one message.
+	MaxChunksCount = 1 << 16
+	// MaxPendingMessages max number of messages being reassembled simultaneously.
+	MaxPendingMessages = 16
+	// PendingTimeout time after which incomplete message is dropped if no new chunks received.
+	PendingTimeout = 1 * time.Minute
+)
+
+/***********************************************************************************************************************
+ * Types
+ **********************************************************************************************************************/
+
+// Assembler reassembles chunked messages.
+type Assembler struct {
+	maxSize  int64
+	messages map[uuid.UUID]*message
+}
+
+type message struct {
+	messageType int
+	count       uint32
+	chunks      map[uint32][]byte
+	size        int64
+	updated     time.Time
+}
+
+/***********************************************************************************************************************
+ * Public
+ **********************************************************************************************************************/
+
+// Split splits message into chunks of chunkSize payload. Message is returned as is if it fits into one chunk.
+// Chunk size less than MinChunkSize is rounded up to MinChunkSize.
+func Split(messageType int, data []byte, chunkSize int) (chunks [][]byte) {
+	if chunkSize <= 0 || len(data) <= chunkSize {
+		return [][]byte{data}
+	}
+
+	if chunkSize < MinChunkSize {
+		chunkSize = MinChunkSize
+	}
+
+	id := uuid.New()
+	count := (len(data) + chunkSize - 1) / chunkSize
+
+	for i := 0; i < count; i++ {
+		end := (i + 1) * chunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+
+		payload := data[i*chunkSize : end]
+		chunk := make([]byte, headerLen, headerLen+len(payload))
+
+		copy(chunk, magic)
+		copy(chunk[len(magic):], id[:])
+		binary.BigEndian.PutUint32(chunk[len(magic)+idLen:], uint32(i))
+		binary.BigEndian.PutUint32(chunk[len(magic)+idLen+4:], uint32(count))
+		chunk[headerLen-1] = byte(messageType)
+
+		chunks = append(chunks, append(chunk, payload...))
+	}
+
+	return chunks
+}
+
+// IsChunk returns true if data is message chunk.
+func IsChunk(data []byte) (result bool) {
+	return len(data) >= headerLen && string(data[:len(magic)]) == magic
+}
+
+// NewAssembler creates new chunks assembler. Reassembled message size is limited by maxSize if it is not 0.
+func NewAssembler(maxSize int64) (assembler *Assembler) {
+	return &Assembler{maxSize: maxSize, messages: make(map[uuid.UUID]*message)}
+}
+
+// Add adds chunk. Reassembled message and its type are returned when all chunks are received.
+func (assembler *Assembler) Add(chunk []byte) (messageType int, data []byte, complete bool, err error) {
+	if !IsChunk(chunk) {
+		return 0, nil, false, aoserrors.New("invalid chunk")
+	}
+
+	var id uuid.UUID
+
+	copy(id[:], chunk[len(magic):])
+
+	index := binary.BigEndian.Uint32(chunk[len(magic)+idLen:])
+	count := binary.BigEndian.Uint32(chunk[len(magic)+idLen+4:])
+	payload := chunk[headerLen:]
+	now := time.Now()
+
+	assembler.removeExpired(now)
+
+	msg, ok := assembler.messages[id]
+	if !ok {
+		if err = assembler.checkCount(count); err != nil {
+			return 0, nil, false, err
+		}
+
+		if len(assembler.messages) >= MaxPendingMessages {
+			return 0, nil, false, aoserrors.New("too many pending chunked messages")
+		}
+
+		msg = &message{messageType: int(chunk[headerLen-1]), count: count, chunks: make(map[uint32][]byte), updated: now}
+		assembler.messages[id] = msg
+	}
+
+	if _, ok := msg.chunks[index]; ok || index >= msg.count || count != msg.count {
+		delete(assembler.messages, id)
+
+		return 0, nil, false, aoserrors.Errorf("invalid chunk index: %d", index)
+	}
+
+	msg.size += int64(len(payload))
+
+	if assembler.maxSize != 0 && msg.size > assembler.maxSize {
+		delete(assembler.messages, id)
+
+		return 0, nil, false, aoserrors.Errorf("message size exceeds limit %d", assembler.maxSize)
+	}
+
+	msg.chunks[index] = append([]byte{}, payload...)
+	msg.updated = now
+
+	if uint32(len(msg.chunks)) < msg.count {
+		return 0, nil, false, nil
+	}
+
+	delete(assembler.messages, id)
+
+	data = make([]byte, 0, msg.size)
+
+	for i := uint32(0); i < msg.count; i++ {
+		data = append(data, msg.chunks[i]...)
+	}
+
+	return msg.messageType, data, true, nil
+}
+
+/***********************************************************************************************************************
+ * Private
+ **********************************************************************************************************************/
+
+func (assembler *Assembler) checkCount(count uint32) (err error) {
+	if count == 0 || count > MaxChunksCount {
+		return aoserrors.Errorf("invalid chunks count: %d", count)
+	}
+
+	if assembler.maxSize != 0 && int64(count) > (assembler.maxSize+MinChunkSize-1)/MinChunkSize {
+		return aoserrors.Errorf("invalid chunks count: %d", count)
+	}
+
+	return nil
+}
+
+func (assembler *Assembler) removeExpired(now time.Time) {
+	for id, msg := range assembler.messages {
+		if now.Sub(msg.updated) > PendingTimeout {
+			delete(assembler.messages, id)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wschunk_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/aoscloud/aos_common/utils/wschunk"
+)
+
+/***********************************************************************************************************************
+ * Consts
+ **********************************************************************************************************************/
+
+const textMessage = 1
+
+/***********************************************************************************************************************
+ * Tests
+ **********************************************************************************************************************/
+
+func TestSplitAssemble(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 100)
+
+	if chunks := wschunk.Split(textMessage, data, len(data)); len(chunks) != 1 || wschunk.IsChunk(chunks[0]) {
+		t.Error("Message should not be split")
+	}
+
+	chunks := wschunk.Split(textMessage, data, 64)
+	if len(chunks) != 16 {
+		t.Fatalf("Wrong chunks count: %d", len(chunks))
+	}
+
+	assembler := wschunk.NewAssembler(int64(len(data)))
+
+	// Add in reverse order
+	for i := len(chunks) - 1; i >= 0; i-- {
+		if !wschunk.IsChunk(chunks[i]) {
+			t.Fatal("Chunk expected")
+		}
+
+		messageType, message, complete, err := assembler.Add(chunks[i])
+		if err != nil {
+			t.Fatalf("Can't add chunk: %s", err)
+		}
+
+		if complete != (i == 0) {
+			t.Fatalf("Wrong complete state: %v", complete)
+		}
+
+		if complete {
+			if messageType != textMessage {
+				t.Errorf("Wrong message type: %d", messageType)
+			}
+
+			if !bytes.Equal(message, data) {
+				t.Error("Wrong reassembled message")
+			}
+		}
+	}
+}
+
+func TestAssembleLimit(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 100)
+	chunks := wschunk.Split(textMessage, data, 64)
+	assembler := wschunk.NewAssembler(int64(len(data) - 1))
+
+	var err error
+
+	for _, chunk := range chunks {
+		if _, _, _, err = assembler.Add(chunk); err != nil {
+			break
+		}
+	}
+
+	if err == nil {
+		t.Error("Size limit error expected")
+	}
+
+	if _, _, _, err = assembler.Add(chunks[0][:10]); err == nil {
+		t.Error("Invalid chunk error expected")
+	}
+}
+
+func TestAssembleInvalidHeader(t *testing.T) {
+	chunks := wschunk.Split(textMessage, bytes.Repeat([]byte("0123456789"), 100), 64)
+
+	// Chunks count offset: magic + message ID + chunk index
+	countOffset := 4 + 16 + 4
+
+	hugeCount := append([]byte{}, chunks[0]...)
+	binary.BigEndian.PutUint32(hugeCount[countOffset:], 0xFFFFFFFF)
+
+	if _, _, _, err := wschunk.NewAssembler(0).Add(hugeCount); err == nil {
+		t.Error("Invalid chunks count error expected")
+	}
+
+	if _, _, _, err := wschunk.NewAssembler(500).Add(chunks[0]); err == nil {
+		t.Error("Invalid chunks count error expected")
+	}
+
+	wrongIndex := append([]byte{}, chunks[0]...)
+	binary.BigEndian.PutUint32(wrongIndex[countOffset-4:], uint32(len(chunks)))
+
+	if _, _, _, err := wschunk.NewAssembler(0).Add(wrongIndex); err == nil {
+		t.Error("Invalid chunk index error expected")
+	}
+}
+
+func TestAssemblePendingLimit(t *testing.T) {
+	assembler := wschunk.NewAssembler(0)
+
+	for i := 0; i < wschunk.MaxPendingMessages; i++ {
+		chunks := wschunk.Split(textMessage, bytes.Repeat([]byte("0123456789"), 100), 64)
+
+		if _, _, _, err := assembler.Add(chunks[0]); err != nil {
+			t.Fatalf("Can't add chunk: %s", err)
+		}
+	}
+
+	chunks := wschunk.Split(textMessage, bytes.Repeat([]byte("0123456789"), 100), 64)
+
+	if _, _, _, err := assembler.Add(chunks[0]); err == nil {
+		t.Error("Too many pending messages error expected")
+	}
+}
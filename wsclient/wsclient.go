@@ -18,7 +18,13 @@
 package wsclient
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
 	"reflect"
 	"strings"
 	"sync"
@@ -30,6 +36,8 @@ import (
 
 	"github.com/aoscloud/aos_common/aoserrors"
 	"github.com/aoscloud/aos_common/utils/cryptutils"
+	"github.com/aoscloud/aos_common/utils/retryhelper"
+	"github.com/aoscloud/aos_common/utils/wschunk"
 )
 
 /***********************************************************************************************************************
@@ -41,6 +49,13 @@ const (
 	errorChannelSize        = 1
 )
 
+const defaultRequestIDKey = "requestId"
+
+const (
+	defaultReconnectInterval    = 1 * time.Second
+	defaultMaxReconnectInterval = 1 * time.Minute
+)
+
 /***********************************************************************************************************************
  * Types
  **********************************************************************************************************************/
@@ -59,19 +74,55 @@ type Client struct {
 	wsDialer          websocket.Dialer
 	clientParam       ClientParam
 	cryptoContext     *cryptutils.CryptoContext
+	url               string
+	reconnectCtx      context.Context
+	reconnectCancel   context.CancelFunc
 }
 
 // ClientParam client parameters.
 type ClientParam struct {
 	CaCertFile       string
 	WebSocketTimeout time.Duration
+	// AutoReconnect reconnects to the server after connection loss. Pending requests are sent again on reconnect.
+	// Error channel receives connection error only if reconnect fails according to reconnect backoff.
+	AutoReconnect bool
+	// ReconnectBackoff reconnect backoff. Default backoff is used if initial interval is not set.
+	ReconnectBackoff retryhelper.Backoff
+	// OnReconnect is called after successful reconnect, e.g. to restore subscriptions.
+	OnReconnect func()
+	// ProxyURL proxy URL: http://[user:password@]host:port for HTTP CONNECT proxy or socks5://host:port.
+	ProxyURL string
+	// ProxyUser and ProxyPassword proxy credentials. Override credentials specified in ProxyURL.
+	ProxyUser     string
+	ProxyPassword string
+	// UseSystemProxy uses proxy from HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables
+	// if ProxyURL is not set.
+	UseSystemProxy bool
+	// PingInterval interval to send ping to server. Keepalive is disabled if not set.
+	PingInterval time.Duration
+	// PongTimeout time to wait for pong or any other message after ping. Connection is closed and error is reported
+	// if nothing is received. Ping interval is used if not set.
+	PongTimeout time.Duration
+	// MaxMessageSize max size of received web socket message. Connection is closed if limit is exceeded.
+	// Not limited if not set.
+	MaxMessageSize int64
+	// ChunkSize messages bigger than chunk size are sent as chunks which are reassembled by receiving side.
+	// Messages are not chunked if not set.
+	ChunkSize int
+	// MaxChunkedMessageSize max size of reassembled chunked message. Not limited if not set.
+	MaxChunkedMessageSize int64
+	// RequestIDKey dot separated JSON key of message ID used by SendMessageRequest to match response with request,
+	// e.g. "header.requestId". "requestId" is used if not set.
+	RequestIDKey string
 }
 
 type requestParam struct {
-	id         interface{}
-	idField    string
-	rspChannel chan bool
-	rsp        interface{}
+	id            interface{}
+	idField       string
+	rspChannel    chan bool
+	rawRspChannel chan []byte
+	req           interface{}
+	rsp           interface{}
 }
 
 /***********************************************************************************************************************
@@ -109,12 +160,32 @@ func New(name string, clientParam ClientParam, messageHandler func([]byte)) (cli
 		}).Debug("Updating TLS config based on caCert")
 	}
 
+	if client.wsDialer.Proxy, err = getProxy(clientParam); err != nil {
+		return nil, err
+	}
+
 	if clientParam.WebSocketTimeout > 0 {
 		client.clientParam.WebSocketTimeout = clientParam.WebSocketTimeout
 	} else {
 		client.clientParam.WebSocketTimeout = defaultWebsocketTimeout
 	}
 
+	if clientParam.RequestIDKey == "" {
+		client.clientParam.RequestIDKey = defaultRequestIDKey
+	}
+
+	if clientParam.PongTimeout == 0 {
+		client.clientParam.PongTimeout = clientParam.PingInterval
+	}
+
+	if clientParam.ReconnectBackoff.InitialInterval == 0 {
+		client.clientParam.ReconnectBackoff = retryhelper.Backoff{
+			InitialInterval: defaultReconnectInterval,
+			MaxInterval:     defaultMaxReconnectInterval,
+			Jitter:          retryhelper.JitterEqual,
+		}
+	}
+
 	return client, nil
 }
 
@@ -133,24 +204,24 @@ func (client *Client) Connect(url string) (err error) {
 		return aoserrors.Errorf("client %s already connected", client.name)
 	}
 
-	connection, _, err := client.wsDialer.Dial(url, nil)
-	if err != nil {
-		return aoserrors.Wrap(err)
+	if client.reconnectCancel != nil {
+		client.reconnectCancel()
 	}
 
-	client.connection = connection
-
-	client.isConnected = true
+	client.url = url
+	client.reconnectCtx, client.reconnectCancel = context.WithCancel(context.Background())
 
-	go client.processMessages()
-
-	return nil
+	return client.connect()
 }
 
 // Disconnect disconnects from ws server.
 func (client *Client) Disconnect() (err error) {
 	client.Lock()
 
+	if client.reconnectCancel != nil {
+		client.reconnectCancel()
+	}
+
 	if !client.isConnected {
 		client.Unlock()
 
@@ -225,6 +296,20 @@ func (client *Client) Close() (err error) {
 
 // SendRequest sends request and waits for response.
 func (client *Client) SendRequest(idField string, idValue interface{}, req interface{}, rsp interface{}) (err error) {
+	return client.SendRequestContext(context.Background(), idField, idValue, req, rsp)
+}
+
+// SendRequestContext sends request and waits for response with ID field equal to request ID. Waiting is canceled
+// when ctx is done. If ctx has no deadline, web socket timeout is used as request timeout.
+func (client *Client) SendRequestContext(
+	ctx context.Context, idField string, idValue interface{}, req interface{}, rsp interface{}) (err error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancelFunc context.CancelFunc
+
+		ctx, cancelFunc = context.WithTimeout(ctx, client.clientParam.WebSocketTimeout)
+		defer cancelFunc()
+	}
+
 	requestID := reflect.ValueOf(req).Elem()
 
 	if requestID.Kind() == reflect.Ptr {
@@ -238,19 +323,20 @@ func (client *Client) SendRequest(idField string, idValue interface{}, req inter
 		}
 	}
 
-	param := requestParam{id: idValue, idField: idField, rspChannel: make(chan bool), rsp: rsp}
+	// Buffered channel to not block receiving if waiter is gone
+	param := requestParam{id: idValue, idField: idField, rspChannel: make(chan bool, 1), req: req, rsp: rsp}
 	client.requests.Store(param.id, param)
 
 	defer client.requests.Delete(param.id)
 
-	if err = client.SendMessage(req); err != nil {
-		return aoserrors.Wrap(err)
+	if err = client.sendRequest(req); err != nil {
+		return err
 	}
 
 	// Wait response or timeout
 	select {
-	case <-time.After(client.clientParam.WebSocketTimeout):
-		return aoserrors.New("wait response timeout")
+	case <-ctx.Done():
+		return getWaitError(ctx)
 
 	case _, ok := <-param.rspChannel:
 		if !ok {
@@ -261,6 +347,48 @@ func (client *Client) SendRequest(idField string, idValue interface{}, req inter
 	return nil
 }
 
+// SendMessageRequest sends message and waits for response message with the same message ID. Message ID is taken
+// from JSON key set by RequestIDKey client parameter. Raw response message is returned. Waiting is canceled when
+// ctx is done. If ctx has no deadline, web socket timeout is used as request timeout.
+func (client *Client) SendMessageRequest(ctx context.Context, message interface{}) (response []byte, err error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancelFunc context.CancelFunc
+
+		ctx, cancelFunc = context.WithTimeout(ctx, client.clientParam.WebSocketTimeout)
+		defer cancelFunc()
+	}
+
+	messageJSON, err := json.Marshal(message)
+	if err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	messageID := getMessageID(messageJSON, client.clientParam.RequestIDKey)
+	if messageID == nil {
+		return nil, aoserrors.Errorf("message has no %s", client.clientParam.RequestIDKey)
+	}
+
+	param := requestParam{id: messageID, rawRspChannel: make(chan []byte, 1), req: message}
+
+	if _, loaded := client.requests.LoadOrStore(param.id, param); loaded {
+		return nil, aoserrors.Errorf("request %v is already in progress", messageID)
+	}
+
+	defer client.requests.Delete(param.id)
+
+	if err = client.sendRequest(message); err != nil {
+		return nil, err
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, getWaitError(ctx)
+
+	case response = <-param.rawRspChannel:
+		return response, nil
+	}
+}
+
 // SendMessage sends message without waiting for response.
 func (client *Client) SendMessage(message interface{}) (err error) {
 	client.Lock()
@@ -277,34 +405,205 @@ func (client *Client) SendMessage(message interface{}) (err error) {
 
 	log.WithFields(log.Fields{"client": client.name, "message": string(messageJSON)}).Debug("Send message")
 
-	if err := client.connection.SetWriteDeadline(time.Now().Add(client.clientParam.WebSocketTimeout)); err != nil {
-		log.WithFields(log.Fields{"client": client.name}).Debugf("Can't set write deadline timeout: %s", err)
+	if chunks := wschunk.Split(
+		websocket.TextMessage, messageJSON, client.clientParam.ChunkSize); len(chunks) > 1 {
+		for _, chunk := range chunks {
+			if err = client.writeMessage(websocket.BinaryMessage, chunk); err != nil {
+				return err
+			}
+		}
 
-		client.connection.Close()
+		return nil
+	}
 
-		return aoserrors.Wrap(err)
+	return client.writeMessage(websocket.TextMessage, messageJSON)
+}
+
+/***********************************************************************************************************************
+ * Private
+ **********************************************************************************************************************/
+
+func getProxy(clientParam ClientParam) (proxy func(*http.Request) (*url.URL, error), err error) {
+	if clientParam.ProxyURL == "" {
+		if clientParam.UseSystemProxy {
+			return http.ProxyFromEnvironment, nil
+		}
+
+		return nil, nil
 	}
 
-	if err = client.connection.WriteMessage(websocket.TextMessage, messageJSON); err != nil {
-		log.WithFields(log.Fields{"client": client.name}).Debugf("Send message error: %s", err)
-		client.connection.Close()
+	proxyURL, err := url.Parse(clientParam.ProxyURL)
+	if err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	if proxyURL.Scheme != "http" && proxyURL.Scheme != "socks5" {
+		return nil, aoserrors.Errorf("unsupported proxy scheme: %s", proxyURL.Scheme)
+	}
+
+	if clientParam.ProxyUser != "" {
+		proxyURL.User = url.UserPassword(clientParam.ProxyUser, clientParam.ProxyPassword)
+	}
+
+	log.WithFields(log.Fields{"scheme": proxyURL.Scheme, "host": proxyURL.Host}).Debug("Use proxy")
+
+	return http.ProxyURL(proxyURL), nil
+}
+
+// sendRequest sends request. If auto reconnect is active, send error is ignored as request is sent again
+// on reconnect.
+func (client *Client) sendRequest(req interface{}) (err error) {
+	if err = client.SendMessage(req); err != nil {
+		if !client.isReconnectActive() {
+			return aoserrors.Wrap(err)
+		}
+
+		log.WithFields(log.Fields{"client": client.name}).Warnf("Can't send request, wait for reconnect: %s", err)
+	}
+
+	return nil
+}
+
+// isReconnectActive returns true if client was connected and connection will be restored by auto reconnect.
+func (client *Client) isReconnectActive() (active bool) {
+	client.Lock()
+	defer client.Unlock()
+
+	return client.clientParam.AutoReconnect && client.reconnectCtx != nil && client.reconnectCtx.Err() == nil
+}
+
+func getWaitError(ctx context.Context) (err error) {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return aoserrors.New("wait response timeout")
+	}
+
+	return aoserrors.Wrap(ctx.Err())
+}
+
+// getMessageID returns value of dot separated JSON key. Nil is returned if message has no such key.
+func getMessageID(message []byte, key string) (id interface{}) {
+	decoder := json.NewDecoder(bytes.NewReader(message))
+	decoder.UseNumber()
+
+	if err := decoder.Decode(&id); err != nil {
+		return nil
+	}
+
+	for _, field := range strings.Split(key, ".") {
+		object, ok := id.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+
+		if id, ok = object[field]; !ok {
+			return nil
+		}
+	}
+
+	// Only scalar values can be used as ID
+	switch id.(type) {
+	case string, json.Number, bool:
+		return id
+
+	default:
+		return nil
+	}
+}
 
+func (client *Client) connect() (err error) {
+	connection, _, err := client.wsDialer.Dial(client.url, nil)
+	if err != nil {
 		return aoserrors.Wrap(err)
 	}
 
+	if client.clientParam.MaxMessageSize != 0 {
+		connection.SetReadLimit(client.clientParam.MaxMessageSize)
+	}
+
+	client.connection = connection
+
+	client.isConnected = true
+
+	go client.processMessages(connection)
+
 	return nil
 }
 
-/***********************************************************************************************************************
- * Private
- **********************************************************************************************************************/
+func (client *Client) reconnect(ctx context.Context, connectionErr error) {
+	err := retryhelper.RetryWithBackoff(ctx, func() error {
+		client.Lock()
+		defer client.Unlock()
+
+		if ctx.Err() != nil {
+			return aoserrors.Permanent(ctx.Err())
+		}
+
+		return client.connect()
+	}, func(retryCount int, delay time.Duration, err error) {
+		log.WithFields(log.Fields{"client": client.name}).Warnf("Reconnect error: %s, try %d in %v", err,
+			retryCount+1, delay)
+	}, client.clientParam.ReconnectBackoff)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.WithFields(log.Fields{"client": client.name}).Errorf("Can't reconnect: %s", err)
+
+			client.ErrorChannel <- connectionErr
+		}
+
+		return
+	}
+
+	log.WithFields(log.Fields{"client": client.name}).Info("Reconnected to server")
+
+	client.requests.Range(func(key, value interface{}) bool {
+		if param, ok := value.(requestParam); ok {
+			if err := client.SendMessage(param.req); err != nil {
+				log.WithFields(log.Fields{"client": client.name}).Errorf("Can't resend request: %s", err)
+			}
+		}
+
+		return true
+	})
+
+	if client.clientParam.OnReconnect != nil {
+		client.clientParam.OnReconnect()
+	}
+}
+
+func (client *Client) processMessages(connection *websocket.Conn) {
+	if client.clientParam.PingInterval > 0 {
+		stopChannel := make(chan struct{})
+		defer close(stopChannel)
+
+		connection.SetPongHandler(func(string) error { return client.extendReadDeadline(connection) })
+
+		if err := client.extendReadDeadline(connection); err != nil {
+			client.disconnect(err)
+
+			return
+		}
+
+		go client.keepAlive(connection, stopChannel)
+	}
+
+	var assembler *wschunk.Assembler
+
+	// Reassemble chunks only if chunking is enabled for this endpoint
+	if client.clientParam.ChunkSize > 0 {
+		assembler = wschunk.NewAssembler(client.clientParam.MaxChunkedMessageSize)
+	}
 
-func (client *Client) processMessages() {
 	for {
-		_, message, err := client.connection.ReadMessage()
+		messageType, message, err := connection.ReadMessage()
 		if err != nil {
-			if !websocket.IsCloseError(err, websocket.CloseNormalClosure) &&
-				!strings.Contains(err.Error(), "use of closed network connection") {
+			var netErr net.Error
+
+			switch {
+			case errors.As(err, &netErr) && netErr.Timeout():
+				log.WithFields(log.Fields{"client": client.name}).Error("Server is not responding")
+
+			case !websocket.IsCloseError(err, websocket.CloseNormalClosure) &&
+				!strings.Contains(err.Error(), "use of closed network connection"):
 				log.WithFields(log.Fields{"client": client.name}).Errorf("Receive message error: %s", err)
 			}
 
@@ -313,6 +612,28 @@ func (client *Client) processMessages() {
 			return
 		}
 
+		if client.clientParam.PingInterval > 0 {
+			if err = client.extendReadDeadline(connection); err != nil {
+				client.disconnect(err)
+
+				return
+			}
+		}
+
+		if assembler != nil && messageType == websocket.BinaryMessage && wschunk.IsChunk(message) {
+			var complete bool
+
+			if _, message, complete, err = assembler.Add(message); err != nil {
+				log.WithFields(log.Fields{"client": client.name}).Errorf("Can't assemble message: %s", err)
+
+				continue
+			}
+
+			if !complete {
+				continue
+			}
+		}
+
 		log.WithFields(log.Fields{"client": client.name, "message": string(message)}).Debug("Receive message")
 
 		rspFound := client.findRequestID(message)
@@ -323,18 +644,95 @@ func (client *Client) processMessages() {
 	}
 }
 
+func (client *Client) writeMessage(messageType int, data []byte) (err error) {
+	if err = client.connection.SetWriteDeadline(time.Now().Add(client.clientParam.WebSocketTimeout)); err != nil {
+		log.WithFields(log.Fields{"client": client.name}).Debugf("Can't set write deadline timeout: %s", err)
+
+		client.connection.Close()
+
+		return aoserrors.Wrap(err)
+	}
+
+	if err = client.connection.WriteMessage(messageType, data); err != nil {
+		log.WithFields(log.Fields{"client": client.name}).Debugf("Send message error: %s", err)
+		client.connection.Close()
+
+		return aoserrors.Wrap(err)
+	}
+
+	return nil
+}
+
+func (client *Client) extendReadDeadline(connection *websocket.Conn) (err error) {
+	return aoserrors.Wrap(connection.SetReadDeadline(
+		time.Now().Add(client.clientParam.PingInterval + client.clientParam.PongTimeout)))
+}
+
+func (client *Client) keepAlive(connection *websocket.Conn, stopChannel <-chan struct{}) {
+	ticker := time.NewTicker(client.clientParam.PingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopChannel:
+			return
+
+		case <-ticker.C:
+			if err := connection.WriteControl(
+				websocket.PingMessage, nil, time.Now().Add(client.clientParam.WebSocketTimeout)); err != nil {
+				if !errors.Is(err, websocket.ErrCloseSent) {
+					log.WithFields(log.Fields{"client": client.name}).Errorf("Can't send ping: %s", err)
+
+					connection.Close()
+				}
+
+				return
+			}
+		}
+	}
+}
+
 func (client *Client) findRequestID(message []byte) (found bool) {
+	var (
+		messageID     interface{}
+		messageIDRead bool
+	)
+
 	client.requests.Range(func(key, value interface{}) bool {
 		param, ok := value.(requestParam)
 		if !ok {
 			return true
 		}
 
-		if err := json.Unmarshal(message, param.rsp); err != nil {
+		if param.rawRspChannel != nil {
+			if !messageIDRead {
+				messageID, messageIDRead = getMessageID(message, client.clientParam.RequestIDKey), true
+			}
+
+			if messageID == nil || key != messageID {
+				return true
+			}
+
+			client.requests.Delete(param.id)
+
+			param.rawRspChannel <- message
+			found = true
+
+			return false
+		}
+
+		if param.rsp == nil {
 			return true
 		}
 
-		requestID := reflect.ValueOf(param.rsp).Elem()
+		// Parse to new value to not spoil response of other requests
+		rsp := reflect.New(reflect.TypeOf(param.rsp).Elem())
+
+		if err := json.Unmarshal(message, rsp.Interface()); err != nil {
+			return true
+		}
+
+		requestID := rsp.Elem()
 
 		for _, field := range strings.Split(param.idField, ".") {
 			requestID = requestID.FieldByName(field)
@@ -347,9 +745,11 @@ func (client *Client) findRequestID(message []byte) (found bool) {
 			requestID = requestID.Elem()
 		}
 
-		if key == requestID.Interface() {
+		if requestID.IsValid() && key == requestID.Interface() {
 			client.requests.Delete(param.id)
 
+			reflect.ValueOf(param.rsp).Elem().Set(rsp.Elem())
+
 			param.rspChannel <- true
 			found = true
 
@@ -372,6 +772,12 @@ func (client *Client) disconnect(err error) {
 		client.connection.Close()
 		client.isConnected = false
 
+		if client.clientParam.AutoReconnect && client.reconnectCtx.Err() == nil {
+			go client.reconnect(client.reconnectCtx, err)
+
+			return
+		}
+
 		client.ErrorChannel <- err
 	} else {
 		client.disconnectChannel <- true
@@ -18,8 +18,18 @@
 package wsclient_test
 
 import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
 	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -28,6 +38,8 @@ import (
 	log "github.com/sirupsen/logrus"
 
 	"github.com/aoscloud/aos_common/aoserrors"
+	"github.com/aoscloud/aos_common/utils/cryptutils"
+	"github.com/aoscloud/aos_common/utils/retryhelper"
 	"github.com/aoscloud/aos_common/wsclient"
 	"github.com/aoscloud/aos_common/wsserver"
 )
@@ -42,6 +54,7 @@ const (
 	crtFile   = "../wsserver/data/crt.pem"
 	keyFile   = "../wsserver/data/key.pem"
 	caCert    = "../wsserver/data/rootCA.pem"
+	proxyURL  = ":8090"
 )
 
 /***********************************************************************************************************************
@@ -54,6 +67,13 @@ type testHandler struct {
 	processMessage
 }
 
+type testAuthenticator struct{}
+
+type testProxy struct {
+	credentials string
+	tunnels     int32
+}
+
 /***********************************************************************************************************************
  * Vars
  **********************************************************************************************************************/
@@ -571,6 +591,671 @@ func TestWSTimeout(t *testing.T) {
 	}
 }
 
+func TestReconnect(t *testing.T) {
+	type Request struct {
+		Type      string
+		RequestID string
+	}
+
+	echoHandler := newTestHandler(
+		func(client *wsserver.Client, messageType int, data []byte) (response []byte, err error) {
+			return data, nil
+		})
+
+	server, err := wsserver.New("TestServer", hostURL, crtFile, keyFile, echoHandler)
+	if err != nil {
+		t.Fatalf("Can't create ws server: %s", err)
+	}
+
+	time.Sleep(1 * time.Second)
+
+	reconnectChannel := make(chan struct{}, 1)
+
+	client, err := wsclient.New("Test", wsclient.ClientParam{
+		CaCertFile:       caCert,
+		WebSocketTimeout: 5 * time.Second,
+		AutoReconnect:    true,
+		ReconnectBackoff: retryhelper.Backoff{InitialInterval: 100 * time.Millisecond, MaxInterval: time.Second},
+		OnReconnect:      func() { reconnectChannel <- struct{}{} },
+	}, nil)
+	if err != nil {
+		t.Fatalf("Can't create ws client: %s", err)
+	}
+	defer client.Close()
+
+	if err = client.Connect(serverURL); err != nil {
+		t.Fatalf("Can't connect to ws server: %s", err)
+	}
+
+	server.Close()
+
+	if server, err = wsserver.New("TestServer", hostURL, crtFile, keyFile, echoHandler); err != nil {
+		t.Fatalf("Can't create ws server: %s", err)
+	}
+	defer server.Close()
+
+	select {
+	case <-reconnectChannel:
+
+	case err := <-client.ErrorChannel:
+		t.Fatalf("Unexpected connection error: %s", err)
+
+	case <-time.After(5 * time.Second):
+		t.Fatal("Waiting reconnect timeout")
+	}
+
+	if !client.IsConnected() {
+		t.Error("Client should be connected")
+	}
+
+	req := Request{Type: "GET", RequestID: uuid.New().String()}
+	rsp := Request{}
+
+	if err = client.SendRequest("RequestID", req.RequestID, &req, &rsp); err != nil {
+		t.Errorf("Can't send request: %s", err)
+	}
+
+	if rsp.RequestID != req.RequestID {
+		t.Errorf("Wrong request ID: %s", rsp.RequestID)
+	}
+}
+
+func TestAuthenticator(t *testing.T) {
+	type Message struct {
+		Type  string
+		Value string
+	}
+
+	server, err := wsserver.NewWithParam("TestServer", wsserver.ServerParam{
+		URL: hostURL, Cert: crtFile, Key: keyFile, Authenticator: &testAuthenticator{},
+	}, newTestHandler(
+		func(client *wsserver.Client, messageType int, data []byte) (response []byte, err error) {
+			return json.Marshal(Message{Type: "IDENTITY", Value: client.Identity})
+		}))
+	if err != nil {
+		t.Fatalf("Can't create ws server: %s", err)
+	}
+	defer server.Close()
+
+	time.Sleep(1 * time.Second)
+
+	messageChannel := make(chan Message, 1)
+
+	client, err := wsclient.New("Test", wsclient.ClientParam{CaCertFile: caCert}, func(data []byte) {
+		var message Message
+
+		if err := json.Unmarshal(data, &message); err != nil {
+			t.Errorf("Parse message error: %s", err)
+
+			return
+		}
+
+		messageChannel <- message
+	})
+	if err != nil {
+		t.Fatalf("Can't create ws client: %s", err)
+	}
+	defer client.Close()
+
+	if err = client.Connect(serverURL); err == nil {
+		t.Error("Connection without credentials should be rejected")
+	}
+
+	if err = client.Connect(serverURL + "/?user=test"); err != nil {
+		t.Fatalf("Can't connect to ws server: %s", err)
+	}
+
+	if err = client.SendMessage(&Message{Type: "GET"}); err != nil {
+		t.Fatalf("Can't send message: %s", err)
+	}
+
+	select {
+	case message := <-messageChannel:
+		if message.Value != "test" {
+			t.Errorf("Wrong client identity: %s", message.Value)
+		}
+
+	case <-time.After(5 * time.Second):
+		t.Error("Waiting message timeout")
+	}
+}
+
+func TestSendRequestContext(t *testing.T) {
+	type Request struct {
+		Type      string
+		RequestID string
+		Value     int
+	}
+
+	server, err := wsserver.New("TestServer", hostURL, crtFile, keyFile, newTestHandler(
+		func(client *wsserver.Client, messageType int, data []byte) (response []byte, err error) {
+			var req Request
+
+			if err = json.Unmarshal(data, &req); err != nil {
+				return nil, aoserrors.Wrap(err)
+			}
+
+			if req.Type == "SLOW" {
+				go func() {
+					time.Sleep(500 * time.Millisecond)
+
+					_ = client.SendMessage(messageType, data)
+				}()
+
+				return nil, nil
+			}
+
+			return data, nil
+		}))
+	if err != nil {
+		t.Fatalf("Can't create ws server: %s", err)
+	}
+	defer server.Close()
+
+	time.Sleep(1 * time.Second)
+
+	client, err := wsclient.New("Test", wsclient.ClientParam{CaCertFile: caCert}, nil)
+	if err != nil {
+		t.Fatalf("Can't create ws client: %s", err)
+	}
+	defer client.Close()
+
+	if err = client.Connect(serverURL); err != nil {
+		t.Fatalf("Can't connect to ws server: %s", err)
+	}
+
+	ctx, cancelFunc := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancelFunc()
+
+	req := Request{Type: "SLOW", RequestID: uuid.New().String()}
+
+	if err = client.SendRequestContext(ctx, "RequestID", req.RequestID, &req, &Request{}); err == nil {
+		t.Error("Timeout error expected")
+	}
+
+	// Wait abandoned response is received
+	time.Sleep(time.Second)
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+
+		go func(value int) {
+			defer wg.Done()
+
+			req := Request{Type: "GET", RequestID: uuid.New().String(), Value: value}
+			rsp := Request{}
+
+			if err := client.SendRequestContext(
+				context.Background(), "RequestID", req.RequestID, &req, &rsp); err != nil {
+				t.Errorf("Can't send request: %s", err)
+
+				return
+			}
+
+			if rsp != req {
+				t.Errorf("Wrong response: %v", rsp)
+			}
+		}(i)
+	}
+
+	wg.Wait()
+}
+
+func TestSendMessageRequest(t *testing.T) {
+	type Header struct {
+		RequestID string `json:"requestId"`
+	}
+
+	type Message struct {
+		Header Header `json:"header"`
+		Value  int    `json:"value"`
+	}
+
+	server, err := wsserver.New("TestServer", hostURL, crtFile, keyFile, newTestHandler(
+		func(client *wsserver.Client, messageType int, data []byte) (response []byte, err error) {
+			var message Message
+
+			if err = json.Unmarshal(data, &message); err != nil {
+				return nil, aoserrors.Wrap(err)
+			}
+
+			// Send unrelated message first to check it is not treated as response
+			_ = client.SendMessage(messageType, []byte(`{"header":{"requestId":"unknown"},"value":-1}`))
+
+			message.Value *= 2
+
+			return json.Marshal(message)
+		}))
+	if err != nil {
+		t.Fatalf("Can't create ws server: %s", err)
+	}
+	defer server.Close()
+
+	time.Sleep(1 * time.Second)
+
+	client, err := wsclient.New("Test", wsclient.ClientParam{
+		CaCertFile: caCert, RequestIDKey: "header.requestId", AutoReconnect: true,
+	}, nil)
+	if err != nil {
+		t.Fatalf("Can't create ws client: %s", err)
+	}
+	defer client.Close()
+
+	// Not connected client with auto reconnect should fail immediately
+	startTime := time.Now()
+
+	if _, err = client.SendMessageRequest(context.Background(), Message{Header: Header{"id"}}); err == nil {
+		t.Error("Error expected")
+	}
+
+	if time.Since(startTime) > time.Second {
+		t.Error("Request should fail without waiting for timeout")
+	}
+
+	if err = client.Connect(serverURL); err != nil {
+		t.Fatalf("Can't connect to ws server: %s", err)
+	}
+
+	if _, err = client.SendMessageRequest(context.Background(), struct{}{}); err == nil {
+		t.Error("Error expected for message without ID")
+	}
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+
+		go func(value int) {
+			defer wg.Done()
+
+			req := Message{Header: Header{RequestID: uuid.New().String()}, Value: value}
+
+			data, err := client.SendMessageRequest(context.Background(), req)
+			if err != nil {
+				t.Errorf("Can't send request: %s", err)
+
+				return
+			}
+
+			var rsp Message
+
+			if err = json.Unmarshal(data, &rsp); err != nil {
+				t.Errorf("Can't parse response: %s", err)
+
+				return
+			}
+
+			if rsp.Header != req.Header || rsp.Value != 2*value {
+				t.Errorf("Wrong response: %v", rsp)
+			}
+		}(i)
+	}
+
+	wg.Wait()
+}
+
+func TestServerShutdown(t *testing.T) {
+	type Request struct {
+		Type      string
+		RequestID string
+	}
+
+	server, err := wsserver.New("TestServer", hostURL, crtFile, keyFile, newTestHandler(
+		func(client *wsserver.Client, messageType int, data []byte) (response []byte, err error) {
+			time.Sleep(500 * time.Millisecond)
+
+			return data, nil
+		}))
+	if err != nil {
+		t.Fatalf("Can't create ws server: %s", err)
+	}
+	defer server.Close()
+
+	time.Sleep(1 * time.Second)
+
+	client, err := wsclient.New("Test", wsclient.ClientParam{CaCertFile: caCert}, nil)
+	if err != nil {
+		t.Fatalf("Can't create ws client: %s", err)
+	}
+	defer client.Close()
+
+	if err = client.Connect(serverURL); err != nil {
+		t.Fatalf("Can't connect to ws server: %s", err)
+	}
+
+	shutdownChannel := make(chan error, 1)
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+
+		ctx, cancelFunc := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancelFunc()
+
+		shutdownChannel <- server.Shutdown(ctx)
+	}()
+
+	// In-flight request should be completed
+	req := Request{Type: "GET", RequestID: uuid.New().String()}
+	rsp := Request{}
+
+	if err = client.SendRequest("RequestID", req.RequestID, &req, &rsp); err != nil {
+		t.Errorf("Can't send request: %s", err)
+	}
+
+	if err = <-shutdownChannel; err != nil {
+		t.Errorf("Shutdown error: %s", err)
+	}
+
+	select {
+	case <-client.ErrorChannel:
+
+	case <-time.After(5 * time.Second):
+		t.Error("Waiting error channel timeout")
+	}
+
+	if len(server.GetClients()) != 0 {
+		t.Error("All clients should be disconnected")
+	}
+}
+
+func TestServerCertificateReload(t *testing.T) {
+	certificate, err := tls.LoadX509KeyPair(crtFile, keyFile)
+	if err != nil {
+		t.Fatalf("Can't load certificate: %s", err)
+	}
+
+	var certRequests int32
+
+	server, err := wsserver.NewWithParam("TestServer", wsserver.ServerParam{
+		URL: hostURL,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			atomic.AddInt32(&certRequests, 1)
+
+			return &certificate, nil
+		},
+	}, newTestHandler(nil))
+	if err != nil {
+		t.Fatalf("Can't create ws server: %s", err)
+	}
+	defer server.Close()
+
+	time.Sleep(1 * time.Second)
+
+	client, err := wsclient.New("Test", wsclient.ClientParam{CaCertFile: caCert}, nil)
+	if err != nil {
+		t.Fatalf("Can't create ws client: %s", err)
+	}
+	defer client.Close()
+
+	for i := 1; i <= 2; i++ {
+		if err = client.Connect(serverURL); err != nil {
+			t.Fatalf("Can't connect to ws server: %s", err)
+		}
+
+		if err = client.Disconnect(); err != nil {
+			t.Errorf("Can't disconnect from ws server: %s", err)
+		}
+
+		if count := atomic.LoadInt32(&certRequests); count != int32(i) {
+			t.Errorf("Wrong certificate requests count: %d", count)
+		}
+	}
+
+	fileServer, err := wsserver.New("FileServer", ":8089", crtFile, keyFile, newTestHandler(nil))
+	if err != nil {
+		t.Fatalf("Can't create ws server: %s", err)
+	}
+	defer fileServer.Close()
+
+	time.Sleep(1 * time.Second)
+
+	if err = client.Connect("wss://localhost:8089"); err != nil {
+		t.Fatalf("Can't connect to ws server: %s", err)
+	}
+
+	if err = fileServer.Reload(); err != nil {
+		t.Fatalf("Can't reload certificate: %s", err)
+	}
+
+	if !client.IsConnected() {
+		t.Error("Existing connection should not be affected by reload")
+	}
+
+	if err = client.Disconnect(); err != nil {
+		t.Errorf("Can't disconnect from ws server: %s", err)
+	}
+
+	if err = client.Connect("wss://localhost:8089"); err != nil {
+		t.Errorf("Can't connect to ws server after reload: %s", err)
+	}
+}
+
+func TestProxy(t *testing.T) {
+	type Message struct {
+		Type  string
+		Value string
+	}
+
+	server, err := wsserver.New("TestServer", hostURL, crtFile, keyFile, newTestHandler(
+		func(client *wsserver.Client, messageType int, data []byte) (response []byte, err error) {
+			return data, nil
+		}))
+	if err != nil {
+		t.Fatalf("Can't create ws server: %s", err)
+	}
+	defer server.Close()
+
+	proxy := newTestProxy("user", "password")
+
+	proxyServer := &http.Server{Addr: proxyURL, Handler: proxy}
+	defer proxyServer.Close()
+
+	go func() {
+		if err := proxyServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			t.Errorf("Proxy server error: %s", err)
+		}
+	}()
+
+	time.Sleep(1 * time.Second)
+
+	if _, err = wsclient.New("Test", wsclient.ClientParam{ProxyURL: "ftp://localhost:8090"}, nil); err == nil {
+		t.Error("Unsupported proxy scheme error expected")
+	}
+
+	client, err := wsclient.New("Test", wsclient.ClientParam{
+		CaCertFile: caCert, ProxyURL: "http://localhost" + proxyURL,
+	}, nil)
+	if err != nil {
+		t.Fatalf("Can't create ws client: %s", err)
+	}
+	defer client.Close()
+
+	if err = client.Connect(serverURL); err == nil {
+		t.Error("Connection without proxy credentials should be rejected")
+	}
+
+	client, err = wsclient.New("Test", wsclient.ClientParam{
+		CaCertFile: caCert, ProxyURL: "http://localhost" + proxyURL, ProxyUser: "user", ProxyPassword: "password",
+	}, nil)
+	if err != nil {
+		t.Fatalf("Can't create ws client: %s", err)
+	}
+	defer client.Close()
+
+	if err = client.Connect(serverURL); err != nil {
+		t.Fatalf("Can't connect to ws server: %s", err)
+	}
+
+	req := Message{Type: "GET", Value: uuid.New().String()}
+	rsp := Message{}
+
+	if err = client.SendRequest("Value", req.Value, &req, &rsp); err != nil {
+		t.Errorf("Can't send request: %s", err)
+	}
+
+	if tunnels := atomic.LoadInt32(&proxy.tunnels); tunnels != 1 {
+		t.Errorf("Wrong proxy tunnels count: %d", tunnels)
+	}
+}
+
+func TestKeepAlive(t *testing.T) {
+	type Message struct {
+		Type string
+	}
+
+	releaseChannel := make(chan struct{})
+
+	server, err := wsserver.NewWithParam("TestServer", wsserver.ServerParam{
+		URL: hostURL, Cert: crtFile, Key: keyFile, PingInterval: 100 * time.Millisecond,
+	}, newTestHandler(
+		func(client *wsserver.Client, messageType int, data []byte) (response []byte, err error) {
+			// Block reading to stop answering client pings
+			<-releaseChannel
+
+			return nil, nil
+		}))
+	if err != nil {
+		t.Fatalf("Can't create ws server: %s", err)
+	}
+	defer server.Close()
+	defer close(releaseChannel)
+
+	time.Sleep(1 * time.Second)
+
+	// Server should disconnect client which doesn't answer pings
+
+	cryptoContext, err := cryptutils.NewCryptoContext(caCert)
+	if err != nil {
+		t.Fatalf("Can't create crypto context: %s", err)
+	}
+	defer cryptoContext.Close()
+
+	dialer := websocket.Dialer{}
+
+	if dialer.TLSClientConfig, err = cryptoContext.GetClientTLSConfig(); err != nil {
+		t.Fatalf("Can't get TLS config: %s", err)
+	}
+
+	connection, _, err := dialer.Dial(serverURL, nil)
+	if err != nil {
+		t.Fatalf("Can't connect to ws server: %s", err)
+	}
+	defer connection.Close()
+
+	time.Sleep(1 * time.Second)
+
+	if len(server.GetClients()) != 0 {
+		t.Error("Not responding client should be disconnected")
+	}
+
+	// Client should keep idle connection alive
+
+	client, err := wsclient.New("Test", wsclient.ClientParam{
+		CaCertFile: caCert, PingInterval: 100 * time.Millisecond,
+	}, nil)
+	if err != nil {
+		t.Fatalf("Can't create ws client: %s", err)
+	}
+	defer client.Close()
+
+	if err = client.Connect(serverURL); err != nil {
+		t.Fatalf("Can't connect to ws server: %s", err)
+	}
+
+	time.Sleep(1 * time.Second)
+
+	if !client.IsConnected() {
+		t.Error("Idle client should be connected")
+	}
+
+	// Client should detect not responding server
+
+	if err = client.SendMessage(&Message{Type: "BLOCK"}); err != nil {
+		t.Fatalf("Can't send message: %s", err)
+	}
+
+	select {
+	case <-client.ErrorChannel:
+
+	case <-time.After(5 * time.Second):
+		t.Error("Waiting error channel timeout")
+	}
+}
+
+func TestLargeMessage(t *testing.T) {
+	type Request struct {
+		RequestID string
+		Data      string
+	}
+
+	const (
+		maxMessageSize = 2048
+		chunkSize      = 1024
+	)
+
+	server, err := wsserver.NewWithParam("TestServer", wsserver.ServerParam{
+		URL: hostURL, Cert: crtFile, Key: keyFile,
+		MaxMessageSize: maxMessageSize, ChunkSize: chunkSize, MaxChunkedMessageSize: 64 * chunkSize,
+	}, newTestHandler(
+		func(client *wsserver.Client, messageType int, data []byte) (response []byte, err error) {
+			return data, nil
+		}))
+	if err != nil {
+		t.Fatalf("Can't create ws server: %s", err)
+	}
+	defer server.Close()
+
+	time.Sleep(1 * time.Second)
+
+	client, err := wsclient.New("Test", wsclient.ClientParam{
+		CaCertFile: caCert, MaxMessageSize: maxMessageSize, ChunkSize: chunkSize, MaxChunkedMessageSize: 64 * chunkSize,
+	}, nil)
+	if err != nil {
+		t.Fatalf("Can't create ws client: %s", err)
+	}
+	defer client.Close()
+
+	if err = client.Connect(serverURL); err != nil {
+		t.Fatalf("Can't connect to ws server: %s", err)
+	}
+
+	req := Request{RequestID: uuid.New().String(), Data: strings.Repeat("0123456789", 1000)}
+	rsp := Request{}
+
+	if err = client.SendRequest("RequestID", req.RequestID, &req, &rsp); err != nil {
+		t.Fatalf("Can't send request: %s", err)
+	}
+
+	if rsp != req {
+		t.Error("Wrong response")
+	}
+
+	// Message exceeding limit should close connection
+
+	bigClient, err := wsclient.New("Test", wsclient.ClientParam{CaCertFile: caCert}, nil)
+	if err != nil {
+		t.Fatalf("Can't create ws client: %s", err)
+	}
+	defer bigClient.Close()
+
+	if err = bigClient.Connect(serverURL); err != nil {
+		t.Fatalf("Can't connect to ws server: %s", err)
+	}
+
+	if err = bigClient.SendMessage(&req); err != nil {
+		t.Fatalf("Can't send message: %s", err)
+	}
+
+	select {
+	case <-bigClient.ErrorChannel:
+
+	case <-time.After(5 * time.Second):
+		t.Error("Waiting error channel timeout")
+	}
+}
+
 /*******************************************************************************
  * Private
  ******************************************************************************/
@@ -591,3 +1276,70 @@ func (handler *testHandler) ProcessMessage(
 
 func (handler *testHandler) ClientDisconnected(client *wsserver.Client) {
 }
+
+func (authenticator *testAuthenticator) Authenticate(request *http.Request) (identity string, err error) {
+	user := request.URL.Query().Get("user")
+	if user == "" {
+		return "", aoserrors.New("user is not specified")
+	}
+
+	return user, nil
+}
+
+func newTestProxy(user, password string) (proxy *testProxy) {
+	return &testProxy{credentials: "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password))}
+}
+
+func (proxy *testProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodConnect {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	if r.Header.Get("Proxy-Authorization") != proxy.credentials {
+		w.WriteHeader(http.StatusProxyAuthRequired)
+
+		return
+	}
+
+	serverConn, err := net.Dial("tcp", r.Host)
+	if err != nil {
+		w.WriteHeader(http.StatusBadGateway)
+
+		return
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		serverConn.Close()
+		w.WriteHeader(http.StatusInternalServerError)
+
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+
+	clientConn, _, err := hijacker.Hijack()
+	if err != nil {
+		serverConn.Close()
+
+		return
+	}
+
+	atomic.AddInt32(&proxy.tunnels, 1)
+
+	go func() {
+		defer serverConn.Close()
+		defer clientConn.Close()
+
+		_, _ = io.Copy(serverConn, clientConn)
+	}()
+
+	go func() {
+		defer serverConn.Close()
+		defer clientConn.Close()
+
+		_, _ = io.Copy(clientConn, serverConn)
+	}()
+}
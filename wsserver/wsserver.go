@@ -19,7 +19,11 @@ package wsserver
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
+	"io/ioutil"
+	"net"
 	"net/http"
 	"strings"
 	"sync"
@@ -29,6 +33,7 @@ import (
 	log "github.com/sirupsen/logrus"
 
 	"github.com/aoscloud/aos_common/aoserrors"
+	"github.com/aoscloud/aos_common/utils/wschunk"
 )
 
 /***********************************************************************************************************************
@@ -49,16 +54,69 @@ type Server struct {
 	httpServer *http.Server
 	upgrader   websocket.Upgrader
 	sync.Mutex
-	clients map[string]*Client
-	handler ClientHandler
+	clients               map[string]*Client
+	handler               ClientHandler
+	authenticator         Authenticator
+	connectionsWG         sync.WaitGroup
+	handlersWG            sync.WaitGroup
+	certFile              string
+	keyFile               string
+	certMutex             sync.RWMutex
+	certificate           *tls.Certificate
+	pingInterval          time.Duration
+	pongTimeout           time.Duration
+	maxMessageSize        int64
+	chunkSize             int
+	maxChunkedMessageSize int64
+}
+
+// ServerParam server parameters.
+type ServerParam struct {
+	URL  string
+	Cert string
+	Key  string
+	// ClientCAFile CA certificates used to verify client certificates. If set, client certificates are requested and
+	// verified if provided. Verified client certificates are available in authenticator request.
+	ClientCAFile string
+	// Authenticator authenticates new connections. All connections are accepted if not set.
+	Authenticator Authenticator
+	// GetCertificate provides server certificate, e.g. cryptutils CertificateProvider.GetCertificate which picks up
+	// rotated certificates. If set, Cert and Key are not used.
+	GetCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)
+	// PingInterval interval to send ping to clients. Keepalive is disabled if not set.
+	PingInterval time.Duration
+	// PongTimeout time to wait for pong or any other message after ping. Client is disconnected if nothing is
+	// received. Ping interval is used if not set.
+	PongTimeout time.Duration
+	// MaxMessageSize max size of received web socket message. Connection is closed if limit is exceeded.
+	// Not limited if not set.
+	MaxMessageSize int64
+	// ChunkSize messages bigger than chunk size are sent as chunks which are reassembled by receiving side.
+	// Messages are not chunked if not set.
+	ChunkSize int
+	// MaxChunkedMessageSize max size of reassembled chunked message. Not limited if not set.
+	MaxChunkedMessageSize int64
+}
+
+// Authenticator provides interface to authenticate new connection. Authenticate is called before websocket upgrade
+// and returns client identity available in Client.Identity. Connection is rejected if error is returned.
+type Authenticator interface {
+	Authenticate(request *http.Request) (identity string, err error)
 }
 
 // Client websocket client handler.
 type Client struct {
 	RemoteAddr string
+	Identity   string
 	handler    ClientHandler
 	connection *websocket.Conn
 	sync.Mutex
+	handlersWG   *sync.WaitGroup
+	closing      bool
+	pingInterval time.Duration
+	pongTimeout  time.Duration
+	chunkSize    int
+	assembler    *wschunk.Assembler
 }
 
 // ClientHandler provides interface to handle client.
@@ -74,13 +132,30 @@ type ClientHandler interface {
 
 // New creates new Web socket server.
 func New(name, url, cert, key string, handler ClientHandler) (server *Server, err error) {
+	return NewWithParam(name, ServerParam{URL: url, Cert: cert, Key: key}, handler)
+}
+
+// NewWithParam creates new Web socket server with specified parameters.
+func NewWithParam(name string, param ServerParam, handler ClientHandler) (server *Server, err error) {
 	server = &Server{
 		name: name,
 		upgrader: websocket.Upgrader{
 			CheckOrigin: func(r *http.Request) bool { return true },
 		},
-		handler: handler,
-		clients: make(map[string]*Client),
+		handler:               handler,
+		clients:               make(map[string]*Client),
+		authenticator:         param.Authenticator,
+		certFile:              param.Cert,
+		keyFile:               param.Key,
+		pingInterval:          param.PingInterval,
+		pongTimeout:           param.PongTimeout,
+		maxMessageSize:        param.MaxMessageSize,
+		chunkSize:             param.ChunkSize,
+		maxChunkedMessageSize: param.MaxChunkedMessageSize,
+	}
+
+	if server.pongTimeout == 0 {
+		server.pongTimeout = server.pingInterval
 	}
 
 	log.WithField("server", server.name).Debug("Create ws server")
@@ -88,21 +163,67 @@ func New(name, url, cert, key string, handler ClientHandler) (server *Server, er
 	serveMux := http.NewServeMux()
 	serveMux.HandleFunc("/", server.handleConnection)
 
-	server.httpServer = &http.Server{Addr: url, Handler: serveMux}
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12, GetCertificate: param.GetCertificate}
+
+	if tlsConfig.GetCertificate == nil {
+		if err = server.Reload(); err != nil {
+			return nil, err
+		}
+
+		tlsConfig.GetCertificate = server.getCertificate
+	}
+
+	if param.ClientCAFile != "" {
+		if tlsConfig.ClientCAs, err = loadCertPool(param.ClientCAFile); err != nil {
+			return nil, err
+		}
+
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	server.httpServer = &http.Server{Addr: param.URL, Handler: serveMux, TLSConfig: tlsConfig}
+
+	url := param.URL
 
 	go func(crt, key string) {
 		log.WithFields(log.Fields{"address": url, "crt": crt, "key": key}).Debug("Listen for clients")
 
-		if err := server.httpServer.ListenAndServeTLS(crt, key); errors.Is(err, http.ErrServerClosed) {
+		// Certificate is provided by TLS config
+		if err := server.httpServer.ListenAndServeTLS("", ""); errors.Is(err, http.ErrServerClosed) {
 			log.Error("Server listening error: ", aoserrors.Wrap(err))
 
 			return
 		}
-	}(cert, key)
+	}(param.Cert, param.Key)
 
 	return server, nil
 }
 
+// Reload reloads server certificate and key files. New certificate is used for new connections, existing
+// connections are not affected. Reload does nothing if the server certificate is provided by GetCertificate
+// parameter.
+func (server *Server) Reload() (err error) {
+	if server.certFile == "" && server.keyFile == "" {
+		return nil
+	}
+
+	certificate, err := tls.LoadX509KeyPair(server.certFile, server.keyFile)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	server.certMutex.Lock()
+	defer server.certMutex.Unlock()
+
+	server.certificate = &certificate
+
+	log.WithFields(log.Fields{
+		"server": server.name, "crt": server.certFile, "key": server.keyFile,
+	}).Debug("Server certificate loaded")
+
+	return nil
+}
+
 // GetClients return client list.
 func (server *Server) GetClients() (clients []*Client) {
 	server.Lock()
@@ -133,6 +254,46 @@ func (server *Server) Close() {
 	}
 }
 
+// Shutdown gracefully shuts down the server: stops accepting new connections, waits for in-flight messages are
+// processed, sends close message to clients and waits for connections are closed by clients. Remaining connections
+// are closed when ctx is done.
+func (server *Server) Shutdown(ctx context.Context) (err error) {
+	log.WithField("server", server.name).Debug("Shutdown ws server")
+
+	// Shutdown doesn't wait for hijacked websocket connections
+	if err = server.httpServer.Shutdown(ctx); err != nil {
+		err = aoserrors.Wrap(err)
+	}
+
+	clients := server.GetClients()
+
+	for _, client := range clients {
+		client.setClosing()
+	}
+
+	waitErr := waitContext(ctx, &server.handlersWG)
+	if waitErr == nil {
+		for _, client := range clients {
+			_ = client.SendMessage(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseGoingAway, ""))
+		}
+
+		waitErr = waitContext(ctx, &server.connectionsWG)
+	}
+
+	if waitErr != nil {
+		log.WithField("server", server.name).Warnf("Force close connections: %s", waitErr)
+
+		for _, client := range server.GetClients() {
+			client.connection.Close()
+		}
+
+		return aoserrors.Wrap(waitErr)
+	}
+
+	return err
+}
+
 // SendMessage sends message to ws client.
 func (client *Client) SendMessage(messageType int, data []byte) (err error) {
 	client.Lock()
@@ -150,29 +311,19 @@ func (client *Client) SendMessage(messageType int, data []byte) (err error) {
 		}).Debug("Send message")
 	}
 
-	if writeSocketTimeout != 0 {
-		if err = client.connection.SetWriteDeadline(time.Now().Add(writeSocketTimeout)); err != nil {
-			if !errors.Is(err, websocket.ErrCloseSent) {
-				log.Errorf("Can't set write deadline timeout: %s", err)
-
-				client.connection.Close()
+	if client.chunkSize > 0 && (messageType == websocket.TextMessage || messageType == websocket.BinaryMessage) {
+		if chunks := wschunk.Split(messageType, data, client.chunkSize); len(chunks) > 1 {
+			for _, chunk := range chunks {
+				if err = client.writeMessage(websocket.BinaryMessage, chunk); err != nil {
+					return err
+				}
 			}
 
-			return aoserrors.Wrap(err)
+			return nil
 		}
 	}
 
-	if err = client.connection.WriteMessage(messageType, data); err != nil {
-		if !errors.Is(err, websocket.ErrCloseSent) {
-			log.Errorf("Can't write message: %s", err)
-
-			client.connection.Close()
-		}
-
-		return aoserrors.Wrap(err)
-	}
-
-	return nil
+	return client.writeMessage(messageType, data)
 }
 
 /***********************************************************************************************************************
@@ -184,28 +335,72 @@ func (server *Server) newClient(w http.ResponseWriter, r *http.Request) (client
 	defer server.Unlock()
 
 	defer func() {
-		if err != nil {
-			if client.connection != nil {
-				client.connection.Close()
-			}
+		if err != nil && client != nil && client.connection != nil {
+			client.connection.Close()
 		}
 	}()
 
-	client = &Client{RemoteAddr: r.RemoteAddr, handler: server.handler}
+	client = &Client{
+		RemoteAddr:   r.RemoteAddr,
+		handler:      server.handler,
+		handlersWG:   &server.handlersWG,
+		pingInterval: server.pingInterval,
+		pongTimeout:  server.pongTimeout,
+		chunkSize:    server.chunkSize,
+	}
+
+	// Reassemble chunks only if chunking is enabled for this endpoint
+	if server.chunkSize > 0 {
+		client.assembler = wschunk.NewAssembler(server.maxChunkedMessageSize)
+	}
 
 	if !websocket.IsWebSocketUpgrade(r) {
 		return nil, aoserrors.New("new connection is not websocket")
 	}
 
+	if server.authenticator != nil {
+		if client.Identity, err = server.authenticator.Authenticate(r); err != nil {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+
+			return nil, aoserrors.Wrap(err)
+		}
+	}
+
 	if client.connection, err = server.upgrader.Upgrade(w, r, nil); err != nil {
 		return nil, aoserrors.Wrap(err)
 	}
 
+	if server.maxMessageSize != 0 {
+		client.connection.SetReadLimit(server.maxMessageSize)
+	}
+
 	server.clients[client.RemoteAddr] = client
 
 	return client, nil
 }
 
+func (server *Server) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	server.certMutex.RLock()
+	defer server.certMutex.RUnlock()
+
+	return server.certificate, nil
+}
+
+func loadCertPool(caFile string) (caPool *x509.CertPool, err error) {
+	pemCA, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	caPool = x509.NewCertPool()
+
+	if !caPool.AppendCertsFromPEM(pemCA) {
+		return nil, aoserrors.Errorf("can't load CA certificates from %s", caFile)
+	}
+
+	return caPool, nil
+}
+
 func (server *Server) deleteClient(client *Client) (err error) {
 	server.Lock()
 	defer server.Unlock()
@@ -228,18 +423,107 @@ func (client *Client) close(sendCloseMessage bool) (err error) {
 	return aoserrors.Wrap(client.connection.Close())
 }
 
+func (client *Client) writeMessage(messageType int, data []byte) (err error) {
+	if writeSocketTimeout != 0 {
+		if err = client.connection.SetWriteDeadline(time.Now().Add(writeSocketTimeout)); err != nil {
+			if !errors.Is(err, websocket.ErrCloseSent) {
+				log.Errorf("Can't set write deadline timeout: %s", err)
+
+				client.connection.Close()
+			}
+
+			return aoserrors.Wrap(err)
+		}
+	}
+
+	if err = client.connection.WriteMessage(messageType, data); err != nil {
+		if !errors.Is(err, websocket.ErrCloseSent) {
+			log.Errorf("Can't write message: %s", err)
+
+			client.connection.Close()
+		}
+
+		return aoserrors.Wrap(err)
+	}
+
+	return nil
+}
+
+func (client *Client) setClosing() {
+	client.Lock()
+	defer client.Unlock()
+
+	client.closing = true
+}
+
+func (client *Client) startProcessing() (started bool) {
+	client.Lock()
+	defer client.Unlock()
+
+	if client.closing {
+		return false
+	}
+
+	client.handlersWG.Add(1)
+
+	return true
+}
+
 func (client *Client) run() {
+	if client.pingInterval > 0 {
+		stopChannel := make(chan struct{})
+		defer close(stopChannel)
+
+		client.connection.SetPongHandler(func(string) error { return client.extendReadDeadline() })
+
+		if err := client.extendReadDeadline(); err != nil {
+			log.Errorf("Can't set read deadline: %s", err)
+
+			return
+		}
+
+		go client.keepAlive(stopChannel)
+	}
+
 	for {
 		messageType, message, err := client.connection.ReadMessage()
 		if err != nil {
-			if !websocket.IsCloseError(err, websocket.CloseNormalClosure) &&
-				!strings.Contains(err.Error(), "use of closed network connection") {
+			var netErr net.Error
+
+			switch {
+			case errors.As(err, &netErr) && netErr.Timeout():
+				log.WithField("remoteAddr", client.RemoteAddr).Error("Client is not responding")
+
+			case !websocket.IsCloseError(err, websocket.CloseNormalClosure) &&
+				!strings.Contains(err.Error(), "use of closed network connection"):
 				log.Errorf("Error reading socket: %s", err)
 			}
 
 			break
 		}
 
+		if client.pingInterval > 0 {
+			if err = client.extendReadDeadline(); err != nil {
+				log.Errorf("Can't set read deadline: %s", err)
+
+				break
+			}
+		}
+
+		if client.assembler != nil && messageType == websocket.BinaryMessage && wschunk.IsChunk(message) {
+			var complete bool
+
+			if messageType, message, complete, err = client.assembler.Add(message); err != nil {
+				log.WithField("remoteAddr", client.RemoteAddr).Errorf("Can't assemble message: %s", err)
+
+				continue
+			}
+
+			if !complete {
+				continue
+			}
+		}
+
 		if messageType == websocket.TextMessage {
 			log.WithFields(log.Fields{
 				"message":    string(message),
@@ -253,7 +537,16 @@ func (client *Client) run() {
 		}
 
 		if client.handler != nil {
+			if !client.startProcessing() {
+				log.WithField("remoteAddr", client.RemoteAddr).Warn("Skip message as client is closing")
+
+				continue
+			}
+
 			response, err := client.handler.ProcessMessage(client, messageType, message)
+
+			client.handlersWG.Done()
+
 			if err != nil {
 				log.Errorf("Can't process message: %s", err)
 
@@ -269,6 +562,34 @@ func (client *Client) run() {
 	}
 }
 
+func (client *Client) extendReadDeadline() (err error) {
+	return aoserrors.Wrap(client.connection.SetReadDeadline(time.Now().Add(client.pingInterval + client.pongTimeout)))
+}
+
+func (client *Client) keepAlive(stopChannel <-chan struct{}) {
+	ticker := time.NewTicker(client.pingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopChannel:
+			return
+
+		case <-ticker.C:
+			if err := client.connection.WriteControl(
+				websocket.PingMessage, nil, time.Now().Add(writeSocketTimeout)); err != nil {
+				if !errors.Is(err, websocket.ErrCloseSent) {
+					log.WithField("remoteAddr", client.RemoteAddr).Errorf("Can't send ping: %s", err)
+
+					client.connection.Close()
+				}
+
+				return
+			}
+		}
+	}
+}
+
 func (server *Server) handleConnection(w http.ResponseWriter, r *http.Request) {
 	log.WithFields(log.Fields{
 		"remoteAddr": r.RemoteAddr,
@@ -282,6 +603,9 @@ func (server *Server) handleConnection(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	server.connectionsWG.Add(1)
+	defer server.connectionsWG.Done()
+
 	if server.handler != nil {
 		server.handler.ClientConnected(client)
 	}
@@ -296,3 +620,20 @@ func (server *Server) handleConnection(w http.ResponseWriter, r *http.Request) {
 		server.handler.ClientDisconnected(client)
 	}
 }
+
+func waitContext(ctx context.Context, wg *sync.WaitGroup) (err error) {
+	doneChannel := make(chan struct{})
+
+	go func() {
+		wg.Wait()
+		close(doneChannel)
+	}()
+
+	select {
+	case <-doneChannel:
+		return nil
+
+	case <-ctx.Done():
+		return aoserrors.Wrap(ctx.Err())
+	}
+}